@@ -11,6 +11,7 @@ import (
 	"go.jetpack.io/devbox/internal/impl"
 	"go.jetpack.io/devbox/internal/planner/plansdk"
 	"go.jetpack.io/devbox/internal/plugin"
+	"go.jetpack.io/devbox/internal/services"
 )
 
 // Devbox provides an isolated development environment.
@@ -18,39 +19,96 @@ type Devbox interface {
 	// Add adds a Nix package to the config so that it's available in the devbox
 	// environment. It validates that the Nix package exists, but doesn't install
 	// it. Adding a duplicate package is a no-op.
-	Add(pkgs ...string) error
+	Add(pkgs []string, opts ...impl.AddOption) error
+	AddDryRun(pkgs ...string) error
 	AddGlobal(pkgs ...string) error
+	// CompareLockfile resolves the project's packages and reports the ones
+	// whose store paths drifted from devbox.lock.
+	CompareLockfile() error
 	Config() *impl.Config
+	// Doctor checks the project's nix profile and plugin symlinks for
+	// problems, without fixing them.
+	Doctor() []impl.DoctorCheck
 	ProjectDir() string
 	Exec(cmds ...string) error
 	// Generate creates the directory of Nix files and the Dockerfile that define
 	// the devbox environment.
 	Generate() error
+	CheckGeneratedFiles() error
+	// ExplainEnv prints the final value of each variable in vars along with
+	// the layers of the devbox environment that set it.
+	ExplainEnv(vars ...string) error
+	// Export writes an archive of the project's config files that Import
+	// can recreate the project from.
+	Export(w io.Writer) error
+	// ExportProfile returns a manifest of every store path in the closure of
+	// the project's nix profile.
+	ExportProfile(format impl.ProfileExportFormat) ([]byte, error)
 	GenerateDevcontainer(force bool) error
-	GenerateDockerfile(force bool) error
-	GenerateEnvrc(force bool, source string) error
-	Info(pkg string, markdown bool) error
-	ListScripts() []string
-	PrintEnv() (string, error)
+	// GenerateDockerfile writes a Dockerfile for the project. If multistage is
+	// true, the image only has the packages' nix store closure instead of
+	// nix and devbox.
+	GenerateDockerfile(force, multistage bool) error
+	// GenerateEnvrc writes a .envrc for direnv, asking whether to run
+	// direnv allow unless impl.WithDirenvAllow says.
+	GenerateEnvrc(force bool, source string, opts ...impl.EnvrcOption) error
+	GenerateJustfile(force bool) error
+	// GenerateReadmeSnippet writes a markdown section documenting the
+	// project's packages, scripts and services to w.
+	GenerateReadmeSnippet(w io.Writer) error
+	Info(pkgs []string, markdown bool) error
+	InfoJSON(pkgs []string) error
+	// Install installs the project's packages into its nix profile and
+	// updates devbox.lock.
+	Install(opts ...impl.InstallOption) error
+	// ListScripts returns the project's scripts and their descriptions,
+	// sorted by name.
+	ListScripts() []impl.ScriptInfo
+	// PackageBinaries returns the names of the binaries each installed package
+	// puts on the PATH, keyed by package name.
+	PackageBinaries() (map[string][]string, error)
+	PrintEnv(format impl.EnvFormat, opts ...impl.PrintEnvOption) (string, error)
+	PortForwardService(ctx context.Context, serviceName, mapping string) error
 	PrintGlobalList() error
 	PullGlobal(path string) error
 	// Remove removes Nix packages from the config so that it no longer exists in
 	// the devbox environment.
 	Remove(pkgs ...string) error
+	// RemoveAll removes all of the packages in the config, asking the user
+	// first if confirm is true.
+	RemoveAll(confirm bool) error
 	RemoveGlobal(pkgs ...string) error
-	RunScript(scriptName string, scriptArgs []string) error
+	// RollbackProfile switches the project's nix profile back to an earlier
+	// generation that isn't broken.
+	RollbackProfile() error
+	RunScript(scriptName string, scriptArgs []string, opts ...impl.RunOption) error
 	// TODO: Deprecate in favor of RunScript
 	RunScriptInShell(scriptName string) error
+	// RestartServices stops and then starts the services, starting the ones
+	// that aren't running.
+	RestartServices(ctx context.Context, services ...string) error
+	// ServiceLogs writes the output of the services that the running
+	// process manager runs, or of all of them if no services are given.
+	ServiceLogs(ctx context.Context, w io.Writer, opts services.LogsOpts, services ...string) error
 	Services() (plugin.Services, error)
+	// ServiceStatuses returns the project's services and whether each one is
+	// running.
+	ServiceStatuses(ctx context.Context) ([]services.Info, error)
 	// Shell generates the devbox environment and launches nix-shell as a child
 	// process.
-	Shell() error
+	Shell(opts ...impl.ShellOption) error
 	// ShellPlan creates a plan of the actions that devbox will take to generate its
 	// shell environment.
 	ShellPlan() (*plansdk.ShellPlan, error)
 	StartProcessManager(ctx context.Context) error
 	StartServices(ctx context.Context, services ...string) error
 	StopServices(ctx context.Context, services ...string) error
+	// Update moves the project to the latest nixpkgs commit and installs the
+	// new versions of its packages.
+	Update(opts ...impl.UpdateOption) error
+	// VerifySignatures checks that every store path in the closure of the
+	// project's nix profile is signed by a trusted public key.
+	VerifySignatures() error
 }
 
 // Open opens a devbox by reading the config file in dir.
@@ -60,8 +118,29 @@ func Open(dir string, writer io.Writer) (Devbox, error) {
 
 // InitConfig creates a default devbox config file if one doesn't already
 // exist.
-func InitConfig(dir string, writer io.Writer) (bool, error) {
-	return impl.InitConfig(dir, writer)
+func InitConfig(dir string, writer io.Writer, opts ...impl.InitOption) (bool, error) {
+	return impl.InitConfig(dir, writer, opts...)
+}
+
+// Import recreates a project exported by Devbox.Export in dir.
+func Import(archive io.Reader, dir string, writer io.Writer) error {
+	return impl.Import(archive, dir, writer)
+}
+
+// InitTemplates returns the templates that InitConfig can start a config from.
+func InitTemplates() []impl.InitTemplate {
+	return impl.InitTemplates()
+}
+
+// NixChecks checks that nix is installed and new enough for devbox.
+func NixChecks() []impl.DoctorCheck {
+	return impl.NixChecks()
+}
+
+// TelemetryDisabled reports whether the devbox config at path, or the global
+// devbox config, opts out of telemetry.
+func TelemetryDisabled(path string) bool {
+	return impl.TelemetryDisabled(path)
 }
 
 func IsDevboxShellEnabled() bool {
@@ -5,18 +5,31 @@ package boxcli
 
 import (
 	"fmt"
+	"io/fs"
+	"os"
+	"strings"
 
 	"github.com/pkg/errors"
 	"github.com/spf13/cobra"
 	"go.jetpack.io/devbox"
 	"go.jetpack.io/devbox/internal/boxcli/usererr"
+	"go.jetpack.io/devbox/internal/impl"
 	"go.jetpack.io/devbox/internal/nix"
+	"golang.org/x/exp/slices"
 )
 
-const toSearchForPackages = "To search for packages use https://search.nixos.org/packages"
+const toSearchForPackages = "To search for packages use devbox search <query> or https://search.nixos.org/packages"
 
 type addCmdFlags struct {
-	config configFlags
+	config      configFlags
+	dryRun      bool
+	strict      bool
+	version     string
+	allowUnfree bool
+	platforms   []string
+	force       bool
+	fromFile    string
+	fromLock    string
 }
 
 func AddCmd() *cobra.Command {
@@ -27,7 +40,17 @@ func AddCmd() *cobra.Command {
 		Short:   "Add a new package to your devbox",
 		PreRunE: ensureNixInstalled,
 		RunE: func(cmd *cobra.Command, args []string) error {
-			if len(args) == 0 {
+			if flags.fromFile != "" {
+				pkgs, err := readPackageFile(flags.fromFile)
+				if err != nil {
+					return err
+				}
+				args = append(args, pkgs...)
+			}
+			if len(args) == 0 && flags.fromFile != "" && flags.fromLock == "" {
+				return usererr.New("%s doesn't list any packages", flags.fromFile)
+			}
+			if len(args) == 0 && flags.fromLock == "" {
 				fmt.Fprintf(
 					cmd.ErrOrStderr(),
 					"Usage: %s\n\n%s\n",
@@ -45,14 +68,103 @@ func AddCmd() *cobra.Command {
 	}
 
 	flags.config.register(command)
+	command.Flags().BoolVar(
+		&flags.dryRun, "dry-run", false,
+		"preview the binaries and store paths the packages would add without changing anything")
+	command.Flags().BoolVar(
+		&flags.strict, "strict", false,
+		"refuse to add packages that provide a binary already provided by another package")
+	command.Flags().StringVar(
+		&flags.version, "version", "",
+		"add a specific version of the package, like `devbox add nodejs --version 18`")
+	command.Flags().BoolVar(
+		&flags.allowUnfree, "allow-unfree", false,
+		"if the project sets allow_unfree to false, add unfree packages to unfree_packages without asking")
+	command.Flags().StringSliceVar(
+		&flags.platforms, "platform", nil,
+		"only install the packages on these systems, like x86_64-linux or aarch64-darwin; can be repeated")
+	command.Flags().BoolVar(
+		&flags.force, "force", false,
+		"add packages even if they can't be found in nixpkgs, such as flake references. "+
+			"They're removed again if they fail to install")
+	command.Flags().StringVar(
+		&flags.fromFile, "from-file", "",
+		"also add the packages listed in this file, one per line. Blank lines and # comments are ignored")
+	command.Flags().StringVar(
+		&flags.fromLock, "from-lock", "",
+		"also add the packages in another project's devbox.lock, pinned to the same nixpkgs commits")
 	return command
 }
 
+// readPackageFile returns the packages in a file that lists one per line, like
+// a requirements.txt. Blank lines are skipped, and # starts a comment when
+// it's at the start of a word, so that flake references like
+// github:owner/repo#pkg can still be listed.
+func readPackageFile(path string) ([]string, error) {
+	data, err := os.ReadFile(path)
+	if errors.Is(err, fs.ErrNotExist) {
+		return nil, usererr.New("Package file %s doesn't exist", path)
+	}
+	if err != nil {
+		return nil, errors.WithStack(err)
+	}
+	pkgs := []string{}
+	for _, line := range strings.Split(string(data), "\n") {
+		fields := strings.Fields(line)
+		comment := slices.IndexFunc(fields, func(f string) bool { return strings.HasPrefix(f, "#") })
+		if comment >= 0 {
+			fields = fields[:comment]
+		}
+		switch len(fields) {
+		case 0:
+			continue
+		case 1:
+			pkgs = append(pkgs, fields[0])
+		default:
+			return nil, usererr.New(
+				"%s lists more than one package on the line %q. List one package per line.", path, line)
+		}
+	}
+	return pkgs, nil
+}
+
 func addCmdFunc(cmd *cobra.Command, args []string, flags addCmdFlags) error {
+	if flags.version != "" {
+		if len(args) != 1 {
+			return usererr.New("--version can only be used when adding a single package")
+		}
+		if strings.Contains(args[0], "@") {
+			return usererr.New("%s already has a version. Remove --version or the @version suffix.", args[0])
+		}
+		args = []string{args[0] + "@" + flags.version}
+	}
+
 	box, err := devbox.Open(flags.config.path, cmd.ErrOrStderr())
 	if err != nil {
 		return errors.WithStack(err)
 	}
 
-	return box.Add(args...)
+	if flags.dryRun {
+		if flags.fromLock != "" {
+			return usererr.New("--dry-run can't be used with --from-lock")
+		}
+		return box.AddDryRun(args...)
+	}
+	opts := []impl.AddOption{}
+	if flags.strict {
+		opts = append(opts, impl.WithStrictAdd())
+	}
+	if flags.allowUnfree {
+		opts = append(opts, impl.WithAllowUnfree())
+	}
+	if flags.force {
+		opts = append(opts, impl.WithForce())
+	}
+	if len(flags.platforms) > 0 {
+		opts = append(opts, impl.WithPlatforms(flags.platforms))
+	}
+	if flags.fromLock != "" {
+		opts = append(opts, impl.WithLockfile(flags.fromLock))
+	}
+	return box.Add(args, opts...)
 }
@@ -3,9 +3,13 @@
 package boxcli
 
 import (
+	"os"
+	"path/filepath"
+	"strings"
 	"testing"
 
 	"github.com/stretchr/testify/assert"
+	"go.jetpack.io/devbox/internal/nix"
 	"go.jetpack.io/devbox/internal/testframework"
 )
 
@@ -31,3 +35,86 @@ func TestAdd(t *testing.T) {
 	assert.NoError(t, err)
 	assert.Contains(t, updatedDevboxJSON.RawPackages, "hello")
 }
+
+func TestAddDryRun(t *testing.T) {
+	devboxJSON := `
+	{
+		"packages": [],
+		"shell": {
+		  "init_hook": null
+		},
+		"nixpkgs": {
+		  "commit": "af9e00071d0971eb292fd5abef334e66eda3cb69"
+		}
+	}`
+	td := testframework.Open()
+	defer td.Close()
+	err := td.SetDevboxJSON(devboxJSON)
+	assert.NoError(t, err)
+	output, err := td.RunCommand(AddCmd(), "--dry-run", "hello")
+	assert.NoError(t, err)
+	assert.Contains(t, output, "Dry run")
+	assert.Contains(t, output, "New binaries on PATH: hello")
+	assert.Contains(t, output, "Store paths pulled in:")
+
+	updatedDevboxJSON, err := td.GetDevboxJSON()
+	assert.NoError(t, err)
+	assert.Empty(t, updatedDevboxJSON.RawPackages)
+	assert.NoDirExists(t, filepath.Join(td.GetTestDir(), nix.ProfilePath))
+}
+
+func TestAddUnfree(t *testing.T) {
+	devboxJSON := `
+	{
+		"packages": [],
+		"allow_unfree": false,
+		"shell": {
+		  "init_hook": null
+		},
+		"nixpkgs": {
+		  "commit": "af9e00071d0971eb292fd5abef334e66eda3cb69"
+		}
+	}`
+	td := testframework.Open()
+	defer td.Close()
+	err := td.SetDevboxJSON(devboxJSON)
+	assert.NoError(t, err)
+
+	// unrar has an unfree license, so it can't be added until it's allowed.
+	_, err = td.RunCommand(AddCmd(), "unrar")
+	assert.ErrorIs(t, err, nix.ErrPackageUnfree)
+	updatedDevboxJSON, err := td.GetDevboxJSON()
+	assert.NoError(t, err)
+	assert.NotContains(t, updatedDevboxJSON.RawPackages, "unrar")
+
+	err = td.SetDevboxJSON(strings.Replace(
+		devboxJSON, `"allow_unfree": false,`, `"allow_unfree": false, "unfree_packages": ["unrar"],`, 1))
+	assert.NoError(t, err)
+	_, err = td.RunCommand(AddCmd(), "unrar")
+	assert.NoError(t, err)
+	updatedDevboxJSON, err = td.GetDevboxJSON()
+	assert.NoError(t, err)
+	assert.Contains(t, updatedDevboxJSON.RawPackages, "unrar")
+}
+
+func TestReadPackageFile(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "packages.txt")
+	err := os.WriteFile(path, []byte(`# Tools for the build
+go@1.20
+  ripgrep   # for searching
+
+github:example/flake#tool
+jq`), 0o644)
+	assert.NoError(t, err)
+	pkgs, err := readPackageFile(path)
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"go@1.20", "ripgrep", "github:example/flake#tool", "jq"}, pkgs)
+
+	err = os.WriteFile(path, []byte("go ripgrep\n"), 0o644)
+	assert.NoError(t, err)
+	_, err = readPackageFile(path)
+	assert.ErrorContains(t, err, "more than one package")
+
+	_, err = readPackageFile(filepath.Join(t.TempDir(), "missing.txt"))
+	assert.ErrorContains(t, err, "doesn't exist")
+}
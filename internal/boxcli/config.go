@@ -11,6 +11,7 @@ type configFlags struct {
 
 func (flags *configFlags) register(cmd *cobra.Command) {
 	cmd.Flags().StringVarP(
-		&flags.path, "config", "c", "", "path to directory containing a devbox.json config file",
+		&flags.path, "config", "c", "", "path to directory containing a devbox.json config file, or a remote config like "+
+			"github:<owner>/<repo>[/<ref>][//<dir>]",
 	)
 }
@@ -0,0 +1,73 @@
+// Copyright 2023 Jetpack Technologies Inc and contributors. All rights reserved.
+// Use of this source code is governed by the license in the LICENSE file.
+
+package boxcli
+
+import (
+	"fmt"
+	"io"
+
+	"github.com/fatih/color"
+	"github.com/spf13/cobra"
+	"go.jetpack.io/devbox"
+	"go.jetpack.io/devbox/internal/boxcli/usererr"
+	"go.jetpack.io/devbox/internal/impl"
+)
+
+type doctorCmdFlags struct {
+	config configFlags
+}
+
+func doctorCmd() *cobra.Command {
+	flags := doctorCmdFlags{}
+	command := &cobra.Command{
+		Use:   "doctor",
+		Short: "Check the nix installation and the project for common problems",
+		Long: "Check the nix installation and the project for common problems, and " +
+			"suggest how to fix them. It doesn't change anything.",
+		Args: cobra.NoArgs,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			return doctorCmdFunc(cmd, flags)
+		},
+	}
+
+	flags.config.register(command)
+	return command
+}
+
+func doctorCmdFunc(cmd *cobra.Command, flags doctorCmdFlags) error {
+	checks := devbox.NixChecks()
+	box, err := devbox.Open(flags.config.path, cmd.ErrOrStderr())
+	if err != nil {
+		checks = append(checks, impl.DoctorCheck{
+			Name: "devbox.json",
+			Err:  err,
+			Hint: "Run devbox init to create one, or pass --config with the project's directory.",
+		})
+	} else {
+		checks = append(checks, box.Doctor()...)
+	}
+
+	if failed := printDoctorChecks(cmd.OutOrStdout(), checks); failed > 0 {
+		return usererr.New("devbox doctor found %d problem(s)", failed)
+	}
+	return nil
+}
+
+// printDoctorChecks prints whether each check passed, along with the error
+// and hint of the ones that failed. It returns the number of failed checks.
+func printDoctorChecks(w io.Writer, checks []impl.DoctorCheck) int {
+	failed := 0
+	for _, check := range checks {
+		if check.Err == nil {
+			fmt.Fprintf(w, "%s %s\n", color.GreenString("✓"), check.Name)
+			continue
+		}
+		failed++
+		fmt.Fprintf(w, "%s %s: %v\n", color.RedString("✗"), check.Name, check.Err)
+		if check.Hint != "" {
+			fmt.Fprintf(w, "  %s\n", check.Hint)
+		}
+	}
+	return failed
+}
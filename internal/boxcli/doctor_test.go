@@ -0,0 +1,27 @@
+// Copyright 2023 Jetpack Technologies Inc and contributors. All rights reserved.
+// Use of this source code is governed by the license in the LICENSE file.
+package boxcli
+
+import (
+	"bytes"
+	"errors"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"go.jetpack.io/devbox/internal/impl"
+)
+
+func TestPrintDoctorChecks(t *testing.T) {
+	checks := []impl.DoctorCheck{
+		{Name: "Nix is installed"},
+		{Name: "Nix profile", Err: errors.New("the project's packages aren't installed yet"), Hint: "Run devbox install."},
+		{Name: "Plugin symlinks", Err: errors.New("permission denied")},
+	}
+	buf := &bytes.Buffer{}
+	failed := printDoctorChecks(buf, checks)
+	assert.Equal(t, 2, failed)
+	assert.Equal(t, "✓ Nix is installed\n"+
+		"✗ Nix profile: the project's packages aren't installed yet\n"+
+		"  Run devbox install.\n"+
+		"✗ Plugin symlinks: permission denied\n", buf.String())
+}
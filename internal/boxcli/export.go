@@ -0,0 +1,97 @@
+// Copyright 2023 Jetpack Technologies Inc and contributors. All rights reserved.
+// Use of this source code is governed by the license in the LICENSE file.
+
+package boxcli
+
+import (
+	"os"
+
+	"github.com/pkg/errors"
+	"github.com/spf13/cobra"
+	"go.jetpack.io/devbox"
+)
+
+const defaultExportFile = "devbox-export.tar.gz"
+
+type exportCmdFlags struct {
+	config configFlags
+	output string
+}
+
+func exportCmd() *cobra.Command {
+	flags := exportCmdFlags{}
+	command := &cobra.Command{
+		Use:   "export",
+		Short: "Export the project's config to a file that devbox import can recreate it from",
+		Long: "Export devbox.json, devbox.lock and the plugin config files in devbox.d to a " +
+			"gzipped tarball, so that devbox import can recreate the environment on another " +
+			"machine. The .env file isn't included because it usually has secrets.",
+		Args: cobra.NoArgs,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			return exportCmdFunc(cmd, flags)
+		},
+	}
+
+	flags.config.register(command)
+	command.Flags().StringVarP(
+		&flags.output, "output", "o", defaultExportFile, "file to write the export to, or - for stdout")
+	return command
+}
+
+func exportCmdFunc(cmd *cobra.Command, flags exportCmdFlags) error {
+	box, err := devbox.Open(flags.config.path, cmd.ErrOrStderr())
+	if err != nil {
+		return errors.WithStack(err)
+	}
+	if flags.output == "-" {
+		return box.Export(cmd.OutOrStdout())
+	}
+
+	f, err := os.Create(flags.output)
+	if err != nil {
+		return errors.WithStack(err)
+	}
+	if err := box.Export(f); err != nil {
+		f.Close()
+		os.Remove(flags.output)
+		return err
+	}
+	if err := f.Close(); err != nil {
+		return errors.WithStack(err)
+	}
+	cmd.PrintErrf("Exported the project to %s. Run devbox import %[1]s to recreate it.\n", flags.output)
+	return nil
+}
+
+func importCmd() *cobra.Command {
+	command := &cobra.Command{
+		Use:   "import <file> [<dir>]",
+		Short: "Recreate a project from a file written by devbox export",
+		Long: "Recreate a project from a file written by devbox export in dir, which defaults " +
+			"to the current directory and must not have a devbox config yet. It checks that " +
+			"the export's nixpkgs commit can be downloaded first.",
+		Args:    cobra.RangeArgs(1, 2),
+		PreRunE: ensureNixInstalled,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			dir := "."
+			if len(args) > 1 {
+				dir = args[1]
+			}
+			return importCmdFunc(cmd, args[0], dir)
+		},
+	}
+	return command
+}
+
+func importCmdFunc(cmd *cobra.Command, file, dir string) error {
+	f, err := os.Open(file)
+	if err != nil {
+		return errors.WithStack(err)
+	}
+	defer f.Close()
+	if err := devbox.Import(f, dir, cmd.ErrOrStderr()); err != nil {
+		return err
+	}
+	cmd.PrintErrf("Imported the project into %s. Run devbox shell there to install its packages.\n", dir)
+	return nil
+}
@@ -9,24 +9,44 @@ import (
 	"github.com/pkg/errors"
 	"github.com/spf13/cobra"
 	"go.jetpack.io/devbox"
+	"go.jetpack.io/devbox/internal/boxcli/usererr"
+	"go.jetpack.io/devbox/internal/impl"
 )
 
 type generateCmdFlags struct {
-	config configFlags
-	force  bool
+	config     configFlags
+	force      bool
+	multistage bool
+	yes        bool
+	no         bool
+	check      bool
 }
 
 func GenerateCmd() *cobra.Command {
 	flags := &generateCmdFlags{}
 
 	command := &cobra.Command{
-		Use:  "generate",
+		Use:   "generate",
+		Short: "Generate supporting files for the project",
+		Long: "Generate supporting files for the project. With --check, it fails if the files that devbox " +
+			"generates in .devbox/gen are out of date with devbox.json, without changing them.",
 		Args: cobra.MaximumNArgs(0),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			if !flags.check {
+				return cmd.Help()
+			}
+			return runGenerateCmd(cmd, args, flags)
+		},
 	}
 	command.AddCommand(devcontainerCmd())
 	command.AddCommand(dockerfileCmd())
 	command.AddCommand(debugCmd())
 	command.AddCommand(direnvCmd())
+	command.AddCommand(justfileCmd())
+	command.AddCommand(readmeSnippetCmd())
+	command.Flags().BoolVar(
+		&flags.check, "check", false,
+		"fail if the generated files in .devbox/gen are out of date, instead of updating them")
 	flags.config.register(command)
 
 	return command
@@ -74,6 +94,9 @@ func dockerfileCmd() *cobra.Command {
 	}
 	command.Flags().BoolVarP(
 		&flags.force, "force", "f", false, "force overwrite existing files")
+	command.Flags().BoolVar(
+		&flags.multistage, "multistage", false,
+		"generate a multi-stage Dockerfile whose image only has the packages and the nix store paths they need")
 	flags.config.register(command)
 	return command
 }
@@ -83,8 +106,31 @@ func direnvCmd() *cobra.Command {
 	command := &cobra.Command{
 		Use:   "direnv",
 		Short: "Generate a .envrc file that integrates direnv with this devbox project",
-		Long:  "Generate a .envrc file that integrates direnv with this devbox project. Requires direnv to be installed.",
-		Args:  cobra.MaximumNArgs(0),
+		Long: "Generate a .envrc file that integrates direnv with this devbox project. Requires direnv to be installed. " +
+			"Unless --yes or --no is passed, it asks whether to run direnv allow when stdin is a terminal.",
+		Args: cobra.MaximumNArgs(0),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			return runGenerateCmd(cmd, args, flags)
+		},
+	}
+	command.Flags().BoolVarP(
+		&flags.force, "force", "f", false, "force overwrite existing files")
+	command.Flags().BoolVarP(
+		&flags.yes, "yes", "y", false, "run direnv allow without asking")
+	command.Flags().BoolVar(
+		&flags.no, "no", false, "don't run direnv allow, and don't ask")
+	flags.config.register(command)
+	return command
+}
+
+func justfileCmd() *cobra.Command {
+	flags := &generateCmdFlags{}
+	command := &cobra.Command{
+		Use:   "justfile",
+		Short: "Generate a justfile with a recipe for each script in devbox.json",
+		Long: "Generate a justfile with a recipe for each script in devbox.json. " +
+			"Each recipe runs its script with `devbox run`, forwarding any arguments.",
+		Args: cobra.MaximumNArgs(0),
 		RunE: func(cmd *cobra.Command, args []string) error {
 			return runGenerateCmd(cmd, args, flags)
 		},
@@ -95,6 +141,23 @@ func direnvCmd() *cobra.Command {
 	return command
 }
 
+func readmeSnippetCmd() *cobra.Command {
+	flags := &generateCmdFlags{}
+	command := &cobra.Command{
+		Use:   "readme-snippet",
+		Short: "Print a README section that explains how to use this project's devbox environment",
+		Long: "Print a markdown section that lists the project's packages, scripts and services " +
+			"and explains how to use them with devbox. Paste it into the project's README, " +
+			"and rerun the command to update it when devbox.json changes.",
+		Args: cobra.MaximumNArgs(0),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			return runGenerateCmd(cmd, args, flags)
+		},
+	}
+	flags.config.register(command)
+	return command
+}
+
 func runGenerateCmd(cmd *cobra.Command, args []string, flags *generateCmdFlags) error {
 	path, err := configPathFromUser(args, &flags.config)
 	if err != nil {
@@ -107,14 +170,27 @@ func runGenerateCmd(cmd *cobra.Command, args []string, flags *generateCmdFlags)
 		return errors.WithStack(err)
 	}
 	switch cmd.Use {
+	case "generate":
+		return box.CheckGeneratedFiles()
 	case "debug":
 		return box.Generate()
 	case "devcontainer":
 		return box.GenerateDevcontainer(flags.force)
 	case "dockerfile":
-		return box.GenerateDockerfile(flags.force)
+		return box.GenerateDockerfile(flags.force, flags.multistage)
 	case "direnv":
-		return box.GenerateEnvrc(flags.force, "generate")
+		if flags.yes && flags.no {
+			return usererr.New("--yes and --no can't be used together")
+		}
+		opts := []impl.EnvrcOption{}
+		if flags.yes || flags.no {
+			opts = append(opts, impl.WithDirenvAllow(flags.yes))
+		}
+		return box.GenerateEnvrc(flags.force, "generate", opts...)
+	case "justfile":
+		return box.GenerateJustfile(flags.force)
+	case "readme-snippet":
+		return box.GenerateReadmeSnippet(cmd.OutOrStdout())
 	}
 	return nil
 }
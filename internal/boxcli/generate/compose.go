@@ -0,0 +1,141 @@
+package generate
+
+import (
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/pkg/errors"
+	"go.jetpack.io/devbox/internal/plugin"
+	"gopkg.in/yaml.v3"
+)
+
+const (
+	// ComposeFilename is the name of the compose file in .devcontainer/.
+	ComposeFilename = "docker-compose.yml"
+	// ContainerProjectDir is where the project is mounted in the containers.
+	ContainerProjectDir = "/code"
+
+	// devcontainerService is the compose service that VSCode connects to.
+	devcontainerService = "devbox"
+)
+
+type composeFile struct {
+	Services map[string]*composeService `yaml:"services"`
+}
+
+type composeService struct {
+	Build       composeBuild      `yaml:"build"`
+	Command     []string          `yaml:"command"`
+	WorkingDir  string            `yaml:"working_dir,omitempty"`
+	Environment map[string]string `yaml:"environment,omitempty"`
+	Volumes     []string          `yaml:"volumes"`
+	NetworkMode string            `yaml:"network_mode,omitempty"`
+	DependsOn   []string          `yaml:"depends_on,omitempty"`
+	Restart     string            `yaml:"restart,omitempty"`
+}
+
+type composeBuild struct {
+	Context    string `yaml:"context"`
+	Dockerfile string `yaml:"dockerfile"`
+}
+
+// processComposeConfig is the part of a process-compose.yaml that translates
+// to compose services.
+type processComposeConfig struct {
+	Processes map[string]struct {
+		Command      string   `yaml:"command"`
+		WorkingDir   string   `yaml:"working_dir"`
+		Environment  []string `yaml:"environment"`
+		Availability struct {
+			Restart string `yaml:"restart"`
+		} `yaml:"availability"`
+	} `yaml:"processes"`
+}
+
+// composeRestartPolicies maps process-compose's restart policies to compose's.
+var composeRestartPolicies = map[string]string{
+	"always":     "always",
+	"on_failure": "on-failure",
+	"no":         "no",
+}
+
+// CreateDockerCompose writes a docker-compose.yml to path with the devcontainer
+// and a service for each process in the process-compose.yaml files of svcs.
+// The services must have been read for ContainerProjectDir, so that their
+// files have the paths they'll have in the containers. The processes run with
+// devbox run in containers that share the devcontainer's network, so they're
+// reachable on localhost like they are outside of containers. It returns false
+// without writing anything if none of the services use process-compose.
+func CreateDockerCompose(path string, svcs plugin.Services) (bool, error) {
+	names := make([]string, 0, len(svcs))
+	for name := range svcs {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	volumes := []string{"..:" + ContainerProjectDir + ":cached"}
+	build := composeBuild{Context: "..", Dockerfile: ".devcontainer/Dockerfile"}
+	compose := &composeFile{Services: map[string]*composeService{
+		devcontainerService: {
+			Build:   build,
+			Command: []string{"sleep", "infinity"},
+			Volumes: volumes,
+		},
+	}}
+
+	seen := map[string]bool{}
+	for _, name := range names {
+		svc := svcs[name]
+		file, ok := svc.ProcessComposeYaml()
+		if !ok || seen[file] {
+			continue
+		}
+		seen[file] = true
+
+		content, err := svc.ProcessComposeContent()
+		if err != nil {
+			return false, err
+		}
+		pc := &processComposeConfig{}
+		if err := yaml.Unmarshal(content, pc); err != nil {
+			return false, errors.Wrapf(err, "unable to parse the process-compose.yaml of service %s", name)
+		}
+		for process, p := range pc.Processes {
+			cs := &composeService{
+				Build: build,
+				// devbox run evaluates the command like a shell would.
+				Command:     []string{"devbox", "run", "--", escapeCompose(p.Command)},
+				WorkingDir:  escapeCompose(p.WorkingDir),
+				Volumes:     volumes,
+				NetworkMode: "service:" + devcontainerService,
+				DependsOn:   []string{devcontainerService},
+				Restart:     composeRestartPolicies[p.Availability.Restart],
+			}
+			for _, env := range p.Environment {
+				k, v, _ := strings.Cut(env, "=")
+				if cs.Environment == nil {
+					cs.Environment = map[string]string{}
+				}
+				cs.Environment[k] = escapeCompose(v)
+			}
+			compose.Services[process] = cs
+		}
+	}
+	if len(seen) == 0 {
+		return false, nil
+	}
+
+	data, err := yaml.Marshal(compose)
+	if err != nil {
+		return false, errors.WithStack(err)
+	}
+	return true, errors.WithStack(os.WriteFile(filepath.Join(path, ComposeFilename), data, 0o644))
+}
+
+// escapeCompose escapes the dollar signs in s so that compose leaves the
+// variables for devbox run to expand.
+func escapeCompose(s string) string {
+	return strings.ReplaceAll(s, "$", "$$")
+}
@@ -9,13 +9,20 @@ import (
 	"strings"
 
 	"github.com/pkg/errors"
+	"golang.org/x/exp/slices"
 )
 
 type devcontainerObject struct {
-	Name           string          `json:"name"`
-	Build          *build          `json:"build"`
-	Customizations *customizations `json:"customizations"`
-	RemoteUser     string          `json:"remoteUser"`
+	Name  string `json:"name"`
+	Build *build `json:"build,omitempty"`
+	// DockerComposeFile, Service and WorkspaceFolder replace Build when the
+	// devcontainer is a service in a docker-compose.yml.
+	DockerComposeFile string          `json:"dockerComposeFile,omitempty"`
+	Service           string          `json:"service,omitempty"`
+	WorkspaceFolder   string          `json:"workspaceFolder,omitempty"`
+	Customizations    *customizations `json:"customizations"`
+	PostCreateCommand string          `json:"postCreateCommand,omitempty"`
+	RemoteUser        string          `json:"remoteUser"`
 }
 
 type build struct {
@@ -32,8 +39,21 @@ type vscode struct {
 	Extensions []string `json:"extensions"`
 }
 
-// Creates a Dockerfile in path and writes devcontainerDockerfile.tmpl's content into it
-func CreateDockerfile(tmplFS embed.FS, path string) error {
+// DevcontainerOptions are the extensions, settings and post-create command
+// from devbox.json that are added to the generated devcontainer.json.
+type DevcontainerOptions struct {
+	// Extensions are added after the ones devbox picks for the packages.
+	Extensions []string
+	// Settings override the ones devbox picks for the packages.
+	Settings map[string]any
+	// PostCreateCommand runs in the container after it's created.
+	PostCreateCommand string
+}
+
+// Creates a Dockerfile in path and writes devcontainerDockerfile.tmpl's content into it.
+// If multistage is true, it writes multistageDockerfile.tmpl instead, which builds
+// a runtime image with only the packages' nix store closure.
+func CreateDockerfile(tmplFS embed.FS, path string, multistage bool) error {
 	// create dockerfile
 	file, err := os.Create(filepath.Join(path, "Dockerfile"))
 	if err != nil {
@@ -41,6 +61,9 @@ func CreateDockerfile(tmplFS embed.FS, path string) error {
 	}
 	// get dockerfile content
 	tmplName := "devcontainerDockerfile.tmpl"
+	if multistage {
+		tmplName = "multistageDockerfile.tmpl"
+	}
 	t := template.Must(template.ParseFS(tmplFS, "tmpl/"+tmplName))
 	// write content into file
 	err = t.Execute(file, nil)
@@ -50,8 +73,11 @@ func CreateDockerfile(tmplFS embed.FS, path string) error {
 	return nil
 }
 
-// Creates a devcontainer.json in path and writes getDevcontainerContent's output into it
-func CreateDevcontainer(path string, pkgs []string) error {
+// Creates a devcontainer.json in path and writes getDevcontainerContent's output into it.
+// If compose is true, the devcontainer is the devbox service of the docker-compose.yml
+// that CreateDockerCompose writes. The fields in opts are merged into what
+// devbox generates for pkgs.
+func CreateDevcontainer(path string, pkgs []string, compose bool, opts DevcontainerOptions) error {
 
 	// create devcontainer.json file
 	file, err := os.Create(filepath.Join(path, "devcontainer.json"))
@@ -60,6 +86,13 @@ func CreateDevcontainer(path string, pkgs []string) error {
 	}
 	// get devcontainer.json's content
 	devcontainerContent := getDevcontainerContent(pkgs)
+	addDevcontainerOptions(devcontainerContent, opts)
+	if compose {
+		devcontainerContent.Build = nil
+		devcontainerContent.DockerComposeFile = ComposeFilename
+		devcontainerContent.Service = devcontainerService
+		devcontainerContent.WorkspaceFolder = ContainerProjectDir
+	}
 	devcontainerFileBytes, err := json.MarshalIndent(devcontainerContent, "", "  ")
 	if err != nil {
 		return errors.WithStack(err)
@@ -130,3 +163,26 @@ func getDevcontainerContent(pkgs []string) *devcontainerObject {
 	}
 	return devcontainerContent
 }
+
+// addDevcontainerOptions merges opts into devcontainerContent.
+func addDevcontainerOptions(devcontainerContent *devcontainerObject, opts DevcontainerOptions) {
+	code := devcontainerContent.Customizations.Vscode
+	for _, ext := range opts.Extensions {
+		if !slices.Contains(code.Extensions, ext) {
+			code.Extensions = append(code.Extensions, ext)
+		}
+	}
+	if len(opts.Settings) > 0 {
+		settings := map[string]any{}
+		if detected, ok := code.Settings.(map[string]any); ok {
+			for k, v := range detected {
+				settings[k] = v
+			}
+		}
+		for k, v := range opts.Settings {
+			settings[k] = v
+		}
+		code.Settings = settings
+	}
+	devcontainerContent.PostCreateCommand = opts.PostCreateCommand
+}
@@ -0,0 +1,82 @@
+package generate
+
+import (
+	"embed"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"text/template"
+
+	"github.com/alessio/shellescape"
+	"github.com/pkg/errors"
+	"go.jetpack.io/devbox/internal/boxcli/usererr"
+)
+
+type justRecipe struct {
+	// Name is the recipe name, sanitized for just's syntax.
+	Name string
+	// Script is the shell-quoted name of the devbox script.
+	Script string
+}
+
+var (
+	// invalidJustChars matches characters that aren't allowed in a just
+	// recipe name.
+	invalidJustChars = regexp.MustCompile(`[^A-Za-z0-9_-]`)
+	// validJustStart matches the characters a just recipe name can start with.
+	validJustStart = regexp.MustCompile(`^[A-Za-z_]`)
+)
+
+// JustRecipeName converts a devbox script name into a valid just recipe name.
+// Recipe names must start with a letter or underscore and may only contain
+// letters, digits, underscores and dashes.
+func JustRecipeName(script string) string {
+	name := invalidJustChars.ReplaceAllString(script, "_")
+	if !validJustStart.MatchString(name) {
+		name = "_" + name
+	}
+	return name
+}
+
+// CreateJustfile creates a justfile in path with a recipe for each script
+// that runs it with `devbox run`, and an install recipe.
+func CreateJustfile(tmplFS embed.FS, path string, scripts []string) error {
+	sort.Strings(scripts)
+	recipes := []justRecipe{}
+	// names maps each recipe name to the script it was generated from.
+	names := map[string]string{}
+	for _, script := range scripts {
+		name := JustRecipeName(script)
+		if other, ok := names[name]; ok {
+			return usererr.New(
+				"Scripts %q and %q both become the just recipe %q. Rename one of them.",
+				other, script, name,
+			)
+		}
+		names[name] = script
+		recipes = append(recipes, justRecipe{Name: name, Script: shellescape.Quote(script)})
+	}
+
+	// Don't shadow a user-defined script that's also called install.
+	installRecipe := "install"
+	if _, ok := names[installRecipe]; ok {
+		installRecipe = ""
+	}
+
+	file, err := os.Create(filepath.Join(path, "justfile"))
+	if err != nil {
+		return errors.WithStack(err)
+	}
+	defer file.Close()
+
+	t := template.Must(template.ParseFS(tmplFS, "tmpl/justfile.tmpl"))
+	err = t.Execute(file, struct {
+		InstallRecipe string
+		Recipes       []justRecipe
+	}{
+		InstallRecipe: installRecipe,
+		Recipes:       recipes,
+	})
+	return errors.WithStack(err)
+}
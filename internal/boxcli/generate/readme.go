@@ -0,0 +1,45 @@
+package generate
+
+import (
+	"embed"
+	"io"
+	"sort"
+	"text/template"
+
+	"github.com/pkg/errors"
+)
+
+// ReadmeScript is a script listed in the README snippet.
+type ReadmeScript struct {
+	Name string
+	// Description is listed next to the script if it's set.
+	Description string
+	// Environments are the environments that override the script.
+	Environments []string
+}
+
+// WriteReadmeSnippet writes a markdown section to w that documents how to use
+// the project's devbox environment: its packages, scripts and services. It's
+// meant to be pasted into the project's README.
+func WriteReadmeSnippet(
+	tmplFS embed.FS,
+	w io.Writer,
+	packages []string,
+	scripts []ReadmeScript,
+	services []string,
+) error {
+	sort.Slice(scripts, func(i, j int) bool { return scripts[i].Name < scripts[j].Name })
+	sort.Strings(services)
+
+	t := template.Must(template.ParseFS(tmplFS, "tmpl/readme.md.tmpl"))
+	err := t.Execute(w, struct {
+		Packages []string
+		Scripts  []ReadmeScript
+		Services []string
+	}{
+		Packages: packages,
+		Scripts:  scripts,
+		Services: services,
+	})
+	return errors.WithStack(err)
+}
@@ -3,10 +3,14 @@
 package boxcli
 
 import (
+	"encoding/json"
+	"os"
 	"testing"
 
+	"github.com/samber/lo"
 	"github.com/stretchr/testify/assert"
 	"go.jetpack.io/devbox/internal/testframework"
+	"gopkg.in/yaml.v3"
 )
 
 func TestGenerateDockerfile(t *testing.T) {
@@ -30,6 +34,34 @@ func TestGenerateDockerfile(t *testing.T) {
 	assert.FileExists(t, "Dockerfile")
 }
 
+func TestGenerateMultistageDockerfile(t *testing.T) {
+	devboxJSON := `
+	{
+		"packages": [],
+		"nixpkgs": {
+		  "commit": "af9e00071d0971eb292fd5abef334e66eda3cb69"
+		}
+	}`
+	td := testframework.Open()
+	defer td.Close()
+	err := td.SetDevboxJSON(devboxJSON)
+	assert.NoError(t, err)
+	_, err = td.RunCommand(GenerateCmd(), "dockerfile", "--multistage")
+	assert.NoError(t, err)
+	data, err := os.ReadFile("Dockerfile")
+	assert.NoError(t, err)
+	assert.Contains(t, string(data), "FROM alpine:3 AS builder")
+	assert.Contains(t, string(data), "nix-store --query --requisites")
+	assert.Contains(t, string(data), "COPY --from=builder /tmp/nix-store-closure /nix/store")
+
+	// The single-stage Dockerfile is still the default.
+	_, err = td.RunCommand(GenerateCmd(), "dockerfile", "--force")
+	assert.NoError(t, err)
+	data, err = os.ReadFile("Dockerfile")
+	assert.NoError(t, err)
+	assert.NotContains(t, string(data), "AS builder")
+}
+
 func TestGenerateDevcontainer(t *testing.T) {
 	devboxJSON := `
 	{
@@ -50,4 +82,169 @@ func TestGenerateDevcontainer(t *testing.T) {
 	assert.NoError(t, err)
 	assert.FileExists(t, ".devcontainer/Dockerfile")
 	assert.FileExists(t, ".devcontainer/devcontainer.json")
+	assert.NoFileExists(t, ".devcontainer/docker-compose.yml")
+
+	// Without a devcontainer block in devbox.json, there's no post-create
+	// command.
+	data, err := os.ReadFile(".devcontainer/devcontainer.json")
+	assert.NoError(t, err)
+	assert.NotContains(t, string(data), "postCreateCommand")
+}
+
+func TestGenerateDevcontainerOptions(t *testing.T) {
+	devboxJSON := `
+	{
+		"packages": ["go_1_19"],
+		"devcontainer": {
+		  "extensions": ["golang.go", "esbenp.prettier-vscode"],
+		  "settings": {"editor.formatOnSave": true},
+		  "post_create_command": ["go mod download", "make setup"]
+		},
+		"nixpkgs": {
+		  "commit": "af9e00071d0971eb292fd5abef334e66eda3cb69"
+		}
+	}`
+	td := testframework.Open()
+	defer td.Close()
+	err := td.SetDevboxJSON(devboxJSON)
+	assert.NoError(t, err)
+	_, err = td.RunCommand(GenerateCmd(), "devcontainer")
+	assert.NoError(t, err)
+
+	data, err := os.ReadFile(".devcontainer/devcontainer.json")
+	assert.NoError(t, err)
+	devcontainer := struct {
+		Customizations struct {
+			Vscode struct {
+				Settings   map[string]any `json:"settings"`
+				Extensions []string       `json:"extensions"`
+			} `json:"vscode"`
+		} `json:"customizations"`
+		PostCreateCommand string `json:"postCreateCommand"`
+	}{}
+	assert.NoError(t, json.Unmarshal(data, &devcontainer))
+	assert.Equal(t,
+		[]string{"jetpack-io.devbox", "golang.go", "esbenp.prettier-vscode"},
+		devcontainer.Customizations.Vscode.Extensions,
+	)
+	assert.Equal(t, map[string]any{"editor.formatOnSave": true}, devcontainer.Customizations.Vscode.Settings)
+	assert.Equal(t, "go mod download\nmake setup", devcontainer.PostCreateCommand)
+}
+
+func TestGenerateDevcontainerCompose(t *testing.T) {
+	devboxJSON := `
+	{
+		"packages": ["nginx", "php81"],
+		"nixpkgs": {
+		  "commit": "af9e00071d0971eb292fd5abef334e66eda3cb69"
+		}
+	}`
+	td := testframework.Open()
+	defer td.Close()
+	err := td.SetDevboxJSON(devboxJSON)
+	assert.NoError(t, err)
+	_, err = td.RunCommand(GenerateCmd(), "devcontainer")
+	assert.NoError(t, err)
+
+	data, err := os.ReadFile(".devcontainer/devcontainer.json")
+	assert.NoError(t, err)
+	devcontainer := map[string]any{}
+	assert.NoError(t, json.Unmarshal(data, &devcontainer))
+	assert.Equal(t, "docker-compose.yml", devcontainer["dockerComposeFile"])
+	assert.Equal(t, "devbox", devcontainer["service"])
+	assert.Equal(t, "/code", devcontainer["workspaceFolder"])
+	assert.NotContains(t, devcontainer, "build")
+
+	data, err = os.ReadFile(".devcontainer/docker-compose.yml")
+	assert.NoError(t, err)
+	compose := struct {
+		Services map[string]struct {
+			Command     []string `yaml:"command"`
+			NetworkMode string   `yaml:"network_mode"`
+			Restart     string   `yaml:"restart"`
+		} `yaml:"services"`
+	}{}
+	assert.NoError(t, yaml.Unmarshal(data, &compose))
+	assert.ElementsMatch(t,
+		[]string{"devbox", "nginx", "nginx-access", "nginx-error", "php-fpm"},
+		lo.Keys(compose.Services),
+	)
+	assert.Equal(t, []string{"sleep", "infinity"}, compose.Services["devbox"].Command)
+	phpFPM := compose.Services["php-fpm"]
+	assert.Equal(t, "service:devbox", phpFPM.NetworkMode)
+	assert.Equal(t, "always", phpFPM.Restart)
+	// The paths are the ones in the container.
+	assert.Equal(t,
+		[]string{"devbox", "run", "--", "php-fpm -y /code/devbox.d/php81/php-fpm.conf --nodaemonize"},
+		phpFPM.Command,
+	)
+	// Variables are escaped so that compose leaves them for devbox run.
+	assert.Contains(t, compose.Services["nginx"].Command[3], "nginx -p $$NGINX_PATH_PREFIX")
+}
+
+func TestGenerateJustfile(t *testing.T) {
+	devboxJSON := `
+	{
+		"packages": [],
+		"shell": {
+		  "scripts": {
+			"build": "go build ./...",
+			"test:unit": "go test ./..."
+		  },
+		  "init_hook": null
+		},
+		"nixpkgs": {
+		  "commit": "af9e00071d0971eb292fd5abef334e66eda3cb69"
+		}
+	}`
+	td := testframework.Open()
+	defer td.Close()
+	err := td.SetDevboxJSON(devboxJSON)
+	assert.NoError(t, err)
+	_, err = td.RunCommand(GenerateCmd(), "justfile")
+	assert.NoError(t, err)
+	assert.FileExists(t, "justfile")
+
+	justfile, err := os.ReadFile("justfile")
+	assert.NoError(t, err)
+	assert.Contains(t, string(justfile), "install:\n")
+	assert.Contains(t, string(justfile), "build *args:\n    devbox run build {{args}}\n")
+	assert.Contains(t, string(justfile), "test_unit *args:\n    devbox run test:unit {{args}}\n")
+
+	// Regenerating without --force shouldn't overwrite the justfile.
+	_, err = td.RunCommand(GenerateCmd(), "justfile")
+	assert.Error(t, err)
+}
+
+func TestGenerateReadmeSnippet(t *testing.T) {
+	devboxJSON := `
+	{
+		"packages": ["go_1_19", "ripgrep"],
+		"shell": {
+		  "scripts": {
+			"test": "go test ./...",
+			"build": "go build ./...",
+			"deploy": {
+			  "command": "./deploy.sh staging",
+			  "description": "Deploy the app",
+			  "environments": {"prod": {"command": "./deploy.sh prod"}}
+			}
+		  },
+		  "init_hook": null
+		},
+		"nixpkgs": {
+		  "commit": "af9e00071d0971eb292fd5abef334e66eda3cb69"
+		}
+	}`
+	td := testframework.Open()
+	defer td.Close()
+	err := td.SetDevboxJSON(devboxJSON)
+	assert.NoError(t, err)
+	output, err := td.RunCommand(GenerateCmd(), "readme-snippet")
+	assert.NoError(t, err)
+	assert.Contains(t, output, "- `go_1_19`\n- `ripgrep`\n")
+	assert.Contains(t, output, "- `devbox run build`\n"+
+		"- `devbox run deploy`: Deploy the app (overridden in environments: `prod`)\n"+
+		"- `devbox run test`\n")
+	assert.NotContains(t, output, "### Services")
 }
@@ -7,35 +7,44 @@ import (
 	"github.com/pkg/errors"
 	"github.com/spf13/cobra"
 	"go.jetpack.io/devbox"
+	"go.jetpack.io/devbox/internal/boxcli/usererr"
 )
 
 type infoCmdFlags struct {
-	config   configFlags
-	markdown bool
+	config     configFlags
+	markdown   bool
+	jsonOutput bool
 }
 
 func InfoCmd() *cobra.Command {
 	flags := infoCmdFlags{}
 	command := &cobra.Command{
-		Use:     "info <pkg>",
+		Use:     "info <pkg>...",
 		Short:   "Display package info",
-		Args:    cobra.ExactArgs(1),
+		Args:    cobra.MinimumNArgs(1),
 		PreRunE: ensureNixInstalled,
 		RunE: func(cmd *cobra.Command, args []string) error {
-			return infoCmdFunc(cmd, args[0], flags)
+			return infoCmdFunc(cmd, args, flags)
 		},
 	}
 
 	flags.config.register(command)
 	command.Flags().BoolVar(&flags.markdown, "markdown", false, "output in markdown format")
+	command.Flags().BoolVar(&flags.jsonOutput, "json", false, "output a JSON array with the info of each package")
 	return command
 }
 
-func infoCmdFunc(cmd *cobra.Command, pkg string, flags infoCmdFlags) error {
+func infoCmdFunc(cmd *cobra.Command, pkgs []string, flags infoCmdFlags) error {
+	if flags.jsonOutput && flags.markdown {
+		return usererr.New("--json and --markdown can't be used together")
+	}
 	box, err := devbox.Open(flags.config.path, cmd.OutOrStdout())
 	if err != nil {
 		return errors.WithStack(err)
 	}
 
-	return box.Info(pkg, flags.markdown)
+	if flags.jsonOutput {
+		return box.InfoJSON(pkgs)
+	}
+	return box.Info(pkgs, flags.markdown)
 }
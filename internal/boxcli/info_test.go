@@ -3,9 +3,11 @@
 package boxcli
 
 import (
+	"encoding/json"
 	"testing"
 
 	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
 	"go.jetpack.io/devbox/internal/testframework"
 )
 
@@ -16,3 +18,29 @@ func TestInfo(t *testing.T) {
 	assert.NoError(t, err)
 	assert.Contains(t, output, "Package notarealpackage not found")
 }
+
+func TestInfoMultiplePackages(t *testing.T) {
+	td := testframework.Open()
+	defer td.Close()
+	output, err := td.RunCommand(InfoCmd(), "jq", "notarealpackage", "ripgrep", "fd")
+	assert.NoError(t, err)
+	assert.Contains(t, output, "jq-")
+	assert.Contains(t, output, "Package notarealpackage not found")
+	assert.Contains(t, output, "ripgrep-")
+	assert.Contains(t, output, "fd-")
+}
+
+func TestInfoJSON(t *testing.T) {
+	td := testframework.Open()
+	defer td.Close()
+	output, err := td.RunCommand(InfoCmd(), "--json", "jq", "notarealpackage")
+	assert.NoError(t, err)
+
+	var infos []map[string]any
+	require.NoError(t, json.Unmarshal([]byte(output), &infos))
+	require.Len(t, infos, 2)
+	assert.Equal(t, "jq", infos[0]["package"])
+	assert.Equal(t, true, infos[0]["found"])
+	assert.Equal(t, "notarealpackage", infos[1]["package"])
+	assert.Equal(t, false, infos[1]["found"])
+}
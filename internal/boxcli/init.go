@@ -4,29 +4,68 @@
 package boxcli
 
 import (
+	"fmt"
+	"text/tabwriter"
+
 	"github.com/pkg/errors"
 	"github.com/spf13/cobra"
 	"go.jetpack.io/devbox"
+	"go.jetpack.io/devbox/internal/boxcli/usererr"
+	"go.jetpack.io/devbox/internal/impl"
 )
 
+type initCmdFlags struct {
+	template      string
+	listTemplates bool
+	postInit      string
+}
+
 func InitCmd() *cobra.Command {
+	flags := initCmdFlags{}
 	command := &cobra.Command{
 		Use:   "init [<dir>]",
 		Short: "Initialize a directory as a devbox project",
-		Long:  "Initialize a directory as a devbox project. This will create an empty devbox.json in the current directory. You can then add packages using `devbox add`",
-		Args:  cobra.MaximumNArgs(1),
+		Long: "Initialize a directory as a devbox project. This will create an empty devbox.json in the current directory. " +
+			"You can then add packages using `devbox add`, or start from a template with --template.",
+		Args: cobra.MaximumNArgs(1),
 		RunE: func(cmd *cobra.Command, args []string) error {
-			return runInitCmd(cmd, args)
+			return runInitCmd(cmd, args, flags)
 		},
 	}
+	command.Flags().StringVar(
+		&flags.template, "template", "",
+		"start from a template with a language's packages, init hook and scripts. See --list-templates")
+	command.Flags().BoolVar(
+		&flags.listTemplates, "list-templates", false, "list the templates that --template accepts")
+	command.Flags().StringVar(
+		&flags.postInit, "post-init", "",
+		"command to run once in the project directory after devbox.json is created")
 
 	return command
 }
 
-func runInitCmd(cmd *cobra.Command, args []string) error {
+func runInitCmd(cmd *cobra.Command, args []string, flags initCmdFlags) error {
+	if flags.listTemplates {
+		if flags.template != "" {
+			return usererr.New("--list-templates can't be used with --template")
+		}
+		tw := tabwriter.NewWriter(cmd.OutOrStdout(), 0, 0, 2, ' ', 0)
+		for _, t := range devbox.InitTemplates() {
+			fmt.Fprintf(tw, "%s\t%s\n", t.Name, t.Description)
+		}
+		return errors.WithStack(tw.Flush())
+	}
+
 	path := pathArg(args)
 
-	_, err := devbox.InitConfig(path, cmd.ErrOrStderr())
+	opts := []impl.InitOption{impl.WithGitignorePrompt()}
+	if flags.template != "" {
+		opts = append(opts, impl.WithInitTemplate(flags.template))
+	}
+	if flags.postInit != "" {
+		opts = append(opts, impl.WithPostInitHook(flags.postInit))
+	}
+	_, err := devbox.InitConfig(path, cmd.ErrOrStderr(), opts...)
 	if err != nil {
 		return errors.WithStack(err)
 	}
@@ -3,9 +3,11 @@
 package boxcli
 
 import (
+	"os"
 	"testing"
 
 	"github.com/stretchr/testify/assert"
+	"go.jetpack.io/devbox/internal/impl"
 	"go.jetpack.io/devbox/internal/testframework"
 )
 
@@ -32,3 +34,60 @@ func TestInitRecommendation(t *testing.T) {
 	assert.Contains(t, output, "nodejs")
 	assert.Contains(t, output, "python3")
 }
+
+func TestInitPostInit(t *testing.T) {
+	td := testframework.Open()
+	defer td.Close()
+	_, err := td.RunCommand(InitCmd(), "--post-init", "echo done > post-init.txt")
+	assert.NoError(t, err)
+	assert.FileExists(t, "post-init.txt")
+
+	// The hook only runs when devbox.json is created.
+	assert.NoError(t, os.Remove("post-init.txt"))
+	_, err = td.RunCommand(InitCmd(), "--post-init", "echo done > post-init.txt")
+	assert.NoError(t, err)
+	assert.NoFileExists(t, "post-init.txt")
+}
+
+func TestInitTemplate(t *testing.T) {
+	td := testframework.Open()
+	defer td.Close()
+	err := td.CreateFile("requirements.txt", "")
+	assert.NoError(t, err)
+	err = td.CreateFile("package.json", "{}")
+	assert.NoError(t, err)
+	output, err := td.RunCommand(InitCmd(), "--template", "python")
+	assert.NoError(t, err)
+	assert.Contains(t, output, "Initialized devbox.json from the python template")
+	// python3 comes from the template, so only nodejs is suggested.
+	assert.Contains(t, output, "nodejs")
+	assert.NotContains(t, output, "python3")
+
+	cfg, err := impl.ReadConfig("devbox.json")
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"python3"}, cfg.RawPackages)
+	assert.Contains(t, cfg.Shell.InitHook.String(), ". .venv/bin/activate")
+	assert.Equal(t, "python -m pytest", cfg.Shell.Scripts["test"].String())
+
+	// A template can't be applied to an existing project.
+	_, err = td.RunCommand(InitCmd(), "--template", "go")
+	assert.ErrorContains(t, err, "already exists")
+}
+
+func TestInitUnknownTemplate(t *testing.T) {
+	td := testframework.Open()
+	defer td.Close()
+	_, err := td.RunCommand(InitCmd(), "--template", "cobol")
+	assert.ErrorContains(t, err, `Unknown template "cobol"`)
+	assert.NoFileExists(t, "devbox.json")
+}
+
+func TestInitListTemplates(t *testing.T) {
+	td := testframework.Open()
+	defer td.Close()
+	output, err := td.RunCommand(InitCmd(), "--list-templates")
+	assert.NoError(t, err)
+	assert.Regexp(t, `(?m)^python\s+Python 3`, output)
+	assert.Regexp(t, `(?m)^go\s+Go`, output)
+	assert.NoFileExists(t, "devbox.json")
+}
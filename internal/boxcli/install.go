@@ -0,0 +1,55 @@
+// Copyright 2023 Jetpack Technologies Inc and contributors. All rights reserved.
+// Use of this source code is governed by the license in the LICENSE file.
+
+package boxcli
+
+import (
+	"github.com/pkg/errors"
+	"github.com/spf13/cobra"
+	"go.jetpack.io/devbox"
+	"go.jetpack.io/devbox/internal/impl"
+)
+
+type installCmdFlags struct {
+	config        configFlags
+	frozen        bool
+	packageGroups []string
+}
+
+func InstallCmd() *cobra.Command {
+	flags := installCmdFlags{}
+	command := &cobra.Command{
+		Use:     "install",
+		Short:   "Install the packages of your devbox",
+		Args:    cobra.NoArgs,
+		PreRunE: ensureNixInstalled,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			return runInstallCmd(cmd, flags)
+		},
+	}
+
+	flags.config.register(command)
+	command.Flags().BoolVar(
+		&flags.frozen, "frozen", false,
+		"fail if devbox.lock is missing or out of date instead of updating it")
+	command.Flags().StringSliceVar(
+		&flags.packageGroups, "with", nil,
+		"also install the packages in this package group from devbox.json; can be repeated or comma-separated")
+	return command
+}
+
+func runInstallCmd(cmd *cobra.Command, flags installCmdFlags) error {
+	box, err := devbox.Open(flags.config.path, cmd.ErrOrStderr())
+	if err != nil {
+		return errors.WithStack(err)
+	}
+
+	opts := []impl.InstallOption{}
+	if flags.frozen {
+		opts = append(opts, impl.WithFrozenLockfile())
+	}
+	if len(flags.packageGroups) > 0 {
+		opts = append(opts, impl.WithInstallPackageGroups(flags.packageGroups...))
+	}
+	return box.Install(opts...)
+}
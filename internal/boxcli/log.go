@@ -2,6 +2,7 @@ package boxcli
 
 import (
 	"github.com/spf13/cobra"
+	"go.jetpack.io/devbox"
 	"go.jetpack.io/devbox/internal/boxcli/usererr"
 	"go.jetpack.io/devbox/internal/telemetry"
 )
@@ -28,6 +29,9 @@ func doLogCommand(cmd *cobra.Command, args []string) error {
 		if len(args) < 2 {
 			return usererr.New("expected a start-time argument for logging the shell-ready event")
 		}
+		if devbox.TelemetryDisabled("") {
+			return nil
+		}
 		return telemetry.LogShellDurationEvent(args[0] /*event name*/, args[1] /*startTime*/)
 	}
 	return usererr.New("unrecognized event-name %s for command: %s", args[0], cmd.CommandPath())
@@ -13,6 +13,7 @@ import (
 	"github.com/getsentry/sentry-go"
 	segment "github.com/segmentio/analytics-go"
 	"github.com/spf13/cobra"
+	"github.com/spf13/pflag"
 	"go.jetpack.io/devbox"
 	"go.jetpack.io/devbox/internal/boxcli/usererr"
 	"go.jetpack.io/devbox/internal/telemetry"
@@ -55,6 +56,9 @@ func (m *telemetryMiddleware) withExecutionID(execID string) Middleware {
 
 func (m *telemetryMiddleware) preRun(cmd *cobra.Command, args []string) {
 	m.startTime = telemetry.CommandStartTime()
+	// Check the configs on every run, so that opting out in devbox.json
+	// applies to the next command.
+	m.disabled = m.disabled || devbox.TelemetryDisabled(configPath(args))
 	if !m.disabled {
 		sentry := telemetry.NewSentry(m.opts.SentryDSN)
 		sentry.Init(m.opts.AppName, m.opts.AppVersion, m.executionID)
@@ -220,6 +224,18 @@ func getSubcommand(c *cobra.Command, args []string) (subcmd *cobra.Command, suba
 	return subcmd, subargs, err
 }
 
+// configPath returns the value of the --config flag in args. preRun runs before
+// cobra parses the command's flags, so it parses just this one and ignores the
+// rest.
+func configPath(args []string) string {
+	flags := pflag.NewFlagSet("config", pflag.ContinueOnError)
+	flags.ParseErrorsWhitelist.UnknownFlags = true
+	flags.SetOutput(io.Discard)
+	path := flags.StringP("config", "c", "", "")
+	_ = flags.Parse(args)
+	return *path
+}
+
 func getPackagesAndCommitHash(c *cobra.Command) ([]string, string) {
 	configFlag := c.Flag("config")
 	// for shell, run, and add command, path can be set via --config
@@ -0,0 +1,24 @@
+// Copyright 2023 Jetpack Technologies Inc and contributors. All rights reserved.
+// Use of this source code is governed by the license in the LICENSE file.
+
+package midcobra
+
+import "testing"
+
+func TestConfigPath(t *testing.T) {
+	cases := []struct {
+		args []string
+		want string
+	}{
+		{[]string{"shell"}, ""},
+		{[]string{"shell", "--config", "path/to/project"}, "path/to/project"},
+		{[]string{"run", "-c", "path/to/project", "test"}, "path/to/project"},
+		{[]string{"add", "--platform", "x86_64-linux", "--config=path/to/project", "go"}, "path/to/project"},
+		{[]string{"run", "--", "echo", "--config", "other"}, ""},
+	}
+	for _, c := range cases {
+		if got := configPath(c.args); got != c.want {
+			t.Errorf("configPath(%q) = %q, want %q", c.args, got, c.want)
+		}
+	}
+}
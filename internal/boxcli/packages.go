@@ -0,0 +1,46 @@
+// Copyright 2023 Jetpack Technologies Inc and contributors. All rights reserved.
+// Use of this source code is governed by the license in the LICENSE file.
+
+package boxcli
+
+import (
+	"github.com/pkg/errors"
+	"github.com/spf13/cobra"
+	"go.jetpack.io/devbox"
+)
+
+type packagesVerifySignaturesCmdFlags struct {
+	config configFlags
+}
+
+func PackagesCmd() *cobra.Command {
+	command := &cobra.Command{
+		Use:   "packages",
+		Short: "Inspect the project's installed packages",
+	}
+	command.AddCommand(packagesVerifySignaturesCmd())
+	return command
+}
+
+func packagesVerifySignaturesCmd() *cobra.Command {
+	flags := packagesVerifySignaturesCmdFlags{}
+	command := &cobra.Command{
+		Use:   "verify-signatures",
+		Short: "Verify that every installed store path is signed by a trusted key",
+		Long: "Verify that every store path in the closure of the project's nix profile is signed " +
+			"by a trusted public key, and exit with an error if any isn't. The trusted keys are " +
+			"the trusted_public_keys in devbox.json or, if that's not set, nix's trusted-public-keys.",
+		Args:    cobra.ExactArgs(0),
+		PreRunE: ensureNixInstalled,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			box, err := devbox.Open(flags.config.path, cmd.ErrOrStderr())
+			if err != nil {
+				return errors.WithStack(err)
+			}
+			return box.VerifySignatures()
+		},
+	}
+
+	flags.config.register(command)
+	return command
+}
@@ -0,0 +1,96 @@
+// Copyright 2023 Jetpack Technologies Inc and contributors. All rights reserved.
+// Use of this source code is governed by the license in the LICENSE file.
+
+package boxcli
+
+import (
+	"fmt"
+
+	"github.com/pkg/errors"
+	"github.com/spf13/cobra"
+	"go.jetpack.io/devbox"
+	"go.jetpack.io/devbox/internal/impl"
+)
+
+type profileExportCmdFlags struct {
+	config configFlags
+	format string
+}
+
+func ProfileCmd() *cobra.Command {
+	command := &cobra.Command{
+		Use:   "profile",
+		Short: "Inspect or repair the project's nix profile",
+	}
+	command.AddCommand(profileExportCmd())
+	command.AddCommand(profileRollbackCmd())
+	return command
+}
+
+func profileExportCmd() *cobra.Command {
+	flags := profileExportCmdFlags{}
+	command := &cobra.Command{
+		Use:   "export",
+		Short: "Export a manifest of every store path in the project's nix profile",
+		Long: "Export a manifest of every store path in the closure of the project's nix profile, " +
+			"including each path's name, version and hash. Use --format spdx or --format cyclonedx " +
+			"to export it as an SBOM.",
+		Args:    cobra.ExactArgs(0),
+		PreRunE: ensureNixInstalled,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			return profileExportCmdFunc(cmd, flags)
+		},
+	}
+
+	flags.config.register(command)
+	command.Flags().StringVar(
+		&flags.format, "format", string(impl.ProfileExportJSON),
+		"output format: json, spdx or cyclonedx")
+	return command
+}
+
+func profileExportCmdFunc(cmd *cobra.Command, flags profileExportCmdFlags) error {
+	format, err := impl.ParseProfileExportFormat(flags.format)
+	if err != nil {
+		return err
+	}
+	box, err := devbox.Open(flags.config.path, cmd.ErrOrStderr())
+	if err != nil {
+		return errors.WithStack(err)
+	}
+	manifest, err := box.ExportProfile(format)
+	if err != nil {
+		return err
+	}
+	fmt.Fprintln(cmd.OutOrStdout(), string(manifest))
+	return nil
+}
+
+type profileRollbackCmdFlags struct {
+	config configFlags
+}
+
+func profileRollbackCmd() *cobra.Command {
+	flags := profileRollbackCmdFlags{}
+	command := &cobra.Command{
+		Use:   "rollback",
+		Short: "Switch the project's nix profile back to an earlier generation",
+		Long: "Switch the project's nix profile back to the newest earlier generation whose " +
+			"store paths all still exist. Use it when devbox can't repair a broken profile.",
+		Args: cobra.ExactArgs(0),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			return profileRollbackCmdFunc(cmd, flags)
+		},
+	}
+
+	flags.config.register(command)
+	return command
+}
+
+func profileRollbackCmdFunc(cmd *cobra.Command, flags profileRollbackCmdFlags) error {
+	box, err := devbox.Open(flags.config.path, cmd.ErrOrStderr())
+	if err != nil {
+		return errors.WithStack(err)
+	}
+	return box.RollbackProfile()
+}
@@ -11,14 +11,21 @@ import (
 
 type removeCmdFlags struct {
 	config configFlags
+	all    bool
+	yes    bool
 }
 
 func RemoveCmd() *cobra.Command {
 	flags := removeCmdFlags{}
 	command := &cobra.Command{
-		Use:     "rm <pkg>...",
-		Short:   "Remove a package from your devbox",
-		Args:    cobra.MinimumNArgs(1),
+		Use:   "rm <pkg>...",
+		Short: "Remove a package from your devbox",
+		Args: func(cmd *cobra.Command, args []string) error {
+			if flags.all {
+				return cobra.NoArgs(cmd, args)
+			}
+			return cobra.MinimumNArgs(1)(cmd, args)
+		},
 		PreRunE: ensureNixInstalled,
 		RunE: func(cmd *cobra.Command, args []string) error {
 			return runRemoveCmd(cmd, args, flags)
@@ -26,6 +33,10 @@ func RemoveCmd() *cobra.Command {
 	}
 
 	flags.config.register(command)
+	command.Flags().BoolVar(
+		&flags.all, "all", false, "remove all of the packages in devbox.json")
+	command.Flags().BoolVarP(
+		&flags.yes, "yes", "y", false, "don't ask for confirmation before removing all packages")
 	return command
 }
 
@@ -35,5 +46,8 @@ func runRemoveCmd(cmd *cobra.Command, args []string, flags removeCmdFlags) error
 		return errors.WithStack(err)
 	}
 
+	if flags.all {
+		return box.RemoveAll(!flags.yes)
+	}
 	return box.Remove(args...)
 }
@@ -40,18 +40,26 @@ func RootCmd() *cobra.Command {
 	command.AddCommand(AddCmd())
 	command.AddCommand(BuildCmd())
 	command.AddCommand(CloudCmd())
+	command.AddCommand(doctorCmd())
+	command.AddCommand(exportCmd())
 	command.AddCommand(GenerateCmd())
 	command.AddCommand(globalCmd())
+	command.AddCommand(importCmd())
 	command.AddCommand(InfoCmd())
 	command.AddCommand(InitCmd())
+	command.AddCommand(InstallCmd())
 	command.AddCommand(LogCmd())
+	command.AddCommand(PackagesCmd())
 	command.AddCommand(PlanCmd())
+	command.AddCommand(ProfileCmd())
 	command.AddCommand(RemoveCmd())
 	command.AddCommand(RunCmd())
+	command.AddCommand(searchCmd())
 	command.AddCommand(ServicesCmd())
 	command.AddCommand(SetupCmd())
 	command.AddCommand(ShellCmd())
 	command.AddCommand(shellEnvCmd())
+	command.AddCommand(UpdateCmd())
 	command.AddCommand(VersionCmd())
 	command.AddCommand(genDocsCmd())
 
@@ -4,6 +4,11 @@
 package boxcli
 
 import (
+	"fmt"
+	"io"
+	"strings"
+	"time"
+
 	"github.com/pkg/errors"
 	"github.com/samber/lo"
 	"github.com/spf13/cobra"
@@ -11,10 +16,26 @@ import (
 	"go.jetpack.io/devbox/internal/boxcli/featureflag"
 	"go.jetpack.io/devbox/internal/boxcli/usererr"
 	"go.jetpack.io/devbox/internal/debug"
+	"go.jetpack.io/devbox/internal/impl"
 )
 
 type runCmdFlags struct {
-	config configFlags
+	config         configFlags
+	noNetwork      bool
+	allowLoopback  bool
+	envPassthrough []string
+	env            []string
+	explainEnv     []string
+	summary        bool
+	scripts        []string
+	keepGoing      bool
+	cwd            string
+	onFailure      string
+	timeout        time.Duration
+	environment    string
+	refresh        bool
+	list           bool
+	packageGroups  []string
 }
 
 func RunCmd() *cobra.Command {
@@ -24,8 +45,13 @@ func RunCmd() *cobra.Command {
 		"after `--` will be passed verbatim into your command (see examples).\n\n"
 	shortHelp := "Runs a script or command in a shell with access to your packages"
 	example := "\nRun a command directly:\n\n  devbox add cowsay\n  devbox run cowsay hello\n  " +
-		"devbox run -- cowsay -d hello\n\nRun a script (defined as `\"moo\": \"cowsay moo\"`) " +
-		"in your devbox.json:\n\n  devbox run moo"
+		"devbox run -- cowsay -d hello\n\nRun a shell snippet, with pipes and redirects:\n\n  " +
+		"devbox run -- 'cowsay hello | tee out.txt'\n\nRun a script (defined as `\"moo\": \"cowsay moo\"`) " +
+		"in your devbox.json:\n\n  devbox run moo\n\nPass arguments to a script (defined as " +
+		"`\"say\": \"cowsay \\\"$@\\\"\"`), which receives them exactly as given:\n\n" +
+		"  devbox run say -- -d \"hello world\"\n\nRun several scripts in order, and report how each one " +
+		"went:\n\n  devbox run --script build --script test --keep-going --summary\n\n" +
+		"List the scripts in your devbox.json:\n\n  devbox run"
 	if featureflag.UnifiedEnv.Disabled() {
 		shortHelp = "Starts a new devbox shell and runs the target script"
 		longHelp = "Starts a new interactive shell and runs your target script in it. The shell will " +
@@ -39,19 +65,83 @@ func RunCmd() *cobra.Command {
 		Short:   shortHelp,
 		Long:    longHelp,
 		Example: example,
-		Args:    cobra.MinimumNArgs(1),
 		PreRunE: ensureNixInstalled,
 		RunE: func(cmd *cobra.Command, args []string) error {
+			if (len(args) == 0 && len(flags.scripts) == 0) || flags.list {
+				return listScriptsCmd(cmd, flags)
+			}
 			return runScriptCmd(cmd, args, flags)
 		},
 	}
 
 	flags.config.register(command)
+	command.Flags().BoolVar(
+		&flags.noNetwork, "no-network", false,
+		"run without network access to catch accidental network dependencies (Linux only)")
+	command.Flags().BoolVar(
+		&flags.allowLoopback, "allow-loopback", false,
+		"with --no-network, allow connections over the loopback interface")
+	command.Flags().StringArrayVar(
+		&flags.envPassthrough, "env-passthrough", nil,
+		"always pass through host environment variables matching this glob pattern (e.g. 'GITHUB_*'); can be repeated")
+	command.Flags().StringArrayVar(
+		&flags.env, "env", nil,
+		"set an environment variable as KEY=VALUE, overriding devbox.json; can be repeated")
+	command.Flags().StringVar(
+		&flags.cwd, "cwd", "",
+		"directory to run the script or command in, relative to the project directory. "+
+			"Overrides the script_cwd setting in devbox.json")
+	command.Flags().StringVar(
+		&flags.onFailure, "on-failure", "",
+		"script or command to run if the script or command exits with a nonzero code. "+
+			"devbox run still exits with the original code")
+	command.Flags().DurationVar(
+		&flags.timeout, "timeout", 0,
+		"terminate the script or command if it runs longer than this duration (e.g. 30s, 5m). "+
+			"Overrides the timeout set in devbox.json. In a terminal on Linux or macOS, a script with "+
+			"a timeout runs in a pseudo-terminal of its own instead of devbox's terminal")
+	command.Flags().StringVar(
+		&flags.environment, "environment", "",
+		"run the script's override for this environment, if it has one, and set DEVBOX_ENV to it. "+
+			"Defaults to the value of DEVBOX_ENV")
+	command.Flags().BoolVar(
+		&flags.refresh, "refresh", false,
+		"recompute the nix environment instead of using the cached one")
+	command.Flags().StringSliceVar(
+		&flags.packageGroups, "with", nil,
+		"also install the packages in this package group from devbox.json; can be repeated or comma-separated")
+	command.Flags().BoolVar(
+		&flags.list, "list", false,
+		"list the scripts in devbox.json and their descriptions")
+	command.Flags().StringArrayVar(
+		&flags.scripts, "script", nil,
+		"run this script from devbox.json; can be repeated to run several scripts in order")
+	command.Flags().BoolVar(
+		&flags.keepGoing, "keep-going", false,
+		"with several --script flags, keep running the remaining scripts after one fails")
+	command.Flags().BoolVar(
+		&flags.summary, "summary", false,
+		"with --script, print the duration and exit status of each script when they complete")
+	command.Flags().StringArrayVar(
+		&flags.explainEnv, "explain-env", nil,
+		"print the value of this variable and the layers of the environment that set it; can be repeated")
 
 	return command
 }
 
 func runScriptCmd(cmd *cobra.Command, args []string, flags runCmdFlags) error {
+	if len(flags.scripts) > 0 {
+		if len(args) > 0 {
+			return usererr.New("--script can't be combined with a script or command argument")
+		}
+		return runScriptsCmd(cmd, flags)
+	}
+	if flags.keepGoing {
+		return usererr.New("--keep-going can only be used with --script")
+	}
+	if flags.summary {
+		return usererr.New("--summary can only be used with --script")
+	}
 
 	path, script, scriptArgs, err := parseScriptArgs(args, flags)
 	if err != nil {
@@ -66,18 +156,146 @@ func runScriptCmd(cmd *cobra.Command, args []string, flags runCmdFlags) error {
 		return errors.WithStack(err)
 	}
 
+	opts, err := runOptions(flags)
+	if err != nil {
+		return err
+	}
+
 	if featureflag.UnifiedEnv.Enabled() {
-		err = box.RunScript(script, scriptArgs)
+		err = box.RunScript(script, scriptArgs, opts...)
 	} else {
 		if devbox.IsDevboxShellEnabled() {
 			err = box.RunScriptInShell(script)
 		} else {
-			err = box.RunScript(script, scriptArgs)
+			err = box.RunScript(script, scriptArgs, opts...)
 		}
 	}
 	return err
 }
 
+// runScriptsCmd runs the scripts given with --script in order. It stops at the
+// first one that fails unless --keep-going is set, and returns that failure.
+func runScriptsCmd(cmd *cobra.Command, flags runCmdFlags) error {
+	path, err := configPathFromUser([]string{}, &flags.config)
+	if err != nil {
+		return err
+	}
+	box, err := devbox.Open(path, cmd.ErrOrStderr())
+	if err != nil {
+		return errors.WithStack(err)
+	}
+	opts, err := runOptions(flags)
+	if err != nil {
+		return err
+	}
+
+	defined := lo.Map(box.ListScripts(), func(s impl.ScriptInfo, _ int) string { return s.Name })
+	for _, script := range flags.scripts {
+		if !lo.Contains(defined, script) {
+			return usererr.New("%s isn't a script in devbox.json", script)
+		}
+	}
+	results, err := runScripts(flags.scripts, flags.keepGoing, func(script string) error {
+		return box.RunScript(script, nil /*scriptArgs*/, opts...)
+	})
+	if flags.summary {
+		printRunSummary(cmd.ErrOrStderr(), results)
+	}
+	return err
+}
+
+// runOptions returns the options for the flags that configure how scripts
+// and commands run.
+func runOptions(flags runCmdFlags) ([]impl.RunOption, error) {
+	if flags.allowLoopback && !flags.noNetwork {
+		return nil, usererr.New("--allow-loopback can only be used with --no-network")
+	}
+	envOverrides, err := impl.ParseEnvOverrides(flags.env)
+	if err != nil {
+		return nil, err
+	}
+	opts := []impl.RunOption{}
+	if flags.noNetwork {
+		opts = append(opts, impl.WithNoNetwork(flags.allowLoopback))
+	}
+	if len(flags.envPassthrough) > 0 {
+		opts = append(opts, impl.WithEnvPassthrough(flags.envPassthrough...))
+	}
+	if len(envOverrides) > 0 {
+		opts = append(opts, impl.WithEnvOverrides(envOverrides))
+	}
+	if len(flags.explainEnv) > 0 {
+		opts = append(opts, impl.WithExplainEnv(flags.explainEnv...))
+	}
+	if flags.cwd != "" {
+		opts = append(opts, impl.WithCwd(flags.cwd))
+	}
+	if flags.onFailure != "" {
+		opts = append(opts, impl.WithOnFailure(flags.onFailure))
+	}
+	if flags.environment != "" {
+		opts = append(opts, impl.WithEnvironment(flags.environment))
+	}
+	if flags.timeout < 0 {
+		return nil, usererr.New("--timeout must be a positive duration")
+	}
+	if flags.timeout > 0 {
+		opts = append(opts, impl.WithTimeout(flags.timeout))
+	}
+	if flags.refresh {
+		opts = append(opts, impl.WithRefreshEnv())
+	}
+	if len(flags.packageGroups) > 0 {
+		opts = append(opts, impl.WithPackageGroups(flags.packageGroups...))
+	}
+	return opts, nil
+}
+
+// listScriptsCmd prints the scripts that devbox run can run, sorted by name,
+// along with their descriptions.
+func listScriptsCmd(cmd *cobra.Command, flags runCmdFlags) error {
+	path, err := configPathFromUser([]string{}, &flags.config)
+	if err != nil {
+		return err
+	}
+	box, err := devbox.Open(path, cmd.ErrOrStderr())
+	if err != nil {
+		return errors.WithStack(err)
+	}
+
+	scripts := box.ListScripts()
+	if len(scripts) == 0 {
+		return usererr.New("no command or script provided, and there are no scripts in devbox.json")
+	}
+	printScripts(cmd.OutOrStdout(), scripts)
+	return nil
+}
+
+// printScripts prints scripts with their descriptions, and the environments
+// that override them, aligned in a column. Scripts without either are printed
+// without trailing spaces.
+func printScripts(w io.Writer, scripts []impl.ScriptInfo) {
+	width := 0
+	for _, script := range scripts {
+		if len(script.Name) > width {
+			width = len(script.Name)
+		}
+	}
+	fmt.Fprintln(w, "Available scripts:")
+	for _, script := range scripts {
+		details := script.Description
+		if len(script.Environments) > 0 {
+			details = strings.TrimSpace(fmt.Sprintf(
+				"%s (environments: %s)", details, strings.Join(script.Environments, ", ")))
+		}
+		if details == "" {
+			fmt.Fprintf(w, "  %s\n", script.Name)
+			continue
+		}
+		fmt.Fprintf(w, "  %-*s  %s\n", width, script.Name, details)
+	}
+}
+
 func parseScriptArgs(args []string, flags runCmdFlags) (string, string, []string, error) {
 	path, err := configPathFromUser([]string{}, &flags.config)
 	if err != nil {
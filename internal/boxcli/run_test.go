@@ -3,9 +3,14 @@
 package boxcli
 
 import (
+	"bytes"
+	"os"
+	"path/filepath"
 	"testing"
 
 	"github.com/stretchr/testify/assert"
+	"go.jetpack.io/devbox/internal/boxcli/usererr"
+	"go.jetpack.io/devbox/internal/impl"
 	"go.jetpack.io/devbox/internal/testframework"
 )
 
@@ -31,6 +36,37 @@ func TestRun(t *testing.T) {
 	assert.NoError(t, err)
 }
 
+func TestRunScriptArgs(t *testing.T) {
+	devboxJSON := `
+	{
+		"packages": [],
+		"shell": {
+		  "scripts": {
+			"args": "for arg in \"$@\"; do echo \"[$arg]\"; done > args.txt"
+		  },
+		  "init_hook": null
+		},
+		"nixpkgs": {
+		  "commit": "af9e00071d0971eb292fd5abef334e66eda3cb69"
+		}
+	}`
+	td := testframework.Open()
+	defer td.Close()
+	err := td.SetDevboxJSON(devboxJSON)
+	assert.NoError(t, err)
+	err = td.SetEnv("DEVBOX_FEATURE_UNIFIED_ENV", "1")
+	assert.NoError(t, err)
+	_, err = td.RunCommand(RunCmd(), "args", "--", "--flag", "value with spaces", "$HOME")
+	assert.NoError(t, err)
+	args, err := os.ReadFile("args.txt")
+	assert.NoError(t, err)
+	assert.Equal(t, "[--flag]\n[value with spaces]\n[$HOME]\n", string(args))
+
+	output, err := td.RunCommand(RunCmd())
+	assert.NoError(t, err)
+	assert.Equal(t, "Available scripts:\n  args\n", output)
+}
+
 func TestRunCommand(t *testing.T) {
 	devboxJSON := `
 	{
@@ -59,3 +95,212 @@ func TestRunCommand(t *testing.T) {
 	assert.NoError(t, err)
 	assert.NoFileExists(t, "test.txt")
 }
+
+func TestRunScriptRequires(t *testing.T) {
+	devboxJSON := `
+	{
+		"packages": [],
+		"shell": {
+		  "scripts": {
+			"greet": {
+			  "command": "hello > hello.txt",
+			  "requires": ["hello"]
+			}
+		  },
+		  "init_hook": null
+		},
+		"nixpkgs": {
+		  "commit": "af9e00071d0971eb292fd5abef334e66eda3cb69"
+		}
+	}`
+	td := testframework.Open()
+	defer td.Close()
+	err := td.SetDevboxJSON(devboxJSON)
+	assert.NoError(t, err)
+	_, err = td.RunCommand(RunCmd(), "greet")
+	assert.NoError(t, err)
+	assert.FileExists(t, "hello.txt")
+
+	updatedDevboxJSON, err := td.GetDevboxJSON()
+	assert.NoError(t, err)
+	assert.NotContains(t, updatedDevboxJSON.RawPackages, "hello")
+}
+
+func TestRunScriptCwdNearest(t *testing.T) {
+	devboxJSON := `
+	{
+		"packages": [],
+		"shell": {
+		  "scripts": {
+			"where": "pwd > where.txt"
+		  },
+		  "script_cwd": "nearest",
+		  "init_hook": null
+		},
+		"nixpkgs": {
+		  "commit": "af9e00071d0971eb292fd5abef334e66eda3cb69"
+		}
+	}`
+	td := testframework.Open()
+	// Close changes to the parent of the project's directory, so it has
+	// to run after the working directory is restored below.
+	t.Cleanup(func() { _ = td.Close() })
+	err := td.SetDevboxJSON(devboxJSON)
+	assert.NoError(t, err)
+	err = os.MkdirAll("web/src", 0o755)
+	assert.NoError(t, err)
+	err = td.CreateFile("web/package.json", "{}")
+	assert.NoError(t, err)
+
+	// Run the script from a subdirectory of the web package.
+	projectDir, err := os.Getwd()
+	assert.NoError(t, err)
+	err = os.Chdir("web/src")
+	assert.NoError(t, err)
+	t.Cleanup(func() { _ = os.Chdir(projectDir) })
+	_, err = td.RunCommand(RunCmd(), "where")
+	assert.NoError(t, err)
+
+	assert.FileExists(t, filepath.Join(projectDir, "web/where.txt"))
+}
+
+func TestRunOnFailure(t *testing.T) {
+	devboxJSON := `
+	{
+		"packages": [],
+		"shell": {
+		  "scripts": {
+			"fail": "exit 3",
+			"pass": "true",
+			"cleanup": "echo $DEVBOX_FAILED_COMMAND $DEVBOX_FAILED_EXIT_CODE > cleanup.txt; exit 1"
+		  },
+		  "init_hook": null
+		},
+		"nixpkgs": {
+		  "commit": "af9e00071d0971eb292fd5abef334e66eda3cb69"
+		}
+	}`
+	td := testframework.Open()
+	defer td.Close()
+	err := td.SetDevboxJSON(devboxJSON)
+	assert.NoError(t, err)
+	err = td.SetEnv("DEVBOX_FEATURE_UNIFIED_ENV", "1")
+	assert.NoError(t, err)
+
+	_, err = td.RunCommand(RunCmd(), "--on-failure", "cleanup", "pass")
+	assert.NoError(t, err)
+	assert.NoFileExists(t, "cleanup.txt")
+
+	// The cleanup script fails too, but devbox run should still exit with
+	// the original script's code.
+	_, err = td.RunCommand(RunCmd(), "--on-failure", "cleanup", "fail")
+	var exitErr *usererr.ExitError
+	if assert.ErrorAs(t, err, &exitErr) {
+		assert.Equal(t, 3, exitErr.ExitCode())
+	}
+	cleanup, err := os.ReadFile("cleanup.txt")
+	assert.NoError(t, err)
+	assert.Equal(t, "fail 3\n", string(cleanup))
+}
+
+func TestRunScriptEnvironment(t *testing.T) {
+	devboxJSON := `
+	{
+		"packages": [],
+		"shell": {
+		  "scripts": {
+			"build": {
+			  "command": "echo default $DEVBOX_ENV > build.txt",
+			  "environments": {
+				"prod": {"command": "echo prod $DEVBOX_ENV > build.txt"}
+			  }
+			}
+		  },
+		  "init_hook": null
+		},
+		"nixpkgs": {
+		  "commit": "af9e00071d0971eb292fd5abef334e66eda3cb69"
+		}
+	}`
+	td := testframework.Open()
+	defer td.Close()
+	err := td.SetDevboxJSON(devboxJSON)
+	assert.NoError(t, err)
+	err = td.SetEnv("DEVBOX_FEATURE_UNIFIED_ENV", "1")
+	assert.NoError(t, err)
+
+	_, err = td.RunCommand(RunCmd(), "build")
+	assert.NoError(t, err)
+	build, err := os.ReadFile("build.txt")
+	assert.NoError(t, err)
+	assert.Equal(t, "default\n", string(build))
+
+	_, err = td.RunCommand(RunCmd(), "--environment", "prod", "build")
+	assert.NoError(t, err)
+	build, err = os.ReadFile("build.txt")
+	assert.NoError(t, err)
+	assert.Equal(t, "prod prod\n", string(build))
+
+	// Environments without an override run the base command.
+	_, err = td.RunCommand(RunCmd(), "--environment", "staging", "build")
+	assert.NoError(t, err)
+	build, err = os.ReadFile("build.txt")
+	assert.NoError(t, err)
+	assert.Equal(t, "default staging\n", string(build))
+}
+
+func TestRunScriptEnv(t *testing.T) {
+	devboxJSON := `
+	{
+		"packages": [],
+		"env": {"NODE_ENV": "development", "GREETING": "hello"},
+		"shell": {
+		  "scripts": {
+			"dev": "echo $NODE_ENV $GREETING > env.txt",
+			"test": {
+			  "command": "echo $NODE_ENV $GREETING > env.txt",
+			  "env": {"NODE_ENV": "test", "GREETING": "${GREETING} world"}
+			}
+		  },
+		  "init_hook": null
+		},
+		"nixpkgs": {
+		  "commit": "af9e00071d0971eb292fd5abef334e66eda3cb69"
+		}
+	}`
+	td := testframework.Open()
+	defer td.Close()
+	err := td.SetDevboxJSON(devboxJSON)
+	assert.NoError(t, err)
+	err = td.SetEnv("DEVBOX_FEATURE_UNIFIED_ENV", "1")
+	assert.NoError(t, err)
+
+	_, err = td.RunCommand(RunCmd(), "dev")
+	assert.NoError(t, err)
+	out, err := os.ReadFile("env.txt")
+	assert.NoError(t, err)
+	assert.Equal(t, "development hello\n", string(out))
+
+	_, err = td.RunCommand(RunCmd(), "test")
+	assert.NoError(t, err)
+	out, err = os.ReadFile("env.txt")
+	assert.NoError(t, err)
+	assert.Equal(t, "test hello world\n", string(out))
+}
+
+func TestPrintScripts(t *testing.T) {
+	buf := &bytes.Buffer{}
+	printScripts(buf, []impl.ScriptInfo{
+		{Name: "build", Description: "Build the binary"},
+		{Name: "lint"},
+		{Name: "test-all", Description: "Run all the tests"},
+		{Name: "deploy", Environments: []string{"prod", "staging"}},
+		{Name: "migrate", Description: "Migrate the database", Environments: []string{"prod"}},
+	})
+	assert.Equal(t, "Available scripts:\n"+
+		"  build     Build the binary\n"+
+		"  lint\n"+
+		"  test-all  Run all the tests\n"+
+		"  deploy    (environments: prod, staging)\n"+
+		"  migrate   Migrate the database (environments: prod)\n", buf.String())
+}
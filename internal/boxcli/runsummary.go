@@ -0,0 +1,83 @@
+// Copyright 2023 Jetpack Technologies Inc and contributors. All rights reserved.
+// Use of this source code is governed by the license in the LICENSE file.
+
+package boxcli
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"text/tabwriter"
+	"time"
+
+	"go.jetpack.io/devbox/internal/boxcli/usererr"
+)
+
+// scriptResult is the outcome of a script or command executed by devbox run.
+type scriptResult struct {
+	name     string
+	duration time.Duration
+	err      error
+}
+
+// status describes how the script exited, including its exit code if it
+// failed with one.
+func (r scriptResult) status() string {
+	if r.err == nil {
+		return "ok"
+	}
+	var exitErr *usererr.ExitError
+	if errors.As(r.err, &exitErr) {
+		return fmt.Sprintf("failed (exit %d)", exitErr.ExitCode())
+	}
+	return "failed"
+}
+
+// printRunSummary prints a table with the duration and status of each result,
+// followed by the overall result.
+func printRunSummary(w io.Writer, results []scriptResult) {
+	fmt.Fprintln(w, "\nRun summary:")
+	tw := tabwriter.NewWriter(w, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(tw, "SCRIPT\tDURATION\tSTATUS")
+	failed := 0
+	for _, r := range results {
+		if r.err != nil {
+			failed++
+		}
+		fmt.Fprintf(tw, "%s\t%s\t%s\n", r.name, r.duration.Round(time.Millisecond), r.status())
+	}
+	tw.Flush()
+
+	if failed == 0 {
+		fmt.Fprintf(w, "\nResult: passed (%d of %d succeeded)\n", len(results), len(results))
+	} else {
+		fmt.Fprintf(w, "\nResult: failed (%d of %d failed)\n", failed, len(results))
+	}
+}
+
+// runScripts calls run for each script in order and returns the result of each
+// one that ran. It stops after the first failure unless keepGoing is set, and
+// the returned error is that first failure.
+func runScripts(
+	scripts []string,
+	keepGoing bool,
+	run func(script string) error,
+) ([]scriptResult, error) {
+	results := []scriptResult{}
+	var firstErr error
+	for _, script := range scripts {
+		start := time.Now()
+		err := run(script)
+		results = append(results, scriptResult{name: script, duration: time.Since(start), err: err})
+		if err == nil {
+			continue
+		}
+		if firstErr == nil {
+			firstErr = err
+		}
+		if !keepGoing {
+			break
+		}
+	}
+	return results, firstErr
+}
@@ -0,0 +1,67 @@
+// Copyright 2023 Jetpack Technologies Inc and contributors. All rights reserved.
+// Use of this source code is governed by the license in the LICENSE file.
+
+package boxcli
+
+import (
+	"bytes"
+	"errors"
+	"os/exec"
+	"regexp"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.jetpack.io/devbox/internal/boxcli/usererr"
+)
+
+func TestPrintRunSummary(t *testing.T) {
+	exitErr := exec.Command("/bin/sh", "-c", "exit 3").Run()
+	require.Error(t, exitErr)
+
+	out := &bytes.Buffer{}
+	printRunSummary(out, []scriptResult{
+		{name: "build", duration: 1200 * time.Millisecond},
+		{name: "test", duration: 3 * time.Second, err: usererr.NewExecError(exitErr)},
+		{name: "lint", duration: 10 * time.Millisecond, err: errors.New("boom")},
+	})
+
+	assert.Regexp(t, regexp.MustCompile(`build\s+1.2s\s+ok`), out.String())
+	assert.Regexp(t, regexp.MustCompile(`test\s+3s\s+failed \(exit 3\)`), out.String())
+	assert.Regexp(t, regexp.MustCompile(`lint\s+10ms\s+failed\n`), out.String())
+	assert.Contains(t, out.String(), "Result: failed (2 of 3 failed)")
+}
+
+func TestRunScriptsSummary(t *testing.T) {
+	exitErr := exec.Command("/bin/sh", "-c", "exit 2").Run()
+	require.Error(t, exitErr)
+	run := func(script string) error {
+		if script == "test" {
+			return usererr.NewExecError(exitErr)
+		}
+		return nil
+	}
+
+	// Without --keep-going, lint doesn't run after test fails.
+	results, err := runScripts([]string{"build", "test", "lint"}, false /*keepGoing*/, run)
+	assert.ErrorIs(t, err, exitErr)
+	assert.Equal(t, []string{"build", "test"}, resultNames(results))
+
+	results, err = runScripts([]string{"build", "test", "lint"}, true /*keepGoing*/, run)
+	assert.ErrorIs(t, err, exitErr)
+	out := &bytes.Buffer{}
+	printRunSummary(out, results)
+	assert.Regexp(t, regexp.MustCompile(`build\s+\S+\s+ok\n`), out.String())
+	assert.Regexp(t, regexp.MustCompile(`test\s+\S+\s+failed \(exit 2\)\n`), out.String())
+	assert.Regexp(t, regexp.MustCompile(`lint\s+\S+\s+ok\n`), out.String())
+	assert.Contains(t, out.String(), "Result: failed (1 of 3 failed)")
+}
+
+func resultNames(results []scriptResult) []string {
+	names := []string{}
+	for _, r := range results {
+		names = append(names, r.name)
+	}
+	return names
+}
@@ -0,0 +1,95 @@
+// Copyright 2023 Jetpack Technologies Inc and contributors. All rights reserved.
+// Use of this source code is governed by the license in the LICENSE file.
+
+package boxcli
+
+import (
+	"fmt"
+	"io"
+	"strings"
+	"text/tabwriter"
+
+	"github.com/pkg/errors"
+	"github.com/spf13/cobra"
+	"go.jetpack.io/devbox"
+	"go.jetpack.io/devbox/internal/cuecfg"
+	"go.jetpack.io/devbox/internal/nix"
+	"go.jetpack.io/devbox/internal/planner/plansdk"
+)
+
+const defaultSearchLimit = 10
+
+type searchCmdFlags struct {
+	config     configFlags
+	limit      int
+	jsonOutput bool
+}
+
+func searchCmd() *cobra.Command {
+	flags := searchCmdFlags{}
+	command := &cobra.Command{
+		Use:   "search <query>",
+		Short: "Search for packages in nixpkgs",
+		Long: "Search for packages in nixpkgs whose name or description matches every word " +
+			"in the query. It searches the project's nixpkgs commit, or devbox's default " +
+			"commit outside of a project.",
+		Args:    cobra.MinimumNArgs(1),
+		PreRunE: ensureNixInstalled,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			return searchCmdFunc(cmd, strings.Join(args, " "), flags)
+		},
+	}
+
+	flags.config.register(command)
+	command.Flags().IntVar(&flags.limit, "limit", defaultSearchLimit, "maximum number of results to show, or 0 to show all of them")
+	command.Flags().BoolVar(&flags.jsonOutput, "json", false, "output a JSON array of the results")
+	return command
+}
+
+func searchCmdFunc(cmd *cobra.Command, query string, flags searchCmdFlags) error {
+	commit := plansdk.DefaultNixpkgsCommit
+	box, err := devbox.Open(flags.config.path, cmd.ErrOrStderr())
+	if err == nil {
+		commit = box.Config().Nixpkgs.Commit
+	} else if flags.config.path != "" {
+		return errors.WithStack(err)
+	}
+
+	results, err := nix.Search(commit, query)
+	if err != nil {
+		return err
+	}
+	total := len(results)
+	if flags.limit > 0 && total > flags.limit {
+		results = results[:flags.limit]
+	}
+
+	if flags.jsonOutput {
+		data, err := cuecfg.MarshalJSON(results)
+		if err != nil {
+			return err
+		}
+		_, err = fmt.Fprintln(cmd.OutOrStdout(), string(data))
+		return errors.WithStack(err)
+	}
+	if total == 0 {
+		cmd.PrintErrf("No packages found for %q\n", query)
+		return nil
+	}
+	printSearchResults(cmd.OutOrStdout(), results)
+	if len(results) < total {
+		cmd.PrintErrf("\nShowing %d of %d results. Use --limit to see more.\n", len(results), total)
+	}
+	return nil
+}
+
+// printSearchResults prints a table with the attribute, version and
+// description of each package.
+func printSearchResults(w io.Writer, results []nix.SearchResult) {
+	tw := tabwriter.NewWriter(w, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(tw, "PACKAGE\tVERSION\tDESCRIPTION")
+	for _, r := range results {
+		fmt.Fprintf(tw, "%s\t%s\t%s\n", r.Package, r.Version, r.Description)
+	}
+	tw.Flush()
+}
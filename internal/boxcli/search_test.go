@@ -0,0 +1,22 @@
+// Copyright 2023 Jetpack Technologies Inc and contributors. All rights reserved.
+// Use of this source code is governed by the license in the LICENSE file.
+package boxcli
+
+import (
+	"bytes"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"go.jetpack.io/devbox/internal/nix"
+)
+
+func TestPrintSearchResults(t *testing.T) {
+	buf := &bytes.Buffer{}
+	printSearchResults(buf, []nix.SearchResult{
+		{Package: "postgresql", Name: "postgresql", Version: "14.8", Description: "A database"},
+		{Package: "postgresql_15", Name: "postgresql", Version: "15.3", Description: "A database"},
+	})
+	assert.Equal(t, "PACKAGE        VERSION  DESCRIPTION\n"+
+		"postgresql     14.8     A database\n"+
+		"postgresql_15  15.3     A database\n", buf.String())
+}
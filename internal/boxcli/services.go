@@ -4,17 +4,35 @@
 package boxcli
 
 import (
+	"fmt"
+	"io"
+	"text/tabwriter"
+
 	"github.com/pkg/errors"
 	"github.com/spf13/cobra"
 	"go.jetpack.io/devbox"
+	"go.jetpack.io/devbox/internal/boxcli/usererr"
+	"go.jetpack.io/devbox/internal/cuecfg"
+	"go.jetpack.io/devbox/internal/services"
 )
 
 type servicesCmdFlags struct {
 	config configFlags
 }
 
+type servicesLsCmdFlags struct {
+	jsonOutput bool
+}
+
+type servicesLogsCmdFlags struct {
+	follow bool
+	lines  int
+}
+
 func ServicesCmd() *cobra.Command {
 	flags := servicesCmdFlags{}
+	lsFlags := servicesLsCmdFlags{}
+	logsFlags := servicesLogsCmdFlags{}
 	servicesCommand := &cobra.Command{
 		Use:   "services",
 		Short: "Interact with devbox services",
@@ -22,12 +40,29 @@ func ServicesCmd() *cobra.Command {
 
 	lsCommand := &cobra.Command{
 		Use:   "ls",
-		Short: "List available services",
+		Short: "List available services and whether they're running",
 		Args:  cobra.ExactArgs(0),
 		RunE: func(cmd *cobra.Command, args []string) error {
-			return listServices(cmd, flags)
+			return listServices(cmd, flags, lsFlags)
+		},
+	}
+	lsCommand.Flags().BoolVar(
+		&lsFlags.jsonOutput, "json", false, "output a JSON array with the status of each service")
+
+	logsCommand := &cobra.Command{
+		Use:   "logs [service]...",
+		Short: "Shows the output of services. If no service is specified, shows the output of all services",
+		Long: "Shows the output of services that the running process manager runs. " +
+			"If no service is specified, shows the output of all of them, with each line " +
+			"starting with the name of its service.",
+		RunE: func(cmd *cobra.Command, args []string) error {
+			return serviceLogs(cmd, args, flags, logsFlags)
 		},
 	}
+	logsCommand.Flags().BoolVarP(
+		&logsFlags.follow, "follow", "f", false, "keep showing new output until interrupted")
+	logsCommand.Flags().IntVarP(
+		&logsFlags.lines, "lines", "n", 100, "number of recent lines to show for each service")
 
 	startCommand := &cobra.Command{
 		Use:   "start [service]...",
@@ -53,6 +88,18 @@ func ServicesCmd() *cobra.Command {
 		},
 	}
 
+	portForwardCommand := &cobra.Command{
+		Use:   "port-forward <service> [<local>:<remote>]",
+		Short: "Makes a service's port available on localhost",
+		Long: "Makes a service's port available on localhost. The remote port defaults " +
+			"to the port declared by the service. If the local port differs from the " +
+			"remote port, devbox forwards connections until interrupted.",
+		Args: cobra.RangeArgs(1, 2),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			return portForwardService(cmd, args, flags)
+		},
+	}
+
 	processManagerCommand := &cobra.Command{
 		Use:   "manager",
 		Short: "Starts process manager with all supported services",
@@ -62,7 +109,9 @@ func ServicesCmd() *cobra.Command {
 	}
 
 	flags.config.register(servicesCommand)
+	servicesCommand.AddCommand(logsCommand)
 	servicesCommand.AddCommand(lsCommand)
+	servicesCommand.AddCommand(portForwardCommand)
 	servicesCommand.AddCommand(processManagerCommand)
 	servicesCommand.AddCommand(restartCommand)
 	servicesCommand.AddCommand(startCommand)
@@ -70,21 +119,69 @@ func ServicesCmd() *cobra.Command {
 	return servicesCommand
 }
 
-func listServices(cmd *cobra.Command, flags servicesCmdFlags) error {
+func listServices(cmd *cobra.Command, flags servicesCmdFlags, lsFlags servicesLsCmdFlags) error {
 	box, err := devbox.Open(flags.config.path, cmd.ErrOrStderr())
 	if err != nil {
 		return errors.WithStack(err)
 	}
-	services, err := box.Services()
+	statuses, err := box.ServiceStatuses(cmd.Context())
 	if err != nil {
 		return err
 	}
-	for _, service := range services {
-		cmd.Println(service.Name)
+	if lsFlags.jsonOutput {
+		data, err := cuecfg.MarshalJSON(statuses)
+		if err != nil {
+			return err
+		}
+		_, err = fmt.Fprintln(cmd.OutOrStdout(), string(data))
+		return errors.WithStack(err)
+	}
+	if len(statuses) == 0 {
+		cmd.Println("No services found")
+		return nil
 	}
+	printServiceStatuses(cmd.OutOrStdout(), statuses)
 	return nil
 }
 
+// printServiceStatuses prints a table with whether process-compose manages
+// each service, its port, and whether it's running.
+func printServiceStatuses(w io.Writer, statuses []services.Info) {
+	tw := tabwriter.NewWriter(w, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(tw, "NAME\tPROCESS-COMPOSE\tPORT\tSTATUS")
+	for _, s := range statuses {
+		processCompose := "no"
+		if s.ProcessCompose {
+			processCompose = "yes"
+		}
+		port := s.Port
+		if port == "" {
+			port = "-"
+		}
+		fmt.Fprintf(tw, "%s\t%s\t%s\t%s\n", s.Name, processCompose, port, s.State)
+	}
+	tw.Flush()
+}
+
+func serviceLogs(
+	cmd *cobra.Command,
+	serviceNames []string,
+	flags servicesCmdFlags,
+	logsFlags servicesLogsCmdFlags,
+) error {
+	if logsFlags.lines <= 0 {
+		return usererr.New("--lines must be greater than 0")
+	}
+	box, err := devbox.Open(flags.config.path, cmd.ErrOrStderr())
+	if err != nil {
+		return errors.WithStack(err)
+	}
+	return box.ServiceLogs(cmd.Context(), cmd.OutOrStdout(), services.LogsOpts{
+		Lines:  logsFlags.lines,
+		Follow: logsFlags.follow,
+	}, serviceNames...)
+}
+
 func startServices(cmd *cobra.Command, services []string, flags servicesCmdFlags) error {
 	box, err := devbox.Open(flags.config.path, cmd.ErrOrStderr())
 	if err != nil {
@@ -138,8 +235,33 @@ func restartServices(
 	services []string,
 	flags servicesCmdFlags,
 ) error {
-	_ = stopServices(cmd, services, flags)
-	return startServices(cmd, services, flags)
+	box, err := devbox.Open(flags.config.path, cmd.ErrOrStderr())
+	if err != nil {
+		return errors.WithStack(err)
+	}
+	if len(services) == 0 {
+		services, err = serviceNames(box)
+		if err != nil {
+			return err
+		}
+		if len(services) == 0 {
+			cmd.Println("No services to restart")
+			return nil
+		}
+	}
+	return box.RestartServices(cmd.Context(), services...)
+}
+
+func portForwardService(cmd *cobra.Command, args []string, flags servicesCmdFlags) error {
+	box, err := devbox.Open(flags.config.path, cmd.ErrOrStderr())
+	if err != nil {
+		return errors.WithStack(err)
+	}
+	mapping := ""
+	if len(args) > 1 {
+		mapping = args[1]
+	}
+	return box.PortForwardService(cmd.Context(), args[0], mapping)
 }
 
 func startProcessManager(cmd *cobra.Command, flags servicesCmdFlags) error {
@@ -11,12 +11,23 @@ import (
 	"go.jetpack.io/devbox"
 	"go.jetpack.io/devbox/internal/boxcli/featureflag"
 	"go.jetpack.io/devbox/internal/boxcli/usererr"
+	"go.jetpack.io/devbox/internal/impl"
 	"go.jetpack.io/devbox/internal/ux"
 )
 
 type shellCmdFlags struct {
-	config   configFlags
-	PrintEnv bool
+	config           configFlags
+	PrintEnv         bool
+	printEnvJSON     bool
+	format           string
+	prefix           string
+	explainEnv       []string
+	env              []string
+	noProfileInstall bool
+	pure             bool
+	noPromptPrefix   bool
+	offline          bool
+	packageGroups    []string
 }
 
 func ShellCmd() *cobra.Command {
@@ -48,6 +59,38 @@ func ShellCmd() *cobra.Command {
 
 	command.Flags().BoolVar(
 		&flags.PrintEnv, "print-env", false, "print script to setup shell environment")
+	command.Flags().StringVar(
+		&flags.format, "format", string(impl.EnvFormatShell),
+		"output format for --print-env: sh, systemd (EnvironmentFile) or json")
+	command.Flags().BoolVar(
+		&flags.printEnvJSON, "print-env-json", false,
+		"print the shell environment as a JSON object; same as --print-env --format json")
+	command.Flags().StringVar(
+		&flags.prefix, "prefix", "",
+		"with --print-env, prefix the variable names (except PATH, HOME and a few others) with this string")
+	command.Flags().StringArrayVar(
+		&flags.explainEnv, "explain-env", nil,
+		"print the value of this variable and the layers of the environment that set it; can be repeated")
+	command.Flags().BoolVar(
+		&flags.noProfileInstall, "no-profile-install", false,
+		"don't install packages; use only the packages that are already in the nix store. "+
+			"Packages that aren't installed yet are missing from the environment")
+	command.Flags().StringArrayVar(
+		&flags.env, "env", nil,
+		"set an environment variable as KEY=VALUE in the shell, overriding devbox.json; can be repeated")
+	command.Flags().BoolVar(
+		&flags.pure, "pure", false,
+		"start the shell without the host environment, except for a few variables like HOME and TERM")
+	command.Flags().BoolVar(
+		&flags.offline, "offline", false,
+		"start the shell without using the network. Fails if a package or anything else "+
+			"that the shell needs hasn't been downloaded yet")
+	command.Flags().BoolVar(
+		&flags.noPromptPrefix, "no-prompt-prefix", false,
+		"don't prepend (devbox), or the shell.prompt in devbox.json, to the shell's prompt")
+	command.Flags().StringSliceVar(
+		&flags.packageGroups, "with", nil,
+		"also install the packages in this package group from devbox.json; can be repeated or comma-separated")
 
 	flags.config.register(command)
 	return command
@@ -58,6 +101,44 @@ func runShellCmd(cmd *cobra.Command, args []string, flags shellCmdFlags) error {
 	if err != nil {
 		return err
 	}
+	if flags.printEnvJSON {
+		if flags.PrintEnv || cmd.Flags().Changed("format") {
+			return usererr.New("--print-env-json can't be used with --print-env or --format")
+		}
+		flags.PrintEnv = true
+		flags.format = string(impl.EnvFormatJSON)
+	}
+	if cmd.Flags().Changed("format") && !flags.PrintEnv {
+		return usererr.New("--format can only be used with --print-env")
+	}
+	if flags.prefix != "" && !flags.PrintEnv {
+		return usererr.New("--prefix can only be used with --print-env")
+	}
+	if flags.noProfileInstall && len(cmds) > 0 {
+		return usererr.New("--no-profile-install can't be used with a command")
+	}
+	if flags.pure && (len(cmds) > 0 || flags.PrintEnv) {
+		return usererr.New("--pure can only be used to start an interactive shell")
+	}
+	if len(flags.env) > 0 && (len(cmds) > 0 || flags.PrintEnv) {
+		return usererr.New("--env can only be used to start an interactive shell")
+	}
+	if flags.noPromptPrefix && (len(cmds) > 0 || flags.PrintEnv) {
+		return usererr.New("--no-prompt-prefix can only be used to start an interactive shell")
+	}
+	if flags.offline && (len(cmds) > 0 || flags.PrintEnv) {
+		return usererr.New("--offline can only be used to start an interactive shell")
+	}
+	if len(flags.packageGroups) > 0 && (len(cmds) > 0 || flags.PrintEnv) {
+		return usererr.New("--with can only be used to start an interactive shell")
+	}
+	if flags.offline && flags.noProfileInstall {
+		return usererr.New("--offline and --no-profile-install can't be used together")
+	}
+	envOverrides, err := impl.ParseEnvOverrides(flags.env)
+	if err != nil {
+		return err
+	}
 	// Check the directory exists.
 	box, err := devbox.Open(path, cmd.ErrOrStderr())
 	if err != nil {
@@ -65,7 +146,18 @@ func runShellCmd(cmd *cobra.Command, args []string, flags shellCmdFlags) error {
 	}
 
 	if flags.PrintEnv {
-		script, err := box.PrintEnv()
+		format, err := impl.ParseEnvFormat(flags.format)
+		if err != nil {
+			return err
+		}
+		opts := []impl.PrintEnvOption{}
+		if flags.prefix != "" {
+			opts = append(opts, impl.WithEnvPrefix(flags.prefix))
+		}
+		if flags.noProfileInstall {
+			opts = append(opts, impl.WithOfflineEnv())
+		}
+		script, err := box.PrintEnv(format, opts...)
 		if err != nil {
 			return err
 		}
@@ -79,6 +171,15 @@ func runShellCmd(cmd *cobra.Command, args []string, flags shellCmdFlags) error {
 		return shellInceptionErrorMsg("devbox shell")
 	}
 
+	if len(flags.explainEnv) > 0 {
+		if featureflag.UnifiedEnv.Disabled() {
+			return usererr.New("--explain-env is not supported when DEVBOX_FEATURE_UNIFIED_ENV is disabled")
+		}
+		if err := box.ExplainEnv(flags.explainEnv...); err != nil {
+			return err
+		}
+	}
+
 	if len(cmds) > 0 {
 		if featureflag.UnifiedEnv.Enabled() {
 			ux.Fwarning(cmd.ErrOrStderr(), "\"devbox shell -- <cmd>\" is deprecated and will disappear "+
@@ -86,7 +187,26 @@ func runShellCmd(cmd *cobra.Command, args []string, flags shellCmdFlags) error {
 		}
 		err = box.Exec(cmds...)
 	} else {
-		err = box.Shell()
+		opts := []impl.ShellOption{}
+		if flags.noProfileInstall {
+			opts = append(opts, impl.WithoutProfileInstall())
+		}
+		if flags.pure {
+			opts = append(opts, impl.WithPureEnv())
+		}
+		if len(envOverrides) > 0 {
+			opts = append(opts, impl.WithShellEnvOverrides(envOverrides))
+		}
+		if flags.noPromptPrefix {
+			opts = append(opts, impl.WithoutPromptPrefix())
+		}
+		if flags.offline {
+			opts = append(opts, impl.WithOffline())
+		}
+		if len(flags.packageGroups) > 0 {
+			opts = append(opts, impl.WithShellPackageGroups(flags.packageGroups...))
+		}
+		err = box.Shell(opts...)
 	}
 	return err
 }
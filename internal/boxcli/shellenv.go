@@ -8,10 +8,12 @@ import (
 
 	"github.com/spf13/cobra"
 	"go.jetpack.io/devbox"
+	"go.jetpack.io/devbox/internal/impl"
 )
 
 type shellEnvCmdFlags struct {
-	config configFlags
+	config      configFlags
+	compareLock bool
 }
 
 func shellEnvCmd() *cobra.Command {
@@ -22,6 +24,9 @@ func shellEnvCmd() *cobra.Command {
 		Args:    cobra.ExactArgs(0),
 		PreRunE: ensureNixInstalled,
 		RunE: func(cmd *cobra.Command, args []string) error {
+			if flags.compareLock {
+				return compareLockfile(cmd, flags)
+			}
 			s, err := shellEnvFunc(cmd, flags)
 			if err != nil {
 				return err
@@ -32,6 +37,10 @@ func shellEnvCmd() *cobra.Command {
 	}
 
 	flags.config.register(command)
+	command.Flags().BoolVar(
+		&flags.compareLock, "compare-lock", false,
+		"instead of printing the environment, compare the store paths that the packages "+
+			"resolve to with devbox.lock, and fail if they differ")
 	return command
 }
 
@@ -41,5 +50,13 @@ func shellEnvFunc(cmd *cobra.Command, flags shellEnvCmdFlags) (string, error) {
 		return "", err
 	}
 
-	return box.PrintEnv()
+	return box.PrintEnv(impl.EnvFormatShell)
+}
+
+func compareLockfile(cmd *cobra.Command, flags shellEnvCmdFlags) error {
+	box, err := devbox.Open(flags.config.path, cmd.ErrOrStderr())
+	if err != nil {
+		return err
+	}
+	return box.CompareLockfile()
 }
@@ -0,0 +1,51 @@
+// Copyright 2023 Jetpack Technologies Inc and contributors. All rights reserved.
+// Use of this source code is governed by the license in the LICENSE file.
+
+package boxcli
+
+import (
+	"github.com/pkg/errors"
+	"github.com/spf13/cobra"
+	"go.jetpack.io/devbox"
+	"go.jetpack.io/devbox/internal/impl"
+)
+
+type updateCmdFlags struct {
+	config configFlags
+	dryRun bool
+}
+
+func UpdateCmd() *cobra.Command {
+	flags := updateCmdFlags{}
+	command := &cobra.Command{
+		Use:   "update",
+		Short: "Update the nixpkgs commit and the packages of your devbox",
+		Long: "Update moves devbox.json to the latest nixpkgs-unstable commit and " +
+			"installs the new versions of its packages. It prints the package versions " +
+			"that change, and doesn't update anything if a package no longer exists.",
+		Args:    cobra.NoArgs,
+		PreRunE: ensureNixInstalled,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			return runUpdateCmd(cmd, flags)
+		},
+	}
+
+	flags.config.register(command)
+	command.Flags().BoolVar(
+		&flags.dryRun, "dry-run", false,
+		"print the package versions that would change without changing anything")
+	return command
+}
+
+func runUpdateCmd(cmd *cobra.Command, flags updateCmdFlags) error {
+	box, err := devbox.Open(flags.config.path, cmd.ErrOrStderr())
+	if err != nil {
+		return errors.WithStack(err)
+	}
+
+	opts := []impl.UpdateOption{}
+	if flags.dryRun {
+		opts = append(opts, impl.WithUpdateDryRun())
+	}
+	return box.Update(opts...)
+}
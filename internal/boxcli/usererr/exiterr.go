@@ -3,11 +3,13 @@ package usererr
 import (
 	"errors"
 	"os/exec"
+	"syscall"
 )
 
 // ExitError is an ExitError for a command run on behalf of a user
 type ExitError struct {
-	err *exec.ExitError
+	err  error
+	code int
 }
 
 func NewExecError(source error) error {
@@ -19,8 +21,25 @@ func NewExecError(source error) error {
 	if !errors.As(source, &exitErr) {
 		return source
 	}
+	code := exitErr.ExitCode()
+	// ExitCode is -1 for commands that were killed by a signal. Report them
+	// the way shells do, as 128 plus the signal number.
+	if status, ok := exitErr.Sys().(syscall.WaitStatus); ok && status.Signaled() {
+		code = 128 + int(status.Signal())
+	}
+	return &ExitError{
+		err:  exitErr,
+		code: code,
+	}
+}
+
+// NewExitError returns an ExitError that makes devbox exit with code. It's
+// for commands that devbox ended itself, such as when they time out, where
+// the command's own exit code isn't meaningful.
+func NewExitError(source error, code int) error {
 	return &ExitError{
-		err: exitErr,
+		err:  source,
+		code: code,
 	}
 }
 
@@ -33,7 +52,7 @@ func (e *ExitError) Is(target error) bool {
 }
 
 func (e *ExitError) ExitCode() int {
-	return e.err.ExitCode()
+	return e.code
 }
 
 // Unwrap provides compatibility for Go 1.13 error chains.
@@ -4,15 +4,27 @@
 package boxcli
 
 import (
+	"encoding/json"
 	"fmt"
+	"io"
+	"net/http"
 	"runtime"
+	"strings"
+	"time"
 
+	"github.com/pkg/errors"
 	"github.com/spf13/cobra"
 	"go.jetpack.io/devbox/internal/build"
+	"golang.org/x/mod/semver"
 )
 
+// latestReleaseURL is the GitHub API endpoint that describes devbox's latest
+// release.
+const latestReleaseURL = "https://api.github.com/repos/jetpack-io/devbox/releases/latest"
+
 type versionFlags struct {
 	verbose bool
+	check   bool
 }
 
 func VersionCmd() *cobra.Command {
@@ -29,6 +41,9 @@ func VersionCmd() *cobra.Command {
 	command.Flags().BoolVarP(&flags.verbose, "verbose", "v", false, // value
 		"displays additional version information",
 	)
+	command.Flags().BoolVar(&flags.check, "check", false,
+		"check whether a newer version of devbox is available",
+	)
 	return command
 }
 
@@ -44,9 +59,64 @@ func versionCmdFunc(cmd *cobra.Command, _ []string, flags versionFlags) error {
 	} else {
 		fmt.Fprintf(w, "%v\n", v.Version)
 	}
+	if flags.check {
+		client := &http.Client{Timeout: 5 * time.Second}
+		checkForUpdate(w, client, latestReleaseURL, v.Version)
+	}
 	return nil
 }
 
+// checkForUpdate prints whether a newer release than version is available,
+// using client to get the latest release from url. Failing to check, such as
+// when offline, isn't an error.
+func checkForUpdate(w io.Writer, client *http.Client, url, version string) {
+	latest, err := latestRelease(client, url)
+	if err != nil {
+		fmt.Fprintf(w, "Unable to check for a newer version of devbox: %v\n", err)
+		return
+	}
+	current := "v" + strings.TrimPrefix(version, "v")
+	if semver.IsValid(current) && semver.Compare(current, latest.tag()) >= 0 {
+		fmt.Fprintln(w, "devbox is up to date.")
+		return
+	}
+	fmt.Fprintf(w, "A newer version of devbox is available: %s\n", strings.TrimPrefix(latest.tag(), "v"))
+	if latest.URL != "" {
+		fmt.Fprintf(w, "Changelog: %s\n", latest.URL)
+	}
+	fmt.Fprintln(w, "To update, run: curl -fsSL https://get.jetpack.io/devbox | bash")
+}
+
+// release is the part of a GitHub release that checkForUpdate uses.
+type release struct {
+	TagName string `json:"tag_name"`
+	URL     string `json:"html_url"`
+}
+
+// tag returns the release's version with a leading v, like semver expects.
+func (r *release) tag() string {
+	return "v" + strings.TrimPrefix(r.TagName, "v")
+}
+
+func latestRelease(client *http.Client, url string) (*release, error) {
+	res, err := client.Get(url)
+	if err != nil {
+		return nil, errors.WithStack(err)
+	}
+	defer res.Body.Close()
+	if res.StatusCode != http.StatusOK {
+		return nil, errors.Errorf("GET %s: %s", url, res.Status)
+	}
+	latest := &release{}
+	if err := json.NewDecoder(res.Body).Decode(latest); err != nil {
+		return nil, errors.Wrapf(err, "GET %s: invalid response", url)
+	}
+	if !semver.IsValid(latest.tag()) {
+		return nil, errors.Errorf("GET %s: invalid version %q", url, latest.TagName)
+	}
+	return latest, nil
+}
+
 type versionInfo struct {
 	Version      string
 	IsPrerelease bool
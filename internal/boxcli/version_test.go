@@ -3,6 +3,10 @@
 package boxcli
 
 import (
+	"bytes"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
 	"testing"
 
 	"github.com/stretchr/testify/assert"
@@ -16,3 +20,26 @@ func TestVersion(t *testing.T) {
 	assert.NoError(t, err)
 	assert.Contains(t, output, "0.0.0-dev")
 }
+
+func TestVersionCheck(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprint(w, `{"tag_name": "0.5.0", "html_url": "https://github.com/jetpack-io/devbox/releases/tag/0.5.0"}`)
+	}))
+	defer server.Close()
+
+	out := &bytes.Buffer{}
+	checkForUpdate(out, server.Client(), server.URL, "0.4.9")
+	assert.Equal(t, "A newer version of devbox is available: 0.5.0\n"+
+		"Changelog: https://github.com/jetpack-io/devbox/releases/tag/0.5.0\n"+
+		"To update, run: curl -fsSL https://get.jetpack.io/devbox | bash\n", out.String())
+
+	out.Reset()
+	checkForUpdate(out, server.Client(), server.URL, "0.5.0")
+	assert.Equal(t, "devbox is up to date.\n", out.String())
+
+	// Being offline isn't an error.
+	server.Close()
+	out.Reset()
+	checkForUpdate(out, server.Client(), server.URL, "0.5.0")
+	assert.Contains(t, out.String(), "Unable to check for a newer version of devbox")
+}
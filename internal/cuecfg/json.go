@@ -28,5 +28,98 @@ func MarshalJSON(v interface{}) ([]byte, error) {
 }
 
 func unmarshalJSON(data []byte, v interface{}) error {
-	return json.Unmarshal(data, v)
+	return json.Unmarshal(standardizeJSON(data), v)
+}
+
+// CountJSONComments returns how many // and /* */ comments data, which may be
+// JSON with comments, has.
+func CountJSONComments(data []byte) int {
+	_, count := stripJSONComments(data)
+	return count
+}
+
+// standardizeJSON converts JSON with comments and trailing commas into standard
+// JSON. The comments and trailing commas are replaced with spaces, so that the
+// offsets in syntax errors still point to the right place in data.
+func standardizeJSON(data []byte) []byte {
+	out, _ := stripJSONComments(data)
+	inString, escaped := false, false
+	for i, c := range out {
+		if inString {
+			switch {
+			case escaped:
+				escaped = false
+			case c == '\\':
+				escaped = true
+			case c == '"':
+				inString = false
+			}
+			continue
+		}
+		switch c {
+		case '"':
+			inString = true
+		case ',':
+			next := bytes.TrimLeft(out[i+1:], " \t\r\n")
+			if len(next) > 0 && (next[0] == '}' || next[0] == ']') {
+				out[i] = ' '
+			}
+		}
+	}
+	return out
+}
+
+// stripJSONComments returns a copy of data with its comments replaced by
+// spaces, keeping newlines, and the number of comments it had.
+func stripJSONComments(data []byte) ([]byte, int) {
+	out := append([]byte(nil), data...)
+	count := 0
+	inString, escaped := false, false
+	for i := 0; i < len(out); i++ {
+		c := out[i]
+		if inString {
+			switch {
+			case escaped:
+				escaped = false
+			case c == '\\':
+				escaped = true
+			case c == '"':
+				inString = false
+			}
+			continue
+		}
+		if c == '"' {
+			inString = true
+			continue
+		}
+		if c != '/' || i+1 >= len(out) {
+			continue
+		}
+		var end int
+		switch out[i+1] {
+		case '/':
+			end = bytes.IndexByte(out[i:], '\n')
+			if end < 0 {
+				end = len(out) - i
+			}
+		case '*':
+			end = bytes.Index(out[i+2:], []byte("*/"))
+			if end < 0 {
+				// Leave an unterminated comment for the JSON parser
+				// to report.
+				continue
+			}
+			end += 4
+		default:
+			continue
+		}
+		count++
+		for j := i; j < i+end; j++ {
+			if out[j] != '\n' {
+				out[j] = ' '
+			}
+		}
+		i += end - 1
+	}
+	return out, count
 }
@@ -0,0 +1,307 @@
+// Copyright 2023 Jetpack Technologies Inc and contributors. All rights reserved.
+// Use of this source code is governed by the license in the LICENSE file.
+
+package cuecfg
+
+import (
+	"bytes"
+	"encoding/json"
+	"reflect"
+
+	"github.com/pkg/errors"
+)
+
+// PatchJSON returns original, a JSON object that may have comments, with its
+// top-level fields changed to match the ones in updated. Fields that didn't
+// change keep their order, formatting and comments. Changed fields are
+// formatted like the ones around them, removed fields are deleted, and new
+// fields are added at the end unless they're empty, like {"init_hook": null}.
+func PatchJSON(original, updated []byte) ([]byte, error) {
+	orig, err := parseJSONObject(original)
+	if err != nil {
+		return nil, err
+	}
+	if len(orig.fields) == 0 {
+		return nil, errors.New("can't patch an empty JSON object")
+	}
+	upd, err := parseJSONObject(updated)
+	if err != nil {
+		return nil, err
+	}
+	updatedFields := map[string]jsonField{}
+	for _, f := range upd.fields {
+		updatedFields[f.key] = f
+	}
+	indentUnit := orig.fields[0].indent
+	if indentUnit == "" {
+		indentUnit = "  "
+	}
+
+	type entry struct{ lead, body, gap []byte }
+	entries := []entry{}
+	seen := map[string]bool{}
+	lastIndent := indentUnit
+	for _, f := range orig.fields {
+		if seen[f.key] {
+			return nil, errors.Errorf("duplicate field %q", f.key)
+		}
+		seen[f.key] = true
+		if f.indent != "" {
+			lastIndent = f.indent
+		}
+		newField, ok := updatedFields[f.key]
+		if !ok {
+			continue
+		}
+		body := original[f.keyStart:f.valueEnd]
+		oldValue, newValue := orig.value(f), upd.value(newField)
+		equal, err := jsonEqual(oldValue, newValue)
+		if err != nil {
+			return nil, err
+		}
+		if !equal {
+			// Don't replace {} with {"init_hook": null}.
+			oldEmpty, _ := isEmptyJSON(oldValue)
+			newEmpty, _ := isEmptyJSON(newValue)
+			equal = oldEmpty && newEmpty
+		}
+		if !equal {
+			inline := !bytes.ContainsRune(oldValue, '\n')
+			value, err := formatJSONValue(newValue, f.indent, indentUnit, inline)
+			if err != nil {
+				return nil, err
+			}
+			body = append(append([]byte(nil), original[f.keyStart:f.valueStart]...), value...)
+		}
+		entries = append(entries, entry{
+			lead: original[f.leadStart:f.keyStart],
+			body: body,
+			gap:  original[f.valueEnd:f.gapEnd],
+		})
+	}
+	for _, f := range upd.fields {
+		if seen[f.key] {
+			continue
+		}
+		empty, err := isEmptyJSON(upd.value(f))
+		if err != nil {
+			return nil, err
+		}
+		if empty {
+			continue
+		}
+		value, err := formatJSONValue(upd.value(f), lastIndent, indentUnit, false)
+		if err != nil {
+			return nil, err
+		}
+		body := append(append([]byte(nil), updated[f.keyStart:f.keyEnd]...), ": "...)
+		entries = append(entries, entry{lead: []byte("\n" + lastIndent), body: append(body, value...)})
+	}
+
+	out := &bytes.Buffer{}
+	out.Write(original[:orig.open+1])
+	for i, e := range entries {
+		out.Write(e.lead)
+		out.Write(e.body)
+		out.Write(e.gap)
+		if i < len(entries)-1 || orig.trailingComma {
+			out.WriteByte(',')
+		}
+	}
+	out.Write(original[orig.tailStart:])
+	return out.Bytes(), nil
+}
+
+// jsonObject is a top-level JSON object along with the offsets of its fields.
+type jsonObject struct {
+	// standard is the object as standard JSON, with the same offsets as the
+	// data it was parsed from.
+	standard []byte
+	fields   []jsonField
+	// open is the offset of the object's opening brace.
+	open int
+	// tailStart is the offset of whatever follows the last field and its
+	// comma, up to and including the closing brace.
+	tailStart int
+	// trailingComma is whether the last field is followed by a comma.
+	trailingComma bool
+}
+
+// jsonField is the offsets of a field in a jsonObject.
+type jsonField struct {
+	key string
+	// indent is the whitespace before the key, if it begins a line.
+	indent string
+	// leadStart is where the whitespace and comments before the key start.
+	leadStart  int
+	keyStart   int
+	keyEnd     int
+	valueStart int
+	valueEnd   int
+	// gapEnd is the offset of the comma after the value, or valueEnd if
+	// there isn't one.
+	gapEnd int
+}
+
+func (o *jsonObject) value(f jsonField) []byte {
+	return o.standard[f.valueStart:f.valueEnd]
+}
+
+// parseJSONObject finds the fields of the object in data, which may have
+// comments and trailing commas.
+func parseJSONObject(data []byte) (*jsonObject, error) {
+	// noComments still has the trailing commas, which tell the fields
+	// apart, and standard is what the values are decoded from.
+	noComments, _ := stripJSONComments(data)
+	obj := &jsonObject{standard: standardizeJSON(data)}
+	syntaxErr := errors.New("expected a JSON object")
+
+	i := skipJSONSpace(noComments, 0)
+	if i >= len(noComments) || noComments[i] != '{' {
+		return nil, syntaxErr
+	}
+	obj.open = i
+	leadStart := i + 1
+	for {
+		i = skipJSONSpace(noComments, leadStart)
+		if i < len(noComments) && noComments[i] == '}' {
+			obj.tailStart = leadStart
+			return obj, nil
+		}
+		f := jsonField{leadStart: leadStart, keyStart: i}
+		if lineStart := bytes.LastIndexByte(data[leadStart:i], '\n'); lineStart >= 0 {
+			if indent := data[leadStart+lineStart+1 : i]; len(bytes.TrimLeft(indent, " \t")) == 0 {
+				f.indent = string(indent)
+			}
+		}
+
+		dec := json.NewDecoder(bytes.NewReader(obj.standard[i:]))
+		token, err := dec.Token()
+		if err != nil {
+			return nil, errors.WithStack(err)
+		}
+		key, ok := token.(string)
+		if !ok {
+			return nil, syntaxErr
+		}
+		f.key = key
+		f.keyEnd = i + int(dec.InputOffset())
+
+		i = skipJSONSpace(noComments, f.keyEnd)
+		if i >= len(noComments) || noComments[i] != ':' {
+			return nil, syntaxErr
+		}
+		f.valueStart = skipJSONSpace(noComments, i+1)
+		var value json.RawMessage
+		dec = json.NewDecoder(bytes.NewReader(obj.standard[f.valueStart:]))
+		if err := dec.Decode(&value); err != nil {
+			return nil, errors.WithStack(err)
+		}
+		f.valueEnd = f.valueStart + int(dec.InputOffset())
+		f.gapEnd = f.valueEnd
+		obj.fields = append(obj.fields, f)
+
+		i = skipJSONSpace(noComments, f.valueEnd)
+		if i >= len(noComments) {
+			return nil, syntaxErr
+		}
+		switch noComments[i] {
+		case '}':
+			obj.tailStart = f.valueEnd
+			return obj, nil
+		case ',':
+			obj.fields[len(obj.fields)-1].gapEnd = i
+			leadStart = i + 1
+			if j := skipJSONSpace(noComments, leadStart); j < len(noComments) && noComments[j] == '}' {
+				obj.trailingComma = true
+				obj.tailStart = leadStart
+				return obj, nil
+			}
+		default:
+			return nil, syntaxErr
+		}
+	}
+}
+
+func skipJSONSpace(data []byte, i int) int {
+	for i < len(data) && bytes.IndexByte([]byte(" \t\r\n"), data[i]) >= 0 {
+		i++
+	}
+	return i
+}
+
+func jsonEqual(a, b []byte) (bool, error) {
+	var va, vb any
+	if err := json.Unmarshal(a, &va); err != nil {
+		return false, errors.WithStack(err)
+	}
+	if err := json.Unmarshal(b, &vb); err != nil {
+		return false, errors.WithStack(err)
+	}
+	return reflect.DeepEqual(va, vb), nil
+}
+
+// isEmptyJSON reports whether value is null, or an empty array or object, or an
+// object whose fields are all empty.
+func isEmptyJSON(value []byte) (bool, error) {
+	var v any
+	if err := json.Unmarshal(value, &v); err != nil {
+		return false, errors.WithStack(err)
+	}
+	var isEmpty func(v any) bool
+	isEmpty = func(v any) bool {
+		switch v := v.(type) {
+		case nil:
+			return true
+		case []any:
+			return len(v) == 0
+		case map[string]any:
+			for _, field := range v {
+				if !isEmpty(field) {
+					return false
+				}
+			}
+			return true
+		}
+		return false
+	}
+	return isEmpty(v), nil
+}
+
+// formatJSONValue formats value either on one line, or indented to go after a
+// key that's indented by indent.
+func formatJSONValue(value []byte, indent, indentUnit string, inline bool) ([]byte, error) {
+	out := &bytes.Buffer{}
+	if !inline {
+		err := json.Indent(out, value, indent, indentUnit)
+		return out.Bytes(), errors.WithStack(err)
+	}
+	if err := json.Compact(out, value); err != nil {
+		return nil, errors.WithStack(err)
+	}
+	// Put a space after each comma and colon, like ["a", "b"].
+	compact := out.Bytes()
+	spaced := make([]byte, 0, len(compact))
+	inString, escaped := false, false
+	for _, c := range compact {
+		spaced = append(spaced, c)
+		if inString {
+			switch {
+			case escaped:
+				escaped = false
+			case c == '\\':
+				escaped = true
+			case c == '"':
+				inString = false
+			}
+			continue
+		}
+		switch c {
+		case '"':
+			inString = true
+		case ',', ':':
+			spaced = append(spaced, ' ')
+		}
+	}
+	return spaced, nil
+}
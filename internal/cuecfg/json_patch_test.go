@@ -0,0 +1,109 @@
+package cuecfg
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestPatchJSON(t *testing.T) {
+	testCases := []struct {
+		name     string
+		original string
+		updated  string
+		want     string
+	}{
+		{
+			name: "unchanged",
+			original: `{
+    "shell": {"init_hook": ["echo hi"]},
+    // Keep go pinned.
+    "packages": ["go@1.20"]
+}
+`,
+			updated: `{"packages": ["go@1.20"], "shell": {"init_hook": ["echo hi"]}}`,
+			want: `{
+    "shell": {"init_hook": ["echo hi"]},
+    // Keep go pinned.
+    "packages": ["go@1.20"]
+}
+`,
+		},
+		{
+			name: "inline array",
+			original: `{
+    "shell": {"init_hook": ["echo hi"]},
+    // Keep go pinned.
+    "packages": ["go@1.20"]
+}
+`,
+			updated: `{"packages": ["go@1.20", "ripgrep"], "shell": {"init_hook": ["echo hi"]}}`,
+			want: `{
+    "shell": {"init_hook": ["echo hi"]},
+    // Keep go pinned.
+    "packages": ["go@1.20", "ripgrep"]
+}
+`,
+		},
+		{
+			name: "multiline array",
+			original: `{
+	"packages": [
+		"go@1.20"
+	],
+	"env": {"A": "1"},
+}`,
+			updated: `{"packages": ["go@1.20", "ripgrep"], "env": {"A": "1"}}`,
+			want: `{
+	"packages": [
+		"go@1.20",
+		"ripgrep"
+	],
+	"env": {"A": "1"},
+}`,
+		},
+		{
+			name: "add and remove fields",
+			original: `{
+  "packages": [],
+  "env": {
+    "A": "1"
+  },
+  "nixpkgs": {
+    "commit": "abc"
+  }
+}`,
+			updated: `{"packages": ["hello"], "nixpkgs": {"commit": "abc"}, "pinned_packages": {"hello": {"attribute": "hello"}}}`,
+			want: `{
+  "packages": ["hello"],
+  "nixpkgs": {
+    "commit": "abc"
+  },
+  "pinned_packages": {
+    "hello": {
+      "attribute": "hello"
+    }
+  }
+}`,
+		},
+		{
+			name:     "remove last field",
+			original: `{"packages": ["hello"], "shell": {}, "env": {"A": "1"}}`,
+			updated:  `{"packages": ["hello"], "shell": {"init_hook": null}}`,
+			want:     `{"packages": ["hello"], "shell": {}}`,
+		},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			got, err := PatchJSON([]byte(tc.original), []byte(tc.updated))
+			require.NoError(t, err)
+			assert.Equal(t, tc.want, string(got))
+		})
+	}
+}
+
+func TestPatchJSONNotAnObject(t *testing.T) {
+	_, err := PatchJSON([]byte(`["hello"]`), []byte(`{"packages": []}`))
+	assert.Error(t, err)
+}
@@ -0,0 +1,41 @@
+package cuecfg
+
+import (
+	"encoding/json"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestUnmarshalJSONC(t *testing.T) {
+	data := []byte(`{
+  // Pinned because 1.21 breaks the build.
+  "packages": ["go@1.20",],
+  /* URLs and escaped quotes in strings aren't comments or trailing commas. */
+  "url": "https://example.com//path",
+  "quoted": "a \"// b\", ]",
+}`)
+	var v struct {
+		Packages []string `json:"packages"`
+		URL      string   `json:"url"`
+		Quoted   string   `json:"quoted"`
+	}
+	require.NoError(t, Unmarshal(data, ".json", &v))
+	assert.Equal(t, []string{"go@1.20"}, v.Packages)
+	assert.Equal(t, "https://example.com//path", v.URL)
+	assert.Equal(t, `a "// b", ]`, v.Quoted)
+	assert.Equal(t, 2, CountJSONComments(data))
+	assert.Zero(t, CountJSONComments([]byte(`{"url": "https://example.com"}`)))
+}
+
+func TestStandardizeJSONKeepsOffsets(t *testing.T) {
+	data := []byte("{\n  // comment\n  \"a\": 1,\n  \"b\": x\n}")
+	standard := standardizeJSON(data)
+	assert.Len(t, standard, len(data))
+
+	// Syntax errors point to the same place in the original data.
+	var syntaxErr *json.SyntaxError
+	require.ErrorAs(t, json.Unmarshal(standard, &map[string]any{}), &syntaxErr)
+	assert.Equal(t, byte('x'), data[syntaxErr.Offset-1])
+}
@@ -0,0 +1,24 @@
+package fileutil
+
+import (
+	"syscall"
+
+	"github.com/pkg/errors"
+)
+
+// FSType returns the name of the type of filesystem that path is on, such as
+// "apfs" or "smbfs".
+func FSType(path string) (string, error) {
+	var st syscall.Statfs_t
+	if err := syscall.Statfs(path, &st); err != nil {
+		return "", errors.WithStack(err)
+	}
+	name := make([]byte, 0, len(st.Fstypename))
+	for _, c := range st.Fstypename {
+		if c == 0 {
+			break
+		}
+		name = append(name, byte(c))
+	}
+	return string(name), nil
+}
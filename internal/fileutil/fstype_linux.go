@@ -0,0 +1,42 @@
+package fileutil
+
+import (
+	"fmt"
+	"syscall"
+
+	"github.com/pkg/errors"
+)
+
+// linuxFSTypes maps the filesystem magic numbers from linux/magic.h (and the
+// statfs(2) man page) that devbox cares about to their names.
+var linuxFSTypes = map[uint32]string{
+	0x6969:     "nfs",
+	0x517b:     "smb",
+	0xff534d42: "cifs",
+	0xfe534d42: "smb2",
+	0x01021997: "v9fs",
+	0x5346414f: "afs",
+	0x564c:     "ncpfs",
+	0x65735546: "fuse",
+	0xef53:     "ext4",
+	0x58465342: "xfs",
+	0x9123683e: "btrfs",
+	0x01021994: "tmpfs",
+	0x794c7630: "overlay",
+}
+
+// FSType returns the name of the type of filesystem that path is on, such as
+// "ext4" or "nfs". Unknown types are returned as a hex magic number.
+func FSType(path string) (string, error) {
+	var st syscall.Statfs_t
+	if err := syscall.Statfs(path, &st); err != nil {
+		return "", errors.WithStack(err)
+	}
+	// Statfs_t.Type is an int32 on some architectures, so convert through
+	// uint32 to compare against the magic numbers.
+	magic := uint32(st.Type)
+	if name, ok := linuxFSTypes[magic]; ok {
+		return name, nil
+	}
+	return fmt.Sprintf("0x%x", magic), nil
+}
@@ -0,0 +1,9 @@
+//go:build !linux && !darwin
+
+package fileutil
+
+// FSType returns an empty string because detecting the filesystem type is
+// only supported on Linux and macOS.
+func FSType(path string) (string, error) {
+	return "", nil
+}
@@ -0,0 +1,79 @@
+// Copyright 2023 Jetpack Technologies Inc and contributors. All rights reserved.
+// Use of this source code is governed by the license in the LICENSE file.
+
+package impl
+
+import (
+	"bytes"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+
+	"github.com/pkg/errors"
+	"go.jetpack.io/devbox/internal/boxcli/usererr"
+	"go.jetpack.io/devbox/internal/debug"
+)
+
+// beforeInitIgnoredVars are the variables that sh sets by itself, which
+// shouldn't be copied from the before_init hook's environment.
+var beforeInitIgnoredVars = map[string]bool{
+	"_":      true,
+	"OLDPWD": true,
+	"PWD":    true,
+	"SHLVL":  true,
+}
+
+// runBeforeInitHook runs the project's before_init hook, if it has one, and
+// sets the variables that it exports in devbox's own environment. That way
+// they apply to the nix commands that install packages, and they're copied
+// into the shell or script's environment like any other variable. The hook
+// only runs the first time this is called.
+func (d *Devbox) runBeforeInitHook() error {
+	hook := d.cfg.beforeInitHook()
+	if hook == "" || d.ranBeforeInitHook {
+		return nil
+	}
+	d.ranBeforeInitHook = true
+
+	envFile, err := os.CreateTemp("", "devbox-before-init-env-")
+	if err != nil {
+		return errors.WithStack(err)
+	}
+	envFile.Close()
+	defer os.Remove(envFile.Name())
+
+	// The hook runs in a group instead of a subshell so that its exports
+	// are still set when env writes them out, which it only does if the
+	// hook succeeds.
+	script := fmt.Sprintf("{\n%s\n} && env -0 > \"$1\"", hook)
+	cmd := exec.Command("sh", "-c", script, "sh", envFile.Name())
+	cmd.Dir = d.projectDir
+	cmd.Stdin = os.Stdin
+	cmd.Stdout = d.writer
+	cmd.Stderr = os.Stderr
+	debug.Log("Running before_init hook: %s", hook)
+	if err := cmd.Run(); err != nil {
+		return usererr.WithUserMessage(
+			err, "The before_init hook in %s failed.", filepath.Base(d.configPath))
+	}
+
+	env, err := os.ReadFile(envFile.Name())
+	if err != nil {
+		return errors.WithStack(err)
+	}
+	for _, entry := range bytes.Split(env, []byte{0}) {
+		name, value, ok := strings.Cut(string(entry), "=")
+		if !ok || beforeInitIgnoredVars[name] {
+			continue
+		}
+		if current, set := os.LookupEnv(name); set && current == value {
+			continue
+		}
+		if err := os.Setenv(name, value); err != nil {
+			return errors.WithStack(err)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,57 @@
+package impl
+
+import (
+	"bytes"
+	"io"
+	"os"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.jetpack.io/devbox/internal/impl/shellcmd"
+)
+
+func TestRunBeforeInitHook(t *testing.T) {
+	t.Setenv("CACHE_TOKEN", "")
+	os.Unsetenv("CACHE_TOKEN")
+	t.Setenv("KEPT", "original")
+
+	dir := t.TempDir()
+	_, err := InitConfig(dir, io.Discard)
+	require.NoError(t, err)
+	out := &bytes.Buffer{}
+	box, err := Open(dir, out)
+	require.NoError(t, err)
+
+	box.cfg.Shell.BeforeInit = &shellcmd.Commands{Cmds: []string{
+		"echo fetching token",
+		`export CACHE_TOKEN="secret with spaces"`,
+		"unexported=1",
+	}}
+	require.NoError(t, box.runBeforeInitHook())
+	assert.Equal(t, "fetching token\n", out.String())
+	assert.Equal(t, "secret with spaces", os.Getenv("CACHE_TOKEN"))
+	assert.Equal(t, "original", os.Getenv("KEPT"))
+	_, set := os.LookupEnv("unexported")
+	assert.False(t, set)
+
+	// The hook only runs once.
+	require.NoError(t, box.runBeforeInitHook())
+	assert.Equal(t, "fetching token\n", out.String())
+}
+
+func TestRunBeforeInitHookFails(t *testing.T) {
+	t.Setenv("CACHE_TOKEN", "")
+	os.Unsetenv("CACHE_TOKEN")
+
+	dir := t.TempDir()
+	_, err := InitConfig(dir, io.Discard)
+	require.NoError(t, err)
+	box, err := Open(dir, io.Discard)
+	require.NoError(t, err)
+
+	box.cfg.Shell.BeforeInit = &shellcmd.Commands{Cmds: []string{"export CACHE_TOKEN=secret", "false"}}
+	assert.Error(t, box.runBeforeInitHook())
+	_, set := os.LookupEnv("CACHE_TOKEN")
+	assert.False(t, set)
+}
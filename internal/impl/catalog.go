@@ -0,0 +1,138 @@
+// Copyright 2023 Jetpack Technologies Inc and contributors. All rights reserved.
+// Use of this source code is governed by the license in the LICENSE file.
+
+package impl
+
+import (
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+
+	"github.com/pkg/errors"
+	"go.jetpack.io/devbox/internal/boxcli/usererr"
+	"go.jetpack.io/devbox/internal/cuecfg"
+)
+
+// catalogEnvVar sets the package catalog for projects that don't set one in
+// their devbox.json.
+const catalogEnvVar = "DEVBOX_CATALOG"
+
+// Catalog maps friendly package names, such as an organization's internal
+// tools, to the nixpkgs attributes that provide them. For example:
+//
+//	{
+//	  "packages": {
+//	    "internal-cli": {
+//	      "attribute": "nodePackages.internal-cli",
+//	      "commit": "af9e00071d0971eb292fd5abef334e66eda3cb69"
+//	    }
+//	  }
+//	}
+type Catalog struct {
+	Packages map[string]CatalogEntry `json:"packages"`
+}
+
+// CatalogEntry is the definition of a package in a Catalog.
+type CatalogEntry struct {
+	// Attribute is the nixpkgs attribute that provides the package.
+	Attribute string `json:"attribute"`
+
+	// Commit optionally pins the nixpkgs commit that the attribute must come
+	// from.
+	Commit string `json:"commit,omitempty"`
+}
+
+// catalog loads the package catalog configured for the project, if any.
+func (d *Devbox) catalog() (*Catalog, error) {
+	location := d.cfg.Catalog
+	if location == "" {
+		location = os.Getenv(catalogEnvVar)
+	}
+	if location == "" {
+		return nil, nil
+	}
+	return readCatalog(location, d.projectDir)
+}
+
+// readCatalog reads a catalog from a URL or a file path. Relative paths are
+// resolved against projectDir.
+func readCatalog(location, projectDir string) (*Catalog, error) {
+	var (
+		data []byte
+		ext  string
+		err  error
+	)
+	if u, parseErr := url.Parse(location); parseErr == nil && (u.Scheme == "http" || u.Scheme == "https") {
+		data, err = fetchCatalog(u)
+		ext = filepath.Ext(u.Path)
+	} else {
+		if !filepath.IsAbs(location) {
+			location = filepath.Join(projectDir, location)
+		}
+		data, err = os.ReadFile(location)
+		ext = filepath.Ext(location)
+	}
+	if err != nil {
+		return nil, usererr.WithUserMessage(err, "Unable to read the package catalog at %s", location)
+	}
+	if !cuecfg.IsSupportedExtension(ext) {
+		ext = ".json"
+	}
+
+	catalog := &Catalog{}
+	if err := cuecfg.Unmarshal(data, ext, catalog); err != nil {
+		return nil, usererr.WithUserMessage(err, "Unable to parse the package catalog at %s", location)
+	}
+	for name, entry := range catalog.Packages {
+		if entry.Attribute == "" {
+			return nil, usererr.New("Package %q in the catalog at %s has no attribute", name, location)
+		}
+	}
+	return catalog, nil
+}
+
+func fetchCatalog(u *url.URL) ([]byte, error) {
+	res, err := http.Get(u.String())
+	if err != nil {
+		return nil, errors.WithStack(err)
+	}
+	defer res.Body.Close()
+	if res.StatusCode != http.StatusOK {
+		return nil, errors.Errorf("GET %s: %s", u, res.Status)
+	}
+	data, err := io.ReadAll(res.Body)
+	return data, errors.WithStack(err)
+}
+
+// resolvePackages replaces each package that's defined in the project's
+// catalog with the nixpkgs attribute the catalog maps it to. If the catalog
+// pins the attribute to another nixpkgs commit than the project's, the
+// attribute is pinned to that commit in the config. Packages that aren't in
+// the catalog are returned unchanged so that they're looked up in nixpkgs.
+func (d *Devbox) resolvePackages(pkgs []string) ([]string, error) {
+	catalog, err := d.catalog()
+	if err != nil || catalog == nil {
+		return pkgs, err
+	}
+
+	resolved := make([]string, 0, len(pkgs))
+	for _, pkg := range pkgs {
+		entry, ok := catalog.Packages[pkg]
+		if !ok {
+			resolved = append(resolved, pkg)
+			continue
+		}
+		if entry.Commit != "" && entry.Commit != d.cfg.Nixpkgs.Commit {
+			d.cfg.setPackagePin(entry.Attribute, PinnedPackage{Commit: entry.Commit})
+			fmt.Fprintf(d.writer, "Resolved %s to %s from nixpkgs commit %s using the package catalog.\n",
+				pkg, entry.Attribute, entry.Commit)
+		} else {
+			fmt.Fprintf(d.writer, "Resolved %s to %s using the package catalog.\n", pkg, entry.Attribute)
+		}
+		resolved = append(resolved, entry.Attribute)
+	}
+	return resolved, nil
+}
@@ -0,0 +1,107 @@
+// Copyright 2023 Jetpack Technologies Inc and contributors. All rights reserved.
+// Use of this source code is governed by the license in the LICENSE file.
+
+package impl
+
+import (
+	"bytes"
+	"io"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.jetpack.io/devbox/internal/nix"
+)
+
+const testCatalog = `{
+  "packages": {
+    "internal-cli": {"attribute": "ripgrep"},
+    "pinned-cli": {
+      "attribute": "jq",
+      "commit": "af9e00071d0971eb292fd5abef334e66eda3cb69"
+    }
+  }
+}`
+
+func TestResolvePackagesFromCatalog(t *testing.T) {
+	projectDir := t.TempDir()
+	err := os.WriteFile(filepath.Join(projectDir, "catalog.json"), []byte(testCatalog), 0o644)
+	require.NoError(t, err)
+
+	d := &Devbox{
+		cfg:        &Config{Catalog: "catalog.json"},
+		projectDir: projectDir,
+		writer:     &bytes.Buffer{},
+	}
+	d.cfg.Nixpkgs.Commit = "af9e00071d0971eb292fd5abef334e66eda3cb69"
+
+	pkgs, err := d.resolvePackages([]string{"internal-cli", "hello", "pinned-cli"})
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"ripgrep", "hello", "jq"}, pkgs)
+
+	d.cfg.Nixpkgs.Commit = "f80ac848e3d6f0c12c52758c0f25c10c97ca3b62"
+	pkgs, err = d.resolvePackages([]string{"pinned-cli"})
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"jq"}, pkgs)
+	commit, attribute := d.packageRef("jq")
+	assert.Equal(t, "af9e00071d0971eb292fd5abef334e66eda3cb69", commit)
+	assert.Equal(t, "jq", attribute)
+}
+
+func TestAddPinnedCatalogPackage(t *testing.T) {
+	t.Setenv("XDG_DATA_HOME", t.TempDir())
+	installed := []string{}
+	client := profileNix(&installed)
+	lookedUp := map[string]string{}
+	client.pkgInfo = func(commit, pkg string) (*nix.Info, bool) {
+		lookedUp[pkg] = commit
+		return &nix.Info{NixName: pkg, Name: pkg}, true
+	}
+	client.buildPackages = func(w io.Writer, commit string, pkgs ...string) ([]string, error) {
+		return []string{t.TempDir()}, nil
+	}
+	client.pathInfo = func(paths ...string) ([]nix.StorePathInfo, error) {
+		return []nix.StorePathInfo{{Path: paths[0]}}, nil
+	}
+
+	dir := t.TempDir()
+	err := os.WriteFile(filepath.Join(dir, "catalog.json"), []byte(testCatalog), 0o644)
+	require.NoError(t, err)
+	err = os.WriteFile(filepath.Join(dir, configFilename), []byte(`{
+  "packages": [],
+  "catalog": "catalog.json",
+  "nixpkgs": {"commit": "f80ac848e3d6f0c12c52758c0f25c10c97ca3b62"}
+}`), 0o644)
+	require.NoError(t, err)
+	box, err := Open(dir, io.Discard, withNixClient(client))
+	require.NoError(t, err)
+
+	require.NoError(t, box.Add([]string{"pinned-cli", "internal-cli"}))
+	assert.Equal(t, map[string]string{
+		"jq":      "af9e00071d0971eb292fd5abef334e66eda3cb69",
+		"ripgrep": "f80ac848e3d6f0c12c52758c0f25c10c97ca3b62",
+	}, lookedUp)
+
+	cfg, err := ReadConfig(filepath.Join(dir, configFilename))
+	require.NoError(t, err)
+	assert.Equal(t, []string{"jq", "ripgrep"}, cfg.RawPackages)
+	pin, ok := cfg.pinnedPackage("jq")
+	assert.True(t, ok)
+	assert.Equal(t, "af9e00071d0971eb292fd5abef334e66eda3cb69", pin.Commit)
+	_, ok = cfg.pinnedPackage("ripgrep")
+	assert.False(t, ok)
+}
+
+func TestResolvePackagesFromCatalogEnv(t *testing.T) {
+	catalogPath := filepath.Join(t.TempDir(), "catalog.json")
+	err := os.WriteFile(catalogPath, []byte(testCatalog), 0o644)
+	require.NoError(t, err)
+	t.Setenv(catalogEnvVar, catalogPath)
+
+	d := &Devbox{cfg: &Config{}, projectDir: t.TempDir(), writer: &bytes.Buffer{}}
+	pkgs, err := d.resolvePackages([]string{"internal-cli"})
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"ripgrep"}, pkgs)
+}
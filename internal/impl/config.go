@@ -14,12 +14,15 @@ import (
 
 	"github.com/pkg/errors"
 	"github.com/samber/lo"
+	"go.jetpack.io/devbox/internal/boxcli/generate"
 	"go.jetpack.io/devbox/internal/boxcli/usererr"
 	"go.jetpack.io/devbox/internal/cuecfg"
 	"go.jetpack.io/devbox/internal/debug"
 	"go.jetpack.io/devbox/internal/impl/shellcmd"
+	"go.jetpack.io/devbox/internal/nix"
 	"go.jetpack.io/devbox/internal/planner/plansdk"
 	"go.jetpack.io/devbox/internal/ux"
+	"golang.org/x/exp/slices"
 )
 
 // Config defines a devbox environment as JSON.
@@ -29,21 +32,179 @@ type Config struct {
 	// It's differentiated from Packages() which also includes global packages.
 	RawPackages []string `cue:"[...string]" json:"packages"`
 
+	// PackageGroups are named sets of packages, like "docs" or "ci", that
+	// are only installed when a command activates them with --with.
+	PackageGroups map[string][]string `json:"package_groups,omitempty"`
+
 	// Env allows specifying env variables
 	Env map[string]string `json:"env,omitempty"`
+	// EnvFile is a dotenv file, relative to devbox.json, whose variables are
+	// added to the environment and can be referenced in Env. It defaults to
+	// .env, and it's fine if it doesn't exist.
+	EnvFile string `json:"env_file,omitempty"`
 	// Shell configures the devbox shell environment.
 	Shell struct {
 		// InitHook contains commands that will run at shell startup.
-		InitHook shellcmd.Commands             `json:"init_hook,omitempty"`
-		Scripts  map[string]*shellcmd.Commands `json:"scripts,omitempty"`
+		InitHook shellcmd.Commands `json:"init_hook,omitempty"`
+		// BeforeInit runs before devbox installs the project's packages,
+		// in both devbox shell and devbox run. The variables it exports,
+		// such as a token for a private binary cache, apply to installing
+		// the packages and to the environment.
+		BeforeInit *shellcmd.Commands `json:"before_init,omitempty"`
+		// PreInitHook runs before devbox sets up the shell's environment
+		// and before any other hook.
+		PreInitHook *shellcmd.Commands `json:"pre_init_hook,omitempty"`
+		// ShellHook runs after InitHook, but only in interactive shells.
+		ShellHook *shellcmd.Commands `json:"shell_hook,omitempty"`
+		// RunHook runs after InitHook, but only for devbox run.
+		RunHook *shellcmd.Commands `json:"run_hook,omitempty"`
+		Scripts map[string]*Script `json:"scripts,omitempty"`
+		// ScriptCwd selects the directory that scripts run in. See
+		// ScriptCwdRoot and ScriptCwdNearest.
+		ScriptCwd string `json:"script_cwd,omitempty"`
+		// TerminalTitle sets the terminal title, and the tmux or screen
+		// window name, to the project's name in interactive shells.
+		TerminalTitle bool `json:"terminal_title,omitempty"`
+		// Prompt is prepended to the prompt of interactive shells instead
+		// of "(devbox)". If it's empty, the prompt isn't changed.
+		Prompt *string `json:"prompt,omitempty"`
+		// InheritRC sources the user's shellrc after the Nix environment
+		// is set up, instead of before it, without letting it change
+		// PATH.
+		InheritRC bool `json:"inherit_rc,omitempty"`
+		// ExportArrays keeps the array variables from the Nix environment,
+		// such as those set by setup hooks, as space-separated lists of
+		// shell-quoted words instead of dropping them.
+		ExportArrays bool `json:"export_arrays,omitempty"`
+		// HistoryFile is where interactive shells keep their command
+		// history, relative to devbox.json. It defaults to
+		// .devbox/shell_history.
+		HistoryFile string `json:"history_file,omitempty"`
+		// StrictPluginHooks checks each command in the init hooks of
+		// plugins. If one fails, devbox run reports which plugin's hook
+		// failed and stops, and interactive shells report it.
+		StrictPluginHooks bool `json:"strict_plugin_hooks,omitempty"`
+		// DefaultTimeout is how long scripts may run, as a duration such
+		// as "10m", unless they set their own timeout.
+		DefaultTimeout string `json:"default_timeout,omitempty"`
 	} `json:"shell,omitempty"`
 
 	// Nixpkgs specifies the repository to pull packages from
 	Nixpkgs NixpkgsConfig `json:"nixpkgs,omitempty"`
+
+	// BinaryCaches are nix caches, such as a team's Cachix or S3 cache, to
+	// download packages from in addition to the user's configured caches.
+	BinaryCaches []nix.BinaryCache `json:"binary_caches,omitempty"`
+
+	// ExtendsParent layers this project on top of the nearest devbox project
+	// in a parent directory, so that the parent's packages and env are also
+	// available.
+	ExtendsParent bool `json:"extends_parent,omitempty"`
+
+	// Extends lists devbox.json files to use as base configs, relative to
+	// this one. Their packages, env, scripts and init hooks are merged into
+	// this config, with later bases and this config taking precedence.
+	Extends []string `cue:"[...string]" json:"extends,omitempty"`
+
+	// Catalog is the path or URL of a package catalog that maps package names
+	// to nixpkgs attributes. It overrides the DEVBOX_CATALOG env variable.
+	Catalog string `json:"catalog,omitempty"`
+
+	// AllowUnfree allows packages with unfree licenses. It defaults to true.
+	// When it's false, only the packages in UnfreePackages can be unfree.
+	AllowUnfree *bool `json:"allow_unfree,omitempty"`
+	// UnfreePackages lists unfree packages that are allowed even when
+	// AllowUnfree is false.
+	UnfreePackages []string `cue:"[...string]" json:"unfree_packages,omitempty"`
+
+	// ProcessCompose configures the process manager that
+	// `devbox services manager` starts.
+	ProcessCompose *ProcessComposeConfig `json:"process_compose,omitempty"`
+
+	// TrustedPublicKeys are the keys that devbox packages verify-signatures
+	// accepts signatures from. If empty, nix's trusted-public-keys are used.
+	TrustedPublicKeys []string `cue:"[...string]" json:"trusted_public_keys,omitempty"`
+
+	// Devcontainer adds VS Code extensions, settings and a post-create
+	// command to the devcontainer.json that devbox generate devcontainer
+	// writes.
+	Devcontainer *DevcontainerConfig `json:"devcontainer,omitempty"`
+
+	// Telemetry, when false, opts out of devbox's anonymous usage telemetry
+	// for this project. Setting it in the global devbox.json opts out for
+	// every project.
+	Telemetry *bool `json:"telemetry,omitempty"`
+
+	// packagePins are the nixpkgs commits of the packages that override
+	// Nixpkgs.Commit in devbox.json, keyed by package name. Packages with a
+	// version, such as "nodejs@18", also record the attribute and version
+	// they resolved to. See packageEntry.
+	packagePins map[string]PinnedPackage
+
+	// packagePlatforms are the nix systems that packages are restricted to
+	// in devbox.json, keyed by package name. See packageEntry.
+	packagePlatforms map[string][]string
+
+	// parent is the config of the nearest devbox project in a parent
+	// directory. It's only set when ExtendsParent is true.
+	parent *Config
+
+	// bases are the configs listed in Extends, in the same order.
+	bases []*Config
+}
+
+// restrictUnfree reports whether the config only allows the unfree packages
+// in UnfreePackages.
+func (c *Config) restrictUnfree() bool {
+	return c.AllowUnfree != nil && !*c.AllowUnfree
+}
+
+// unfreeAllowed reports whether pkg can be installed if it has an unfree
+// license.
+func (c *Config) unfreeAllowed(pkg string) bool {
+	return !c.restrictUnfree() || slices.Contains(c.UnfreePackages, pkg)
 }
 
 type NixpkgsConfig struct {
 	Commit string `json:"commit,omitempty"`
+	// Channel is a nixpkgs channel, like nixos-23.05, that Commit was
+	// resolved from. If it's set without a commit, devbox resolves it to the
+	// channel's latest commit, and devbox update moves Commit to the latest
+	// commit of the channel instead of nixpkgs-unstable.
+	Channel string `json:"channel,omitempty"`
+}
+
+// updateChannel returns the channel that devbox update takes the latest commit
+// from.
+func (n NixpkgsConfig) updateChannel() string {
+	if n.Channel != "" {
+		return n.Channel
+	}
+	return nix.UnstableChannel
+}
+
+// ProcessComposeConfig configures process-compose for a project.
+type ProcessComposeConfig struct {
+	// Port is the port that process-compose serves its API on. Projects
+	// whose process managers run at the same time need different ports.
+	Port int `json:"port,omitempty"`
+	// File is a process-compose.yaml, relative to devbox.json, that's loaded
+	// after the plugins' files so that it can add processes or override
+	// theirs.
+	File string `json:"file,omitempty"`
+}
+
+// DevcontainerConfig is the devcontainer block of devbox.json.
+type DevcontainerConfig struct {
+	// Extensions are the IDs of VS Code extensions to install in the
+	// container, like "golang.go".
+	Extensions []string `cue:"[...string]" json:"extensions,omitempty"`
+	// Settings are VS Code settings for the container. They override the
+	// settings that devbox picks for the project's packages.
+	Settings map[string]any `json:"settings,omitempty"`
+	// PostCreateCommand runs in the container after it's created, such as
+	// to install the project's dependencies.
+	PostCreateCommand *shellcmd.Commands `json:"post_create_command,omitempty"`
 }
 
 // This contains a subset of fields from plansdk.Stage
@@ -54,13 +215,14 @@ type Stage struct {
 var commitMismatchWarningShown = false
 
 func (c *Config) Packages(w io.Writer) []string {
+	local := c.localPackages()
 	dataPath, err := GlobalDataPath()
 	if err != nil {
 		ux.Ferror(w, "unable to get devbox global data path: %s\n", err)
 	}
 	global, err := readConfig(filepath.Join(dataPath, "devbox.json"))
 	if err != nil {
-		return c.RawPackages
+		return local
 	}
 	if c.Nixpkgs.Commit != global.Nixpkgs.Commit && !commitMismatchWarningShown {
 		commitMismatchWarningShown = true
@@ -69,15 +231,286 @@ func (c *Config) Packages(w io.Writer) []string {
 				"Will use the local version. This may lead to version mismatch and "+
 				"nix store bloat.\n")
 	}
-	return lo.Uniq(append(c.RawPackages, global.RawPackages...))
+	return lo.Uniq(append(local, lo.Filter(global.RawPackages, func(pkg string, _ int) bool {
+		return global.supportsSystem(pkg)
+	})...))
+}
+
+// layers returns the configs that make up this one, from the lowest
+// precedence to the highest: the parent project it extends, then the configs
+// in Extends, then the config itself. Each of those is expanded into its own
+// layers, and configs that are reached more than once are only included the
+// first time.
+func (c *Config) layers() []*Config {
+	layers := []*Config{}
+	add := func(cfg *Config) {
+		for _, l := range cfg.layers() {
+			if !slices.Contains(layers, l) {
+				layers = append(layers, l)
+			}
+		}
+	}
+	if c.parent != nil {
+		add(c.parent)
+	}
+	for _, base := range c.bases {
+		add(base)
+	}
+	return append(layers, c)
+}
+
+// localPackages returns the project's packages followed by the packages of
+// the configs it extends. Packages that are restricted to other systems are
+// left out.
+func (c *Config) localPackages() []string {
+	pkgs := []string{}
+	layers := c.layers()
+	for i := len(layers) - 1; i >= 0; i-- {
+		for _, pkg := range layers[i].RawPackages {
+			if layers[i].supportsSystem(pkg) {
+				pkgs = append(pkgs, pkg)
+			}
+		}
+	}
+	return lo.Uniq(pkgs)
+}
+
+// packageGroups returns the package groups defined in the config and in the
+// configs it extends. A group has the packages of every layer that defines
+// it.
+func (c *Config) packageGroups() map[string][]string {
+	groups := map[string][]string{}
+	for _, l := range c.layers() {
+		for name, pkgs := range l.PackageGroups {
+			groups[name] = lo.Uniq(append(groups[name], pkgs...))
+		}
+	}
+	return groups
+}
+
+// groupPackages returns the packages in the given package groups.
+func (c *Config) groupPackages(groups []string) []string {
+	all := c.packageGroups()
+	pkgs := []string{}
+	for _, group := range groups {
+		pkgs = append(pkgs, all[group]...)
+	}
+	return lo.Uniq(pkgs)
+}
+
+// env returns the env variables defined in the config, layered on top of the
+// env of the configs it extends.
+func (c *Config) env() map[string]string {
+	env := map[string]string{}
+	for _, l := range c.layers() {
+		for k, v := range l.Env {
+			env[k] = v
+		}
+	}
+	return env
+}
+
+// scripts returns the scripts defined in the config and in the configs it
+// extends. A script overrides any script with the same name in the configs
+// it extends.
+func (c *Config) scripts() map[string]*Script {
+	scripts := map[string]*Script{}
+	for _, l := range c.layers() {
+		for name, script := range l.Shell.Scripts {
+			scripts[name] = script
+		}
+	}
+	return scripts
+}
+
+// initHook returns the init hooks of the configs that this one extends,
+// followed by its own.
+func (c *Config) initHook() string {
+	return c.layeredHook(func(l *Config) *shellcmd.Commands { return &l.Shell.InitHook })
+}
+
+// preInitHook is like initHook, for the pre-init hooks.
+func (c *Config) preInitHook() string {
+	return c.layeredHook(func(l *Config) *shellcmd.Commands { return l.Shell.PreInitHook })
+}
+
+// beforeInitHook is like initHook, for the before_init hooks.
+func (c *Config) beforeInitHook() string {
+	return c.layeredHook(func(l *Config) *shellcmd.Commands { return l.Shell.BeforeInit })
+}
+
+// shellHook is like initHook, for the hooks of interactive shells.
+func (c *Config) shellHook() string {
+	return c.layeredHook(func(l *Config) *shellcmd.Commands { return l.Shell.ShellHook })
+}
+
+// runHook is like initHook, for the hooks of devbox run.
+func (c *Config) runHook() string {
+	return c.layeredHook(func(l *Config) *shellcmd.Commands { return l.Shell.RunHook })
+}
+
+// binaryCaches returns the binary caches of the configs that this one
+// extends, followed by its own, without duplicates.
+func (c *Config) binaryCaches() []nix.BinaryCache {
+	caches := []nix.BinaryCache{}
+	for _, l := range c.layers() {
+		for _, cache := range l.BinaryCaches {
+			if !slices.Contains(caches, cache) {
+				caches = append(caches, cache)
+			}
+		}
+	}
+	return caches
+}
+
+// devcontainerOptions merges the devcontainer blocks of the configs that this
+// one extends with its own. Later layers' settings take precedence, and their
+// post-create commands run last.
+func (c *Config) devcontainerOptions() generate.DevcontainerOptions {
+	opts := generate.DevcontainerOptions{}
+	for _, l := range c.layers() {
+		if l.Devcontainer == nil {
+			continue
+		}
+		for _, ext := range l.Devcontainer.Extensions {
+			if !slices.Contains(opts.Extensions, ext) {
+				opts.Extensions = append(opts.Extensions, ext)
+			}
+		}
+		for k, v := range l.Devcontainer.Settings {
+			if opts.Settings == nil {
+				opts.Settings = map[string]any{}
+			}
+			opts.Settings[k] = v
+		}
+	}
+	opts.PostCreateCommand = c.layeredHook(func(l *Config) *shellcmd.Commands {
+		if l.Devcontainer == nil {
+			return nil
+		}
+		return l.Devcontainer.PostCreateCommand
+	})
+	return opts
+}
+
+// layeredHook joins the hook that get returns for each of the config's
+// layers, from the configs it extends to the config itself. get returns nil
+// if a layer doesn't have the hook.
+func (c *Config) layeredHook(get func(*Config) *shellcmd.Commands) string {
+	hooks := []string{}
+	for _, l := range c.layers() {
+		if hook := get(l); hook != nil && hook.String() != "" {
+			hooks = append(hooks, hook.String())
+		}
+	}
+	return strings.Join(hooks, "\n")
+}
+
+// loadParentConfigs follows extends_parent up the directory tree and sets
+// the parent of each config that extends one.
+func loadParentConfigs(cfg *Config, projectDir string) error {
+	visited := map[string]bool{}
+	for cur, dir := cfg, projectDir; cur.ExtendsParent; {
+		realDir, err := filepath.EvalSymlinks(dir)
+		if err != nil {
+			return errors.WithStack(err)
+		}
+		visited[realDir] = true
+
+		parentDir, err := findProjectDirFromParentDirSearch("/", filepath.Dir(realDir))
+		if err != nil {
+			return usererr.New(
+				"%s sets extends_parent, but no devbox.json was found in any of its parent directories",
+				filepath.Join(dir, configFilename),
+			)
+		}
+		realParentDir, err := filepath.EvalSymlinks(parentDir)
+		if err != nil {
+			return errors.WithStack(err)
+		}
+		if visited[realParentDir] {
+			return usererr.New(
+				"extends_parent in %s refers back to a project it's already extending",
+				filepath.Join(dir, configFilename),
+			)
+		}
+
+		parentConfigPath, _ := findConfigFile(parentDir)
+		parent, err := ReadConfig(parentConfigPath)
+		if err != nil {
+			return err
+		}
+		if err := loadExtendedConfigs(parent, parentConfigPath); err != nil {
+			return err
+		}
+		cur.parent = parent
+		cur, dir = parent, parentDir
+	}
+	return nil
+}
+
+// loadExtendedConfigs reads the configs in the Extends field of cfg, which was
+// read from path, and the configs that they extend in turn.
+func loadExtendedConfigs(cfg *Config, path string) error {
+	return loadBaseConfigs(cfg, path, nil, map[string]*Config{})
+}
+
+// loadBaseConfigs sets the bases of cfg. chain holds the real paths of the
+// configs that led to cfg, to detect cycles, and loaded caches the configs
+// that were already read so that a config extended by several others is only
+// read once.
+func loadBaseConfigs(cfg *Config, path string, chain []string, loaded map[string]*Config) error {
+	realPath, err := filepath.EvalSymlinks(path)
+	if err != nil {
+		return errors.WithStack(err)
+	}
+	chain = append(chain, realPath)
+
+	cfg.bases = nil
+	for _, ext := range cfg.Extends {
+		basePath := ext
+		if !filepath.IsAbs(basePath) {
+			basePath = filepath.Join(filepath.Dir(path), basePath)
+		}
+		if fi, err := os.Stat(basePath); err == nil && fi.IsDir() {
+			basePath = filepath.Join(basePath, configFilename)
+		}
+		realBasePath, err := filepath.EvalSymlinks(basePath)
+		if err != nil {
+			return usererr.New("%s extends %s, which doesn't exist", path, ext)
+		}
+		if i := slices.Index(chain, realBasePath); i >= 0 {
+			return usererr.New(
+				"devbox.json files can't extend each other in a cycle: %s",
+				strings.Join(append(chain[i:], realBasePath), " -> "),
+			)
+		}
+
+		base, ok := loaded[realBasePath]
+		if !ok {
+			base, err = ReadConfig(basePath)
+			if err != nil {
+				return err
+			}
+			if err := loadBaseConfigs(base, basePath, chain, loaded); err != nil {
+				return err
+			}
+			loaded[realBasePath] = base
+		}
+		cfg.bases = append(cfg.bases, base)
+	}
+	return nil
 }
 
 func readConfig(path string) (*Config, error) {
-	cfg := &Config{}
-	err := cuecfg.ParseFile(path, cfg)
+	data, err := os.ReadFile(path)
 	if err != nil {
 		return nil, errors.WithStack(err)
 	}
+	cfg := &Config{}
+	if err := unmarshalConfig(data, filepath.Ext(path), cfg); err != nil {
+		return nil, errors.WithStack(err)
+	}
 	return cfg, nil
 }
 
@@ -93,6 +526,31 @@ func ReadConfig(path string) (*Config, error) {
 	return cfg, err
 }
 
+// TelemetryDisabled reports whether the devbox config at path, or the global
+// devbox config, sets "telemetry" to false. It reads the configs directly,
+// without fetching remote configs or upgrading them, so that it's cheap to
+// check before every command.
+func TelemetryDisabled(path string) bool {
+	paths := []string{}
+	if dataPath, err := GlobalDataPath(); err == nil {
+		paths = append(paths, filepath.Join(dataPath, configFilename))
+	}
+	if !isRemoteConfig(path) {
+		if projectDir, err := findProjectDir(path); err == nil {
+			if cfgPath, err := configPathForOpen(path, projectDir, io.Discard); err == nil {
+				paths = append(paths, cfgPath)
+			}
+		}
+	}
+	for _, p := range paths {
+		cfg, err := readConfig(p)
+		if err == nil && cfg.Telemetry != nil && !*cfg.Telemetry {
+			return true
+		}
+	}
+	return false
+}
+
 func readConfigFromURL(url *url.URL) (*Config, error) {
 	res, err := http.Get(url.String())
 	if err != nil {
@@ -108,10 +566,19 @@ func readConfigFromURL(url *url.URL) (*Config, error) {
 	if !cuecfg.IsSupportedExtension(ext) {
 		ext = ".json"
 	}
-	return cfg, cuecfg.Unmarshal(data, ext, cfg)
+	return cfg, unmarshalConfig(data, ext, cfg)
 }
 
-func upgradeConfig(cfg *Config, absFilePath string) error {
+func upgradeConfig(cfg *Config, absFilePath string, client nixClient) error {
+	if cfg.Nixpkgs.Commit == "" && cfg.Nixpkgs.Channel != "" {
+		commit, err := resolveNixpkgsChannel(client, cfg.Nixpkgs.Channel)
+		if err != nil {
+			return err
+		}
+		debug.Log("Resolved nixpkgs channel %s to commit %s", cfg.Nixpkgs.Channel, commit)
+		cfg.Nixpkgs.Commit = commit
+		return WriteConfig(absFilePath, cfg)
+	}
 	if cfg.Nixpkgs.Commit == "" {
 		debug.Log("Missing nixpkgs.version from config, so adding the default value of %s",
 			plansdk.DefaultNixpkgsCommit)
@@ -128,7 +595,11 @@ func WriteConfig(path string, cfg *Config) error {
 	if err != nil {
 		return err
 	}
-	return cuecfg.WriteFile(path, cfg)
+	data, err := marshalConfig(cfg, filepath.Ext(path))
+	if err != nil {
+		return err
+	}
+	return errors.WithStack(os.WriteFile(path, data, 0644))
 }
 
 // findProjectDir walks up the directory tree looking for a devbox.json
@@ -160,7 +631,7 @@ func findProjectDirAtPath(absPath string) (string, error) {
 
 	switch mode := fi.Mode(); {
 	case mode.IsDir():
-		if !plansdk.FileExists(filepath.Join(absPath, configFilename)) {
+		if !hasConfigFile(absPath) {
 			return "", missingConfigError(absPath, false /*didCheckParents*/)
 		}
 		return absPath, nil
@@ -179,12 +650,12 @@ func findProjectDirFromParentDirSearch(root string, absPath string) (string, err
 	// Search parent directories for a devbox.json
 	for cur != root {
 		debug.Log("finding %s in dir: %s\n", configFilename, cur)
-		if plansdk.FileExists(filepath.Join(cur, configFilename)) {
+		if hasConfigFile(cur) {
 			return cur, nil
 		}
 		cur = filepath.Dir(cur)
 	}
-	if plansdk.FileExists(filepath.Join(cur, configFilename)) {
+	if hasConfigFile(cur) {
 		return cur, nil
 	}
 	return "", missingConfigError(absPath, true /*didCheckParents*/)
@@ -225,6 +696,9 @@ func validateConfig(cfg *Config) error {
 	fns := [](func(cfg *Config) error){
 		validateNixpkg,
 		validateScripts,
+		validateProcessCompose,
+		validateBinaryCaches,
+		validatePackageGroups,
 	}
 
 	for _, fn := range fns {
@@ -235,9 +709,31 @@ func validateConfig(cfg *Config) error {
 	return nil
 }
 
+func validateBinaryCaches(cfg *Config) error {
+	for _, cache := range cfg.BinaryCaches {
+		if err := cache.Validate(); err != nil {
+			return errors.Wrap(err, "invalid binary_caches in devbox.json")
+		}
+	}
+	return nil
+}
+
 var whitespace = regexp.MustCompile(`\s`)
 
 func validateScripts(cfg *Config) error {
+	switch cfg.Shell.ScriptCwd {
+	case "", ScriptCwdRoot, ScriptCwdNearest:
+	default:
+		return errors.Errorf(
+			"invalid script_cwd %q in devbox.json: must be %q or %q",
+			cfg.Shell.ScriptCwd, ScriptCwdRoot, ScriptCwdNearest,
+		)
+	}
+	if cfg.Shell.DefaultTimeout != "" {
+		if _, err := parseTimeout(cfg.Shell.DefaultTimeout); err != nil {
+			return errors.Wrap(err, "invalid default_timeout in devbox.json")
+		}
+	}
 	for k := range cfg.Shell.Scripts {
 		if strings.TrimSpace(k) == "" {
 			return errors.New("cannot have script with empty name in devbox.json")
@@ -248,22 +744,124 @@ func validateScripts(cfg *Config) error {
 		if strings.TrimSpace(cfg.Shell.Scripts[k].String()) == "" {
 			return errors.Errorf("cannot have an empty script body in devbox.json: %s", k)
 		}
+		for _, pkg := range cfg.Shell.Scripts[k].Requires {
+			if strings.TrimSpace(pkg) == "" {
+				return errors.Errorf("cannot have an empty required package in devbox.json script: %s", k)
+			}
+		}
+		seenArgs := map[string]bool{}
+		for _, arg := range cfg.Shell.Scripts[k].Args {
+			if !envVarName.MatchString(arg.Name) {
+				return errors.Errorf(
+					"script %s in devbox.json has an invalid argument name %q: must be a valid environment variable name", k, arg.Name)
+			}
+			if seenArgs[arg.Name] {
+				return errors.Errorf("script %s in devbox.json declares argument %q more than once", k, arg.Name)
+			}
+			seenArgs[arg.Name] = true
+		}
+		for env, override := range cfg.Shell.Scripts[k].Environments {
+			if strings.TrimSpace(env) == "" || whitespace.MatchString(env) || strings.Contains(env, "/") {
+				return errors.Errorf(
+					"script %s in devbox.json has an invalid environment name %q: "+
+						"must be non-empty and can't contain whitespace or slashes", k, env)
+			}
+			if _, ok := cfg.Shell.Scripts[environmentScriptName(k, env)]; ok {
+				return errors.Errorf(
+					"script %s in devbox.json conflicts with the %s override of script %s",
+					environmentScriptName(k, env), env, k)
+			}
+			if strings.TrimSpace(override.Command.String()) == "" {
+				return errors.Errorf("cannot have an empty %s override of script %s in devbox.json", env, k)
+			}
+		}
+		if timeout := cfg.Shell.Scripts[k].Timeout; timeout != "" {
+			if _, err := parseTimeout(timeout); err != nil {
+				return errors.Wrapf(err, "script %s in devbox.json", k)
+			}
+		}
 	}
 	return nil
 }
 
-func validateNixpkg(cfg *Config) error {
-	if cfg.Nixpkgs.Commit == "" {
+func validatePackageGroups(cfg *Config) error {
+	for name, pkgs := range cfg.PackageGroups {
+		if name == "" || whitespace.MatchString(name) || strings.Contains(name, ",") {
+			return usererr.New(
+				"package_groups in devbox.json has an invalid group name %q: it can't be empty or have commas or spaces",
+				name)
+		}
+		for _, pkg := range pkgs {
+			if strings.TrimSpace(pkg) == "" {
+				return usererr.New("Package group %s in devbox.json has an empty package", name)
+			}
+		}
+	}
+	return nil
+}
+
+func validateProcessCompose(cfg *Config) error {
+	if cfg.ProcessCompose == nil {
 		return nil
 	}
+	if port := cfg.ProcessCompose.Port; port < 0 || port > 65535 {
+		return usererr.New("process_compose.port in devbox.json must be between 1 and 65535, but it's %d", port)
+	}
+	return nil
+}
+
+// nixpkgsChannelRegex matches the names of nixpkgs channels, like nixos-23.05
+// or nixpkgs-unstable.
+var nixpkgsChannelRegex = regexp.MustCompile(`^[a-z0-9][a-z0-9.-]*$`)
 
+func validateNixpkg(cfg *Config) error {
 	const commitLength = 40
-	if len(cfg.Nixpkgs.Commit) != commitLength {
+	if cfg.Nixpkgs.Channel != "" && !nixpkgsChannelRegex.MatchString(cfg.Nixpkgs.Channel) {
+		return usererr.New(
+			"nixpkgs.channel %q isn't a valid channel name. Channels are named like nixos-23.05 or nixpkgs-unstable",
+			cfg.Nixpkgs.Channel,
+		)
+	}
+	if cfg.Nixpkgs.Commit != "" && len(cfg.Nixpkgs.Commit) != commitLength {
 		return usererr.New(
 			"Expected nixpkgs.commit to be of length %d but it has length %d",
 			commitLength,
 			len(cfg.Nixpkgs.Commit),
 		)
 	}
+	for pkg, pin := range cfg.packagePins {
+		if pin.Commit == "" {
+			return usererr.New("Package %s sets an attribute or version without a commit in devbox.json", pkg)
+		}
+		if len(pin.Commit) != commitLength {
+			return usererr.New(
+				"Expected the commit of package %s to be of length %d but it has length %d",
+				pkg,
+				commitLength,
+				len(pin.Commit),
+			)
+		}
+		if _, _, ok := parseVersionedPackage(pkg); ok && pin.Attribute == "" {
+			return usererr.New(
+				"Package %s has a version, so its commit in devbox.json also needs an attribute", pkg)
+		}
+	}
+	for pkg, platforms := range cfg.packagePlatforms {
+		if err := validatePlatforms(platforms); err != nil {
+			return usererr.New("Package %s in devbox.json has invalid platforms: %s", pkg, err)
+		}
+	}
+	return nil
+}
+
+// validatePlatforms returns an error if platforms has a system that devbox
+// doesn't run on.
+func validatePlatforms(platforms []string) error {
+	for _, platform := range platforms {
+		if !slices.Contains(nix.Systems, platform) {
+			return errors.Errorf(
+				"unknown platform %q, expected one of %s", platform, strings.Join(nix.Systems, ", "))
+		}
+	}
 	return nil
 }
@@ -1,11 +1,21 @@
 package impl
 
 import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
 	"os"
 	"path/filepath"
 	"testing"
 
+	"github.com/pkg/errors"
+	"github.com/samber/lo"
 	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.jetpack.io/devbox/internal/cuecfg"
+	"go.jetpack.io/devbox/internal/nix"
+	"go.jetpack.io/devbox/internal/services"
 )
 
 func TestFindProjectDirFromParentDirSearch(t *testing.T) {
@@ -140,10 +150,13 @@ func TestFindParentDirAtPath(t *testing.T) {
 func TestNixpkgsValidation(t *testing.T) {
 	testCases := map[string]struct {
 		commit   string
+		channel  string
 		isErrant bool
 	}{
-		"invalid_nixpkg_commit": {"1234545", true},
-		"valid_nixpkg_commit":   {"af9e00071d0971eb292fd5abef334e66eda3cb69", false},
+		"invalid_nixpkg_commit":  {"1234545", "", true},
+		"valid_nixpkg_commit":    {"af9e00071d0971eb292fd5abef334e66eda3cb69", "", false},
+		"valid_nixpkg_channel":   {"", "nixos-23.05", false},
+		"invalid_nixpkg_channel": {"", "nixos 23.05", true},
 	}
 
 	for name, testCase := range testCases {
@@ -152,7 +165,8 @@ func TestNixpkgsValidation(t *testing.T) {
 
 			err := validateNixpkg(&Config{
 				Nixpkgs: NixpkgsConfig{
-					Commit: testCase.commit,
+					Commit:  testCase.commit,
+					Channel: testCase.channel,
 				},
 			})
 			if testCase.isErrant {
@@ -163,3 +177,662 @@ func TestNixpkgsValidation(t *testing.T) {
 		})
 	}
 }
+
+func TestNixpkgsChannel(t *testing.T) {
+	const commit = "f80ac848e3d6f0c12c52758c0f25c10c97ca3b62"
+	client := &fakeNix{latestNixpkgsCommit: func(channel string) (string, error) {
+		if channel != "nixos-23.05" {
+			return "", errors.New("404 Not Found")
+		}
+		return commit, nil
+	}}
+
+	dir := t.TempDir()
+	path := filepath.Join(dir, configFilename)
+	err := os.WriteFile(path, []byte(`{"packages": [], "nixpkgs": {"channel": "nixos-23.05"}}`), 0o644)
+	require.NoError(t, err)
+	box, err := Open(dir, io.Discard, withNixClient(client))
+	require.NoError(t, err)
+	assert.Equal(t, NixpkgsConfig{Commit: commit, Channel: "nixos-23.05"}, box.cfg.Nixpkgs)
+	saved, err := ReadConfig(path)
+	require.NoError(t, err)
+	assert.Equal(t, box.cfg.Nixpkgs, saved.Nixpkgs)
+
+	err = os.WriteFile(path, []byte(`{"packages": [], "nixpkgs": {"channel": "nixos-1.0"}}`), 0o644)
+	require.NoError(t, err)
+	_, err = Open(dir, io.Discard, withNixClient(client))
+	assert.ErrorContains(t, err, "nixpkgs channel nixos-1.0")
+	assert.ErrorContains(t, err, "404 Not Found")
+}
+
+func TestProcessComposeConfig(t *testing.T) {
+	assert := assert.New(t)
+	dir := t.TempDir()
+	path := filepath.Join(dir, configFilename)
+	content := `{
+  "packages": [],
+  "process_compose": {
+    "port": 8281,
+    "file": "services/process-compose.yaml"
+  }
+}`
+	assert.NoError(os.WriteFile(path, []byte(content), 0o644))
+
+	cfg, err := ReadConfig(path)
+	assert.NoError(err)
+	d := &Devbox{cfg: cfg, projectDir: dir}
+	opts := d.processManagerOpts()
+	assert.Equal(8281, opts.Port)
+	assert.Equal(filepath.Join(dir, "services", "process-compose.yaml"), opts.File)
+
+	// Without the setting, the process manager uses its defaults.
+	d.cfg = &Config{}
+	assert.Equal(&services.ProcessManagerOpts{}, d.processManagerOpts())
+
+	assert.Error(validateProcessCompose(&Config{ProcessCompose: &ProcessComposeConfig{Port: 70000}}))
+	assert.NoError(validateProcessCompose(&Config{ProcessCompose: &ProcessComposeConfig{File: "pc.yaml"}}))
+}
+
+func TestPackageCommits(t *testing.T) {
+	assert := assert.New(t)
+	path := filepath.Join(t.TempDir(), configFilename)
+	content := `{
+  "packages": [
+    "go",
+    {
+      "name": "python",
+      "commit": "f80ac848e3d6f0c12c52758c0f25c10c97ca3b62"
+    }
+  ],
+  "nixpkgs": {
+    "commit": "af9e00071d0971eb292fd5abef334e66eda3cb69"
+  }
+}`
+	assert.NoError(os.WriteFile(path, []byte(content), 0o644))
+
+	cfg, err := ReadConfig(path)
+	assert.NoError(err)
+	assert.Equal([]string{"go", "python"}, cfg.RawPackages)
+	pin, ok := cfg.pinnedPackage("python")
+	assert.True(ok)
+	assert.Equal("f80ac848e3d6f0c12c52758c0f25c10c97ca3b62", pin.Commit)
+	_, ok = cfg.pinnedPackage("go")
+	assert.False(ok)
+
+	d := &Devbox{cfg: cfg}
+	commit, attribute := d.packageRef("python")
+	assert.Equal("f80ac848e3d6f0c12c52758c0f25c10c97ca3b62", commit)
+	assert.Equal("python", attribute)
+	commit, _ = d.packageRef("go")
+	assert.Equal("af9e00071d0971eb292fd5abef334e66eda3cb69", commit)
+
+	assert.NoError(WriteConfig(path, cfg))
+	cfg, err = ReadConfig(path)
+	assert.NoError(err)
+	assert.Equal([]string{"go", "python"}, cfg.RawPackages)
+	assert.Equal(map[string]PinnedPackage{
+		"python": {Commit: "f80ac848e3d6f0c12c52758c0f25c10c97ca3b62"},
+	}, cfg.packagePins)
+
+	cfg.packagePins["python"] = PinnedPackage{Commit: "1234545"}
+	assert.Error(validateConfig(cfg))
+	cfg.packagePins = map[string]PinnedPackage{"nodejs@18": {Commit: "f80ac848e3d6f0c12c52758c0f25c10c97ca3b62"}}
+	assert.Error(validateConfig(cfg))
+	cfg.packagePins = map[string]PinnedPackage{"nodejs@18": {Attribute: "nodejs-18_x"}}
+	assert.Error(validateConfig(cfg))
+}
+
+func TestVersionedPackageEntry(t *testing.T) {
+	assert := assert.New(t)
+
+	path := filepath.Join(t.TempDir(), configFilename)
+	content := `{
+  "packages": [
+    "go",
+    {
+      "name": "nodejs@18",
+      "version": "18.16.0",
+      "attribute": "nodejs-18_x",
+      "commit": "f80ac848e3d6f0c12c52758c0f25c10c97ca3b62"
+    }
+  ],
+  "nixpkgs": {
+    "commit": "af9e00071d0971eb292fd5abef334e66eda3cb69"
+  }
+}`
+	assert.NoError(os.WriteFile(path, []byte(content), 0o644))
+
+	cfg, err := ReadConfig(path)
+	assert.NoError(err)
+	assert.NoError(validateConfig(cfg))
+	assert.Equal([]string{"go", "nodejs@18"}, cfg.RawPackages)
+
+	d := &Devbox{cfg: cfg}
+	commit, attribute := d.packageRef("nodejs@18")
+	assert.Equal("f80ac848e3d6f0c12c52758c0f25c10c97ca3b62", commit)
+	assert.Equal("nodejs-18_x", attribute)
+
+	assert.NoError(WriteConfig(path, cfg))
+	data, err := os.ReadFile(path)
+	assert.NoError(err)
+	assert.Contains(string(data), `"version": "18.16.0"`)
+	assert.NotContains(string(data), "pinned_packages")
+}
+
+func TestPackagePlatforms(t *testing.T) {
+	assert := assert.New(t)
+	t.Setenv("XDG_DATA_HOME", t.TempDir())
+
+	other := "x86_64-darwin"
+	if nix.System() == other {
+		other = "x86_64-linux"
+	}
+	path := filepath.Join(t.TempDir(), configFilename)
+	content := fmt.Sprintf(`{
+  "packages": [
+    "go",
+    {
+      "name": "strace",
+      "platforms": ["%s"]
+    },
+    {
+      "name": "htop",
+      "platforms": ["%s", "%s"]
+    }
+  ],
+  "shell": {"init_hook": null},
+  "nixpkgs": {}
+}`, other, other, nix.System())
+	assert.NoError(os.WriteFile(path, []byte(content), 0o644))
+
+	cfg, err := ReadConfig(path)
+	assert.NoError(err)
+	assert.Equal([]string{"go", "strace", "htop"}, cfg.RawPackages)
+	assert.Equal([]string{"go", "htop"}, cfg.localPackages())
+	assert.Equal([]string{"go", "htop"}, cfg.Packages(io.Discard))
+
+	assert.NoError(WriteConfig(path, cfg))
+	data, err := os.ReadFile(path)
+	assert.NoError(err)
+	assert.JSONEq(content, string(data))
+
+	cfg.setPackagePlatforms("go", []string{"x86_64-windows"})
+	assert.Error(validateConfig(cfg))
+}
+
+func TestScriptsRoundTrip(t *testing.T) {
+	assert := assert.New(t)
+
+	data := []byte(`{
+  "packages": [],
+  "shell": {
+    "init_hook": null,
+    "scripts": {
+      "build": "go build ./...",
+      "deploy": {
+        "command": "./deploy.sh staging",
+        "environments": {
+          "prod": {
+            "command": "./deploy.sh prod"
+          }
+        }
+      },
+      "lint": {
+        "command": [
+          "golangci-lint run"
+        ],
+        "requires": [
+          "golangci-lint"
+        ],
+        "timeout": "5m",
+        "env": {
+          "GOFLAGS": "-mod=mod"
+        }
+      },
+      "test": [
+        "go test ./..."
+      ]
+    }
+  },
+  "nixpkgs": {}
+}`)
+	cfg := &Config{}
+	err := cuecfg.Unmarshal(data, ".json", cfg)
+	assert.NoError(err)
+
+	assert.Equal("go build ./...", cfg.Shell.Scripts["build"].String())
+	assert.Equal("golangci-lint run", cfg.Shell.Scripts["lint"].String())
+	assert.Equal([]string{"golangci-lint"}, cfg.Shell.Scripts["lint"].Requires)
+	assert.Equal("5m", cfg.Shell.Scripts["lint"].Timeout)
+	assert.Equal(map[string]string{"GOFLAGS": "-mod=mod"}, cfg.Shell.Scripts["lint"].Env)
+	assert.Equal([]string{"prod"}, cfg.Shell.Scripts["deploy"].EnvironmentNames())
+	prod := cfg.Shell.Scripts["deploy"].Environments["prod"]
+	assert.Equal("./deploy.sh prod", prod.Command.String())
+	assert.Empty(cfg.Shell.Scripts["test"].Requires)
+
+	out, err := cuecfg.Marshal(cfg, ".json")
+	assert.NoError(err)
+	assert.JSONEq(string(data), string(out))
+}
+
+func TestShellHooksRoundTrip(t *testing.T) {
+	assert := assert.New(t)
+
+	data := []byte(`{
+  "packages": [],
+  "shell": {
+    "init_hook": "echo init",
+    "pre_init_hook": "echo pre-init",
+    "shell_hook": [
+      "echo shell"
+    ],
+    "run_hook": "echo run"
+  },
+  "nixpkgs": {}
+}`)
+	cfg := &Config{}
+	assert.NoError(cuecfg.Unmarshal(data, ".json", cfg))
+	assert.Equal("echo init", cfg.initHook())
+	assert.Equal("echo pre-init", cfg.preInitHook())
+	assert.Equal("echo shell", cfg.shellHook())
+	assert.Equal("echo run", cfg.runHook())
+
+	out, err := cuecfg.Marshal(cfg, ".json")
+	assert.NoError(err)
+	assert.JSONEq(string(data), string(out))
+
+	// Configs without the new hooks are saved without them.
+	cfg = &Config{}
+	out, err = cuecfg.Marshal(cfg, ".json")
+	assert.NoError(err)
+	assert.NotContains(string(out), "pre_init_hook")
+	assert.Empty(cfg.preInitHook())
+}
+
+func TestScriptEnvironmentsValidation(t *testing.T) {
+	testCases := map[string]struct {
+		scripts  string
+		isErrant bool
+	}{
+		"valid": {
+			`{"deploy": {"command": "a", "environments": {"prod": {"command": "b"}}}}`,
+			false,
+		},
+		"environment_with_whitespace": {
+			`{"deploy": {"command": "a", "environments": {"my prod": {"command": "b"}}}}`,
+			true,
+		},
+		"environment_with_slash": {
+			`{"deploy": {"command": "a", "environments": {"../prod": {"command": "b"}}}}`,
+			true,
+		},
+		"empty_override": {
+			`{"deploy": {"command": "a", "environments": {"prod": {"command": ""}}}}`,
+			true,
+		},
+		"conflicting_script_name": {
+			`{"deploy": {"command": "a", "environments": {"prod": {"command": "b"}}}, "deploy@prod": "c"}`,
+			true,
+		},
+	}
+
+	for name, testCase := range testCases {
+		t.Run(name, func(t *testing.T) {
+			assert := assert.New(t)
+
+			cfg := &Config{}
+			err := json.Unmarshal([]byte(testCase.scripts), &cfg.Shell.Scripts)
+			assert.NoError(err)
+			err = validateScripts(cfg)
+			if testCase.isErrant {
+				assert.Error(err)
+			} else {
+				assert.NoError(err)
+			}
+		})
+	}
+}
+
+func TestExtendsParent(t *testing.T) {
+	assert := assert.New(t)
+	t.Setenv("XDG_DATA_HOME", t.TempDir())
+
+	parentDir := t.TempDir()
+	childDir := filepath.Join(parentDir, "child")
+	assert.NoError(os.Mkdir(childDir, 0o755))
+
+	err := os.WriteFile(filepath.Join(parentDir, configFilename), []byte(`{
+  "packages": ["go", "jq"],
+  "env": {"SHARED": "parent", "PARENT_ONLY": "1"},
+  "nixpkgs": {"commit": "f80ac848e3d6f0c12c52758c0f25c10c97ca3b62"}
+}`), 0o644)
+	assert.NoError(err)
+	err = os.WriteFile(filepath.Join(childDir, configFilename), []byte(`{
+  "packages": ["ripgrep", "jq"],
+  "env": {"SHARED": "child"},
+  "extends_parent": true,
+  "nixpkgs": {"commit": "f80ac848e3d6f0c12c52758c0f25c10c97ca3b62"}
+}`), 0o644)
+	assert.NoError(err)
+
+	box, err := Open(childDir, os.Stdout)
+	assert.NoError(err)
+	assert.Equal([]string{"ripgrep", "jq", "go"}, box.packages())
+	assert.Equal(
+		map[string]string{"SHARED": "child", "PARENT_ONLY": "1"},
+		box.cfg.env(),
+	)
+}
+
+func TestExtendsParentWithoutParent(t *testing.T) {
+	dir := t.TempDir()
+	cfg := &Config{ExtendsParent: true}
+	err := loadParentConfigs(cfg, dir)
+	assert.Error(t, err)
+}
+
+func TestExtends(t *testing.T) {
+	assert := assert.New(t)
+	root := t.TempDir()
+	writeConfig := func(path, content string) {
+		assert.NoError(os.MkdirAll(filepath.Dir(path), 0o755))
+		assert.NoError(os.WriteFile(path, []byte(content), 0o644))
+	}
+	writeConfig(filepath.Join(root, "base", configFilename), `{
+  "packages": ["go", "jq"],
+  "env": {"SHARED": "base", "BASE_ONLY": "1"},
+  "shell": {
+    "init_hook": "echo base",
+    "scripts": {"build": "go build ./...", "test": "go test ./..."}
+  }
+}`)
+	writeConfig(filepath.Join(root, "lint", "lint.json"), `{
+  "packages": ["golangci-lint"],
+  "extends": ["../base"],
+  "shell": {"init_hook": "echo lint", "scripts": {"lint": "golangci-lint run"}}
+}`)
+	projectDir := filepath.Join(root, "project")
+	writeConfig(filepath.Join(projectDir, configFilename), `{
+  "packages": ["ripgrep", "go"],
+  "extends": ["../base/devbox.json", "../lint/lint.json"],
+  "env": {"SHARED": "project"},
+  "shell": {"init_hook": "echo project", "scripts": {"test": "go test -race ./..."}}
+}`)
+
+	box, err := Open(projectDir, os.Stdout)
+	assert.NoError(err)
+	assert.Equal([]string{"ripgrep", "go", "golangci-lint", "jq"}, box.cfg.localPackages())
+	assert.Equal(map[string]string{"SHARED": "project", "BASE_ONLY": "1"}, box.cfg.env())
+	assert.Equal("echo base\necho lint\necho project", box.cfg.initHook())
+	assert.Equal([]ScriptInfo{{Name: "build"}, {Name: "lint"}, {Name: "test"}}, box.ListScripts())
+	assert.Equal("go test -race ./...", box.cfg.scripts()["test"].String())
+}
+
+func TestExtendsErrors(t *testing.T) {
+	testCases := []struct {
+		name    string
+		configs map[string]string
+		errMsg  string
+	}{
+		{
+			name: "missing",
+			configs: map[string]string{
+				"a.json": `{"packages": [], "extends": ["missing.json"]}`,
+			},
+			errMsg: "extends missing.json, which doesn't exist",
+		},
+		{
+			name: "self",
+			configs: map[string]string{
+				"a.json": `{"packages": [], "extends": ["a.json"]}`,
+			},
+			errMsg: "a.json -> ",
+		},
+		{
+			name: "cycle",
+			configs: map[string]string{
+				"a.json": `{"packages": [], "extends": ["b.json"]}`,
+				"b.json": `{"packages": [], "extends": ["c.json"]}`,
+				"c.json": `{"packages": [], "extends": ["a.json"]}`,
+			},
+			errMsg: "b.json -> ",
+		},
+	}
+	for _, testCase := range testCases {
+		t.Run(testCase.name, func(t *testing.T) {
+			dir := t.TempDir()
+			for name, content := range testCase.configs {
+				err := os.WriteFile(filepath.Join(dir, name), []byte(content), 0o644)
+				assert.NoError(t, err)
+			}
+			path := filepath.Join(dir, "a.json")
+			cfg, err := ReadConfig(path)
+			assert.NoError(t, err)
+			err = loadExtendedConfigs(cfg, path)
+			assert.ErrorContains(t, err, testCase.errMsg)
+		})
+	}
+}
+
+func TestExtendsDiamond(t *testing.T) {
+	assert := assert.New(t)
+	dir := t.TempDir()
+	configs := map[string]string{
+		"a.json":    `{"packages": ["a"], "extends": ["b.json", "c.json"]}`,
+		"b.json":    `{"packages": ["b"], "extends": ["base.json"]}`,
+		"c.json":    `{"packages": ["c"], "extends": ["base.json"]}`,
+		"base.json": `{"packages": ["base"], "shell": {"init_hook": "echo base"}}`,
+	}
+	for name, content := range configs {
+		assert.NoError(os.WriteFile(filepath.Join(dir, name), []byte(content), 0o644))
+	}
+	path := filepath.Join(dir, "a.json")
+	cfg, err := ReadConfig(path)
+	assert.NoError(err)
+	assert.NoError(loadExtendedConfigs(cfg, path))
+	assert.Equal([]string{"a", "c", "b", "base"}, cfg.localPackages())
+	assert.Equal("echo base", cfg.initHook())
+}
+
+func TestConfigFormatsRoundTrip(t *testing.T) {
+	testCases := map[string]string{
+		"devbox.yaml": `packages:
+  - go
+  - ripgrep
+env:
+  FOO: bar
+shell:
+  init_hook: echo hello
+  scripts:
+    build: go build ./...
+    lint:
+      command: golangci-lint run
+      requires:
+        - golangci-lint
+nixpkgs:
+  commit: f80ac848e3d6f0c12c52758c0f25c10c97ca3b62
+`,
+		"devbox.toml": `packages = ["go", "ripgrep"]
+
+[env]
+FOO = "bar"
+
+[shell]
+init_hook = "echo hello"
+
+[shell.scripts]
+build = "go build ./..."
+
+[shell.scripts.lint]
+command = "golangci-lint run"
+requires = ["golangci-lint"]
+
+[nixpkgs]
+commit = "f80ac848e3d6f0c12c52758c0f25c10c97ca3b62"
+`,
+	}
+
+	for name, content := range testCases {
+		t.Run(name, func(t *testing.T) {
+			assert := assert.New(t)
+			t.Setenv("XDG_DATA_HOME", t.TempDir())
+			dir := t.TempDir()
+			path := filepath.Join(dir, name)
+			assert.NoError(os.WriteFile(path, []byte(content), 0o644))
+
+			box, err := Open(dir, os.Stdout)
+			assert.NoError(err)
+			assertConfig := func(cfg *Config, pkgs ...string) {
+				assert.Equal(pkgs, cfg.RawPackages)
+				assert.Equal(map[string]string{"FOO": "bar"}, cfg.Env)
+				assert.Equal("echo hello", cfg.Shell.InitHook.String())
+				assert.Equal("go build ./...", cfg.Shell.Scripts["build"].String())
+				assert.Equal("golangci-lint run", cfg.Shell.Scripts["lint"].String())
+				assert.Equal([]string{"golangci-lint"}, cfg.Shell.Scripts["lint"].Requires)
+				assert.Equal("f80ac848e3d6f0c12c52758c0f25c10c97ca3b62", cfg.Nixpkgs.Commit)
+			}
+			assertConfig(box.cfg, "go", "ripgrep")
+
+			box.cfg.RawPackages = append(box.cfg.RawPackages, "jq")
+			assert.NoError(box.saveCfg())
+			assert.NoFileExists(filepath.Join(dir, configFilename))
+
+			cfg, err := ReadConfig(path)
+			assert.NoError(err)
+			assertConfig(cfg, "go", "ripgrep", "jq")
+		})
+	}
+}
+
+func TestFindConfigFilePrefersJSON(t *testing.T) {
+	dir := t.TempDir()
+	for _, name := range []string{"devbox.toml", configFilename} {
+		assert.NoError(t, os.WriteFile(filepath.Join(dir, name), []byte("{}"), 0o644))
+	}
+	path, ignored := findConfigFile(dir)
+	assert.Equal(t, filepath.Join(dir, configFilename), path)
+	assert.Equal(t, []string{filepath.Join(dir, "devbox.toml")}, ignored)
+}
+
+func TestUnfreeAllowed(t *testing.T) {
+	cfg := &Config{}
+	assert.True(t, cfg.unfreeAllowed("vscode"), "unfree packages are allowed by default")
+
+	cfg.AllowUnfree = lo.ToPtr(false)
+	assert.False(t, cfg.unfreeAllowed("vscode"))
+
+	cfg.UnfreePackages = []string{"vscode"}
+	assert.True(t, cfg.unfreeAllowed("vscode"))
+	assert.False(t, cfg.unfreeAllowed("terraform"))
+}
+
+func TestTelemetryDisabled(t *testing.T) {
+	t.Setenv("XDG_DATA_HOME", t.TempDir())
+	projectDir := t.TempDir()
+	writeConfig := func(t *testing.T, path, content string) {
+		require.NoError(t, os.MkdirAll(filepath.Dir(path), 0o755))
+		require.NoError(t, os.WriteFile(path, []byte(content), 0o644))
+	}
+
+	// Without a config, telemetry is on.
+	assert.False(t, TelemetryDisabled(projectDir))
+
+	writeConfig(t, filepath.Join(projectDir, "devbox.json"), `{"packages": []}`)
+	assert.False(t, TelemetryDisabled(projectDir))
+
+	writeConfig(t, filepath.Join(projectDir, "devbox.json"), `{"packages": [], "telemetry": false}`)
+	assert.True(t, TelemetryDisabled(projectDir))
+
+	// Opting out in the global config applies to every project.
+	writeConfig(t, filepath.Join(projectDir, "devbox.json"), `{"packages": [], "telemetry": true}`)
+	assert.False(t, TelemetryDisabled(projectDir))
+	globalDir, err := GlobalDataPath()
+	require.NoError(t, err)
+	writeConfig(t, filepath.Join(globalDir, "devbox.json"), `{"packages": [], "telemetry": false}`)
+	assert.True(t, TelemetryDisabled(projectDir))
+}
+
+func TestConfigWithComments(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "devbox.json")
+	require.NoError(t, os.WriteFile(path, []byte(`{
+  // Pinned because 1.21 breaks the build.
+  "packages": ["go@1.20"],
+  "env": {
+    "GOFLAGS": "-mod=mod", // Until vendoring works.
+  },
+  "nixpkgs": {"commit": "f80ac848e3d6f0c12c52758c0f25c10c97ca3b62"},
+}`), 0o644))
+
+	out := &bytes.Buffer{}
+	d, err := Open(dir, out)
+	require.NoError(t, err)
+	assert.Equal(t, []string{"go@1.20"}, d.cfg.RawPackages)
+	assert.Empty(t, out.String())
+
+	// Only the fields that changed are rewritten, so the comments in the
+	// others are kept.
+	d.cfg.RawPackages = append(d.cfg.RawPackages, "ripgrep")
+	d.cfg.Env["CGO_ENABLED"] = "0"
+	require.NoError(t, d.saveCfg())
+	assert.Contains(t, out.String(), "devbox removed some comments in devbox.json")
+	data, err := os.ReadFile(path)
+	require.NoError(t, err)
+	assert.Equal(t, `{
+  // Pinned because 1.21 breaks the build.
+  "packages": ["go@1.20", "ripgrep"],
+  "env": {
+    "CGO_ENABLED": "0",
+    "GOFLAGS": "-mod=mod"
+  },
+  "nixpkgs": {"commit": "f80ac848e3d6f0c12c52758c0f25c10c97ca3b62"},
+}`, string(data))
+}
+
+func TestBinaryCaches(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "devbox.json")
+	require.NoError(t, os.WriteFile(path, []byte(`{
+  "packages": [],
+  "binary_caches": [{"url": "https://example.cachix.org", "public_key": "example.cachix.org-1:oops"}]
+}`), 0o644))
+	_, err := ReadConfig(path)
+	assert.ErrorContains(t, err, "invalid binary_caches in devbox.json")
+
+	// Extended configs' caches come first, without duplicates.
+	shared := nix.BinaryCache{URL: "https://team.cachix.org"}
+	base := &Config{BinaryCaches: []nix.BinaryCache{shared}}
+	cfg := &Config{
+		BinaryCaches: []nix.BinaryCache{{URL: "s3://project"}, shared},
+		bases:        []*Config{base},
+	}
+	assert.Equal(t, []nix.BinaryCache{shared, {URL: "s3://project"}}, cfg.binaryCaches())
+}
+
+func TestPackageGroups(t *testing.T) {
+	t.Setenv("XDG_DATA_HOME", t.TempDir())
+	dir := t.TempDir()
+	path := filepath.Join(dir, "devbox.json")
+	require.NoError(t, os.WriteFile(path, []byte(`{
+  "packages": [],
+  "package_groups": {"docs tools": ["mdbook"]}
+}`), 0o644))
+	_, err := ReadConfig(path)
+	assert.ErrorContains(t, err, `invalid group name "docs tools"`)
+
+	// Groups with the same name in extended configs are merged.
+	base := &Config{PackageGroups: map[string][]string{"ci": {"act"}, "docs": {"mdbook"}}}
+	cfg := &Config{
+		RawPackages:   []string{"go"},
+		PackageGroups: map[string][]string{"ci": {"shellcheck", "act"}},
+		bases:         []*Config{base},
+	}
+	assert.Equal(t, map[string][]string{"ci": {"act", "shellcheck"}, "docs": {"mdbook"}}, cfg.packageGroups())
+
+	d := &Devbox{cfg: cfg, configPath: path, writer: io.Discard}
+	assert.Equal(t, []string{"go"}, d.packages())
+	err = d.activatePackageGroups([]string{"lint"})
+	assert.ErrorContains(t, err, "devbox.json has no package group named lint. Its groups are: ci, docs")
+	require.NoError(t, d.activatePackageGroups([]string{"docs", "ci"}))
+	assert.Equal(t, []string{"go", "mdbook", "act", "shellcheck"}, d.packages())
+}
@@ -0,0 +1,106 @@
+// Copyright 2023 Jetpack Technologies Inc and contributors. All rights reserved.
+// Use of this source code is governed by the license in the LICENSE file.
+
+package impl
+
+import (
+	"encoding/json"
+	"os"
+	"path/filepath"
+
+	"github.com/pkg/errors"
+	"go.jetpack.io/devbox/internal/cuecfg"
+)
+
+// configFilenames are the names of the files that can define a devbox
+// environment, in order of preference when a directory has more than one.
+var configFilenames = []string{
+	configFilename,
+	"devbox.yaml",
+	"devbox.yml",
+	"devbox.toml",
+}
+
+// findConfigFile returns the path of the config file in dir. If dir has more
+// than one config file, it returns the preferred one and the paths of the
+// others. It returns an empty path if dir has no config file.
+func findConfigFile(dir string) (path string, ignored []string) {
+	for _, name := range configFilenames {
+		p := filepath.Join(dir, name)
+		if _, err := os.Stat(p); err != nil {
+			continue
+		}
+		if path == "" {
+			path = p
+		} else {
+			ignored = append(ignored, p)
+		}
+	}
+	return path, ignored
+}
+
+// hasConfigFile reports whether dir contains a devbox config file in any of
+// the supported formats.
+func hasConfigFile(dir string) bool {
+	path, _ := findConfigFile(dir)
+	return path != ""
+}
+
+// unmarshalConfig parses a config in the format given by ext into cfg.
+//
+// The config's field names and custom decoding (for example, scripts that can
+// be a string, an array or an object) are defined in terms of JSON, so other
+// formats are first decoded into generic values and then converted to JSON.
+func unmarshalConfig(data []byte, ext string, cfg *Config) error {
+	aux := &configJSON{configFields: (*configFields)(cfg)}
+	if ext == ".json" {
+		if err := cuecfg.Unmarshal(data, ext, aux); err != nil {
+			return err
+		}
+		aux.fromJSON()
+		return nil
+	}
+	var generic map[string]any
+	if err := cuecfg.Unmarshal(data, ext, &generic); err != nil {
+		return err
+	}
+	jsonData, err := json.Marshal(generic)
+	if err != nil {
+		return errors.WithStack(err)
+	}
+	if err := cuecfg.Unmarshal(jsonData, ".json", aux); err != nil {
+		return err
+	}
+	aux.fromJSON()
+	return nil
+}
+
+// marshalConfig is the inverse of unmarshalConfig.
+func marshalConfig(cfg *Config, ext string) ([]byte, error) {
+	if ext == ".json" {
+		return cuecfg.Marshal(cfg.toJSON(), ext)
+	}
+	jsonData, err := cuecfg.Marshal(cfg.toJSON(), ".json")
+	if err != nil {
+		return nil, err
+	}
+	var generic map[string]any
+	if err := json.Unmarshal(jsonData, &generic); err != nil {
+		return nil, errors.WithStack(err)
+	}
+	// TOML can't represent nulls, and they're noise in YAML.
+	dropNulls(generic)
+	return cuecfg.Marshal(&generic, ext)
+}
+
+// dropNulls recursively removes keys with null values from m.
+func dropNulls(m map[string]any) {
+	for k, v := range m {
+		switch v := v.(type) {
+		case nil:
+			delete(m, k)
+		case map[string]any:
+			dropNulls(v)
+		}
+	}
+}
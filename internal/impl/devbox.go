@@ -6,15 +6,19 @@ package impl
 
 import (
 	"context"
+	"encoding/json"
 	"fmt"
 	"io"
 	"os"
 	"os/exec"
+	"os/user"
+	"path"
 	"path/filepath"
 	"strconv"
 	"strings"
+	"time"
 
-	"github.com/AlecAivazis/survey/v2"
+	"github.com/alessio/shellescape"
 	"github.com/fatih/color"
 	"github.com/pkg/errors"
 	"github.com/samber/lo"
@@ -29,9 +33,11 @@ import (
 	"go.jetpack.io/devbox/internal/planner"
 	"go.jetpack.io/devbox/internal/planner/plansdk"
 	"go.jetpack.io/devbox/internal/plugin"
+	"go.jetpack.io/devbox/internal/searcher"
 	"go.jetpack.io/devbox/internal/services"
 	"go.jetpack.io/devbox/internal/telemetry"
 	"go.jetpack.io/devbox/internal/ux"
+	"golang.org/x/exp/maps"
 	"golang.org/x/exp/slices"
 )
 
@@ -41,13 +47,78 @@ const (
 
 	// shellHistoryFile keeps the history of commands invoked inside devbox shell
 	shellHistoryFile = ".devbox/shell_history"
+	// runHistoryFile keeps the history of devbox run invocations separate
+	// from the history of interactive shells.
+	runHistoryFile = ".devbox/run_history"
 
 	scriptsDir           = ".devbox/gen/scripts"
 	hooksFilename        = ".hooks"
 	arbitraryCmdFilename = ".cmd"
+
+	// arbitraryCmdBody runs the command in DEVBOX_RUN_CMD. It's quoted so
+	// that the shell doesn't split or glob the command before eval parses
+	// it, which would mangle snippets with newlines or repeated spaces.
+	arbitraryCmdBody = "eval \"$DEVBOX_RUN_CMD\"\n"
 )
 
-func InitConfig(dir string, writer io.Writer) (created bool, err error) {
+// InitOption configures InitConfig.
+type InitOption func(*initOptions)
+
+type initOptions struct {
+	template       string
+	postInitHook   string
+	offerGitignore bool
+}
+
+// WithInitTemplate starts the config from the named template. See
+// InitTemplates.
+func WithInitTemplate(name string) InitOption {
+	return func(o *initOptions) {
+		o.template = name
+	}
+}
+
+// WithGitignorePrompt offers to add .devbox/ to the project's .gitignore once
+// devbox.json is created, unless the .gitignore already has it.
+func WithGitignorePrompt() InitOption {
+	return func(o *initOptions) {
+		o.offerGitignore = true
+	}
+}
+
+// WithPostInitHook runs hook with sh in the project directory once devbox init
+// has created devbox.json. It runs in the host's environment, since the
+// project's packages aren't installed yet.
+func WithPostInitHook(hook string) InitOption {
+	return func(o *initOptions) {
+		o.postInitHook = hook
+	}
+}
+
+// InitConfig creates devbox.json in dir if it doesn't exist. The options that
+// run after devbox.json is created only run if InitConfig created it.
+func InitConfig(dir string, writer io.Writer, opts ...InitOption) (created bool, err error) {
+	initOpts := &initOptions{}
+	for _, opt := range opts {
+		opt(initOpts)
+	}
+	var template *initTemplate
+	if initOpts.template != "" {
+		template, err = findInitTemplate(initOpts.template)
+		if err != nil {
+			return false, err
+		}
+	}
+
+	if hasConfigFile(dir) {
+		if template != nil {
+			return false, usererr.New(
+				"%s already exists in %s, so it can't be initialized from the %s template",
+				configFilename, dir, template.Name,
+			)
+		}
+		return false, nil
+	}
 	cfgPath := filepath.Join(dir, configFilename)
 
 	config := &Config{
@@ -60,11 +131,16 @@ func InitConfig(dir string, writer io.Writer) (created bool, err error) {
 		// to have omitempty for Env in Config or not.
 		config.Env = map[string]string{}
 	}
+	if template != nil {
+		template.apply(config)
+	}
 	// package suggestion
 	pkgsToSuggest, err := initrec.Get(dir)
 	if err != nil {
 		return false, err
 	}
+	// The template's packages are already in the config.
+	pkgsToSuggest = lo.Without(pkgsToSuggest, config.RawPackages...)
 	if len(pkgsToSuggest) > 0 {
 		s := fmt.Sprintf("devbox add %s", strings.Join(pkgsToSuggest, " "))
 		fmt.Fprintf(
@@ -74,43 +150,170 @@ func InitConfig(dir string, writer io.Writer) (created bool, err error) {
 		)
 	}
 
-	return cuecfg.InitFile(cfgPath, config)
+	created, err = cuecfg.InitFile(cfgPath, config)
+	if !created || err != nil {
+		return created, err
+	}
+	if template != nil {
+		fmt.Fprintf(writer, "Initialized %s from the %s template\n", configFilename, template.Name)
+	}
+	if initOpts.offerGitignore {
+		if err := offerGitignore(dir, writer, terminalConfirm); err != nil {
+			return created, err
+		}
+	}
+	if initOpts.postInitHook != "" {
+		env := map[string]string{}
+		for _, kv := range os.Environ() {
+			k, v, _ := strings.Cut(kv, "=")
+			env[k] = v
+		}
+		if err := nix.RunScript(dir, initOpts.postInitHook, nil, env); err != nil {
+			return created, err
+		}
+	}
+	return created, nil
 }
 
 type Devbox struct {
 	cfg *Config
 	// projectDir is the directory where the config file (devbox.json) resides
-	projectDir    string
+	projectDir string
+	// configPath is the path of the config file, which can be in any of the
+	// supported formats.
+	configPath    string
 	pluginManager *plugin.Manager
 	writer        io.Writer
+
+	// storePathBinaries caches the binaries found in each package's store
+	// path. Store paths are immutable, so entries never need invalidating.
+	storePathBinaries map[string][]string
+	// ranBeforeInitHook is whether runBeforeInitHook already ran the
+	// before_init hook, which only needs to run once.
+	ranBeforeInitHook bool
+	// profileLock is the file that lockProfile locked, and
+	// profileLockDepth is how many times it's been locked without being
+	// unlocked.
+	profileLock      *os.File
+	profileLockDepth int
+	// confirm asks the user yes or no questions.
+	confirm confirmFunc
+	// packageGroups are the package groups in devbox.json whose packages
+	// are installed along with the project's packages.
+	packageGroups []string
+
+	// nix looks up, builds and verifies packages.
+	nix nixClient
+	// resolver finds the nixpkgs commits of package versions.
+	resolver versionResolver
+	// fsType detects the filesystem type of a directory.
+	fsType func(dir string) (string, error)
+	// profileLockTimeout is how long lockProfile waits for another devbox
+	// process to finish changing the project's profile.
+	profileLockTimeout time.Duration
+}
+
+// OpenOption configures Open.
+type OpenOption func(*openOptions)
+
+type openOptions struct {
+	nix nixClient
 }
 
-func Open(path string, writer io.Writer) (*Devbox, error) {
+// withNixClient makes the Devbox that Open returns use client instead of the
+// nix command.
+func withNixClient(client nixClient) OpenOption {
+	return func(o *openOptions) {
+		o.nix = client
+	}
+}
+
+func Open(path string, writer io.Writer, opts ...OpenOption) (*Devbox, error) {
+	openOpts := &openOptions{nix: nixCLI{}}
+	for _, opt := range opts {
+		opt(openOpts)
+	}
+
+	if isRemoteConfig(path) {
+		var err error
+		if path, err = fetchRemoteConfig(path, writer); err != nil {
+			return nil, err
+		}
+	}
 
 	projectDir, err := findProjectDir(path)
 	if err != nil {
 		return nil, err
 	}
-	cfgPath := filepath.Join(projectDir, configFilename)
-
-	cfg, err := ReadConfig(cfgPath)
+	cfgPath, err := configPathForOpen(path, projectDir, writer)
 	if err != nil {
-		return nil, errors.WithStack(err)
+		return nil, err
 	}
 
-	if err = upgradeConfig(cfg, cfgPath); err != nil {
+	cfg, err := readProjectConfig(cfgPath, projectDir, openOpts.nix)
+	if err != nil {
 		return nil, err
 	}
 
 	box := &Devbox{
 		cfg:           cfg,
 		projectDir:    projectDir,
+		configPath:    cfgPath,
 		pluginManager: plugin.NewManager(),
 		writer:        writer,
+		confirm:       terminalConfirm,
+
+		nix:                openOpts.nix,
+		resolver:           searcher.NewClient(),
+		fsType:             fileutil.FSType,
+		profileLockTimeout: defaultProfileLockTimeout,
 	}
 	return box, nil
 }
 
+// readProjectConfig reads the config file at cfgPath, along with the configs
+// that it extends and the configs of the projects that projectDir is in.
+func readProjectConfig(cfgPath, projectDir string, client nixClient) (*Config, error) {
+	cfg, err := ReadConfig(cfgPath)
+	if err != nil {
+		return nil, errors.WithStack(err)
+	}
+
+	if err = upgradeConfig(cfg, cfgPath, client); err != nil {
+		return nil, err
+	}
+
+	if err = loadExtendedConfigs(cfg, cfgPath); err != nil {
+		return nil, err
+	}
+	if err = loadParentConfigs(cfg, projectDir); err != nil {
+		return nil, err
+	}
+	return cfg, nil
+}
+
+// configPathForOpen returns the config file that Open should read. If path is
+// a config file, it's used as is. Otherwise the config file in projectDir is
+// used, with a warning if there's more than one to choose from.
+func configPathForOpen(path, projectDir string, w io.Writer) (string, error) {
+	if fi, err := os.Stat(path); err == nil && !fi.IsDir() &&
+		slices.Contains(configFilenames, filepath.Base(path)) {
+		absPath, err := filepath.Abs(path)
+		return absPath, errors.WithStack(err)
+	}
+	cfgPath, ignored := findConfigFile(projectDir)
+	if len(ignored) > 0 {
+		ux.Fwarning(
+			w,
+			"found more than one devbox config file. Using %s and ignoring %s. "+
+				"Pass --config to pick a different one.\n",
+			filepath.Base(cfgPath),
+			strings.Join(lo.Map(ignored, func(p string, _ int) string { return filepath.Base(p) }), ", "),
+		)
+	}
+	return cfgPath, nil
+}
+
 func (d *Devbox) ProjectDir() string {
 	return d.projectDir
 }
@@ -119,19 +322,147 @@ func (d *Devbox) Config() *Config {
 	return d.cfg
 }
 
+// AddOption configures a single invocation of Add.
+type AddOption func(*addOptions)
+
+type addOptions struct {
+	strict      bool
+	allowUnfree bool
+	platforms   []string
+	force       bool
+	lockfile    string
+}
+
+// WithStrictAdd makes Add refuse to add packages that provide a binary that
+// another package already provides, instead of only warning about it.
+func WithStrictAdd() AddOption {
+	return func(o *addOptions) {
+		o.strict = true
+	}
+}
+
+// WithAllowUnfree adds the packages that have an unfree license to
+// unfree_packages in devbox.json, without asking, if the project sets
+// allow_unfree to false.
+func WithAllowUnfree() AddOption {
+	return func(o *addOptions) {
+		o.allowUnfree = true
+	}
+}
+
+// WithForce adds packages that can't be found in nixpkgs, such as flake
+// references, instead of refusing to add them. They're still removed from
+// devbox.json if they fail to install.
+func WithForce() AddOption {
+	return func(o *addOptions) {
+		o.force = true
+	}
+}
+
+// WithLockfile also adds the packages in the lockfile at path, such as
+// another project's devbox.lock, pinned to the same nixpkgs commits and
+// attributes.
+func WithLockfile(path string) AddOption {
+	return func(o *addOptions) {
+		o.lockfile = path
+	}
+}
+
+// WithPlatforms only installs the added packages on the nix systems in
+// platforms, such as x86_64-linux. On other systems they're skipped.
+func WithPlatforms(platforms []string) AddOption {
+	return func(o *addOptions) {
+		o.platforms = platforms
+	}
+}
+
 // TODO savil. move to packages.go
-func (d *Devbox) Add(pkgs ...string) error {
-	original := d.cfg.RawPackages
-	// Check packages are valid before adding.
-	for _, pkg := range pkgs {
-		ok := nix.PkgExists(d.cfg.Nixpkgs.Commit, pkg)
-		if !ok {
-			return errors.WithMessage(nix.ErrPackageNotFound, pkg)
+func (d *Devbox) Add(pkgs []string, opts ...AddOption) error {
+	addOpts := &addOptions{}
+	for _, opt := range opts {
+		opt(addOpts)
+	}
+	if err := validatePlatforms(addOpts.platforms); err != nil {
+		return usererr.New("Invalid --platform: %s", err)
+	}
+	unlock, err := d.lockProfile()
+	if err != nil {
+		return err
+	}
+	defer unlock()
+
+	original, originalUnfree := d.cfg.RawPackages, d.cfg.UnfreePackages
+	originalPlatforms := maps.Clone(d.cfg.packagePlatforms)
+	originalPins := maps.Clone(d.cfg.packagePins)
+	pkgs, err = d.resolvePackages(pkgs)
+	if err != nil {
+		return err
+	}
+	if addOpts.lockfile != "" {
+		locked, err := d.pinLockedPackages(addOpts.lockfile)
+		if err != nil {
+			d.cfg.packagePins = originalPins
+			return err
+		}
+		pkgs = lo.Uniq(append(pkgs, locked...))
+	}
+	if _, err := d.pinPackages(pkgs); err != nil {
+		d.cfg.packagePins = originalPins
+		return err
+	}
+	// Packages that aren't installed on this system can't be checked here.
+	checkedPkgs := pkgs
+	if len(addOpts.platforms) > 0 && !slices.Contains(addOpts.platforms, nix.System()) {
+		checkedPkgs = nil
+	}
+	// Check packages are valid before adding. All of the packages that
+	// aren't found are reported together, and none of the packages are
+	// added.
+	infos := map[string]*nix.Info{}
+	notFound := []error{}
+	for _, pkg := range checkedPkgs {
+		info, found := d.pkgInfo(pkg)
+		if !found && addOpts.force {
+			ux.Fwarning(d.writer, "%s wasn't found in nixpkgs, but --force adds it anyway.\n", pkg)
+			continue
+		}
+		if !found {
+			notFound = append(notFound, d.packageNotFoundError(pkg))
+			continue
+		}
+		infos[pkg] = info
+	}
+	if len(notFound) > 0 {
+		d.cfg.packagePins = originalPins
+		return packagesNotFoundError(notFound)
+	}
+	// Packages that weren't found can only be checked by installing them.
+	checkedPkgs = lo.Filter(checkedPkgs, func(pkg string, _ int) bool {
+		_, found := infos[pkg]
+		return found
+	})
+	if err := d.checkPackageMeta(checkedPkgs, infos, addOpts.allowUnfree); err != nil {
+		d.cfg.UnfreePackages = originalUnfree
+		d.cfg.packagePins = originalPins
+		return err
+	}
+
+	if addOpts.strict {
+		if err := d.checkBinaryConflicts(checkedPkgs); err != nil {
+			d.cfg.UnfreePackages = originalUnfree
+			d.cfg.packagePins = originalPins
+			return err
 		}
 	}
+	newPkgs := lo.Filter(checkedPkgs, func(pkg string, _ int) bool {
+		return !slices.Contains(original, pkg)
+	})
 
 	// Add to Packages to config only if it's not already there
 	for _, pkg := range pkgs {
+		if len(addOpts.platforms) > 0 {
+			d.cfg.setPackagePlatforms(pkg, addOpts.platforms)
+		}
 		if slices.Contains(d.cfg.RawPackages, pkg) {
 			continue
 		}
@@ -154,11 +485,23 @@ func (d *Devbox) Add(pkgs ...string) error {
 			strings.Join(pkgs, ", "),
 		)
 		d.cfg.RawPackages = original
+		d.cfg.UnfreePackages = originalUnfree
+		d.cfg.packagePlatforms = originalPlatforms
+		d.cfg.packagePins = originalPins
 		_ = d.saveCfg() // ignore error to ensure we return the original error
 		return err
 	}
+	if !addOpts.strict {
+		// The packages are already added, so a conflict is only a warning.
+		if err := d.warnBinaryConflicts(newPkgs); err != nil {
+			debug.Log("unable to check the added packages for binary conflicts: %v", err)
+		}
+	}
 
 	for _, pkg := range pkgs {
+		if err := plugin.PrintContributions(pkg, d.projectDir, d.writer); err != nil {
+			return err
+		}
 		if err := plugin.PrintReadme(
 			pkg,
 			d.projectDir,
@@ -172,8 +515,142 @@ func (d *Devbox) Add(pkgs ...string) error {
 	return d.printPackageUpdateMessage(install, pkgs)
 }
 
+// AddDryRun previews what adding pkgs would change without modifying
+// devbox.json or the nix profile. It prints the binaries each package adds to
+// the PATH and the store paths (and their size) that would be pulled in. The
+// packages are only evaluated, so nothing is built or downloaded.
+func (d *Devbox) AddDryRun(pkgs ...string) error {
+	// Pins are only kept in memory since the config is never saved.
+	originalPins := maps.Clone(d.cfg.packagePins)
+	defer func() { d.cfg.packagePins = originalPins }()
+	pkgs, err := d.resolvePackages(pkgs)
+	if err != nil {
+		return err
+	}
+	if _, err := d.pinPackages(pkgs); err != nil {
+		return err
+	}
+	for _, pkg := range pkgs {
+		if !d.pkgExists(pkg) {
+			return d.packageNotFoundError(pkg)
+		}
+	}
+
+	fmt.Fprintln(d.writer, "Dry run: devbox.json and the nix profile won't be changed.")
+	newPkgs := []string{}
+	for _, pkg := range pkgs {
+		if slices.Contains(d.cfg.RawPackages, pkg) {
+			fmt.Fprintf(d.writer, "%s is already in devbox.json\n", pkg)
+			continue
+		}
+		newPkgs = append(newPkgs, pkg)
+	}
+	if len(newPkgs) == 0 {
+		return nil
+	}
+
+	storePaths := []string{}
+	for _, pkg := range newPkgs {
+		commit, attribute := d.packageRef(pkg)
+		paths, err := d.nix.OutPaths(commit, attribute)
+		if err != nil {
+			return usererr.WithUserMessage(
+				err, "Unable to resolve packages: %s", strings.Join(newPkgs, ", "))
+		}
+		storePaths = append(storePaths, paths...)
+	}
+
+	fmt.Fprintln(d.writer)
+	for _, pkg := range newPkgs {
+		info, _ := d.pkgInfo(pkg)
+		fmt.Fprintf(d.writer, "%s (%s)\n", pkg, info)
+	}
+
+	// Binaries and store paths that the profile already has aren't new.
+	profileBinaries := []string{}
+	profileClosure := map[string]bool{}
+	if profile := filepath.Join(d.projectDir, nix.ProfilePath); fileutil.Exists(profile) {
+		binaries, err := d.PackageBinaries()
+		if err != nil {
+			return err
+		}
+		for _, b := range binaries {
+			profileBinaries = append(profileBinaries, b...)
+		}
+		closure, err := d.nix.StoreClosure("" /*store*/, profile)
+		if err != nil {
+			return err
+		}
+		for _, p := range closure {
+			profileClosure[p.Path] = true
+		}
+	}
+
+	stores := d.dryRunStores()
+	binaries := []string{}
+	for _, path := range storePaths {
+		for _, store := range stores {
+			if b, err := d.nix.StoreBinaries(store, path); err == nil {
+				binaries = append(binaries, b...)
+				break
+			}
+		}
+	}
+	binaries, _ = lo.Difference(lo.Uniq(binaries), profileBinaries)
+	if len(binaries) > 0 {
+		fmt.Fprintf(d.writer, "\nNew binaries on PATH: %s\n", strings.Join(binaries, ", "))
+	}
+
+	var closure []nix.StorePathInfo
+	for _, store := range stores {
+		if closure, err = d.nix.StoreClosure(store, storePaths...); err == nil {
+			break
+		}
+	}
+	if err != nil {
+		fmt.Fprintln(
+			d.writer,
+			"\nStore paths pulled in: unknown, the packages aren't in a binary cache and would be built locally",
+		)
+		return nil
+	}
+	closure = lo.Filter(closure, func(p nix.StorePathInfo, _ int) bool {
+		return !profileClosure[p.Path]
+	})
+	var size int64
+	for _, p := range closure {
+		size += p.NarSize
+	}
+	fmt.Fprintf(
+		d.writer,
+		"\nStore paths pulled in: %d (%s)\n",
+		len(closure),
+		formatBytes(size),
+	)
+	for _, p := range closure {
+		fmt.Fprintf(d.writer, "  %s (%s)\n", p.Name(), formatBytes(p.NarSize))
+	}
+	return nil
+}
+
+// dryRunStores returns the stores that AddDryRun looks up store paths in, in
+// order: the local nix store (an empty string) for paths that are already
+// there, the project's binary caches and the default nixos.org cache.
+func (d *Devbox) dryRunStores() []string {
+	stores := []string{""}
+	for _, cache := range d.cfg.binaryCaches() {
+		stores = append(stores, cache.URL)
+	}
+	return append(stores, "https://cache.nixos.org")
+}
+
 // TODO savil. move to packages.go
 func (d *Devbox) Remove(pkgs ...string) error {
+	unlock, err := d.lockProfile()
+	if err != nil {
+		return err
+	}
+	defer unlock()
 
 	// First, save which packages are being uninstalled. Do this before we modify d.cfg.RawPackages below.
 	uninstalledPackages := lo.Intersect(d.cfg.RawPackages, pkgs)
@@ -196,7 +673,11 @@ func (d *Devbox) Remove(pkgs ...string) error {
 		return err
 	}
 
-	if err := d.removePackagesFromProfile(uninstalledPackages); err != nil {
+	// Packages that are restricted to other systems were never installed.
+	installedPackages := lo.Filter(uninstalledPackages, func(pkg string, _ int) bool {
+		return d.cfg.supportsSystem(pkg)
+	})
+	if err := d.removePackagesFromProfile(installedPackages); err != nil {
 		return err
 	}
 
@@ -204,32 +685,208 @@ func (d *Devbox) Remove(pkgs ...string) error {
 		return err
 	}
 
-	return d.printPackageUpdateMessage(uninstall, uninstalledPackages)
+	if err := d.printPackageUpdateMessage(uninstall, uninstalledPackages); err != nil {
+		return err
+	}
+	// Pins are removed last because removing the packages from the profile
+	// needs their attributes.
+	if lo.SomeBy(uninstalledPackages, func(pkg string) bool {
+		_, ok := d.cfg.packagePins[pkg]
+		return ok
+	}) {
+		d.unpinPackages(uninstalledPackages)
+		return d.saveCfg()
+	}
+	return nil
+}
+
+// RemoveAll removes every package in the project's devbox.json, like calling
+// Remove with all of them. If confirm is true, it asks the user first.
+func (d *Devbox) RemoveAll(confirm bool) error {
+	pkgs := slices.Clone(d.cfg.RawPackages)
+	if len(pkgs) == 0 {
+		fmt.Fprintf(d.writer, "There are no packages in %s to remove.\n", filepath.Base(d.configPath))
+		return nil
+	}
+	if confirm {
+		remove, err := d.confirm(
+			fmt.Sprintf("Remove all %d packages (%s)?", len(pkgs), strings.Join(pkgs, ", ")), false)
+		// Removing every package shouldn't happen by accident, so it
+		// needs an answer.
+		if errors.Is(err, errNoTerminal) {
+			return usererr.New("pass --yes to remove all packages without a terminal to confirm it")
+		}
+		if err != nil {
+			return err
+		}
+		if !remove {
+			fmt.Fprintln(d.writer, "No packages removed.")
+			return nil
+		}
+	}
+	return d.Remove(pkgs...)
 }
 
 func (d *Devbox) ShellPlan() (*plansdk.ShellPlan, error) {
 	userDefinedPkgs := d.packages()
 	shellPlan := planner.GetShellPlan(d.projectDir, userDefinedPkgs)
-	shellPlan.DevPackages = userDefinedPkgs
+	shellPlan.DevPackages = []string{}
+	for _, pkg := range userDefinedPkgs {
+		commit, attribute := d.packageRef(pkg)
+		if commit == d.cfg.Nixpkgs.Commit && attribute == pkg {
+			shellPlan.DevPackages = append(shellPlan.DevPackages, pkg)
+			continue
+		}
+		info, err := plansdk.GetNixpkgsInfo(commit)
+		if err != nil {
+			return nil, err
+		}
+		shellPlan.PinnedPackages = append(shellPlan.PinnedPackages, plansdk.PinnedPackage{
+			Attribute:  attribute,
+			Commit:     commit,
+			NixpkgsURL: info.URL,
+		})
+	}
 
 	nixpkgsInfo, err := plansdk.GetNixpkgsInfo(d.cfg.Nixpkgs.Commit)
 	if err != nil {
 		return nil, err
 	}
 	shellPlan.NixpkgsInfo = nixpkgsInfo
+	shellPlan.RestrictUnfree = d.cfg.restrictUnfree()
+	shellPlan.UnfreePackages = d.cfg.UnfreePackages
 
 	return shellPlan, nil
 }
 
 func (d *Devbox) Generate() error {
-	if err := d.generateShellFiles(); err != nil {
+	stale, err := d.generateShellFiles()
+	if err != nil {
 		return errors.WithStack(err)
 	}
+	d.warnStaleShellFiles(stale)
 	return nil
 }
 
-func (d *Devbox) Shell() error {
-	if err := d.ensurePackagesAreInstalled(ensure); err != nil {
+// CheckGeneratedFiles returns an error listing the files in .devbox/gen that
+// don't match what devbox would generate from the project's config, without
+// changing them.
+func (d *Devbox) CheckGeneratedFiles() error {
+	plan, err := d.ShellPlan()
+	if err != nil {
+		return err
+	}
+	files, err := renderShellFiles(plan)
+	if err != nil {
+		return err
+	}
+	stale, err := staleShellFiles(d.projectDir, files)
+	if err != nil {
+		return err
+	}
+	if len(stale) > 0 {
+		return usererr.New("These generated files are out of date with %s: %s. Run devbox install to update them.",
+			filepath.Base(d.configPath), strings.Join(stale, ", "))
+	}
+	fmt.Fprintln(d.writer, "The generated files are up to date.")
+	return nil
+}
+
+// ShellOption configures Shell.
+type ShellOption func(*shellOptions)
+
+type shellOptions struct {
+	noProfileInstall bool
+	pure             bool
+	envOverrides     map[string]string
+	noPromptPrefix   bool
+	offline          bool
+	packageGroups    []string
+}
+
+// WithoutProfileInstall starts the shell without installing packages into the
+// project's nix profile. The shell only has the packages that are already in
+// the nix store, and it never changes the profile.
+func WithoutProfileInstall() ShellOption {
+	return func(o *shellOptions) {
+		o.noProfileInstall = true
+	}
+}
+
+// WithOffline starts the shell without using the network. Unlike
+// WithoutProfileInstall, the shell fails to start if it needs anything that
+// isn't downloaded yet, such as a package that isn't installed.
+func WithOffline() ShellOption {
+	return func(o *shellOptions) {
+		o.offline = true
+	}
+}
+
+// WithPureEnv starts the shell without the current environment, like
+// nix develop --ignore-environment. Only the nix, plugin and devbox.json
+// variables are set, along with the few host variables in pureEnvVars that
+// programs can't work without.
+func WithPureEnv() ShellOption {
+	return func(o *shellOptions) {
+		o.pure = true
+	}
+}
+
+// WithShellEnvOverrides sets variables in the shell's environment, taking
+// precedence over the variables from devbox.json and plugins.
+func WithShellEnvOverrides(env map[string]string) ShellOption {
+	return func(o *shellOptions) {
+		o.envOverrides = env
+	}
+}
+
+// WithoutPromptPrefix leaves the shell's prompt as it is, instead of
+// prepending the shell.prompt from devbox.json or nix.DefaultPromptPrefix.
+func WithoutPromptPrefix() ShellOption {
+	return func(o *shellOptions) {
+		o.noPromptPrefix = true
+	}
+}
+
+// WithShellPackageGroups adds the packages in the package groups from
+// devbox.json to the shell.
+func WithShellPackageGroups(groups ...string) ShellOption {
+	return func(o *shellOptions) {
+		o.packageGroups = append(o.packageGroups, groups...)
+	}
+}
+
+func (d *Devbox) Shell(opts ...ShellOption) error {
+	shellOpts := &shellOptions{}
+	for _, opt := range opts {
+		opt(shellOpts)
+	}
+	if err := d.activatePackageGroups(shellOpts.packageGroups); err != nil {
+		return err
+	}
+	if shellOpts.pure && featureflag.UnifiedEnv.Disabled() {
+		return usererr.New("--pure is not supported when DEVBOX_FEATURE_UNIFIED_ENV is disabled")
+	}
+	if shellOpts.offline && featureflag.UnifiedEnv.Disabled() {
+		return usererr.New("--offline is not supported when DEVBOX_FEATURE_UNIFIED_ENV is disabled")
+	}
+	d.warnIfNetworkFilesystem()
+	if shellOpts.offline {
+		if err := d.prepareOfflineShell(); err != nil {
+			return err
+		}
+	} else if shellOpts.noProfileInstall {
+		ux.Fwarning(d.writer, "Skipping package installation. Packages that aren't installed yet "+
+			"will be missing from the shell.\n")
+		if err := d.runBeforeInitHook(); err != nil {
+			return err
+		}
+		stale, err := d.generateShellFiles()
+		if err != nil {
+			return err
+		}
+		d.warnStaleShellFiles(stale)
+	} else if err := d.ensurePackagesAreInstalled(ensure); err != nil {
 		return err
 	}
 	fmt.Fprintln(d.writer, "Starting a devbox shell...")
@@ -239,14 +896,21 @@ func (d *Devbox) Shell() error {
 		return err
 	}
 
-	pluginHooks, err := plugin.InitHooks(d.packages(), d.projectDir)
+	pluginHooks, err := d.pluginInitHooks("")
 	if err != nil {
 		return err
 	}
 
 	var env map[string]string
 	if featureflag.UnifiedEnv.Enabled() {
-		env, err = d.computeNixEnv()
+		env, err = d.computeNixEnvWithHistory(nil, nixEnvOptions{
+			// Without installing packages, nix can't download what
+			// the environment needs, and the shell falls back to the
+			// packages that the profile already has.
+			offline:           shellOpts.offline || shellOpts.noProfileInstall,
+			fallbackToProfile: shellOpts.noProfileInstall,
+			pure:              shellOpts.pure,
+		})
 		if err != nil {
 			return err
 		}
@@ -256,36 +920,236 @@ func (d *Devbox) Shell() error {
 			return err
 		}
 	}
+	for k, v := range shellOpts.envOverrides {
+		env[k] = v
+	}
+
+	// The shell start time makes the shellrc log how long the shell took to
+	// start, so leave it out when telemetry is off.
+	shellStartTime := ""
+	if !telemetry.IsDisabled(telemetry.InitOpts()) && !TelemetryDisabled(d.projectDir) {
+		shellStartTime = os.Getenv("DEVBOX_SHELL_START_TIME")
+		if shellStartTime == "" {
+			shellStartTime = telemetry.UnixTimestampFromTime(telemetry.CommandStartTime())
+		}
+	}
 
-	shellStartTime := os.Getenv("DEVBOX_SHELL_START_TIME")
-	if shellStartTime == "" {
-		shellStartTime = telemetry.UnixTimestampFromTime(telemetry.CommandStartTime())
+	historyFile := d.shellHistoryPath()
+	if err := os.MkdirAll(filepath.Dir(historyFile), 0o755); err != nil {
+		return errors.WithStack(err)
 	}
 
-	opts := []nix.ShellOption{
+	nixOpts := []nix.ShellOption{
 		nix.WithPluginInitHook(strings.Join(pluginHooks, "\n")),
 		nix.WithProfile(profileDir),
-		nix.WithHistoryFile(filepath.Join(d.projectDir, shellHistoryFile)),
+		nix.WithHistoryFile(historyFile),
 		nix.WithProjectDir(d.projectDir),
 		nix.WithEnvVariables(env),
 		nix.WithPKGConfigDir(d.pluginVirtenvPath()),
 		nix.WithShellStartTime(shellStartTime),
 	}
+	if d.cfg.Shell.TerminalTitle {
+		nixOpts = append(nixOpts, nix.WithTerminalTitle(filepath.Base(d.projectDir)))
+	}
+	if shellOpts.noPromptPrefix {
+		nixOpts = append(nixOpts, nix.WithPromptPrefix(""))
+	} else if d.cfg.Shell.Prompt != nil {
+		nixOpts = append(nixOpts, nix.WithPromptPrefix(*d.cfg.Shell.Prompt))
+	}
+	if d.cfg.Shell.InheritRC {
+		nixOpts = append(nixOpts, nix.WithInheritRC())
+	}
+	if shellOpts.offline {
+		nixOpts = append(nixOpts, nix.WithOffline())
+	}
 
-	shell, err := nix.NewDevboxShell(d.cfg.Nixpkgs.Commit, opts...)
+	shell, err := nix.NewDevboxShell(d.cfg.Nixpkgs.Commit, nixOpts...)
 	if err != nil {
 		return err
 	}
 
-	shell.UserInitHook = d.cfg.Shell.InitHook.String()
+	shell.UserInitHook = d.cfg.initHook()
+	shell.UserPreInitHook = d.cfg.preInitHook()
+	shell.UserShellHook = d.cfg.shellHook()
 	return shell.Run(d.nixShellFilePath(), d.nixFlakesFilePath())
 }
 
-func (d *Devbox) RunScript(cmdName string, cmdArgs []string) error {
+// RunOption configures a single invocation of RunScript.
+type RunOption func(*runOptions)
+
+type runOptions struct {
+	noNetwork      bool
+	allowLoopback  bool
+	envPassthrough []string
+	explainEnv     []string
+	cwd            string
+	onFailure      string
+	extraEnv       map[string]string
+	timeout        time.Duration
+	environment    string
+	refreshEnv     bool
+	envOverrides   map[string]string
+	packageGroups  []string
+}
+
+// WithRefreshEnv recomputes the nix environment instead of using the cached
+// output of nix print-dev-env.
+func WithRefreshEnv() RunOption {
+	return func(o *runOptions) {
+		o.refreshEnv = true
+	}
+}
+
+// WithNoNetwork runs the script or command without network access. If
+// allowLoopback is true, the command can still reach services listening on
+// its own loopback interface.
+func WithNoNetwork(allowLoopback bool) RunOption {
+	return func(o *runOptions) {
+		o.noNetwork = true
+		o.allowLoopback = allowLoopback
+	}
+}
+
+// WithEnvPassthrough forces variables from the current environment whose names
+// match any of the glob patterns into the computed environment, even if they
+// would normally be ignored or overridden by Nix.
+func WithEnvPassthrough(patterns ...string) RunOption {
+	return func(o *runOptions) {
+		o.envPassthrough = append(o.envPassthrough, patterns...)
+	}
+}
+
+// WithExplainEnv prints the final value of each of the variables, along with
+// the layers of the environment that set it, before running the script or
+// command.
+func WithExplainEnv(vars ...string) RunOption {
+	return func(o *runOptions) {
+		o.explainEnv = append(o.explainEnv, vars...)
+	}
+}
+
+// WithCwd runs the script or command in dir instead of the directory chosen
+// by the project's script_cwd setting. A relative dir is relative to the
+// project directory, so that scripts in a monorepo can run in a subpackage
+// with the root project's environment.
+func WithCwd(dir string) RunOption {
+	return func(o *runOptions) {
+		o.cwd = dir
+	}
+}
+
+// WithOnFailure runs script if the script or command exits with a nonzero
+// code. The failure script gets the name and exit code of what failed in
+// DEVBOX_FAILED_COMMAND and DEVBOX_FAILED_EXIT_CODE. Its own result doesn't
+// replace the original error.
+func WithOnFailure(script string) RunOption {
+	return func(o *runOptions) {
+		o.onFailure = script
+	}
+}
+
+// WithTimeout terminates the script or command if it runs longer than timeout.
+// It overrides the timeout set in devbox.json.
+func WithTimeout(timeout time.Duration) RunOption {
+	return func(o *runOptions) {
+		o.timeout = timeout
+	}
+}
+
+// WithEnvironment runs the environment's override of a script, if it has one,
+// and sets DEVBOX_ENV to environment. Without this option, the environment is
+// taken from DEVBOX_ENV.
+func WithEnvironment(environment string) RunOption {
+	return func(o *runOptions) {
+		o.environment = environment
+	}
+}
+
+// WithEnvOverrides sets variables in the script's environment, taking
+// precedence over every other layer, including devbox.json and the script's
+// own env.
+func WithEnvOverrides(env map[string]string) RunOption {
+	return func(o *runOptions) {
+		o.envOverrides = env
+	}
+}
+
+// WithPackageGroups adds the packages in the package groups from devbox.json
+// to the script's environment.
+func WithPackageGroups(groups ...string) RunOption {
+	return func(o *runOptions) {
+		o.packageGroups = append(o.packageGroups, groups...)
+	}
+}
+
+// ParseEnvOverrides parses KEY=VALUE pairs, such as the values of --env, into
+// a map. Only the first = separates the key from the value, so values can
+// contain = and spaces. A later pair for the same key replaces an earlier one.
+func ParseEnvOverrides(pairs []string) (map[string]string, error) {
+	env := make(map[string]string, len(pairs))
+	for _, pair := range pairs {
+		key, value, ok := strings.Cut(pair, "=")
+		if !ok || !envVarName.MatchString(key) {
+			return nil, usererr.New("invalid --env %q: it must be KEY=VALUE, where KEY is a valid variable name", pair)
+		}
+		env[key] = value
+	}
+	return env, nil
+}
+
+// withExtraEnv sets variables in the script's environment on top of the
+// computed devbox environment.
+func withExtraEnv(env map[string]string) RunOption {
+	return func(o *runOptions) {
+		o.extraEnv = env
+	}
+}
+
+func (d *Devbox) RunScript(cmdName string, cmdArgs []string, opts ...RunOption) error {
+	runOpts := &runOptions{}
+	for _, opt := range opts {
+		opt(runOpts)
+	}
+	if err := d.activatePackageGroups(runOpts.packageGroups); err != nil {
+		return err
+	}
+
 	if featureflag.UnifiedEnv.Disabled() {
+		if runOpts.noNetwork {
+			return usererr.New("--no-network is not supported when DEVBOX_FEATURE_UNIFIED_ENV is disabled")
+		}
+		if len(runOpts.envPassthrough) > 0 {
+			return usererr.New("--env-passthrough is not supported when DEVBOX_FEATURE_UNIFIED_ENV is disabled")
+		}
+		if len(runOpts.explainEnv) > 0 {
+			return usererr.New("--explain-env is not supported when DEVBOX_FEATURE_UNIFIED_ENV is disabled")
+		}
+		if runOpts.cwd != "" {
+			return usererr.New("--cwd is not supported when DEVBOX_FEATURE_UNIFIED_ENV is disabled")
+		}
+		if runOpts.onFailure != "" {
+			return usererr.New("--on-failure is not supported when DEVBOX_FEATURE_UNIFIED_ENV is disabled")
+		}
+		if runOpts.timeout > 0 {
+			return usererr.New("--timeout is not supported when DEVBOX_FEATURE_UNIFIED_ENV is disabled")
+		}
+		if runOpts.environment != "" {
+			return usererr.New("--environment is not supported when DEVBOX_FEATURE_UNIFIED_ENV is disabled")
+		}
+		if len(runOpts.envOverrides) > 0 {
+			return usererr.New("--env is not supported when DEVBOX_FEATURE_UNIFIED_ENV is disabled")
+		}
 		return d.RunScriptInNewNixShell(cmdName)
 	}
 
+	if runOpts.cwd != "" {
+		dir, err := d.runDir(runOpts.cwd)
+		if err != nil {
+			return err
+		}
+		runOpts.cwd = dir
+	}
+
 	if err := d.ensurePackagesAreInstalled(ensure); err != nil {
 		return err
 	}
@@ -294,30 +1158,182 @@ func (d *Devbox) RunScript(cmdName string, cmdArgs []string) error {
 		return err
 	}
 
-	env, err := d.computeNixEnv()
+	var history envHistory
+	if len(runOpts.explainEnv) > 0 {
+		history = envHistory{}
+	}
+	env, err := d.computeNixEnvWithHistory(history, nixEnvOptions{
+		envPassthrough: runOpts.envPassthrough,
+		refresh:        runOpts.refreshEnv,
+	})
 	if err != nil {
 		return err
 	}
+	environment := os.Getenv("DEVBOX_ENV")
+	if runOpts.environment != "" {
+		environment = runOpts.environment
+		history.set(env, "DEVBOX_ENV", environment, envSourceEnvironment)
+	}
 
 	var cmdWithArgs []string
-	if _, ok := d.cfg.Shell.Scripts[cmdName]; ok {
+	dir := d.projectDir
+	timeout := runOpts.timeout
+	if script, ok := d.cfg.scripts()[cmdName]; ok {
+		d.warnIfScriptShadowsBinary(cmdName, env["PATH"])
+		timeout, err = script.timeout(d.cfg.Shell.DefaultTimeout, runOpts.timeout)
+		if err != nil {
+			return err
+		}
+		if d.cfg.Shell.ScriptCwd == ScriptCwdNearest {
+			wd, err := os.Getwd()
+			if err != nil {
+				return errors.WithStack(err)
+			}
+			dir = nearestPackageDir(wd, d.projectDir)
+		}
+		if len(script.Requires) > 0 {
+			binPaths, err := d.requiredPackagesBinPaths(script)
+			if err != nil {
+				return err
+			}
+			history.set(env, "PATH", nix.JoinPathLists(append(binPaths, env["PATH"])...), envSourceRequires)
+		}
+		argValues, rest, err := script.resolveArgs(cmdName, cmdArgs)
+		if err != nil {
+			return err
+		}
+		for k, v := range argValues {
+			history.set(env, k, v, envSourceScriptArg)
+		}
+		scriptEnv, err := d.expandEnv(script.Env, env)
+		if err != nil {
+			return err
+		}
+		for k, v := range scriptEnv {
+			history.set(env, k, v, envSourceScriptEnv)
+		}
+		cmdArgs = rest
+		scriptName := cmdName
+		if _, ok := script.Environments[environment]; ok {
+			scriptName = environmentScriptName(cmdName, environment)
+		}
 		// it's a script, so replace the command with the script file's path.
-		cmdWithArgs = append([]string{d.scriptPath(d.scriptFilename(cmdName))}, cmdArgs...)
+		cmdWithArgs = append([]string{d.scriptPath(d.scriptFilename(scriptName))}, cmdArgs...)
 	} else {
 		// Arbitrary commands should also run the hooks, so we write them to a file as well. However, if the
 		// command args include env variable evaluations, then they'll be evaluated _before_ the hooks run,
 		// which we don't want. So, one solution is to write the entire command and its arguments into the
 		// file itself, but that may not be great if the variables contain sensitive information. Instead,
 		// we save the entire command (with args) into the DEVBOX_RUN_CMD var, and then the script evals it.
-		err := d.writeScriptFile(arbitraryCmdFilename, d.scriptBody("eval $DEVBOX_RUN_CMD\n"))
+		err := d.writeScriptFile(arbitraryCmdFilename, d.scriptBody(arbitraryCmdBody))
 		if err != nil {
 			return err
 		}
 		cmdWithArgs = []string{d.scriptPath(d.scriptFilename(arbitraryCmdFilename))}
-		env["DEVBOX_RUN_CMD"] = strings.Join(append([]string{cmdName}, cmdArgs...), " ")
+		env["DEVBOX_RUN_CMD"] = arbitraryCmd(cmdName, cmdArgs)
+	}
+	for k, v := range runOpts.extraEnv {
+		history.set(env, k, v, envSourceOnFailure)
+	}
+	for k, v := range runOpts.envOverrides {
+		history.set(env, k, v, envSourceFlag)
 	}
 
-	return nix.RunScript(d.projectDir, strings.Join(cmdWithArgs, " "), env)
+	if len(runOpts.explainEnv) > 0 {
+		history.explain(d.writer, env, runOpts.explainEnv)
+	}
+
+	if runOpts.cwd != "" {
+		dir = runOpts.cwd
+	}
+
+	scriptOpts := []nix.RunScriptOption{nix.WithDir(dir)}
+	if runOpts.noNetwork {
+		scriptOpts = append(scriptOpts, nix.WithNoNetwork(runOpts.allowLoopback))
+	}
+	if timeout > 0 {
+		// Scripts with a timeout can be terminated, so they get a
+		// pseudo-terminal that can't be left in a bad state. Other
+		// scripts use devbox's terminal directly, which keeps job
+		// control such as Ctrl-Z working.
+		scriptOpts = append(scriptOpts, nix.WithTimeout(timeout), nix.WithPTY())
+	}
+	// cmdWithArgs is passed as separate arguments so that arguments with spaces
+	// or $ reach the script exactly as they were given.
+	err = nix.RunScript(d.projectDir, `"$@"`, cmdWithArgs, env, scriptOpts...)
+	if errors.Is(err, nix.ErrTimeout) {
+		color.New(color.FgRed).Fprintf(d.writer, "%s timed out after %s and was terminated.\n", cmdName, timeout)
+	}
+	var exitErr *usererr.ExitError
+	if runOpts.onFailure != "" && errors.As(err, &exitErr) {
+		d.runFailureScript(runOpts, cmdName, exitErr.ExitCode())
+	}
+	return err
+}
+
+// runFailureScript runs the --on-failure script after cmdName exited with
+// exitCode. It only reports the failure script's own errors so that the
+// original failure is what devbox run exits with.
+func (d *Devbox) runFailureScript(runOpts *runOptions, cmdName string, exitCode int) {
+	fmt.Fprintf(d.writer, "%s failed with exit code %d. Running %s.\n", cmdName, exitCode, runOpts.onFailure)
+	opts := []RunOption{
+		WithEnvPassthrough(runOpts.envPassthrough...),
+		withExtraEnv(map[string]string{
+			"DEVBOX_FAILED_COMMAND":   cmdName,
+			"DEVBOX_FAILED_EXIT_CODE": strconv.Itoa(exitCode),
+		}),
+	}
+	if runOpts.noNetwork {
+		opts = append(opts, WithNoNetwork(runOpts.allowLoopback))
+	}
+	if runOpts.cwd != "" {
+		opts = append(opts, WithCwd(runOpts.cwd))
+	}
+	if runOpts.environment != "" {
+		opts = append(opts, WithEnvironment(runOpts.environment))
+	}
+	if len(runOpts.envOverrides) > 0 {
+		opts = append(opts, WithEnvOverrides(runOpts.envOverrides))
+	}
+	if err := d.RunScript(runOpts.onFailure, nil, opts...); err != nil {
+		color.New(color.FgYellow).Fprintf(d.writer, "Warning: %s also failed: %v\n", runOpts.onFailure, err)
+	}
+}
+
+// requiredPackagesBinPaths makes the packages required by a script available
+// without adding them to devbox.json, and returns their bin directories.
+// Packages that are already part of the project are skipped.
+func (d *Devbox) requiredPackagesBinPaths(script *Script) ([]string, error) {
+	pkgs, _ := lo.Difference(script.Requires, d.packages())
+	if len(pkgs) == 0 {
+		return nil, nil
+	}
+	fmt.Fprintf(d.writer, "Ensuring packages required by the script are available: %s\n", strings.Join(pkgs, ", "))
+	storePaths, err := nix.BuildPackages(d.writer, d.cfg.Nixpkgs.Commit, pkgs...)
+	if err != nil {
+		return nil, usererr.WithUserMessage(
+			err,
+			"Unable to make the required packages available: %s",
+			strings.Join(pkgs, ", "),
+		)
+	}
+	binPaths := []string{}
+	for _, path := range storePaths {
+		if binPath := filepath.Join(path, "bin"); fileutil.IsDir(binPath) {
+			binPaths = append(binPaths, binPath)
+		}
+	}
+	return binPaths, nil
+}
+
+// shellHistoryPath returns the history file for interactive shells, which is
+// shell.history_file in devbox.json if it's set.
+func (d *Devbox) shellHistoryPath() string {
+	path := lo.Ternary(d.cfg.Shell.HistoryFile != "", d.cfg.Shell.HistoryFile, shellHistoryFile)
+	if filepath.IsAbs(path) {
+		return path
+	}
+	return filepath.Join(d.projectDir, path)
 }
 
 // RunScriptInNewNixShell implements `devbox run` (from outside a devbox shell) using a nix shell.
@@ -333,12 +1349,12 @@ func (d *Devbox) RunScriptInNewNixShell(scriptName string) error {
 		return err
 	}
 
-	script := d.cfg.Shell.Scripts[scriptName]
+	script := d.cfg.scripts()[scriptName]
 	if script == nil {
 		return usererr.New("unable to find a script with name %s", scriptName)
 	}
 
-	pluginHooks, err := plugin.InitHooks(d.packages(), d.projectDir)
+	pluginHooks, err := d.pluginInitHooks("")
 	if err != nil {
 		return err
 	}
@@ -351,7 +1367,7 @@ func (d *Devbox) RunScriptInNewNixShell(scriptName string) error {
 	opts := []nix.ShellOption{
 		nix.WithPluginInitHook(strings.Join(pluginHooks, "\n")),
 		nix.WithProfile(profileDir),
-		nix.WithHistoryFile(filepath.Join(d.projectDir, shellHistoryFile)),
+		nix.WithHistoryFile(filepath.Join(d.projectDir, runHistoryFile)),
 		nix.WithUserScript(scriptName, script.String()),
 		nix.WithProjectDir(d.projectDir),
 		nix.WithEnvVariables(env),
@@ -365,7 +1381,9 @@ func (d *Devbox) RunScriptInNewNixShell(scriptName string) error {
 		return err
 	}
 
-	shell.UserInitHook = d.cfg.Shell.InitHook.String()
+	shell.UserInitHook = d.cfg.initHook()
+	shell.UserPreInitHook = d.cfg.preInitHook()
+	shell.UserRunHook = d.cfg.runHook()
 	return shell.Run(d.nixShellFilePath(), d.nixFlakesFilePath())
 }
 
@@ -376,7 +1394,7 @@ func (d *Devbox) RunScriptInShell(scriptName string) error {
 		return err
 	}
 
-	script := d.cfg.Shell.Scripts[scriptName]
+	script := d.cfg.scripts()[scriptName]
 	if script == nil {
 		return usererr.New("unable to find a script with name %s", scriptName)
 	}
@@ -384,7 +1402,7 @@ func (d *Devbox) RunScriptInShell(scriptName string) error {
 	shell, err := nix.NewDevboxShell(
 		d.cfg.Nixpkgs.Commit,
 		nix.WithProfile(profileDir),
-		nix.WithHistoryFile(filepath.Join(d.projectDir, shellHistoryFile)),
+		nix.WithHistoryFile(filepath.Join(d.projectDir, runHistoryFile)),
 		nix.WithUserScript(scriptName, script.String()),
 		nix.WithProjectDir(d.projectDir),
 	)
@@ -397,14 +1415,26 @@ func (d *Devbox) RunScriptInShell(scriptName string) error {
 	return shell.RunInShell()
 }
 
-func (d *Devbox) ListScripts() []string {
-	keys := make([]string, len(d.cfg.Shell.Scripts))
-	i := 0
-	for k := range d.cfg.Shell.Scripts {
-		keys[i] = k
-		i++
+// ListScripts returns the project's scripts sorted by name.
+func (d *Devbox) ListScripts() []ScriptInfo {
+	scripts := d.cfg.scripts()
+	names := lo.Keys(scripts)
+	slices.Sort(names)
+	infos := make([]ScriptInfo, 0, len(names))
+	for _, name := range names {
+		script := scripts[name]
+		var environments []string
+		if len(script.Environments) > 0 {
+			environments = lo.Keys(script.Environments)
+			slices.Sort(environments)
+		}
+		infos = append(infos, ScriptInfo{
+			Name:         name,
+			Description:  script.Description,
+			Environments: environments,
+		})
 	}
-	return keys
+	return infos
 }
 
 // TODO: deprecate in favor of RunScript().
@@ -442,22 +1472,34 @@ func (d *Devbox) Exec(cmds ...string) error {
 	return errors.Errorf("cannot execute empty command: %v", cmds)
 }
 
-func (d *Devbox) PrintEnv() (string, error) {
+func (d *Devbox) PrintEnv(format EnvFormat, opts ...PrintEnvOption) (string, error) {
+	printOpts := &printEnvOptions{}
+	for _, opt := range opts {
+		opt(printOpts)
+	}
+
+	envs, err := d.environment(printOpts.offline)
+	if err != nil {
+		return "", err
+	}
+	if printOpts.prefix != "" {
+		envs = prefixEnv(envs, printOpts.prefix)
+	}
+
+	switch format {
+	case EnvFormatSystemd:
+		return formatSystemdEnv(envs, d.writer), nil
+	case EnvFormatJSON:
+		return formatJSONEnv(envs)
+	}
+
 	script := ""
 	if featureflag.UnifiedEnv.Disabled() {
-		envs, err := plugin.Env(d.packages(), d.projectDir)
-		if err != nil {
-			return "", err
-		}
 		for k, v := range envs {
 			script += fmt.Sprintf("export %s=%s\n", k, v)
 		}
 		return script, nil
 	}
-	envs, err := d.computeNixEnv()
-	if err != nil {
-		return "", err
-	}
 
 	for k, v := range envs {
 		// %q is for escaping quotes in env variables that
@@ -468,8 +1510,37 @@ func (d *Devbox) PrintEnv() (string, error) {
 	return script, nil
 }
 
-func (d *Devbox) Info(pkg string, markdown bool) error {
-	info, hasInfo := nix.PkgInfo(d.cfg.Nixpkgs.Commit, pkg)
+// environment returns the variables that define the devbox environment. With
+// the unified env this is the full computed nix environment, otherwise it only
+// contains the variables set by plugins. If offline is true, the nix
+// environment is computed with computeOfflineNixEnv.
+func (d *Devbox) environment(offline bool) (map[string]string, error) {
+	if featureflag.UnifiedEnv.Disabled() {
+		return plugin.Env(d.packages(), d.projectDir)
+	}
+	if offline {
+		return d.computeOfflineNixEnv()
+	}
+	return d.computeNixEnv()
+}
+
+// Info prints the info and readme of each package in pkgs. Packages that
+// can't be found are noted in the output without stopping the others from
+// being printed.
+func (d *Devbox) Info(pkgs []string, markdown bool) error {
+	for i, pkg := range pkgs {
+		if i > 0 {
+			fmt.Fprintln(d.writer)
+		}
+		if err := d.printInfo(pkg, markdown); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (d *Devbox) printInfo(pkg string, markdown bool) error {
+	info, hasInfo := d.pkgInfo(pkg)
 	if !hasInfo {
 		_, err := fmt.Fprintf(d.writer, "Package %s not found\n", pkg)
 		return errors.WithStack(err)
@@ -482,6 +1553,11 @@ func (d *Devbox) Info(pkg string, markdown bool) error {
 	); err != nil {
 		return errors.WithStack(err)
 	}
+	if channel := d.nixpkgsChannel(pkg); channel != "" {
+		if _, err := fmt.Fprintf(d.writer, "From nixpkgs channel %s\n", channel); err != nil {
+			return errors.WithStack(err)
+		}
+	}
 	return plugin.PrintReadme(
 		pkg,
 		d.projectDir,
@@ -490,16 +1566,70 @@ func (d *Devbox) Info(pkg string, markdown bool) error {
 	)
 }
 
+// nixpkgsChannel returns the nixpkgs channel that pkg comes from, or "" if
+// the project's nixpkgs commit doesn't have a channel or pkg uses another
+// commit.
+func (d *Devbox) nixpkgsChannel(pkg string) string {
+	if commit, _ := d.packageRef(pkg); commit != d.cfg.Nixpkgs.Commit {
+		return ""
+	}
+	return d.cfg.Nixpkgs.Channel
+}
+
+// pkgInfoJSON is how InfoJSON prints a package. The fields of nix.Info are
+// only set if the package is found.
+type pkgInfoJSON struct {
+	Package string `json:"package"`
+	Found   bool   `json:"found"`
+	*nix.Info
+	// Plugin is whether devbox has a plugin for the package.
+	Plugin bool `json:"plugin"`
+	// NixpkgsChannel is the nixpkgs channel that the package comes from, if
+	// the project's nixpkgs commit was resolved from one.
+	NixpkgsChannel string `json:"nixpkgs_channel,omitempty"`
+}
+
+// InfoJSON prints a JSON array with the info of each package in pkgs.
+// Packages that can't be found are included with "found" set to false.
+func (d *Devbox) InfoJSON(pkgs []string) error {
+	infos := make([]pkgInfoJSON, 0, len(pkgs))
+	for _, pkg := range pkgs {
+		entry := pkgInfoJSON{Package: pkg}
+		if info, found := d.pkgInfo(pkg); found {
+			entry.Found = true
+			entry.Info = info
+			entry.NixpkgsChannel = d.nixpkgsChannel(pkg)
+		}
+		hasPlugin, err := plugin.Exists(pkg, d.projectDir)
+		if err != nil {
+			return err
+		}
+		entry.Plugin = hasPlugin
+		infos = append(infos, entry)
+	}
+	out, err := json.MarshalIndent(infos, "", "  ")
+	if err != nil {
+		return errors.WithStack(err)
+	}
+	_, err = fmt.Fprintln(d.writer, string(out))
+	return errors.WithStack(err)
+}
+
 // generates devcontainer.json and Dockerfile for vscode run-in-container
-// and Github Codespaces
+// and Github Codespaces. If the project has services with process-compose
+// files, it also generates a docker-compose.yml that runs them next to the
+// devcontainer.
 func (d *Devbox) GenerateDevcontainer(force bool) error {
 	// construct path to devcontainer directory
 	devContainerPath := filepath.Join(d.projectDir, ".devcontainer/")
 	devContainerJSONPath := filepath.Join(devContainerPath, "devcontainer.json")
 	dockerfilePath := filepath.Join(devContainerPath, "Dockerfile")
+	composePath := filepath.Join(devContainerPath, generate.ComposeFilename)
 
-	// check if devcontainer.json or Dockerfile exist
-	filesExist := plansdk.FileExists(devContainerJSONPath) || plansdk.FileExists(dockerfilePath)
+	// check if devcontainer.json, Dockerfile or docker-compose.yml exist
+	filesExist := plansdk.FileExists(devContainerJSONPath) ||
+		plansdk.FileExists(dockerfilePath) ||
+		plansdk.FileExists(composePath)
 
 	if force || !filesExist {
 		// create directory
@@ -508,18 +1638,29 @@ func (d *Devbox) GenerateDevcontainer(force bool) error {
 			return errors.WithStack(err)
 		}
 		// generate dockerfile
-		err = generate.CreateDockerfile(tmplFS, devContainerPath)
+		err = generate.CreateDockerfile(tmplFS, devContainerPath, false /* multistage */)
 		if err != nil {
 			return errors.WithStack(err)
 		}
+		// generate docker-compose.yml with the services as they are in the
+		// containers
+		svcs, err := plugin.GetServices(d.packages(), generate.ContainerProjectDir)
+		if err != nil {
+			return err
+		}
+		compose, err := generate.CreateDockerCompose(devContainerPath, svcs)
+		if err != nil {
+			return err
+		}
 		// generate devcontainer.json
-		err = generate.CreateDevcontainer(devContainerPath, d.packages())
+		err = generate.CreateDevcontainer(
+			devContainerPath, d.packages(), compose, d.cfg.devcontainerOptions())
 		if err != nil {
 			return errors.WithStack(err)
 		}
 	} else {
 		return usererr.New(
-			"Files devcontainer.json or Dockerfile are already present in .devcontainer/. " +
+			"Files devcontainer.json, Dockerfile or docker-compose.yml are already present in .devcontainer/. " +
 				"Remove the files or use --force to overwrite them.",
 		)
 	}
@@ -527,13 +1668,13 @@ func (d *Devbox) GenerateDevcontainer(force bool) error {
 }
 
 // generates a Dockerfile that replicates the devbox shell
-func (d *Devbox) GenerateDockerfile(force bool) error {
+func (d *Devbox) GenerateDockerfile(force, multistage bool) error {
 	dockerfilePath := filepath.Join(d.projectDir, "Dockerfile")
 	// check if Dockerfile doesn't exist
 	filesExist := plansdk.FileExists(dockerfilePath)
 	if force || !filesExist {
 		// generate dockerfile
-		err := generate.CreateDockerfile(tmplFS, d.projectDir)
+		err := generate.CreateDockerfile(tmplFS, d.projectDir, multistage)
 		if err != nil {
 			return errors.WithStack(err)
 		}
@@ -547,60 +1688,163 @@ func (d *Devbox) GenerateDockerfile(force bool) error {
 	return nil
 }
 
-// generates a .envrc file that makes direnv integration convenient
-func (d *Devbox) GenerateEnvrc(force bool, source string) error {
-	envrcfilePath := filepath.Join(d.projectDir, ".envrc")
-	filesExist := fileutil.Exists(envrcfilePath)
-	// confirm .envrc doesn't exist and don't overwrite an existing .envrc
-	if force || !filesExist {
-		if commandExists("direnv") {
-			// prompt for direnv allow
-			var result string
-			prompt := &survey.Input{
-				Message: "Do you want to enable direnv integration for this devbox project? [y/N]",
-			}
-			err := survey.AskOne(prompt, &result)
-			if err != nil {
-				return errors.WithStack(err)
-			}
+// generates a justfile with a recipe for each script in devbox.json
+func (d *Devbox) GenerateJustfile(force bool) error {
+	justfilePath := filepath.Join(d.projectDir, "justfile")
+	if !force && fileutil.Exists(justfilePath) {
+		return usererr.New(
+			"A justfile is already present in the current directory. " +
+				"Remove it or use --force to overwrite it.",
+		)
+	}
+	return errors.WithStack(generate.CreateJustfile(tmplFS, d.projectDir, lo.Keys(d.cfg.scripts())))
+}
 
-			if strings.ToLower(result) == "y" {
-				// .envrc file creation
-				err := generate.CreateEnvrc(tmplFS, d.projectDir)
-				if err != nil {
-					return errors.WithStack(err)
-				}
-				cmd := exec.Command("direnv", "allow")
-				err = cmd.Run()
-				if err != nil {
-					return errors.WithStack(err)
-				}
-			} else if source == "generate" {
-				// .envrc file creation
-				err := generate.CreateEnvrc(tmplFS, d.projectDir)
-				if err != nil {
-					return errors.WithStack(err)
-				}
-			}
-		}
-	} else {
+// GenerateReadmeSnippet writes a markdown section to w that documents the
+// project's packages, scripts and services for its README.
+func (d *Devbox) GenerateReadmeSnippet(w io.Writer) error {
+	services, err := d.Services()
+	if err != nil {
+		return err
+	}
+	scripts := []generate.ReadmeScript{}
+	for name, script := range d.cfg.scripts() {
+		scripts = append(scripts, generate.ReadmeScript{
+			Name:         name,
+			Description:  script.Description,
+			Environments: script.EnvironmentNames(),
+		})
+	}
+	return generate.WriteReadmeSnippet(tmplFS, w, d.packages(), scripts, lo.Keys(services))
+}
+
+// EnvrcOption configures GenerateEnvrc.
+type EnvrcOption func(*envrcOptions)
+
+type envrcOptions struct {
+	// allowDirenv is whether to run direnv allow, or nil to ask the user.
+	allowDirenv *bool
+}
+
+// WithDirenvAllow makes GenerateEnvrc run direnv allow if allow is true
+// instead of asking whether to enable the direnv integration.
+func WithDirenvAllow(allow bool) EnvrcOption {
+	return func(o *envrcOptions) {
+		o.allowDirenv = &allow
+	}
+}
+
+// GenerateEnvrc generates a .envrc file that makes direnv integration
+// convenient, and runs direnv allow if the user wants to enable it. When
+// source is "init" the .envrc is only created if the integration is enabled.
+func (d *Devbox) GenerateEnvrc(force bool, source string, opts ...EnvrcOption) error {
+	envrcOpts := &envrcOptions{}
+	for _, opt := range opts {
+		opt(envrcOpts)
+	}
+
+	envrcfilePath := filepath.Join(d.projectDir, ".envrc")
+	// don't overwrite an existing .envrc
+	if !force && fileutil.Exists(envrcfilePath) {
 		return usererr.New(
 			"A .envrc is already present in the current directory. " +
 				"Remove it or use --force to overwrite it.",
 		)
 	}
+	if !commandExists("direnv") {
+		return nil
+	}
+
+	var allow bool
+	if envrcOpts.allowDirenv != nil {
+		allow = *envrcOpts.allowDirenv
+	} else {
+		var err error
+		allow, err = confirmOrNo(d.confirm,
+			"Do you want to enable direnv integration for this devbox project?", false)
+		if err != nil {
+			return err
+		}
+	}
+	if !allow && source != "generate" {
+		return nil
+	}
 
+	if err := generate.CreateEnvrc(tmplFS, d.projectDir); err != nil {
+		return errors.WithStack(err)
+	}
+	if allow {
+		cmd := exec.Command("direnv", "allow")
+		cmd.Dir = d.projectDir
+		if err := cmd.Run(); err != nil {
+			return errors.WithStack(err)
+		}
+	}
 	return nil
 }
 
-// saveCfg writes the config file to the devbox directory.
-func (d *Devbox) saveCfg() error {
-	cfgPath := filepath.Join(d.projectDir, configFilename)
-	return cuecfg.WriteFile(cfgPath, d.cfg)
+// saveCfg writes the config file back to the devbox directory, in the same
+// format it was read.
+func (d *Devbox) saveCfg() error {
+	data, err := marshalConfig(d.cfg, filepath.Ext(d.configPath))
+	if err != nil {
+		return err
+	}
+	if old, err := os.ReadFile(d.configPath); err == nil && filepath.Ext(d.configPath) == ".json" {
+		// Only rewrite the fields that changed so that the user's
+		// formatting and comments stay put.
+		if patched, err := cuecfg.PatchJSON(old, data); err == nil {
+			data = patched
+		} else {
+			debug.Log("unable to patch %s, rewriting it: %v", d.configPath, err)
+		}
+		if cuecfg.CountJSONComments(data) < cuecfg.CountJSONComments(old) {
+			ux.Fwarning(d.writer, "devbox removed some comments in %s when it updated it.\n", filepath.Base(d.configPath))
+		}
+	}
+	return errors.WithStack(os.WriteFile(d.configPath, data, 0644))
+}
+
+func (d *Devbox) Services() (plugin.Services, error) {
+	return plugin.GetServices(d.packages(), d.projectDir)
+}
+
+// ServiceStatuses returns the project's services along with whether each one
+// is running.
+func (d *Devbox) ServiceStatuses(ctx context.Context) ([]services.Info, error) {
+	svcs, err := d.Services()
+	if err != nil {
+		return nil, err
+	}
+	env, err := plugin.Env(d.packages(), d.projectDir)
+	if err != nil {
+		return nil, err
+	}
+	return services.Statuses(ctx, svcs, env, d.processManagerOpts()), nil
+}
+
+// processManagerOpts returns the process-compose settings in devbox.json, with
+// the file resolved relative to the project directory.
+func (d *Devbox) processManagerOpts() *services.ProcessManagerOpts {
+	opts := &services.ProcessManagerOpts{}
+	if pc := d.cfg.ProcessCompose; pc != nil {
+		opts.Port = pc.Port
+		if pc.File != "" {
+			opts.File = filepath.Join(d.projectDir, pc.File)
+		}
+	}
+	return opts
 }
 
-func (d *Devbox) Services() (plugin.Services, error) {
-	return plugin.GetServices(d.packages(), d.projectDir)
+// ServiceLogs writes the output of the services that the running process
+// manager runs to w, or the output of all of them if serviceNames is empty.
+func (d *Devbox) ServiceLogs(
+	ctx context.Context,
+	w io.Writer,
+	opts services.LogsOpts,
+	serviceNames ...string,
+) error {
+	return services.Logs(ctx, serviceNames, d.processManagerOpts(), opts, w)
 }
 
 func (d *Devbox) StartServices(ctx context.Context, serviceNames ...string) error {
@@ -622,8 +1866,9 @@ func (d *Devbox) StartProcessManager(ctx context.Context) error {
 			break
 		}
 	}
-	if !hasServiceWithProcessCompose {
-		return usererr.New("No services with process-compose.yaml found")
+	opts := d.processManagerOpts()
+	if !hasServiceWithProcessCompose && opts.File == "" {
+		return usererr.New("No services with process-compose.yaml found, and process_compose.file isn't set in devbox.json")
 	}
 	processComposePath, err := utilityLookPath("process-compose")
 	if err != nil {
@@ -636,7 +1881,21 @@ func (d *Devbox) StartProcessManager(ctx context.Context) error {
 		return d.Exec("devbox", "services", "manager")
 	}
 
-	return services.StartProcessManager(ctx, processComposePath, svcs)
+	return services.StartProcessManager(ctx, processComposePath, svcs, opts)
+}
+
+// PortForwardService makes a service's port reachable on the host. mapping is
+// optional and has the form "local" or "local:remote".
+func (d *Devbox) PortForwardService(ctx context.Context, serviceName, mapping string) error {
+	svcs, err := d.Services()
+	if err != nil {
+		return err
+	}
+	portMapping, err := services.ParsePortMapping(svcs, serviceName, mapping)
+	if err != nil {
+		return err
+	}
+	return services.PortForward(ctx, portMapping, d.writer)
 }
 
 func (d *Devbox) StopServices(ctx context.Context, serviceNames ...string) error {
@@ -646,12 +1905,84 @@ func (d *Devbox) StopServices(ctx context.Context, serviceNames ...string) error
 	return services.Stop(ctx, d.packages(), serviceNames, d.projectDir, d.writer)
 }
 
-func (d *Devbox) generateShellFiles() error {
+func (d *Devbox) RestartServices(ctx context.Context, serviceNames ...string) error {
+	if !IsDevboxShellEnabled() {
+		return d.Exec(append([]string{"devbox", "services", "restart"}, serviceNames...)...)
+	}
+	return services.Restart(ctx, d.packages(), serviceNames, d.projectDir, d.writer)
+}
+
+// generateShellFiles writes the files in .devbox/gen. It returns the ones
+// that were out of date, relative to the project's directory.
+func (d *Devbox) generateShellFiles() ([]string, error) {
 	plan, err := d.ShellPlan()
+	if err != nil {
+		return nil, err
+	}
+	stale, err := generateForShell(d.projectDir, plan, d.pluginManager)
+	if err != nil {
+		return nil, err
+	}
+	for _, path := range stale {
+		debug.Log("Regenerated out of date file %s", path)
+	}
+	return stale, nil
+}
+
+// warnStaleShellFiles tells the user that generated files didn't match the
+// project's config, such as when they were committed or edited by hand, and
+// that they were regenerated.
+func (d *Devbox) warnStaleShellFiles(stale []string) {
+	if len(stale) == 0 {
+		return
+	}
+	ux.Fwarning(d.writer, "regenerated these files because they were out of date with %s: %s\n",
+		filepath.Base(d.configPath), strings.Join(stale, ", "))
+}
+
+// prepareOfflineShell is ensurePackagesAreInstalled for shells that can't use
+// the network. Instead of installing or resolving packages, it fails if any of
+// them aren't installed or resolved yet.
+func (d *Devbox) prepareOfflineShell() error {
+	if err := d.runBeforeInitHook(); err != nil {
+		return err
+	}
+	unresolved := []string{}
+	for _, pkg := range d.cfg.RawPackages {
+		if _, _, versioned := parseVersionedPackage(pkg); versioned {
+			if _, pinned := d.cfg.pinnedPackage(pkg); !pinned {
+				unresolved = append(unresolved, pkg)
+			}
+		}
+	}
+	if len(unresolved) > 0 {
+		return usererr.New(
+			"These packages' versions haven't been resolved yet, which needs the network: %s. "+
+				"Run devbox shell without --offline once to resolve them.",
+			strings.Join(unresolved, ", "))
+	}
+
+	stale, err := d.generateShellFiles()
 	if err != nil {
 		return err
 	}
-	return generateForShell(d.projectDir, plan, d.pluginManager)
+	d.warnStaleShellFiles(stale)
+	if featureflag.Flakes.Disabled() {
+		// Without flakes, nix print-dev-env is what finds out whether
+		// the packages are in the nix store.
+		return nil
+	}
+	pending, err := d.pendingPackagesForInstallation()
+	if err != nil {
+		return err
+	}
+	if len(pending) > 0 {
+		return usererr.New(
+			"These packages aren't installed yet, and devbox can't download them offline: %s. "+
+				"Run devbox shell without --offline once to install them.",
+			strings.Join(pending, ", "))
+	}
+	return nil
 }
 
 // installMode is an enum for helping with ensurePackagesAreInstalled implementation
@@ -665,15 +1996,70 @@ const (
 
 // TODO savil. move to packages.go
 func (d *Devbox) ensurePackagesAreInstalled(mode installMode) error {
-	if err := d.generateShellFiles(); err != nil {
+	if err := d.runBeforeInitHook(); err != nil {
+		return err
+	}
+	unlock, err := d.lockProfile()
+	if err != nil {
+		return err
+	}
+	defer unlock()
+
+	// Packages with a version may have been added to devbox.json by hand.
+	pinned, err := d.pinPackages(d.cfg.RawPackages)
+	if err != nil {
+		return err
+	}
+	if len(pinned) > 0 {
+		if err := d.saveCfg(); err != nil {
+			return err
+		}
+	}
+
+	lock, err := readLockfile(d.projectDir)
+	if err != nil {
+		return err
+	}
+	locked := d.realiseLockedPackages(lock)
+
+	stale, err := d.generateShellFiles()
+	if err != nil {
 		return err
 	}
 	if mode == ensure {
+		// When packages are added or removed, the files are expected to
+		// be out of date.
+		d.warnStaleShellFiles(stale)
 		fmt.Fprintln(d.writer, "Ensuring packages are installed.")
 	}
 
+	repaired, err := d.resetBrokenProfile()
+	if err != nil {
+		return err
+	}
+	if err := d.installPackages(mode, locked); err != nil {
+		if repaired {
+			return usererr.WithUserMessage(
+				err,
+				"Devbox was unable to repair the broken nix profile in %s. "+
+					"Run `devbox profile rollback` to switch back to an earlier generation of it.",
+				filepath.Join(d.projectDir, filepath.Dir(nix.ProfilePath)),
+			)
+		}
+		return err
+	}
+	if err := d.updateLockfile(lock); err != nil {
+		return err
+	}
+
+	return plugin.RemoveInvalidSymlinks(d.projectDir)
+}
+
+// installPackages installs the project's packages into its nix profile. With
+// flakes, the packages in locked are installed from their locked store paths.
+func (d *Devbox) installPackages(mode installMode, locked map[string][]string) error {
 	if featureflag.Flakes.Enabled() {
-		if err := d.addPackagesToProfile(mode); err != nil {
+		if err := d.addPackagesToProfile(mode, locked); err != nil {
 			return err
 		}
 
@@ -692,8 +2078,7 @@ func (d *Devbox) ensurePackagesAreInstalled(mode installMode) error {
 			return errors.Wrap(err, "apply Nix derivation")
 		}
 	}
-
-	return plugin.RemoveInvalidSymlinks(d.projectDir)
+	return nil
 }
 
 // TODO savil. move to packages.go
@@ -704,7 +2089,7 @@ func (d *Devbox) printPackageUpdateMessage(
 	verb := "installed"
 	var infos []*nix.Info
 	for _, pkg := range pkgs {
-		info, _ := nix.PkgInfo(d.cfg.Nixpkgs.Commit, pkg)
+		info, _ := d.pkgInfo(pkg)
 		infos = append(infos, info)
 	}
 	if mode == uninstall {
@@ -757,106 +2142,263 @@ func (d *Devbox) printPackageUpdateMessage(
 // duplicate keys from the previous:
 //
 //  1. Copy variables from the current environment except for those in
-//     ignoreCurrentEnvVar, such as PWD and SHELL.
+//     ignoreCurrentEnvVar, such as PWD and SHELL. Variables matching one of
+//     the envPassthrough glob patterns are always copied.
 //  2. Copy variables from "nix print-dev-env" except for those in
-//     ignoreDevEnvVar, such as TMPDIR and HOME.
-//  3. Copy variables from Devbox plugins.
-//  4. Set PATH to the concatenation of the PATHs from step 3, step 2, and
+//     ignoreDevEnvVar, such as TMPDIR and HOME, and those passed through in
+//     step 1.
+//  3. Copy variables from the project's dotenv file, if it has one.
+//  4. Copy variables from Devbox plugins.
+//  5. Set PATH to the concatenation of the PATHs from step 4, step 2, and
 //     step 1 (in that order).
 //
 // The final result is a set of environment variables where Devbox plugins have
-// the highest priority, then Nix environment variables, and then variables
-// from the current environment. Similarly, the PATH gives Devbox plugin
+// the highest priority, then the dotenv file, then Nix environment variables,
+// and then variables from the current environment. Similarly, the PATH gives Devbox plugin
 // binaries the highest priority, then Nix packages, and then non-Nix
 // programs.
 //
 // Note that the shellrc.tmpl template (which sources this environment) does
 // some additional processing. The computeNixEnv environment won't necessarily
 // represent the final "devbox run" or "devbox shell" environments.
-func (d *Devbox) computeNixEnv() (map[string]string, error) {
-	currentEnv := os.Environ()
+func (d *Devbox) computeNixEnv(envPassthrough ...string) (map[string]string, error) {
+	return d.computeNixEnvWithHistory(nil, nixEnvOptions{envPassthrough: envPassthrough})
+}
+
+// computeOfflineNixEnv is computeNixEnv, but it doesn't download any packages.
+// If some of the packages aren't in the nix store yet, it warns and leaves the
+// nix layer out of the environment instead of failing.
+func (d *Devbox) computeOfflineNixEnv() (map[string]string, error) {
+	return d.computeNixEnvWithHistory(nil, nixEnvOptions{offline: true, fallbackToProfile: true})
+}
+
+// nixEnvOptions control how computeNixEnvWithHistory computes the
+// environment.
+type nixEnvOptions struct {
+	// offline computes the environment without downloading anything. If
+	// nix needs something that it hasn't downloaded yet, that's an error
+	// unless fallbackToProfile is set.
+	offline bool
+	// fallbackToProfile makes an environment that nix can't compute
+	// offline a warning instead of an error. The environment then only has
+	// the binaries of the profile's packages on the PATH.
+	fallbackToProfile bool
+	// pure leaves the current environment out, except for the variables in
+	// pureEnvVars and the ones matching envPassthrough.
+	pure           bool
+	envPassthrough []string
+	// refresh recomputes the output of nix print-dev-env instead of using
+	// the cached one.
+	refresh bool
+}
+
+// computeNixEnvWithHistory is computeNixEnv, but it also records which layer
+// set each variable in history (if it isn't nil), and opts control how the
+// environment is computed.
+func (d *Devbox) computeNixEnvWithHistory(
+	history envHistory,
+	opts nixEnvOptions,
+) (map[string]string, error) {
+	currentEnv, passedThrough, err := copyCurrentEnv(os.Environ(), opts.envPassthrough)
+	if err != nil {
+		return nil, err
+	}
+	if opts.pure {
+		currentEnv = pureEnv(currentEnv, passedThrough)
+	}
 	env := make(map[string]string, len(currentEnv))
-	for _, kv := range currentEnv {
-		key, val, found := strings.Cut(kv, "=")
-		if !found {
-			return nil, errors.Errorf("expected \"=\" in keyval: %s", kv)
-		}
-		if ignoreCurrentEnvVar[key] {
-			continue
-		}
-		env[key] = val
+	for k, v := range currentEnv {
+		history.set(env, k, v, lo.Ternary(passedThrough[k], envSourcePassthrough, envSourceHost))
 	}
 	currentEnvPath := env["PATH"]
 	debug.Log("current environment PATH is: %s", currentEnvPath)
 
-	vaf, err := nix.PrintDevEnv(d.nixShellFilePath(), d.nixFlakesFilePath())
+	vaf, err := d.cachedPrintDevEnv(&nix.PrintDevEnvArgs{
+		NixShellFilePath:  d.nixShellFilePath(),
+		NixFlakesFilePath: d.nixFlakesFilePath(),
+		RestrictUnfree:    d.cfg.restrictUnfree(),
+		Offline:           opts.offline,
+		ExtraFlags:        nix.BinaryCacheFlags(d.cfg.binaryCaches()),
+	}, opts.refresh)
+	if errors.Is(err, nix.ErrPackageUnfree) {
+		return nil, usererr.WithUserMessage(
+			err,
+			"One of the packages has an unfree license and this project sets allow_unfree to false. "+
+				"Add the package to unfree_packages in devbox.json to allow it.",
+		)
+	}
+	if err != nil && opts.offline && !opts.fallbackToProfile {
+		return nil, usererr.WithUserMessage(err,
+			"Unable to compute the environment offline, because nix needs something that it hasn't "+
+				"downloaded yet. Run devbox shell without --offline once to download it.")
+	}
+	if err != nil && opts.offline && opts.fallbackToProfile {
+		ux.Fwarning(d.writer,
+			"Unable to compute the nix environment without installing packages. Only the packages "+
+				"already installed in the project's profile are available, without their "+
+				"environment variables: %v\n", err)
+		vaf, err = nil, nil
+		history.set(env, "PATH", nix.JoinPathLists(d.profileBinDir(), env["PATH"]), envSourceProfile)
+	}
 	if err != nil {
 		return nil, err
 	}
 
-	// Add environment variables from "nix print-dev-env" except for a few
-	// special ones we need to ignore.
-	for key, val := range vaf.Variables {
-		// We only care about "exported" because the var and array types seem to only be used by nix-defined
-		// functions that we don't need (like genericBuild). For reference, each type translates to bash as follows:
-		// var: export VAR=VAL
-		// exported: export VAR=VAL
-		// array: declare -a VAR=('VAL1' 'VAL2' )
-		if val.Type != "exported" {
-			continue
-		}
+	// vaf is nil if the environment was computed offline and nix couldn't
+	// evaluate it.
+	if vaf != nil {
+		// Add environment variables from "nix print-dev-env" except for a few
+		// special ones we need to ignore.
+		for key, val := range vaf.Variables {
+			// We only care about "exported" because the var and array types seem to only be used by nix-defined
+			// functions that we don't need (like genericBuild). For reference, each type translates to bash as follows:
+			// var: export VAR=VAL
+			// exported: export VAR=VAL
+			// array: declare -a VAR=('VAL1' 'VAL2' )
+			// Projects that need the arrays can opt in with shell.export_arrays,
+			// which exports them as a string of quoted words since environment
+			// variables can't hold arrays.
+			var value string
+			switch {
+			case val.Type == "exported":
+				value = val.Value.(string)
+			case val.Type == "array" && d.cfg.Shell.ExportArrays:
+				value = joinShellWords(val.Value)
+			default:
+				continue
+			}
 
-		// SSL_CERT_FILE is a special-case. We only ignore it if it's
-		// set to a specific value. This emulates the behavior of
-		// "nix develop".
-		if key == "SSL_CERT_FILE" && val.Value.(string) == "/no-cert-file.crt" {
-			continue
-		}
+			// SSL_CERT_FILE is a special-case. We only ignore it if it's
+			// set to a specific value. This emulates the behavior of
+			// "nix develop".
+			if key == "SSL_CERT_FILE" && value == "/no-cert-file.crt" {
+				continue
+			}
 
-		// Certain variables get set to invalid values after Nix builds
-		// the shell environment. For example, HOME=/homeless-shelter
-		// and TMPDIR points to a missing directory. We want to ignore
-		// those values and just use the values from the current
-		// environment instead.
-		if ignoreDevEnvVar[key] {
-			continue
-		}
+			// Certain variables get set to invalid values after Nix builds
+			// the shell environment. For example, HOME=/homeless-shelter
+			// and TMPDIR points to a missing directory. We want to ignore
+			// those values and just use the values from the current
+			// environment instead.
+			if ignoreDevEnvVar[key] || passedThrough[key] {
+				continue
+			}
 
-		env[key] = val.Value.(string)
+			history.set(env, key, value, envSourceNix)
+		}
 	}
 	nixEnvPath := env["PATH"]
 	debug.Log("nix environment PATH is: %s", nixEnvPath)
 
+	if err := d.addDevboxEnv(env, history); err != nil {
+		return nil, err
+	}
+
+	// TODO: consider removing this; not being used?
+	pluginVirtenvPath := d.pluginVirtenvPath()
+	debug.Log("plugin virtual environment PATH is: %s", pluginVirtenvPath)
+
+	history.set(env, "PATH", nix.JoinPathLists(pluginVirtenvPath, nixEnvPath, currentEnvPath), envSourcePath)
+	debug.Log("computed unified environment PATH is: %s", env["PATH"])
+
+	return env, nil
+}
+
+// addDevboxEnv adds the variables that devbox itself, the dotenv file, plugins
+// and devbox.json define on top of env.
+func (d *Devbox) addDevboxEnv(env map[string]string, history envHistory) error {
 	// These variables are only needed for shell, but we include them here in the computed env
 	// for both shell and run in order to be as identical as possible.
-	env["__ETC_PROFILE_NIX_SOURCED"] = "1" // Prevent user init file from loading nix profiles
-	env["DEVBOX_SHELL_ENABLED"] = "1"      // Used to determine whether we're inside a shell (e.g. to prevent shell inception)
+	history.set(env, "__ETC_PROFILE_NIX_SOURCED", "1", envSourceDevbox) // Prevent user init file from loading nix profiles
+	history.set(env, "DEVBOX_SHELL_ENABLED", "1", envSourceDevbox)      // Used to determine whether we're inside a shell (e.g. to prevent shell inception)
 
-	// Add any vars defined in plugins.
-	pluginEnv, err := plugin.Env(d.packages(), d.projectDir)
+	// Set the built-in variables before the plugin and config layers so that
+	// config values can refer to them, but don't let those layers change them.
+	builtins := d.builtinEnv()
+	for k, v := range builtins {
+		history.set(env, k, v, envSourceDevbox)
+	}
+
+	// Add the vars in the project's dotenv file, so that they can be
+	// referenced in devbox.json without being written there.
+	envFile := d.envFilePath()
+	dotenv, err := readEnvFile(envFile)
 	if err != nil {
-		return nil, err
+		return err
 	}
-	for k, v := range pluginEnv {
-		env[k] = v
+	for k, v := range dotenv {
+		if _, ok := builtins[k]; ok {
+			continue
+		}
+		history.set(env, k, v, envFileSource(envFile))
+	}
+
+	// Add any vars defined in plugins.
+	for _, pkg := range d.packages() {
+		pluginEnv, err := plugin.Env([]string{pkg}, d.projectDir)
+		if err != nil {
+			return err
+		}
+		for k, v := range pluginEnv {
+			if _, ok := builtins[k]; ok {
+				continue
+			}
+			history.set(env, k, v, pluginEnvSource(pkg))
+		}
 	}
 
 	// Include env variables in devbox.json
 	if featureflag.EnvConfig.Enabled() {
+		for k := range d.cfg.env() {
+			if _, ok := builtins[k]; ok {
+				color.New(color.FgYellow).Fprintf(
+					d.writer, "Warning: ignoring %s in devbox.json env because it's set by devbox.\n", k)
+			}
+		}
+		configEnv, err := d.configEnvs(env)
+		if err != nil {
+			return err
+		}
 		// TODO: if the uer defines PATH here, how should it be handled?
-		for k, v := range d.configEnvs(env) {
-			env[k] = v
+		for k, v := range configEnv {
+			history.set(env, k, v, envSourceConfig)
 		}
 	}
+	return nil
+}
 
-	// TODO: consider removing this; not being used?
-	pluginVirtenvPath := d.pluginVirtenvPath()
-	debug.Log("plugin virtual environment PATH is: %s", pluginVirtenvPath)
-
-	env["PATH"] = nix.JoinPathLists(pluginVirtenvPath, nixEnvPath, currentEnvPath)
-	debug.Log("computed unified environment PATH is: %s", env["PATH"])
+// builtinEnv returns the variables that devbox always sets in the shell and
+// in scripts so that they can find the project regardless of the current
+// directory:
+//
+//   - DEVBOX_PROJECT_ROOT is the project directory.
+//   - DEVBOX_CONFIG_DIR is the directory containing the project's config file.
+//   - DEVBOX_PACKAGES_DIR is the bin directory of the project's nix profile.
+//   - DEVBOX_ENV is the environment that selects scripts' overrides. devbox run
+//     --environment replaces it.
+func (d *Devbox) builtinEnv() map[string]string {
+	configDir := d.projectDir
+	if d.configPath != "" {
+		configDir = filepath.Dir(d.configPath)
+	}
+	return map[string]string{
+		"DEVBOX_PROJECT_ROOT": d.projectDir,
+		"DEVBOX_CONFIG_DIR":   configDir,
+		"DEVBOX_PACKAGES_DIR": d.profileBinDir(),
+		"DEVBOX_ENV":          os.Getenv("DEVBOX_ENV"),
+	}
+}
 
-	return env, nil
+// ExplainEnv prints the final value of each variable in vars along with the
+// layers of the devbox environment that set it.
+func (d *Devbox) ExplainEnv(vars ...string) error {
+	history := envHistory{}
+	env, err := d.computeNixEnvWithHistory(history, nixEnvOptions{})
+	if err != nil {
+		return err
+	}
+	history.explain(d.writer, env, vars)
+	return nil
 }
 
 // TODO savil. move to packages.go
@@ -874,6 +2416,7 @@ func (d *Devbox) installNixProfile() (err error) {
 		"--install",
 		"-f", filepath.Join(d.projectDir, ".devbox/gen/development.nix"),
 	)
+	cmd.Args = append(cmd.Args, nix.BinaryCacheFlags(d.cfg.binaryCaches())...)
 
 	cmd.Env = nix.DefaultEnv()
 	cmd.Stdout = &nix.PackageInstallWriter{Writer: d.writer}
@@ -893,6 +2436,26 @@ func (d *Devbox) installNixProfile() (err error) {
 	return nil
 }
 
+// runDir returns the directory that WithCwd selects, resolving a relative dir
+// against the project directory, or an error if it isn't a directory.
+func (d *Devbox) runDir(dir string) (string, error) {
+	path := dir
+	if !filepath.IsAbs(path) {
+		path = filepath.Join(d.projectDir, path)
+	}
+	if !fileutil.IsDir(path) {
+		return "", usererr.New("--cwd %s is not a directory in %s", dir, d.projectDir)
+	}
+	return path, nil
+}
+
+// arbitraryCmd returns the shell snippet that runs cmdName with args. Like
+// devbox shell -- used to, the arguments are joined with spaces and parsed by
+// the shell, so devbox run -- 'a | b > c' runs a pipeline.
+func arbitraryCmd(cmdName string, args []string) string {
+	return strings.Join(append([]string{cmdName}, args...), " ")
+}
+
 // writeScriptsToFiles writes scripts defined in devbox.json into files inside .devbox/gen/scripts.
 // Scripts (and hooks) are persisted so that we can easily call them from devbox run (inside or outside shell).
 func (d *Devbox) writeScriptsToFiles() error {
@@ -909,11 +2472,11 @@ func (d *Devbox) writeScriptsToFiles() error {
 
 	// Write all hooks to a file.
 	written := map[string]struct{}{} // set semantics; value is irrelevant
-	pluginHooks, err := plugin.InitHooks(d.packages(), d.projectDir)
+	pluginHooks, err := d.pluginInitHooks("exit 1")
 	if err != nil {
 		return errors.WithStack(err)
 	}
-	hooks := strings.Join(append([]string{d.cfg.Shell.InitHook.String()}, pluginHooks...), "\n\n")
+	hooks := d.runHooks(pluginHooks)
 	// always write it, even if there are no hooks, because scripts will source it.
 	err = d.writeScriptFile(hooksFilename, hooks)
 	if err != nil {
@@ -922,12 +2485,21 @@ func (d *Devbox) writeScriptsToFiles() error {
 	written[d.scriptFilename(hooksFilename)] = struct{}{}
 
 	// Write scripts to files.
-	for name, body := range d.cfg.Shell.Scripts {
-		err = d.writeScriptFile(name, d.scriptBody(body.String()))
+	for name, body := range d.cfg.scripts() {
+		err = d.writeScriptFile(name, d.scriptBody(scriptCommands(body.Commands)))
 		if err != nil {
 			return errors.WithStack(err)
 		}
 		written[d.scriptFilename(name)] = struct{}{}
+
+		for env, override := range body.Environments {
+			envName := environmentScriptName(name, env)
+			err = d.writeScriptFile(envName, d.scriptBody(scriptCommands(override.Command)))
+			if err != nil {
+				return errors.WithStack(err)
+			}
+			written[d.scriptFilename(envName)] = struct{}{}
+		}
 	}
 
 	// Delete any files that weren't written just now.
@@ -943,6 +2515,53 @@ func (d *Devbox) writeScriptsToFiles() error {
 	return nil
 }
 
+// pluginInitHooks returns the commands in the init hooks of the project's
+// plugins. If shell.strict_plugin_hooks is set, each command is checked: if it
+// fails, it prints which plugin's hook failed and then runs onFailure, such as
+// "exit 1".
+func (d *Devbox) pluginInitHooks(onFailure string) ([]string, error) {
+	if !d.cfg.Shell.StrictPluginHooks {
+		return plugin.InitHooks(d.packages(), d.projectDir)
+	}
+	pluginHooks, err := plugin.InitHooksByPlugin(d.packages(), d.projectDir)
+	if err != nil {
+		return nil, err
+	}
+	hooks := []string{}
+	for _, hook := range pluginHooks {
+		hooks = append(hooks, checkedHook(hook, onFailure))
+	}
+	return hooks, nil
+}
+
+// checkedHook wraps a command from a plugin's init hook so that if it fails,
+// it prints the plugin and the command to stderr and then runs onFailure. The
+// command runs in a group rather than a subshell so that its exports still
+// apply.
+func checkedHook(hook plugin.InitHook, onFailure string) string {
+	failed := fmt.Sprintf(
+		`echo "Error: the init hook of the %s plugin failed with exit status $?:" >&2`+"\n"+
+			`printf '  %%s\n' %s >&2`,
+		hook.Plugin, shellescape.Quote(hook.Cmd))
+	if onFailure != "" {
+		failed += "\n" + onFailure
+	}
+	return fmt.Sprintf("{\n%s\n} || {\n%s\n}", hook.Cmd, failed)
+}
+
+// runHooks returns the hooks that scripts run before their commands: the
+// pre-init hook, the init and plugin hooks, and the hook for devbox run.
+func (d *Devbox) runHooks(pluginHooks []string) string {
+	hooks := strings.Join(append([]string{d.cfg.initHook()}, pluginHooks...), "\n\n")
+	if pre := d.cfg.preInitHook(); pre != "" {
+		hooks = pre + "\n\n" + hooks
+	}
+	if run := d.cfg.runHook(); run != "" {
+		hooks += "\n\n" + run
+	}
+	return hooks
+}
+
 func (d *Devbox) writeScriptFile(name string, body string) (err error) {
 	script, err := os.Create(d.scriptPath(d.scriptFilename(name)))
 	if err != nil {
@@ -983,7 +2602,29 @@ func (d *Devbox) nixFlakesFilePath() string {
 }
 
 func (d *Devbox) packages() []string {
-	return d.cfg.Packages(d.writer)
+	return lo.Uniq(append(d.cfg.Packages(d.writer), d.cfg.groupPackages(d.packageGroups)...))
+}
+
+// activatePackageGroups installs the packages in groups along with the
+// project's packages. It returns an error if devbox.json doesn't define one of
+// the groups.
+func (d *Devbox) activatePackageGroups(groups []string) error {
+	all := d.cfg.packageGroups()
+	for _, group := range groups {
+		if _, ok := all[group]; ok {
+			continue
+		}
+		names := maps.Keys(all)
+		if len(names) == 0 {
+			return usererr.New("%s doesn't define any package_groups, so --with %s can't be used",
+				filepath.Base(d.configPath), group)
+		}
+		slices.Sort(names)
+		return usererr.New("%s has no package group named %s. Its groups are: %s",
+			filepath.Base(d.configPath), group, strings.Join(names, ", "))
+	}
+	d.packageGroups = lo.Uniq(append(d.packageGroups, groups...))
+	return nil
 }
 
 func (d *Devbox) pluginVirtenvPath() string {
@@ -993,30 +2634,81 @@ func (d *Devbox) pluginVirtenvPath() string {
 // configEnvs takes the computed env variables (nix + plugin) and adds env
 // variables defined in Config. It also parses variables in config
 // that are referenced by $VAR or ${VAR} and replaces them with
-// their value in the computed env variables. Note, this doesn't
-// allow env variables from outside the shell to be referenced so
-// no leaked variables are caused by this function.
-func (d *Devbox) configEnvs(computedEnv map[string]string) map[string]string {
-	mapperfunc := func(value string) string {
-		// Special variables that should return correct value
-		switch value {
-		case "PWD":
-			return d.ProjectDir()
-		}
-		// check if referenced variables exists in computed environment
-		if v, ok := computedEnv[value]; ok {
-			return v
+// their value, either from the other variables in Config or from the
+// computed env variables. Note, this doesn't allow env variables from
+// outside the shell to be referenced so no leaked variables are caused by
+// this function. Variables that devbox sets itself are left out, so that
+// references to them get devbox's value.
+func (d *Devbox) configEnvs(computedEnv map[string]string) (map[string]string, error) {
+	vars := d.cfg.env()
+	for k := range d.builtinEnv() {
+		delete(vars, k)
+	}
+	return d.expandEnv(vars, computedEnv)
+}
+
+// expandEnv replaces the variables referenced by $VAR or ${VAR} in the values
+// of vars, the same way as configEnvs. A reference to another variable in vars
+// is replaced with that variable's expanded value, so vars are expanded in
+// dependency order. A variable that refers to itself, like PATH=$PATH:/bin,
+// gets the value it has in computedEnv. It returns an error if variables refer
+// to each other in a cycle.
+func (d *Devbox) expandEnv(vars, computedEnv map[string]string) (map[string]string, error) {
+	expanded := map[string]string{}
+	// visiting are the variables that are being expanded, each one
+	// referenced by the one before it.
+	visiting := []string{}
+	var expand func(key string) error
+	expand = func(key string) error {
+		if _, ok := expanded[key]; ok {
+			return nil
+		}
+		if i := slices.Index(visiting, key); i >= 0 {
+			cycle := append(slices.Clone(visiting[i:]), key)
+			return usererr.New("Env variables refer to each other in a cycle: %s", strings.Join(cycle, " -> "))
+		}
+		visiting = append(visiting, key)
+		var err error
+		mapperfunc := func(name string) string {
+			// Special variables that should return correct value
+			switch name {
+			case "PWD":
+				return d.ProjectDir()
+			}
+			// check if referenced variables are also being defined
+			if _, ok := vars[name]; ok && name != key {
+				if expandErr := expand(name); expandErr != nil {
+					if err == nil {
+						err = expandErr
+					}
+					return ""
+				}
+				return expanded[name]
+			}
+			// check if referenced variables exists in computed environment
+			if v, ok := computedEnv[name]; ok {
+				return v
+			}
+			return ""
 		}
-		return ""
-	}
-	configEnvs := map[string]string{}
-	// Include env variables in config
-	for key, value := range d.cfg.Env {
 		// parse values for "$VAR" or "${VAR}"
-		parsedValue := os.Expand(value, mapperfunc)
-		configEnvs[key] = parsedValue
+		value := os.Expand(vars[key], mapperfunc)
+		visiting = visiting[:len(visiting)-1]
+		if err != nil {
+			return err
+		}
+		expanded[key] = value
+		return nil
+	}
+
+	keys := lo.Keys(vars)
+	slices.Sort(keys)
+	for _, key := range keys {
+		if err := expand(key); err != nil {
+			return nil, err
+		}
 	}
-	return configEnvs
+	return expanded, nil
 }
 
 // Move to a utility package?
@@ -1028,11 +2720,140 @@ func IsDevboxShellEnabled() bool {
 	return inDevboxShell
 }
 
+// warnIfScriptShadowsBinary warns that the script called name is run instead
+// of the program with the same name on pathList, which is surprising if the
+// user meant to run the program.
+func (d *Devbox) warnIfScriptShadowsBinary(name, pathList string) {
+	if shellBuiltins[name] {
+		// Scripts are often called test, and nobody means the
+		// /usr/bin/test that exists alongside the builtin.
+		return
+	}
+	binPath := findExecutable(name, pathList)
+	if binPath == "" {
+		return
+	}
+	ux.Fwarning(
+		d.writer,
+		"the script %[1]q in %[2]s runs instead of %[3]s. To run %[3]s, use \"devbox run -- command %[1]s\".\n",
+		name, filepath.Base(d.configPath), binPath,
+	)
+}
+
+// shellBuiltins are the commands that shells run themselves even though a
+// program with the same name is usually on the PATH.
+var shellBuiltins = map[string]bool{
+	"[":      true,
+	"cd":     true,
+	"echo":   true,
+	"false":  true,
+	"kill":   true,
+	"printf": true,
+	"pwd":    true,
+	"test":   true,
+	"true":   true,
+}
+
+// findExecutable returns the path of the first executable file called name in
+// the directories of pathList, or "" if there isn't one. Unlike
+// exec.LookPath, it searches pathList instead of the PATH of devbox itself.
+func findExecutable(name, pathList string) string {
+	if strings.ContainsRune(name, os.PathSeparator) {
+		return ""
+	}
+	for _, dir := range filepath.SplitList(pathList) {
+		if dir == "" {
+			continue
+		}
+		path := filepath.Join(dir, name)
+		if info, err := os.Stat(path); err == nil && info.Mode().IsRegular() && info.Mode()&0o111 != 0 {
+			return path
+		}
+	}
+	return ""
+}
+
 func commandExists(command string) bool {
 	_, err := exec.LookPath(command)
 	return err == nil
 }
 
+// copyCurrentEnv copies the variables in currentEnv (formatted like
+// [os.Environ]) into a map, skipping those in ignoreCurrentEnvVar unless they
+// match one of the passthrough glob patterns. It also returns the set of
+// variables that matched a passthrough pattern.
+func copyCurrentEnv(currentEnv, passthrough []string) (
+	env map[string]string, passedThrough map[string]bool, err error,
+) {
+	env = make(map[string]string, len(currentEnv))
+	passedThrough = map[string]bool{}
+	for _, kv := range currentEnv {
+		key, val, found := strings.Cut(kv, "=")
+		if !found {
+			return nil, nil, errors.Errorf("expected \"=\" in keyval: %s", kv)
+		}
+		for _, pattern := range passthrough {
+			match, err := path.Match(pattern, key)
+			if err != nil {
+				return nil, nil, usererr.New("invalid --env-passthrough pattern %q: %v", pattern, err)
+			}
+			if match {
+				passedThrough[key] = true
+				break
+			}
+		}
+		if ignoreCurrentEnvVar[key] && !passedThrough[key] {
+			continue
+		}
+		env[key] = val
+	}
+	return env, passedThrough, nil
+}
+
+// pureEnvVars are the variables of the current environment that a pure
+// environment keeps, because many programs don't work without them. If one
+// of them isn't set and has a default function, the default is used instead.
+var pureEnvVars = map[string]func() string{
+	"HOME": func() string {
+		if u, err := user.Current(); err == nil {
+			return u.HomeDir
+		}
+		return ""
+	},
+	"USER": func() string {
+		if u, err := user.Current(); err == nil {
+			return u.Username
+		}
+		return ""
+	},
+	"TERM":    func() string { return "xterm-256color" },
+	"LOGNAME": nil,
+	"TMPDIR":  nil,
+	"LANG":    nil,
+	"LC_ALL":  nil,
+}
+
+// pureEnv returns the variables of currentEnv that a pure environment keeps:
+// those in pureEnvVars and those that were passed through with
+// --env-passthrough.
+func pureEnv(currentEnv map[string]string, passedThrough map[string]bool) map[string]string {
+	env := map[string]string{}
+	for k, v := range currentEnv {
+		if _, ok := pureEnvVars[k]; ok || passedThrough[k] {
+			env[k] = v
+		}
+	}
+	for k, defaultValue := range pureEnvVars {
+		if _, ok := env[k]; ok || defaultValue == nil {
+			continue
+		}
+		if v := defaultValue(); v != "" {
+			env[k] = v
+		}
+	}
+	return env
+}
+
 // ignoreCurrentEnvVar contains environment variables that Devbox should remove
 // from the slice of [os.Environ] variables before sourcing them. These are
 // variables that are set automatically by a new shell.
@@ -1073,3 +2894,16 @@ var ignoreDevEnvVar = map[string]bool{
 	"TZ":                 true,
 	"UID":                true,
 }
+
+// joinShellWords converts the value of an array variable from "nix
+// print-dev-env" into a single string of shell-quoted words, so that
+// `eval "set -- $VAR"` or `declare -a arr="($VAR)"` recovers the original
+// elements.
+func joinShellWords(value any) string {
+	elems, _ := value.([]any)
+	words := make([]string, 0, len(elems))
+	for _, elem := range elems {
+		words = append(words, shellescape.Quote(fmt.Sprint(elem)))
+	}
+	return strings.Join(words, " ")
+}
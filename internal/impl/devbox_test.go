@@ -1,17 +1,24 @@
 package impl
 
 import (
+	"bytes"
 	"encoding/json"
 	"fmt"
+	"io"
 	"os"
+	"os/exec"
 	"path/filepath"
 	"strings"
 	"testing"
 
 	"github.com/bmatcuk/doublestar/v4"
+	"github.com/pkg/errors"
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/require"
+	"go.jetpack.io/devbox/internal/impl/shellcmd"
+	"go.jetpack.io/devbox/internal/nix"
 	"go.jetpack.io/devbox/internal/planner/plansdk"
+	"go.jetpack.io/devbox/internal/plugin"
 )
 
 func TestDevbox(t *testing.T) {
@@ -74,3 +81,381 @@ func fileExists(path string) bool {
 	_, err := os.Stat(path)
 	return err == nil
 }
+
+func TestCopyCurrentEnvPassthrough(t *testing.T) {
+	currentEnv := []string{
+		"HOME=/home/user",
+		"GITHUB_TOKEN=secret",
+		"SHLVL=2",
+		"PWD=/tmp",
+		"SHELL=/bin/zsh",
+	}
+
+	env, passedThrough, err := copyCurrentEnv(currentEnv, []string{"GITHUB_*", "SHLVL"})
+	require.NoError(t, err)
+	assert.Equal(t, map[string]string{
+		"HOME":         "/home/user",
+		"GITHUB_TOKEN": "secret",
+		"SHLVL":        "2",
+	}, env)
+	assert.Equal(t, map[string]bool{"GITHUB_TOKEN": true, "SHLVL": true}, passedThrough)
+
+	_, _, err = copyCurrentEnv(currentEnv, []string{"["})
+	assert.Error(t, err)
+}
+
+func TestPureEnv(t *testing.T) {
+	currentEnv := map[string]string{
+		"HOME":         "/home/user",
+		"USER":         "user",
+		"LANG":         "en_US.UTF-8",
+		"GITHUB_TOKEN": "secret",
+		"PATH":         "/usr/bin",
+		"EDITOR":       "vim",
+	}
+
+	env := pureEnv(currentEnv, map[string]bool{"GITHUB_TOKEN": true})
+	assert.Equal(t, map[string]string{
+		"HOME":         "/home/user",
+		"USER":         "user",
+		"LANG":         "en_US.UTF-8",
+		"GITHUB_TOKEN": "secret",
+		"TERM":         "xterm-256color",
+	}, env)
+}
+
+func TestExpandEnv(t *testing.T) {
+	d := &Devbox{projectDir: "/project"}
+	computedEnv := map[string]string{
+		"PATH":     "/nix/bin",
+		"NODE_ENV": "development",
+	}
+
+	env, err := d.expandEnv(map[string]string{
+		"NODE_ENV":  "test",
+		"PATH":      "${PATH}:/project/bin",
+		"DATA_DIR":  "$PWD/data",
+		"UNDEFINED": "$NOT_SET",
+		// Variables can refer to each other, in any order.
+		"CACHE_DIR": "${DATA_DIR}/cache",
+		"LOG_FILE":  "$LOG_DIR/$NODE_ENV.log",
+		"LOG_DIR":   "${CACHE_DIR}/logs",
+	}, computedEnv)
+	require.NoError(t, err)
+	assert.Equal(t, map[string]string{
+		"NODE_ENV":  "test",
+		"PATH":      "/nix/bin:/project/bin",
+		"DATA_DIR":  "/project/data",
+		"UNDEFINED": "",
+		"CACHE_DIR": "/project/data/cache",
+		"LOG_FILE":  "/project/data/cache/logs/test.log",
+		"LOG_DIR":   "/project/data/cache/logs",
+	}, env)
+}
+
+func TestExpandEnvCycle(t *testing.T) {
+	d := &Devbox{projectDir: "/project"}
+	_, err := d.expandEnv(map[string]string{
+		"A": "$B",
+		"B": "${C}/b",
+		"C": "$A",
+		"D": "$A",
+	}, map[string]string{"A": "computed"})
+	assert.ErrorContains(t, err, "A -> B -> C -> A")
+}
+
+func TestRunHooks(t *testing.T) {
+	cfg := &Config{}
+	cfg.Shell.InitHook.Cmds = []string{"echo init"}
+	d := &Devbox{cfg: cfg}
+	assert.Equal(t, "echo init\n\necho plugin", d.runHooks([]string{"echo plugin"}))
+
+	cfg.Shell.PreInitHook = &shellcmd.Commands{Cmds: []string{"echo pre-init"}}
+	cfg.Shell.ShellHook = &shellcmd.Commands{Cmds: []string{"echo shell"}}
+	cfg.Shell.RunHook = &shellcmd.Commands{Cmds: []string{"echo run"}}
+	assert.Equal(
+		t,
+		"echo pre-init\n\necho init\n\necho plugin\n\necho run",
+		d.runHooks([]string{"echo plugin"}),
+	)
+}
+
+func TestCheckedHook(t *testing.T) {
+	run := func(script string) (string, string, int) {
+		stdout, stderr := &bytes.Buffer{}, &bytes.Buffer{}
+		cmd := exec.Command("sh", "-c", script)
+		cmd.Stdout, cmd.Stderr = stdout, stderr
+		err := cmd.Run()
+		var exitErr *exec.ExitError
+		if errors.As(err, &exitErr) {
+			return stdout.String(), stderr.String(), exitErr.ExitCode()
+		}
+		require.NoError(t, err)
+		return stdout.String(), stderr.String(), 0
+	}
+
+	hook := checkedHook(plugin.InitHook{Plugin: "pip", Cmd: "export A=1"}, "exit 3")
+	stdout, stderr, code := run(hook + "\necho \"A=$A\"")
+	assert.Equal(t, "A=1\n", stdout)
+	assert.Empty(t, stderr)
+	assert.Zero(t, code)
+
+	hook = checkedHook(plugin.InitHook{Plugin: "pip", Cmd: "echo 'setting up'; false"}, "exit 3")
+	stdout, stderr, code = run(hook + "\necho after")
+	assert.Equal(t, "setting up\n", stdout)
+	assert.Equal(t,
+		"Error: the init hook of the pip plugin failed with exit status 1:\n  echo 'setting up'; false\n", stderr)
+	assert.Equal(t, 3, code)
+
+	hook = checkedHook(plugin.InitHook{Plugin: "pip", Cmd: "false"}, "")
+	stdout, stderr, code = run(hook + "\necho after")
+	assert.Equal(t, "after\n", stdout)
+	assert.Contains(t, stderr, "the init hook of the pip plugin failed")
+	assert.Zero(t, code)
+}
+
+func TestInfoJSON(t *testing.T) {
+	client := &fakeNix{pkgInfo: func(commit, pkg string) (*nix.Info, bool) {
+		if pkg != "nginx" {
+			return nil, false
+		}
+		return &nix.Info{
+			NixName:     pkg,
+			Name:        "nginx",
+			Version:     "1.24.0",
+			Description: "A reverse proxy and lightweight webserver",
+			Homepage:    "http://nginx.org",
+			License:     "BSD-2-Clause",
+		}, true
+	}}
+
+	out := &bytes.Buffer{}
+	d := &Devbox{cfg: &Config{}, projectDir: t.TempDir(), writer: out, nix: client}
+	require.NoError(t, d.InfoJSON([]string{"nginx", "notarealpackage"}))
+
+	var infos []map[string]any
+	require.NoError(t, json.Unmarshal(out.Bytes(), &infos))
+	assert.Equal(t, []map[string]any{
+		{
+			"package":     "nginx",
+			"found":       true,
+			"name":        "nginx",
+			"version":     "1.24.0",
+			"description": "A reverse proxy and lightweight webserver",
+			"homepage":    "http://nginx.org",
+			"license":     "BSD-2-Clause",
+			"unfree":      false,
+			"broken":      false,
+			"plugin":      true,
+		},
+		{
+			"package": "notarealpackage",
+			"found":   false,
+			"plugin":  false,
+		},
+	}, infos)
+}
+
+func TestAddForce(t *testing.T) {
+	t.Setenv("XDG_DATA_HOME", t.TempDir())
+	client := &fakeNix{
+		pkgInfo: func(commit, pkg string) (*nix.Info, bool) { return nil, false },
+		profileListItems: func(io.Writer, string) ([]*nix.NixProfileListItem, error) {
+			return nil, nil
+		},
+		profileInstall: func(*nix.ProfileInstallArgs) error { return errors.New("build failed") },
+	}
+
+	dir := t.TempDir()
+	_, err := InitConfig(dir, io.Discard)
+	require.NoError(t, err)
+	out := &bytes.Buffer{}
+	box, err := Open(dir, out, withNixClient(client))
+	require.NoError(t, err)
+
+	pkg := "github:example/flake#tool"
+	err = box.Add([]string{pkg})
+	assert.ErrorIs(t, err, nix.ErrPackageNotFound)
+	assert.NotContains(t, out.String(), "--force")
+
+	// With force the package is added, but it's removed again when it
+	// fails to install.
+	err = box.Add([]string{pkg}, WithForce())
+	assert.Error(t, err)
+	assert.Contains(t, out.String(), pkg+" wasn't found in nixpkgs, but --force adds it anyway.")
+	cfg, err := ReadConfig(filepath.Join(dir, configFilename))
+	require.NoError(t, err)
+	assert.Empty(t, cfg.RawPackages)
+}
+
+func TestAddReportsAllMissingPackages(t *testing.T) {
+	t.Setenv("XDG_DATA_HOME", t.TempDir())
+	client := &fakeNix{
+		pkgInfo: func(commit, pkg string) (*nix.Info, bool) {
+			return &nix.Info{NixName: pkg, Name: pkg}, pkg == "hello"
+		},
+		packageNames: func(commit string) ([]string, error) {
+			return []string{"hello", "ripgrep"}, nil
+		},
+	}
+
+	dir := t.TempDir()
+	_, err := InitConfig(dir, io.Discard)
+	require.NoError(t, err)
+	box, err := Open(dir, io.Discard, withNixClient(client))
+	require.NoError(t, err)
+
+	err = box.Add([]string{"hello", "ripgrp", "notarealpackage"})
+	assert.ErrorIs(t, err, nix.ErrPackageNotFound)
+	assert.ErrorContains(t, err, "2 packages weren't found")
+	assert.ErrorContains(t, err, "ripgrp: package not found. Did you mean ripgrep?")
+	assert.ErrorContains(t, err, "notarealpackage: package not found")
+	cfg, err := ReadConfig(filepath.Join(dir, configFilename))
+	require.NoError(t, err)
+	assert.Empty(t, cfg.RawPackages)
+}
+
+func TestAddDryRun(t *testing.T) {
+	t.Setenv("XDG_DATA_HOME", t.TempDir())
+	const cache = "https://cache.nixos.org"
+	installed := []string{"go"}
+	client := profileNix(&installed)
+	client.pkgInfo = func(commit, pkg string) (*nix.Info, bool) {
+		return &nix.Info{NixName: pkg, Name: pkg, Version: "0.11.0"}, true
+	}
+	client.outPaths = func(commit, pkg string) ([]string, error) {
+		return []string{"/nix/store/abc-" + pkg}, nil
+	}
+	// Only the profile's paths are in the local store, so the new package
+	// has to be looked up in the binary cache.
+	client.storeBinaries = func(store, storePath string) ([]string, error) {
+		if store != cache {
+			return nil, errors.New("path is not valid")
+		}
+		return []string{"gofmt", "goimports"}, nil
+	}
+	client.storeClosure = func(store string, paths ...string) ([]nix.StorePathInfo, error) {
+		if strings.HasSuffix(paths[0], nix.ProfilePath) {
+			return []nix.StorePathInfo{
+				{Path: "/nix/store/abc-glibc-2.35", NarSize: 30000},
+				{Path: "/nix/store/abc-go", NarSize: 4000},
+			}, nil
+		}
+		if store != cache {
+			return nil, errors.New("path is not valid")
+		}
+		return []nix.StorePathInfo{
+			{Path: "/nix/store/abc-glibc-2.35", NarSize: 30000},
+			{Path: "/nix/store/abc-gotools", NarSize: 2048},
+		}, nil
+	}
+
+	dir := t.TempDir()
+	_, err := InitConfig(dir, io.Discard)
+	require.NoError(t, err)
+	require.NoError(t, os.MkdirAll(filepath.Join(dir, nix.ProfilePath), 0o755))
+	out := &bytes.Buffer{}
+	box, err := Open(dir, out, withNixClient(client))
+	require.NoError(t, err)
+	box.cfg.RawPackages = []string{"go"}
+	require.NoError(t, box.saveCfg())
+	box.storePathBinaries = map[string][]string{"/nix/store/abc-go": {"go", "gofmt"}}
+
+	// Installing or building anything would call a nil func and panic.
+	client.profileInstall = nil
+	require.NoError(t, box.AddDryRun("go", "gotools"))
+	assert.Contains(t, out.String(), "go is already in devbox.json")
+	assert.Contains(t, out.String(), "gotools (gotools-0.11.0)")
+	assert.Contains(t, out.String(), "New binaries on PATH: goimports\n")
+	assert.Contains(t, out.String(), "Store paths pulled in: 1 (2.0 KiB)")
+	assert.NotContains(t, out.String(), "glibc")
+	assert.Equal(t, []string{"go"}, installed)
+	cfg, err := ReadConfig(filepath.Join(dir, configFilename))
+	require.NoError(t, err)
+	assert.Equal(t, []string{"go"}, cfg.RawPackages)
+}
+
+func TestRemoveAll(t *testing.T) {
+	dir := t.TempDir()
+	_, err := InitConfig(dir, io.Discard)
+	require.NoError(t, err)
+	out := &bytes.Buffer{}
+	box, err := Open(dir, out)
+	require.NoError(t, err)
+	asked := []string{}
+	box.confirm = func(question string, defaultYes bool) (bool, error) {
+		asked = append(asked, question)
+		return false, nil
+	}
+
+	// Without packages there's nothing to confirm.
+	require.NoError(t, box.RemoveAll(true))
+	assert.Empty(t, asked)
+	assert.Equal(t, "There are no packages in devbox.json to remove.\n", out.String())
+
+	// Declining leaves the packages alone.
+	out.Reset()
+	box.cfg.RawPackages = []string{"go", "ripgrep"}
+	require.NoError(t, box.RemoveAll(true))
+	assert.Equal(t, []string{"Remove all 2 packages (go, ripgrep)?"}, asked)
+	assert.Equal(t, "No packages removed.\n", out.String())
+	assert.Equal(t, []string{"go", "ripgrep"}, box.cfg.RawPackages)
+
+	// Without a terminal to ask on, nothing is removed.
+	box.confirm = func(string, bool) (bool, error) { return false, errNoTerminal }
+	assert.ErrorContains(t, box.RemoveAll(true), "pass --yes")
+	assert.Equal(t, []string{"go", "ripgrep"}, box.cfg.RawPackages)
+}
+
+func TestRunDir(t *testing.T) {
+	projectDir := t.TempDir()
+	require.NoError(t, os.MkdirAll(filepath.Join(projectDir, "frontend"), 0o755))
+	d := &Devbox{projectDir: projectDir}
+
+	dir, err := d.runDir("./frontend")
+	assert.NoError(t, err)
+	assert.Equal(t, filepath.Join(projectDir, "frontend"), dir)
+
+	other := t.TempDir()
+	dir, err = d.runDir(other)
+	assert.NoError(t, err)
+	assert.Equal(t, other, dir)
+
+	_, err = d.runDir("backend")
+	assert.ErrorContains(t, err, "--cwd backend is not a directory")
+}
+
+func TestShellHistoryPath(t *testing.T) {
+	projectDir := t.TempDir()
+	d := &Devbox{cfg: &Config{}, projectDir: projectDir}
+	assert.Equal(t, filepath.Join(projectDir, ".devbox/shell_history"), d.shellHistoryPath())
+
+	d.cfg.Shell.HistoryFile = ".history"
+	assert.Equal(t, filepath.Join(projectDir, ".history"), d.shellHistoryPath())
+
+	abs := filepath.Join(t.TempDir(), "history")
+	d.cfg.Shell.HistoryFile = abs
+	assert.Equal(t, abs, d.shellHistoryPath())
+}
+
+func TestParseEnvOverrides(t *testing.T) {
+	env, err := ParseEnvOverrides([]string{
+		"FOO=bar",
+		"QUERY=a=b&c=d",
+		"MESSAGE=hello world",
+		"EMPTY=",
+		"FOO=baz",
+	})
+	require.NoError(t, err)
+	assert.Equal(t, map[string]string{
+		"FOO":     "baz",
+		"QUERY":   "a=b&c=d",
+		"MESSAGE": "hello world",
+		"EMPTY":   "",
+	}, env)
+
+	for _, invalid := range []string{"FOO", "=bar", "1FOO=bar", "FOO BAR=baz"} {
+		_, err := ParseEnvOverrides([]string{invalid})
+		assert.ErrorContains(t, err, "invalid --env", invalid)
+	}
+}
@@ -0,0 +1,126 @@
+// Copyright 2023 Jetpack Technologies Inc and contributors. All rights reserved.
+// Use of this source code is governed by the license in the LICENSE file.
+
+package impl
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/pkg/errors"
+	"go.jetpack.io/devbox/internal/boxcli/featureflag"
+	"go.jetpack.io/devbox/internal/debug"
+	"go.jetpack.io/devbox/internal/fileutil"
+	"go.jetpack.io/devbox/internal/nix"
+)
+
+// devEnvCacheFilename is where the output of nix print-dev-env is cached,
+// relative to the project directory.
+const devEnvCacheFilename = ".devbox/print-dev-env.json"
+
+// devEnvCache is the output of nix print-dev-env and the hash of its inputs.
+type devEnvCache struct {
+	Key          string            `json:"key"`
+	VarsAndFuncs *nix.VarsAndFuncs `json:"vars_and_funcs"`
+}
+
+// devEnvCacheKey hashes the inputs of nix print-dev-env: the nix files that
+// generateShellFiles writes, the nixpkgs commit, and the settings that change
+// how nix evaluates them.
+func (d *Devbox) devEnvCacheKey(args *nix.PrintDevEnvArgs) (string, error) {
+	genDir := filepath.Join(d.projectDir, ".devbox/gen")
+	entries, err := os.ReadDir(genDir)
+	if err != nil {
+		return "", errors.WithStack(err)
+	}
+	files := []string{}
+	for _, entry := range entries {
+		if entry.Type().IsRegular() {
+			files = append(files, filepath.Join(genDir, entry.Name()))
+		}
+	}
+	for _, name := range []string{"flake.nix", "flake.lock"} {
+		if path := filepath.Join(genDir, "flake", name); fileutil.Exists(path) {
+			files = append(files, path)
+		}
+	}
+	sort.Strings(files)
+
+	h := sha256.New()
+	fmt.Fprintf(h, "commit=%s\nrestrict_unfree=%t\nflakes=%t\n",
+		d.cfg.Nixpkgs.Commit, args.RestrictUnfree, featureflag.Flakes.Enabled())
+	for _, path := range files {
+		data, err := os.ReadFile(path)
+		if err != nil {
+			return "", errors.WithStack(err)
+		}
+		fmt.Fprintf(h, "%s %d\n", filepath.Base(path), len(data))
+		h.Write(data)
+	}
+	return hex.EncodeToString(h.Sum(nil)), nil
+}
+
+// cachedPrintDevEnv returns the output of nix print-dev-env from the cache
+// if its inputs haven't changed, and otherwise computes and caches it. refresh
+// skips the cache.
+func (d *Devbox) cachedPrintDevEnv(args *nix.PrintDevEnvArgs, refresh bool) (*nix.VarsAndFuncs, error) {
+	key, err := d.devEnvCacheKey(args)
+	if err != nil {
+		// Without a key the output can't be cached, but it can still be
+		// computed.
+		debug.Log("unable to compute the print-dev-env cache key: %v", err)
+		return d.nix.PrintDevEnv(args)
+	}
+
+	cachePath := filepath.Join(d.projectDir, devEnvCacheFilename)
+	if !refresh {
+		if vaf := readDevEnvCache(cachePath, key); vaf != nil {
+			debug.Log("using the cached output of nix print-dev-env")
+			return vaf, nil
+		}
+	}
+
+	vaf, err := d.nix.PrintDevEnv(args)
+	if err != nil {
+		return nil, err
+	}
+	data, err := json.Marshal(&devEnvCache{Key: key, VarsAndFuncs: vaf})
+	if err == nil {
+		err = os.WriteFile(cachePath, data, 0o644)
+	}
+	if err != nil {
+		debug.Log("unable to cache the output of nix print-dev-env: %v", err)
+	}
+	return vaf, nil
+}
+
+// readDevEnvCache returns the cached output of nix print-dev-env if it was
+// computed from the inputs that key hashes and the store paths on its PATH
+// still exist. It returns nil otherwise.
+func readDevEnvCache(path, key string) *nix.VarsAndFuncs {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil
+	}
+	cache := &devEnvCache{}
+	if err := json.Unmarshal(data, cache); err != nil || cache.Key != key || cache.VarsAndFuncs == nil {
+		return nil
+	}
+	// The nix store may have been garbage collected since the output was
+	// cached.
+	if p, ok := cache.VarsAndFuncs.Variables["PATH"]; ok {
+		pathList, _ := p.Value.(string)
+		for _, dir := range filepath.SplitList(pathList) {
+			if strings.HasPrefix(dir, "/nix/store/") && !fileutil.Exists(dir) {
+				return nil
+			}
+		}
+	}
+	return cache.VarsAndFuncs
+}
@@ -0,0 +1,73 @@
+// Copyright 2023 Jetpack Technologies Inc and contributors. All rights reserved.
+// Use of this source code is governed by the license in the LICENSE file.
+
+package impl
+
+import (
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.jetpack.io/devbox/internal/nix"
+)
+
+func TestCachedPrintDevEnv(t *testing.T) {
+	path := "/usr/bin"
+	calls := 0
+	client := &fakeNix{printDevEnv: func(*nix.PrintDevEnvArgs) (*nix.VarsAndFuncs, error) {
+		calls++
+		vaf := &nix.VarsAndFuncs{}
+		err := json.Unmarshal([]byte(`{"variables": {"PATH": {"type": "exported", "value": "`+path+`"}}}`), vaf)
+		return vaf, err
+	}}
+
+	projectDir := t.TempDir()
+	shellNix := filepath.Join(projectDir, ".devbox/gen/shell.nix")
+	require.NoError(t, os.MkdirAll(filepath.Dir(shellNix), 0o755))
+	require.NoError(t, os.WriteFile(shellNix, []byte("{ }"), 0o644))
+	d := &Devbox{cfg: &Config{Nixpkgs: NixpkgsConfig{Commit: "abc"}}, projectDir: projectDir, nix: client}
+	args := &nix.PrintDevEnvArgs{NixShellFilePath: shellNix}
+
+	vaf, err := d.cachedPrintDevEnv(args, false)
+	require.NoError(t, err)
+	assert.Equal(t, "/usr/bin", vaf.Variables["PATH"].Value)
+	assert.Equal(t, 1, calls)
+
+	// The inputs haven't changed, so the cached output is used.
+	vaf, err = d.cachedPrintDevEnv(args, false)
+	require.NoError(t, err)
+	assert.Equal(t, "/usr/bin", vaf.Variables["PATH"].Value)
+	assert.Equal(t, 1, calls)
+
+	// refresh skips the cache.
+	_, err = d.cachedPrintDevEnv(args, true)
+	require.NoError(t, err)
+	assert.Equal(t, 2, calls)
+
+	// Regenerating the nix files with different content invalidates it.
+	require.NoError(t, os.WriteFile(shellNix, []byte("{ pkgs }"), 0o644))
+	_, err = d.cachedPrintDevEnv(args, false)
+	require.NoError(t, err)
+	assert.Equal(t, 3, calls)
+
+	// So do a different nixpkgs commit and unfree setting.
+	d.cfg.Nixpkgs.Commit = "def"
+	_, err = d.cachedPrintDevEnv(args, false)
+	require.NoError(t, err)
+	assert.Equal(t, 4, calls)
+	_, err = d.cachedPrintDevEnv(&nix.PrintDevEnvArgs{NixShellFilePath: shellNix, RestrictUnfree: true}, false)
+	require.NoError(t, err)
+	assert.Equal(t, 5, calls)
+
+	// The cached output isn't used if store paths on its PATH were garbage
+	// collected.
+	path = "/nix/store/missing-hello-2.12.1/bin:/usr/bin"
+	_, err = d.cachedPrintDevEnv(args, true)
+	require.NoError(t, err)
+	_, err = d.cachedPrintDevEnv(args, false)
+	require.NoError(t, err)
+	assert.Equal(t, 7, calls)
+}
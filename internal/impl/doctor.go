@@ -0,0 +1,114 @@
+// Copyright 2023 Jetpack Technologies Inc and contributors. All rights reserved.
+// Use of this source code is governed by the license in the LICENSE file.
+
+package impl
+
+import (
+	"os"
+	"path/filepath"
+
+	"github.com/pkg/errors"
+	"github.com/samber/lo"
+	"go.jetpack.io/devbox/internal/boxcli/featureflag"
+	"go.jetpack.io/devbox/internal/nix"
+	"go.jetpack.io/devbox/internal/plugin"
+)
+
+// DoctorCheck is the result of one of the checks that devbox doctor runs.
+type DoctorCheck struct {
+	Name string
+	// Err is why the check failed, or nil if it passed.
+	Err error
+	// Hint tells the user how to fix a failed check.
+	Hint string
+}
+
+// NixChecks checks that nix is installed and new enough for devbox. Unlike the
+// commands that need nix, it doesn't offer to install it.
+func NixChecks() []DoctorCheck {
+	installed := DoctorCheck{Name: "Nix is installed"}
+	if !nix.BinaryInstalled() && nix.DirExists() {
+		// Commands source the nix environment before giving up, so do
+		// the same here.
+		_ = nix.SourceNixEnv()
+	}
+	if !nix.BinaryInstalled() {
+		if nix.DirExists() {
+			installed.Err = errors.New("found /nix, but the nix binary isn't in your PATH")
+			installed.Hint = "Restart your terminal. If that doesn't work, your nix installation " +
+				"might be broken and need to be reinstalled."
+		} else {
+			installed.Err = errors.New("nix isn't installed")
+			installed.Hint = "Run devbox setup nix to install it."
+		}
+		return []DoctorCheck{installed}
+	}
+
+	version := DoctorCheck{Name: "Nix version"}
+	v, err := nix.Version()
+	if err != nil {
+		version.Err = err
+		version.Hint = "Check that running nix --version works."
+	} else if !nix.VersionAtLeast(v, nix.MinVersion) {
+		version.Err = errors.Errorf(
+			"nix %s is older than %s, which devbox needs for the nix command and flakes", v, nix.MinVersion)
+		version.Hint = "Upgrade nix: https://nixos.org/manual/nix/stable/installation/upgrading.html"
+	}
+	return []DoctorCheck{installed, version}
+}
+
+// Doctor checks the project's nix profile and the symlinks in its plugin
+// virtenv. It only reports problems, and doesn't fix them.
+func (d *Devbox) Doctor() []DoctorCheck {
+	return []DoctorCheck{d.checkProfile(), d.checkProfileFormat(), d.checkPluginSymlinks()}
+}
+
+func (d *Devbox) checkProfile() DoctorCheck {
+	check := DoctorCheck{Name: "Nix profile"}
+	profileDir := filepath.Join(d.projectDir, nix.ProfilePath)
+	if _, err := os.Lstat(profileDir); err != nil {
+		if len(d.packages()) > 0 {
+			check.Err = errors.New("the project's packages aren't installed yet")
+			check.Hint = "Run devbox install."
+		}
+		return check
+	}
+	if profileIsBroken(profileDir) {
+		check.Err = errors.Errorf(
+			"the nix profile in %s refers to store paths that no longer exist", filepath.Dir(profileDir))
+		check.Hint = "Run devbox install to rebuild it."
+	}
+	return check
+}
+
+func (d *Devbox) checkProfileFormat() DoctorCheck {
+	check := DoctorCheck{Name: "Nix profile format"}
+	dir, err := filepath.EvalSymlinks(filepath.Join(d.projectDir, nix.ProfilePath))
+	if err != nil {
+		// A missing or broken profile is reported by checkProfile.
+		return check
+	}
+	if profileFormatMismatch(dir) {
+		check.Err = errors.Errorf(
+			"the nix profile was created with the flakes feature %s, but it's %s now",
+			lo.Ternary(featureflag.Flakes.Enabled(), "disabled", "enabled"),
+			lo.Ternary(featureflag.Flakes.Enabled(), "enabled", "disabled"),
+		)
+		check.Hint = "Run devbox install to recreate it."
+	}
+	return check
+}
+
+func (d *Devbox) checkPluginSymlinks() DoctorCheck {
+	check := DoctorCheck{Name: "Plugin symlinks"}
+	invalid, err := plugin.InvalidSymlinks(d.projectDir)
+	if err != nil {
+		check.Err = err
+		return check
+	}
+	if len(invalid) > 0 {
+		check.Err = errors.Errorf("%d broken symlinks in %s", len(invalid), filepath.Join(d.projectDir, plugin.VirtenvBinPath))
+		check.Hint = "Run devbox install to remove them."
+	}
+	return check
+}
@@ -0,0 +1,57 @@
+package impl
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.jetpack.io/devbox/internal/nix"
+	"go.jetpack.io/devbox/internal/plugin"
+)
+
+func TestDoctor(t *testing.T) {
+	checkErrs := func(checks []DoctorCheck) map[string]error {
+		errs := map[string]error{}
+		for _, check := range checks {
+			errs[check.Name] = check.Err
+		}
+		return errs
+	}
+
+	projectDir := t.TempDir()
+	d := &Devbox{cfg: &Config{}, projectDir: projectDir, writer: &bytes.Buffer{}}
+
+	// A project without packages doesn't need a profile.
+	for name, err := range checkErrs(d.Doctor()) {
+		assert.NoError(t, err, name)
+	}
+
+	d.cfg.RawPackages = []string{"hello"}
+	errs := checkErrs(d.Doctor())
+	assert.ErrorContains(t, errs["Nix profile"], "aren't installed yet")
+
+	// A profile created without flakes has a manifest.nix.
+	generation := t.TempDir()
+	require.NoError(t, os.WriteFile(filepath.Join(generation, "manifest.nix"), []byte("[ ]"), 0o644))
+	profile := filepath.Join(projectDir, nix.ProfilePath)
+	require.NoError(t, os.MkdirAll(filepath.Dir(profile), 0o755))
+	require.NoError(t, os.Symlink(generation, profile))
+
+	// A plugin symlink whose target is gone.
+	binDir := filepath.Join(projectDir, plugin.VirtenvBinPath)
+	require.NoError(t, os.MkdirAll(binDir, 0o755))
+	require.NoError(t, os.Symlink(filepath.Join(projectDir, "missing"), filepath.Join(binDir, "tool")))
+
+	errs = checkErrs(d.Doctor())
+	assert.NoError(t, errs["Nix profile"])
+	assert.ErrorContains(t, errs["Nix profile format"], "created with the flakes feature disabled")
+	assert.ErrorContains(t, errs["Plugin symlinks"], "1 broken symlinks")
+
+	// Doctor only reports problems.
+	assert.FileExists(t, filepath.Join(profile, "manifest.nix"))
+	_, err := os.Lstat(filepath.Join(binDir, "tool"))
+	assert.NoError(t, err)
+}
@@ -0,0 +1,116 @@
+// Copyright 2023 Jetpack Technologies Inc and contributors. All rights reserved.
+// Use of this source code is governed by the license in the LICENSE file.
+
+package impl
+
+import (
+	"bufio"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/pkg/errors"
+	"go.jetpack.io/devbox/internal/boxcli/usererr"
+)
+
+// defaultEnvFile is the dotenv file that devbox loads if devbox.json doesn't
+// set env_file.
+const defaultEnvFile = ".env"
+
+// envFilePath returns the path of the project's dotenv file. A relative
+// env_file is relative to the directory of devbox.json.
+func (d *Devbox) envFilePath() string {
+	path := d.cfg.EnvFile
+	if path == "" {
+		path = defaultEnvFile
+	}
+	if filepath.IsAbs(path) {
+		return path
+	}
+	configDir := d.projectDir
+	if d.configPath != "" {
+		configDir = filepath.Dir(d.configPath)
+	}
+	return filepath.Join(configDir, path)
+}
+
+// readEnvFile reads the variables in the dotenv file at path. It returns nil
+// if the file doesn't exist.
+func readEnvFile(path string) (map[string]string, error) {
+	f, err := os.Open(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, errors.WithStack(err)
+	}
+	defer f.Close()
+
+	env := map[string]string{}
+	scanner := bufio.NewScanner(f)
+	for lineNum := 1; scanner.Scan(); lineNum++ {
+		key, value, ok, err := parseEnvLine(scanner.Text())
+		if err != nil {
+			return nil, usererr.New("%s:%d: %s", path, lineNum, err)
+		}
+		if ok {
+			env[key] = value
+		}
+	}
+	return env, errors.WithStack(scanner.Err())
+}
+
+// parseEnvLine parses a line of a dotenv file. Lines are KEY=VALUE and can
+// start with "export". Values can be in single quotes, which keep them as is,
+// or in double quotes, which also expand \n, \t, \" and \\. Unquoted values
+// end at a " #" comment. ok is false for blank lines and comments.
+func parseEnvLine(line string) (key, value string, ok bool, err error) {
+	line = strings.TrimSpace(line)
+	if line == "" || strings.HasPrefix(line, "#") {
+		return "", "", false, nil
+	}
+	line = strings.TrimSpace(strings.TrimPrefix(line, "export "))
+
+	key, value, found := strings.Cut(line, "=")
+	key = strings.TrimSpace(key)
+	if !found || key == "" || strings.ContainsAny(key, " \t") {
+		return "", "", false, errors.Errorf("expected KEY=VALUE, but got %q", line)
+	}
+	value = strings.TrimSpace(value)
+
+	switch {
+	case strings.HasPrefix(value, "'"):
+		end := strings.Index(value[1:], "'")
+		if end < 0 {
+			return "", "", false, errors.Errorf("value of %s is missing a closing quote", key)
+		}
+		return key, value[1 : end+1], true, nil
+	case strings.HasPrefix(value, `"`):
+		var b strings.Builder
+		for i := 1; i < len(value); i++ {
+			c := value[i]
+			switch {
+			case c == '"':
+				return key, b.String(), true, nil
+			case c == '\\' && i+1 < len(value):
+				i++
+				switch value[i] {
+				case 'n':
+					b.WriteByte('\n')
+				case 't':
+					b.WriteByte('\t')
+				default:
+					b.WriteByte(value[i])
+				}
+			default:
+				b.WriteByte(c)
+			}
+		}
+		return "", "", false, errors.Errorf("value of %s is missing a closing quote", key)
+	default:
+		if i := strings.Index(value, " #"); i >= 0 {
+			value = strings.TrimSpace(value[:i])
+		}
+		return key, value, true, nil
+	}
+}
@@ -0,0 +1,68 @@
+// Copyright 2023 Jetpack Technologies Inc and contributors. All rights reserved.
+// Use of this source code is governed by the license in the LICENSE file.
+
+package impl
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestParseEnvLine(t *testing.T) {
+	tests := []struct {
+		line    string
+		key     string
+		value   string
+		ok      bool
+		wantErr bool
+	}{
+		{line: "", ok: false},
+		{line: "  # a comment", ok: false},
+		{line: "FOO=bar", key: "FOO", value: "bar", ok: true},
+		{line: "export FOO = bar ", key: "FOO", value: "bar", ok: true},
+		{line: "FOO=", key: "FOO", value: "", ok: true},
+		{line: "FOO=bar # comment", key: "FOO", value: "bar", ok: true},
+		{line: "FOO=bar#baz", key: "FOO", value: "bar#baz", ok: true},
+		{line: "FOO='$HOME # not a comment\\n'", key: "FOO", value: "$HOME # not a comment\\n", ok: true},
+		{line: `FOO="a\nb \"c\" \\d" # comment`, key: "FOO", value: "a\nb \"c\" \\d", ok: true},
+		{line: "FOO=a=b", key: "FOO", value: "a=b", ok: true},
+		{line: "FOO", wantErr: true},
+		{line: "MY VAR=1", wantErr: true},
+		{line: `FOO="unterminated`, wantErr: true},
+		{line: "FOO='unterminated", wantErr: true},
+	}
+	for _, test := range tests {
+		t.Run(test.line, func(t *testing.T) {
+			key, value, ok, err := parseEnvLine(test.line)
+			if test.wantErr {
+				assert.Error(t, err)
+				return
+			}
+			require.NoError(t, err)
+			assert.Equal(t, test.ok, ok)
+			assert.Equal(t, test.key, key)
+			assert.Equal(t, test.value, value)
+		})
+	}
+}
+
+func TestReadEnvFile(t *testing.T) {
+	dir := t.TempDir()
+	env, err := readEnvFile(filepath.Join(dir, ".env"))
+	require.NoError(t, err)
+	assert.Nil(t, env)
+
+	path := filepath.Join(dir, ".env")
+	require.NoError(t, os.WriteFile(path, []byte("# secrets\nTOKEN=abc\n\nexport URL=\"http://localhost\"\n"), 0o644))
+	env, err = readEnvFile(path)
+	require.NoError(t, err)
+	assert.Equal(t, map[string]string{"TOKEN": "abc", "URL": "http://localhost"}, env)
+
+	require.NoError(t, os.WriteFile(path, []byte("TOKEN=abc\nnot a variable\n"), 0o644))
+	_, err = readEnvFile(path)
+	assert.ErrorContains(t, err, ".env:2")
+}
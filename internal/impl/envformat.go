@@ -0,0 +1,152 @@
+// Copyright 2023 Jetpack Technologies Inc and contributors. All rights reserved.
+// Use of this source code is governed by the license in the LICENSE file.
+
+package impl
+
+import (
+	"io"
+	"regexp"
+	"sort"
+	"strings"
+
+	"go.jetpack.io/devbox/internal/boxcli/usererr"
+	"go.jetpack.io/devbox/internal/cuecfg"
+	"go.jetpack.io/devbox/internal/ux"
+)
+
+// EnvFormat is an output format for PrintEnv.
+type EnvFormat string
+
+const (
+	// EnvFormatShell prints export statements that can be eval'd by a POSIX shell.
+	EnvFormatShell EnvFormat = "sh"
+	// EnvFormatSystemd prints KEY=VALUE lines that can be used as a systemd
+	// EnvironmentFile.
+	EnvFormatSystemd EnvFormat = "systemd"
+	// EnvFormatJSON prints a JSON object that maps each variable to its value.
+	EnvFormatJSON EnvFormat = "json"
+)
+
+// EnvFormats lists the supported values for EnvFormat.
+var EnvFormats = []EnvFormat{EnvFormatShell, EnvFormatSystemd, EnvFormatJSON}
+
+// ParseEnvFormat validates a user-provided env format name.
+func ParseEnvFormat(s string) (EnvFormat, error) {
+	for _, f := range EnvFormats {
+		if string(f) == s {
+			return f, nil
+		}
+	}
+	names := make([]string, len(EnvFormats))
+	for i, f := range EnvFormats {
+		names[i] = string(f)
+	}
+	return "", usererr.New("Unsupported env format %q. Valid formats are: %s", s, strings.Join(names, ", "))
+}
+
+// PrintEnvOption configures the output of PrintEnv.
+type PrintEnvOption func(*printEnvOptions)
+
+type printEnvOptions struct {
+	prefix  string
+	offline bool
+}
+
+// WithEnvPrefix prefixes the names of the printed variables with prefix, so
+// that they don't overwrite existing variables when sourced. Variables in
+// unprefixedEnvVars keep their names.
+func WithEnvPrefix(prefix string) PrintEnvOption {
+	return func(o *printEnvOptions) {
+		o.prefix = prefix
+	}
+}
+
+// WithOfflineEnv computes the environment only from packages that are already
+// in the nix store, without downloading anything. If some packages are
+// missing, it prints a warning and leaves their variables out instead of
+// failing.
+func WithOfflineEnv() PrintEnvOption {
+	return func(o *printEnvOptions) {
+		o.offline = true
+	}
+}
+
+// unprefixedEnvVars are variables that WithEnvPrefix doesn't rename because
+// the environment isn't usable without them.
+var unprefixedEnvVars = map[string]bool{
+	"PATH":   true,
+	"HOME":   true,
+	"USER":   true,
+	"SHELL":  true,
+	"TERM":   true,
+	"TMPDIR": true,
+}
+
+// prefixEnv returns a copy of env where every variable name, except those in
+// unprefixedEnvVars, starts with prefix.
+func prefixEnv(env map[string]string, prefix string) map[string]string {
+	prefixed := make(map[string]string, len(env))
+	for k, v := range env {
+		if unprefixedEnvVars[k] {
+			prefixed[k] = v
+		} else {
+			prefixed[prefix+k] = v
+		}
+	}
+	return prefixed
+}
+
+// envVarName matches valid environment variable names. These are also the
+// names that systemd accepts in an EnvironmentFile.
+var envVarName = regexp.MustCompile(`^[A-Za-z_][A-Za-z0-9_]*$`)
+
+// formatSystemdEnv formats env as a systemd EnvironmentFile. Each value is
+// double-quoted, and the characters that systemd treats specially inside
+// double quotes are escaped with a backslash. Variables with multi-line values
+// or names that systemd rejects are dropped, and a warning listing them is
+// written to w.
+func formatSystemdEnv(env map[string]string, w io.Writer) string {
+	keys := make([]string, 0, len(env))
+	for k := range env {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+
+	dropped := []string{}
+	sb := strings.Builder{}
+	for _, k := range keys {
+		v := env[k]
+		if !envVarName.MatchString(k) || strings.ContainsAny(v, "\n\r") {
+			dropped = append(dropped, k)
+			continue
+		}
+		sb.WriteString(k)
+		sb.WriteString(`="`)
+		for _, r := range v {
+			switch r {
+			case '"', '\\', '`', '$':
+				sb.WriteRune('\\')
+			}
+			sb.WriteRune(r)
+		}
+		sb.WriteString("\"\n")
+	}
+	if len(dropped) > 0 {
+		ux.Fwarning(
+			w,
+			"the following variables can't be represented in a systemd EnvironmentFile and were omitted: %s\n",
+			strings.Join(dropped, ", "),
+		)
+	}
+	return sb.String()
+}
+
+// formatJSONEnv formats env as a JSON object with the variables sorted by
+// name. Values are kept exactly as they are, including multi-line values.
+func formatJSONEnv(env map[string]string) (string, error) {
+	data, err := cuecfg.MarshalJSON(env)
+	if err != nil {
+		return "", err
+	}
+	return string(data) + "\n", nil
+}
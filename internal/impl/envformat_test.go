@@ -0,0 +1,190 @@
+package impl
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"errors"
+	"io"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"go.jetpack.io/devbox/internal/nix"
+)
+
+func TestFormatSystemdEnv(t *testing.T) {
+	env := map[string]string{
+		"SIMPLE":      "value",
+		"WITH_SPACES": "a value with spaces",
+		"SPECIAL":     `quote " backslash \ dollar $HOME tick ` + "`" + ` hash # semi ;`,
+		"EMPTY":       "",
+		"MULTILINE":   "line1\nline2",
+		"bad-name":    "value",
+	}
+
+	warnings := &bytes.Buffer{}
+	out := formatSystemdEnv(env, warnings)
+
+	parsed := parseSystemdEnvFile(t, out)
+	assert.Equal(t, map[string]string{
+		"SIMPLE":      env["SIMPLE"],
+		"WITH_SPACES": env["WITH_SPACES"],
+		"SPECIAL":     env["SPECIAL"],
+		"EMPTY":       env["EMPTY"],
+	}, parsed)
+	assert.Contains(t, warnings.String(), "MULTILINE, bad-name")
+}
+
+// parseSystemdEnvFile parses an EnvironmentFile following the rules systemd
+// uses for double-quoted values: a backslash escapes the next character if it
+// is one of "\`$, and is kept literally otherwise.
+func parseSystemdEnvFile(t *testing.T, data string) map[string]string {
+	env := map[string]string{}
+	scanner := bufio.NewScanner(strings.NewReader(data))
+	for scanner.Scan() {
+		line := scanner.Text()
+		key, quoted, found := strings.Cut(line, "=")
+		if !found {
+			t.Fatalf("line %q is missing '='", line)
+		}
+		if len(quoted) < 2 || quoted[0] != '"' || quoted[len(quoted)-1] != '"' {
+			t.Fatalf("value for %s isn't double-quoted: %s", key, quoted)
+		}
+		quoted = quoted[1 : len(quoted)-1]
+
+		sb := strings.Builder{}
+		for i := 0; i < len(quoted); i++ {
+			c := quoted[i]
+			if c == '\\' && i+1 < len(quoted) && strings.IndexByte("\"\\`$", quoted[i+1]) >= 0 {
+				i++
+				c = quoted[i]
+			} else if c == '"' {
+				t.Fatalf("unescaped quote in value for %s: %s", key, quoted)
+			}
+			sb.WriteByte(c)
+		}
+		env[key] = sb.String()
+	}
+	return env
+}
+
+func TestFormatJSONEnv(t *testing.T) {
+	env := map[string]string{
+		"SIMPLE":    "value",
+		"SPECIAL":   `quote " backslash \ dollar $HOME <html> & tick ` + "`",
+		"EMPTY":     "",
+		"MULTILINE": "line1\nline2\n",
+		"bad-name":  "value",
+	}
+
+	out, err := formatJSONEnv(env)
+	assert.NoError(t, err)
+
+	parsed := map[string]string{}
+	assert.NoError(t, json.Unmarshal([]byte(out), &parsed))
+	assert.Equal(t, env, parsed)
+	assert.Contains(t, out, "<html> &")
+}
+
+func TestPrefixEnv(t *testing.T) {
+	env := map[string]string{
+		"PATH":   "/nix/store/abc-go/bin:/usr/bin",
+		"HOME":   "/home/user",
+		"GOROOT": "/nix/store/abc-go/share/go",
+		"PGDATA": "/project/.devbox/virtenv/postgresql/data",
+	}
+
+	assert.Equal(t, map[string]string{
+		"PATH":          "/nix/store/abc-go/bin:/usr/bin",
+		"HOME":          "/home/user",
+		"DEVBOX_GOROOT": "/nix/store/abc-go/share/go",
+		"DEVBOX_PGDATA": "/project/.devbox/virtenv/postgresql/data",
+	}, prefixEnv(env, "DEVBOX_"))
+}
+
+func TestPrintEnvOffline(t *testing.T) {
+	var gotArgs *nix.PrintDevEnvArgs
+	client := &fakeNix{printDevEnv: func(args *nix.PrintDevEnvArgs) (*nix.VarsAndFuncs, error) {
+		gotArgs = args
+		return nil, errors.New("path '/nix/store/abc-hello-2.12.1' is required, but there is no substituter")
+	}}
+
+	projectDir := t.TempDir()
+	out := &bytes.Buffer{}
+	d := &Devbox{cfg: &Config{}, projectDir: projectDir, writer: out, nix: client}
+	script, err := d.PrintEnv(EnvFormatShell, WithOfflineEnv())
+	assert.NoError(t, err)
+	assert.True(t, gotArgs.Offline)
+	assert.Contains(t, out.String(), "Unable to compute the nix environment without installing packages")
+
+	// Packages that are already installed in the profile are still on the
+	// PATH, and computing the environment didn't create the profile.
+	profileBin := filepath.Join(projectDir, nix.ProfilePath, "bin")
+	assert.Contains(t, script, ":"+profileBin+":")
+	assert.Contains(t, script, "export DEVBOX_PROJECT_ROOT=\""+projectDir+"\"\n")
+	assert.NoFileExists(t, filepath.Join(projectDir, nix.ProfilePath))
+
+	// Without WithOfflineEnv, a failure to compute the nix environment is
+	// still an error.
+	gotArgs = nil
+	_, err = d.PrintEnv(EnvFormatShell)
+	assert.Error(t, err)
+	assert.False(t, gotArgs.Offline)
+}
+
+func TestComputeNixEnvOffline(t *testing.T) {
+	var gotArgs *nix.PrintDevEnvArgs
+	client := &fakeNix{printDevEnv: func(args *nix.PrintDevEnvArgs) (*nix.VarsAndFuncs, error) {
+		gotArgs = args
+		return nil, errors.New("cannot download source tarball while in offline mode")
+	}}
+
+	d := &Devbox{cfg: &Config{}, projectDir: t.TempDir(), writer: io.Discard, nix: client}
+	_, err := d.computeNixEnvWithHistory(nil, nixEnvOptions{offline: true})
+	assert.ErrorContains(t, err, "Unable to compute the environment offline")
+	assert.True(t, gotArgs.Offline)
+
+	// Falling back to the profile leaves the nix layer out instead.
+	gotArgs = nil
+	env, err := d.computeNixEnvWithHistory(nil, nixEnvOptions{offline: true, fallbackToProfile: true})
+	assert.NoError(t, err)
+	assert.True(t, gotArgs.Offline)
+	assert.Contains(t, env["PATH"], d.profileBinDir())
+}
+
+func TestPrepareOfflineShell(t *testing.T) {
+	cfg := &Config{RawPackages: []string{"go@1.20", "ripgrep@13"}}
+	cfg.packagePins = map[string]PinnedPackage{
+		"go@1.20": {Version: "1.20.4", Attribute: "go_1_20", Commit: "f80ac848e3d6f0c12c52758c0f25c10c97ca3b62"},
+	}
+	d := &Devbox{cfg: cfg, projectDir: t.TempDir(), writer: io.Discard}
+	err := d.prepareOfflineShell()
+	assert.ErrorContains(t, err, "haven't been resolved yet, which needs the network: ripgrep@13.")
+}
+
+func TestPrintEnvExportArrays(t *testing.T) {
+	client := &fakeNix{printDevEnv: func(args *nix.PrintDevEnvArgs) (*nix.VarsAndFuncs, error) {
+		vaf := &nix.VarsAndFuncs{}
+		err := json.Unmarshal([]byte(`{"variables": {
+			"CFLAGS": {"type": "exported", "value": "-O2"},
+			"patches": {"type": "array", "value": ["a.patch", "has space.patch", "it's.patch"]},
+			"noPatches": {"type": "array", "value": []}
+		}}`), vaf)
+		return vaf, err
+	}}
+
+	d := &Devbox{cfg: &Config{}, projectDir: t.TempDir(), writer: &bytes.Buffer{}, nix: client}
+	env, err := d.computeNixEnv()
+	assert.NoError(t, err)
+	assert.Equal(t, "-O2", env["CFLAGS"])
+	assert.NotContains(t, env, "patches")
+
+	d.cfg.Shell.ExportArrays = true
+	env, err = d.computeNixEnv()
+	assert.NoError(t, err)
+	assert.Equal(t, `a.patch 'has space.patch' 'it'"'"'s.patch'`, env["patches"])
+	assert.Equal(t, "", env["noPatches"])
+	assert.Contains(t, env, "noPatches")
+}
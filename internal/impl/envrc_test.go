@@ -0,0 +1,65 @@
+package impl
+
+import (
+	"io"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestGenerateEnvrc(t *testing.T) {
+	// A fake direnv records the directories it's allowed in.
+	binDir := t.TempDir()
+	allowed := filepath.Join(t.TempDir(), "allowed")
+	script := "#!/bin/sh\npwd >> " + allowed + "\n"
+	require.NoError(t, os.WriteFile(filepath.Join(binDir, "direnv"), []byte(script), 0o755))
+	t.Setenv("PATH", binDir+string(os.PathListSeparator)+os.Getenv("PATH"))
+
+	testCases := []struct {
+		name        string
+		source      string
+		allow       bool
+		wantEnvrc   bool
+		wantAllowed bool
+	}{
+		{name: "generate yes", source: "generate", allow: true, wantEnvrc: true, wantAllowed: true},
+		{name: "generate no", source: "generate", allow: false, wantEnvrc: true},
+		{name: "init no", source: "init", allow: false},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			os.Remove(allowed)
+			dir := t.TempDir()
+			_, err := InitConfig(dir, io.Discard)
+			require.NoError(t, err)
+			box, err := Open(dir, io.Discard)
+			require.NoError(t, err)
+			box.confirm = func(string, bool) (bool, error) {
+				t.Fatal("GenerateEnvrc asked whether to enable direnv")
+				return false, nil
+			}
+
+			require.NoError(t, box.GenerateEnvrc(false, tc.source, WithDirenvAllow(tc.allow)))
+			envrc, err := os.ReadFile(filepath.Join(dir, ".envrc"))
+			if !tc.wantEnvrc {
+				assert.ErrorIs(t, err, os.ErrNotExist)
+				return
+			}
+			require.NoError(t, err)
+			assert.Contains(t, string(envrc), `eval "$(devbox shellenv)"`)
+
+			allowedDirs, err := os.ReadFile(allowed)
+			if !tc.wantAllowed {
+				assert.ErrorIs(t, err, os.ErrNotExist)
+				return
+			}
+			require.NoError(t, err)
+			wantDir, err := filepath.EvalSymlinks(dir)
+			require.NoError(t, err)
+			assert.Equal(t, wantDir+"\n", string(allowedDirs))
+		})
+	}
+}
@@ -0,0 +1,75 @@
+// Copyright 2023 Jetpack Technologies Inc and contributors. All rights reserved.
+// Use of this source code is governed by the license in the LICENSE file.
+
+package impl
+
+import (
+	"fmt"
+	"io"
+)
+
+// Sources of the variables in the computed environment. See computeNixEnv for
+// the order in which they're layered.
+const (
+	envSourceHost        = "host environment"
+	envSourcePassthrough = "host environment (--env-passthrough)"
+	envSourceNix         = "nix print-dev-env"
+	envSourceDevbox      = "devbox"
+	envSourceConfig      = "devbox.json env"
+	envSourcePath        = "devbox (PATH joined from plugins, nix and the host environment)"
+	envSourceScriptArg   = "script argument"
+	envSourceRequires    = "script requires"
+	envSourceScriptEnv   = "script env"
+	envSourceOnFailure   = "devbox run --on-failure"
+	envSourceEnvironment = "devbox run --environment"
+	envSourceFlag        = "--env"
+	envSourceProfile     = "devbox profile (packages already installed)"
+)
+
+func envFileSource(path string) string {
+	return "env file " + path
+}
+
+func pluginEnvSource(pkg string) string {
+	return "plugin " + pkg
+}
+
+// envAssignment is a single layer setting a variable to a value.
+type envAssignment struct {
+	source string
+	value  string
+}
+
+// envHistory records, for each variable in an environment, every layer that
+// set it in the order they were applied. The last assignment is the one that
+// determines the variable's final value.
+type envHistory map[string][]envAssignment
+
+// set sets key to value in env and records source as the layer that set it.
+func (h envHistory) set(env map[string]string, key, value, source string) {
+	env[key] = value
+	if h != nil {
+		h[key] = append(h[key], envAssignment{source: source, value: value})
+	}
+}
+
+// explain writes the final value of each variable in vars along with the
+// layers that set it.
+func (h envHistory) explain(w io.Writer, env map[string]string, vars []string) {
+	for _, key := range vars {
+		value, ok := env[key]
+		if !ok {
+			fmt.Fprintf(w, "%s is not set in the devbox environment\n", key)
+			continue
+		}
+		fmt.Fprintf(w, "%s=%q\n", key, value)
+		assignments := h[key]
+		for i, a := range assignments {
+			status := "overridden"
+			if i == len(assignments)-1 {
+				status = "final"
+			}
+			fmt.Fprintf(w, "  %s: %q (%s)\n", a.source, a.value, status)
+		}
+	}
+}
@@ -0,0 +1,117 @@
+// Copyright 2023 Jetpack Technologies Inc and contributors. All rights reserved.
+// Use of this source code is governed by the license in the LICENSE file.
+
+package impl
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.jetpack.io/devbox/internal/nix"
+)
+
+func TestAddDevboxEnvHistory(t *testing.T) {
+	t.Setenv("XDG_DATA_HOME", t.TempDir())
+	t.Setenv("DEVBOX_FEATURE_ENV_CONFIG", "1")
+
+	d := &Devbox{
+		cfg: &Config{
+			RawPackages: []string{"postgresql"},
+			Env:         map[string]string{"FOO": "bar", "PGHOST": "/tmp/pg"},
+		},
+		projectDir: t.TempDir(),
+	}
+
+	env := map[string]string{"FOO": "host"}
+	history := envHistory{}
+	history.set(env, "FOO", "host", envSourceHost)
+	require.NoError(t, d.addDevboxEnv(env, history))
+
+	assert.Equal(t, []envAssignment{
+		{source: envSourceHost, value: "host"},
+		{source: envSourceConfig, value: "bar"},
+	}, history["FOO"])
+
+	require.Len(t, history["PGDATA"], 1)
+	assert.Equal(t, pluginEnvSource("postgresql"), history["PGDATA"][0].source)
+
+	require.Len(t, history["PGHOST"], 2)
+	assert.Equal(t, pluginEnvSource("postgresql"), history["PGHOST"][0].source)
+	assert.Equal(t, envSourceConfig, history["PGHOST"][1].source)
+
+	out := &bytes.Buffer{}
+	history.explain(out, env, []string{"PGHOST", "MISSING"})
+	assert.Contains(t, out.String(), `PGHOST="/tmp/pg"`)
+	assert.Contains(t, out.String(), `devbox.json env: "/tmp/pg" (final)`)
+	assert.Contains(t, out.String(), "plugin postgresql:")
+	assert.Contains(t, out.String(), "MISSING is not set in the devbox environment")
+}
+
+func TestAddDevboxEnvBuiltins(t *testing.T) {
+	t.Setenv("DEVBOX_FEATURE_ENV_CONFIG", "1")
+	t.Setenv("DEVBOX_ENV", "staging")
+
+	projectDir := t.TempDir()
+	out := &bytes.Buffer{}
+	d := &Devbox{
+		cfg: &Config{
+			Env: map[string]string{
+				"DEVBOX_PROJECT_ROOT": "/somewhere/else",
+				"DEVBOX_ENV":          "prod",
+				"DATA_DIR":            "$DEVBOX_PROJECT_ROOT/data",
+			},
+		},
+		projectDir: projectDir,
+		configPath: filepath.Join(projectDir, "devbox.yaml"),
+		writer:     out,
+	}
+
+	env := map[string]string{}
+	require.NoError(t, d.addDevboxEnv(env, nil))
+
+	assert.Equal(t, projectDir, env["DEVBOX_PROJECT_ROOT"])
+	assert.Equal(t, projectDir, env["DEVBOX_CONFIG_DIR"])
+	assert.Equal(t, filepath.Join(projectDir, nix.ProfilePath, "bin"), env["DEVBOX_PACKAGES_DIR"])
+	assert.Equal(t, "staging", env["DEVBOX_ENV"])
+	assert.Equal(t, filepath.Join(projectDir, "data"), env["DATA_DIR"])
+	assert.Contains(t, out.String(), "ignoring DEVBOX_PROJECT_ROOT in devbox.json env")
+}
+
+func TestAddDevboxEnvFile(t *testing.T) {
+	t.Setenv("XDG_DATA_HOME", t.TempDir())
+	t.Setenv("DEVBOX_FEATURE_ENV_CONFIG", "1")
+
+	projectDir := t.TempDir()
+	envFile := filepath.Join(projectDir, ".env")
+	require.NoError(t, os.WriteFile(envFile, []byte(
+		"API_TOKEN=secret\nPGHOST=/from/dotenv\nDEVBOX_PROJECT_ROOT=/somewhere/else\n"), 0o644))
+	d := &Devbox{
+		cfg: &Config{
+			RawPackages: []string{"postgresql"},
+			Env:         map[string]string{"AUTH_HEADER": "Bearer $API_TOKEN"},
+		},
+		projectDir: projectDir,
+	}
+
+	env := map[string]string{"API_TOKEN": "host"}
+	history := envHistory{}
+	require.NoError(t, d.addDevboxEnv(env, history))
+
+	// The dotenv file overrides the host environment, devbox.json can
+	// reference its variables, and plugins override it.
+	assert.Equal(t, "secret", env["API_TOKEN"])
+	assert.Equal(t, envFileSource(envFile), history["API_TOKEN"][0].source)
+	assert.Equal(t, "Bearer secret", env["AUTH_HEADER"])
+	assert.Equal(t, filepath.Join(projectDir, ".devbox/virtenv/postgresql"), env["PGHOST"])
+	assert.Equal(t, projectDir, env["DEVBOX_PROJECT_ROOT"])
+
+	// env_file sets the path, and a missing file is fine.
+	d.cfg.EnvFile = "config/dev.env"
+	env = map[string]string{}
+	require.NoError(t, d.addDevboxEnv(env, nil))
+	assert.NotContains(t, env, "API_TOKEN")
+}
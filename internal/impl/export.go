@@ -0,0 +1,213 @@
+// Copyright 2023 Jetpack Technologies Inc and contributors. All rights reserved.
+// Use of this source code is governed by the license in the LICENSE file.
+
+package impl
+
+import (
+	"archive/tar"
+	"compress/gzip"
+	"encoding/json"
+	"io"
+	"io/fs"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/pkg/errors"
+	"go.jetpack.io/devbox/internal/boxcli/usererr"
+	"go.jetpack.io/devbox/internal/build"
+	"go.jetpack.io/devbox/internal/nix"
+	"go.jetpack.io/devbox/internal/plugin"
+	"go.jetpack.io/devbox/internal/ux"
+	"golang.org/x/exp/slices"
+)
+
+// exportManifestName is the name of the file in an export that describes it.
+const exportManifestName = "devbox-export.json"
+
+// exportManifest describes where an export came from.
+type exportManifest struct {
+	// Config is the name of the devbox config file in the export.
+	Config        string    `json:"config"`
+	NixpkgsCommit string    `json:"nixpkgs_commit"`
+	System        string    `json:"system"`
+	DevboxVersion string    `json:"devbox_version"`
+	Created       time.Time `json:"created"`
+}
+
+// Export writes a gzipped tarball of the project's config, lockfile and the
+// plugin config files in devbox.d to w, so that Import can recreate the
+// project on another machine. The .env file is left out because it usually
+// has secrets.
+func (d *Devbox) Export(w io.Writer) error {
+	if len(d.cfg.Extends) > 0 {
+		ux.Fwarning(d.writer, "the configs that %s extends aren't included in the export.\n",
+			filepath.Base(d.configPath))
+	}
+
+	files := []string{filepath.Base(d.configPath)}
+	if _, err := os.Stat(filepath.Join(d.projectDir, lockfileName)); err == nil {
+		files = append(files, lockfileName)
+	}
+	err := filepath.WalkDir(filepath.Join(d.projectDir, plugin.ConfigDir), func(path string, entry fs.DirEntry, err error) error {
+		if errors.Is(err, fs.ErrNotExist) {
+			return nil
+		}
+		if err != nil || !entry.Type().IsRegular() {
+			return err
+		}
+		rel, err := filepath.Rel(d.projectDir, path)
+		files = append(files, rel)
+		return err
+	})
+	if err != nil {
+		return errors.WithStack(err)
+	}
+
+	manifest, err := json.MarshalIndent(&exportManifest{
+		Config:        filepath.Base(d.configPath),
+		NixpkgsCommit: d.cfg.Nixpkgs.Commit,
+		System:        nix.System(),
+		DevboxVersion: build.Version,
+		Created:       time.Now().UTC(),
+	}, "", "  ")
+	if err != nil {
+		return errors.WithStack(err)
+	}
+
+	gz := gzip.NewWriter(w)
+	tw := tar.NewWriter(gz)
+	if err := writeTarFile(tw, exportManifestName, manifest, 0o644); err != nil {
+		return err
+	}
+	for _, name := range files {
+		path := filepath.Join(d.projectDir, name)
+		info, err := os.Stat(path)
+		if err != nil {
+			return errors.WithStack(err)
+		}
+		data, err := os.ReadFile(path)
+		if err != nil {
+			return errors.WithStack(err)
+		}
+		if err := writeTarFile(tw, filepath.ToSlash(name), data, info.Mode().Perm()); err != nil {
+			return err
+		}
+	}
+	if err := tw.Close(); err != nil {
+		return errors.WithStack(err)
+	}
+	return errors.WithStack(gz.Close())
+}
+
+func writeTarFile(tw *tar.Writer, name string, data []byte, mode fs.FileMode) error {
+	err := tw.WriteHeader(&tar.Header{
+		Name:    name,
+		Mode:    int64(mode),
+		Size:    int64(len(data)),
+		ModTime: time.Now(),
+	})
+	if err != nil {
+		return errors.WithStack(err)
+	}
+	_, err = tw.Write(data)
+	return errors.WithStack(err)
+}
+
+// Import recreates the project in an archive written by Export in dir, which
+// must not have a devbox config yet. It checks that the export's nixpkgs
+// commit can be fetched before writing any files, and warns if the export
+// came from a different system.
+func Import(archive io.Reader, dir string, w io.Writer) error {
+	return importArchive(archive, dir, w, nixCLI{})
+}
+
+// importArchive is Import with the nixClient that fetches the export's
+// nixpkgs commit.
+func importArchive(archive io.Reader, dir string, w io.Writer, client nixClient) error {
+	if path, _ := findConfigFile(dir); path != "" {
+		return usererr.New("%s already has a devbox config: %s", dir, path)
+	}
+
+	files, err := readExport(archive)
+	if err != nil {
+		return err
+	}
+	manifest := &exportManifest{}
+	if err := json.Unmarshal(files[exportManifestName].data, manifest); err != nil {
+		return usererr.New("the file isn't a devbox export: it's missing a valid %s", exportManifestName)
+	}
+	delete(files, exportManifestName)
+	if _, ok := files[manifest.Config]; !ok || !slices.Contains(configFilenames, manifest.Config) {
+		return usererr.New("the export is missing its config file, %s", manifest.Config)
+	}
+
+	if manifest.System != nix.System() {
+		ux.Fwarning(w, "the environment was exported on %s, but this machine is %s. "+
+			"Packages that aren't available for %[2]s won't install.\n", manifest.System, nix.System())
+	}
+	if manifest.NixpkgsCommit != "" {
+		if err := client.PrefetchNixpkgs(w, manifest.NixpkgsCommit); err != nil {
+			return usererr.WithUserMessage(err,
+				"The nixpkgs commit %s in the export can't be fetched.", manifest.NixpkgsCommit)
+		}
+	}
+
+	for name, f := range files {
+		path := filepath.Join(dir, filepath.FromSlash(name))
+		if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+			return errors.WithStack(err)
+		}
+		if err := os.WriteFile(path, f.data, f.mode); err != nil {
+			return errors.WithStack(err)
+		}
+	}
+	return nil
+}
+
+// exportFile is a file read from an export.
+type exportFile struct {
+	data []byte
+	mode fs.FileMode
+}
+
+// readExport returns the files in an export, keyed by their slash-separated
+// path. It rejects paths that would be written outside of the project.
+func readExport(archive io.Reader) (map[string]exportFile, error) {
+	gz, err := gzip.NewReader(archive)
+	if err != nil {
+		return nil, usererr.New("the file isn't a devbox export: %v", err)
+	}
+	defer gz.Close()
+
+	files := map[string]exportFile{}
+	tr := tar.NewReader(gz)
+	for {
+		header, err := tr.Next()
+		if errors.Is(err, io.EOF) {
+			return files, nil
+		}
+		if err != nil {
+			return nil, usererr.New("the file isn't a devbox export: %v", err)
+		}
+		if header.Typeflag == tar.TypeDir {
+			continue
+		}
+		name := path.Clean(header.Name)
+		if header.Typeflag != tar.TypeReg || path.IsAbs(name) || name == ".." || strings.HasPrefix(name, "../") {
+			return nil, usererr.New("the export has an unexpected file: %s", header.Name)
+		}
+		data, err := io.ReadAll(tr)
+		if err != nil {
+			return nil, errors.WithStack(err)
+		}
+		// Keep whether the file is executable, but not odd permissions.
+		mode := fs.FileMode(0o644)
+		if header.Mode&0o100 != 0 {
+			mode = 0o755
+		}
+		files[name] = exportFile{data: data, mode: mode}
+	}
+}
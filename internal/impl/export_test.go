@@ -0,0 +1,107 @@
+package impl
+
+import (
+	"archive/tar"
+	"bytes"
+	"compress/gzip"
+	"io"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/pkg/errors"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestExportImport(t *testing.T) {
+	prefetched := []string{}
+	client := &fakeNix{prefetchNixpkgs: func(w io.Writer, commit string) error {
+		prefetched = append(prefetched, commit)
+		return nil
+	}}
+
+	src := t.TempDir()
+	_, err := InitConfig(src, io.Discard)
+	require.NoError(t, err)
+	writeFile := func(name, content string, mode os.FileMode) {
+		path := filepath.Join(src, name)
+		require.NoError(t, os.MkdirAll(filepath.Dir(path), 0o755))
+		require.NoError(t, os.WriteFile(path, []byte(content), mode))
+	}
+	writeFile(lockfileName, `{"packages": {}}`, 0o644)
+	writeFile("devbox.d/postgresql/postgresql.conf", "port = 5432\n", 0o644)
+	writeFile("devbox.d/postgresql/setup.sh", "#!/bin/sh\n", 0o755)
+	writeFile(".env", "SECRET=1\n", 0o644)
+
+	box, err := Open(src, io.Discard)
+	require.NoError(t, err)
+	archive := &bytes.Buffer{}
+	require.NoError(t, box.Export(archive))
+
+	dst := filepath.Join(t.TempDir(), "project")
+	out := &bytes.Buffer{}
+	require.NoError(t, importArchive(bytes.NewReader(archive.Bytes()), dst, out, client))
+	assert.Equal(t, []string{box.cfg.Nixpkgs.Commit}, prefetched)
+	assert.Empty(t, out.String())
+
+	for _, name := range []string{configFilename, lockfileName, "devbox.d/postgresql/postgresql.conf"} {
+		want, err := os.ReadFile(filepath.Join(src, name))
+		require.NoError(t, err)
+		got, err := os.ReadFile(filepath.Join(dst, name))
+		require.NoError(t, err)
+		assert.Equal(t, string(want), string(got), name)
+	}
+	info, err := os.Stat(filepath.Join(dst, "devbox.d/postgresql/setup.sh"))
+	require.NoError(t, err)
+	assert.NotZero(t, info.Mode()&0o100, "setup.sh should still be executable")
+	assert.NoFileExists(t, filepath.Join(dst, ".env"))
+	assert.NoFileExists(t, filepath.Join(dst, exportManifestName))
+
+	// Importing again fails because there's already a config.
+	err = importArchive(bytes.NewReader(archive.Bytes()), dst, io.Discard, client)
+	assert.ErrorContains(t, err, "already has a devbox config")
+
+	// Nothing is written if the nixpkgs commit can't be fetched.
+	client.prefetchNixpkgs = func(w io.Writer, commit string) error { return errors.New("not found") }
+	other := t.TempDir()
+	assert.Error(t, importArchive(bytes.NewReader(archive.Bytes()), other, io.Discard, client))
+	assert.NoFileExists(t, filepath.Join(other, configFilename))
+}
+
+func TestImportInvalid(t *testing.T) {
+	client := &fakeNix{prefetchNixpkgs: func(w io.Writer, commit string) error { return nil }}
+
+	archive := func(files map[string]string) io.Reader {
+		buf := &bytes.Buffer{}
+		gz := gzip.NewWriter(buf)
+		tw := tar.NewWriter(gz)
+		for name, content := range files {
+			require.NoError(t, writeTarFile(tw, name, []byte(content), 0o644))
+		}
+		require.NoError(t, tw.Close())
+		require.NoError(t, gz.Close())
+		return buf
+	}
+
+	dir := t.TempDir()
+	err := importArchive(archive(map[string]string{
+		exportManifestName: `{"config": "devbox.json", "system": "x86_64-linux"}`,
+		"devbox.json":      `{"packages": []}`,
+		"../evil":          "",
+	}), dir, io.Discard, client)
+	assert.ErrorContains(t, err, "unexpected file: ../evil")
+
+	err = importArchive(archive(map[string]string{"devbox.json": `{"packages": []}`}), dir, io.Discard, client)
+	assert.ErrorContains(t, err, "isn't a devbox export")
+
+	// Exports from other systems can be imported, with a warning.
+	out := &bytes.Buffer{}
+	err = Import(archive(map[string]string{
+		exportManifestName: `{"config": "devbox.json", "system": "riscv64-plan9"}`,
+		"devbox.json":      `{"packages": []}`,
+	}), dir, out)
+	require.NoError(t, err)
+	assert.Contains(t, out.String(), "the environment was exported on riscv64-plan9")
+	assert.FileExists(t, filepath.Join(dir, "devbox.json"))
+}
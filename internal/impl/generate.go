@@ -4,11 +4,14 @@
 package impl
 
 import (
+	"bytes"
 	"embed"
 	"fmt"
+	"io/fs"
 	"os"
 	"os/exec"
 	"path/filepath"
+	"sort"
 	"strings"
 	"text/template"
 
@@ -25,63 +28,117 @@ var tmplFS embed.FS
 
 var shellFiles = []string{"development.nix", "shell.nix"}
 
-func generateForShell(rootPath string, plan *plansdk.ShellPlan, pluginManager *plugin.Manager) error {
-	outPath := filepath.Join(rootPath, ".devbox/gen")
-
-	for _, file := range shellFiles {
-		err := writeFromTemplate(outPath, plan, file)
-		if err != nil {
-			return errors.WithStack(err)
-		}
+// generateForShell writes the files in .devbox/gen that the shell is built
+// from, and creates the files of the packages' plugins. It returns the paths of
+// the generated files, relative to rootPath, that already existed but were out
+// of date.
+func generateForShell(rootPath string, plan *plansdk.ShellPlan, pluginManager *plugin.Manager) ([]string, error) {
+	files, err := renderShellFiles(plan)
+	if err != nil {
+		return nil, err
 	}
-
-	// Gitignore file is added to the .devbox directory
-	err := writeFromTemplate(filepath.Join(rootPath, ".devbox"), plan, ".gitignore")
+	stale, err := staleShellFiles(rootPath, files)
 	if err != nil {
-		return errors.WithStack(err)
+		return nil, err
+	}
+	for name, data := range files {
+		if err := writeGeneratedFile(filepath.Join(rootPath, name), data); err != nil {
+			return nil, err
+		}
 	}
 
-	err = makeFlakeFile(outPath, plan)
+	err = makeFlakeFile(filepath.Join(rootPath, ".devbox/gen"))
 	if err != nil {
-		return errors.WithStack(err)
+		return nil, errors.WithStack(err)
 	}
 
-	for name, content := range plan.GeneratedFiles {
-		filePath := filepath.Join(outPath, name)
-		if err := os.WriteFile(filePath, []byte(content), 0644); err != nil {
-			return errors.WithStack(err)
+	for _, pkg := range plan.DevPackages {
+		if err := pluginManager.CreateFilesAndShowReadme(pkg, rootPath); err != nil {
+			return nil, err
 		}
 	}
 
-	for _, pkg := range plan.DevPackages {
-		if err := pluginManager.CreateFilesAndShowReadme(pkg, rootPath); err != nil {
-			return err
+	return stale, nil
+}
+
+// renderShellFiles returns the contents of the files that generateForShell
+// writes, keyed by their path relative to the project's directory.
+func renderShellFiles(plan *plansdk.ShellPlan) (map[string][]byte, error) {
+	outPath := ".devbox/gen"
+	files := map[string][]byte{}
+	templates := map[string]string{
+		// Gitignore file is added to the .devbox directory
+		".devbox/.gitignore": ".gitignore",
+	}
+	for _, file := range shellFiles {
+		templates[filepath.Join(outPath, file)] = file
+	}
+	if featureflag.Flakes.Enabled() {
+		templates[filepath.Join(outPath, "flake", "flake.nix")] = "flake.nix"
+	}
+	for path, tmplName := range templates {
+		data, err := renderTemplate(plan, tmplName)
+		if err != nil {
+			return nil, err
 		}
+		files[path] = data
+	}
+	for name, content := range plan.GeneratedFiles {
+		files[filepath.Join(outPath, name)] = []byte(content)
 	}
+	return files, nil
+}
 
-	return nil
+// staleShellFiles returns the paths in files, sorted, of the files in rootPath
+// that have different contents. Files that don't exist yet aren't stale.
+func staleShellFiles(rootPath string, files map[string][]byte) ([]string, error) {
+	stale := []string{}
+	for name, data := range files {
+		current, err := os.ReadFile(filepath.Join(rootPath, name))
+		if errors.Is(err, fs.ErrNotExist) {
+			continue
+		}
+		if err != nil {
+			return nil, errors.WithStack(err)
+		}
+		if !bytes.Equal(current, data) {
+			stale = append(stale, name)
+		}
+	}
+	sort.Strings(stale)
+	return stale, nil
 }
 
 func writeFromTemplate(path string, plan interface{}, tmplName string) error {
-	embeddedPath := fmt.Sprintf("tmpl/%s.tmpl", tmplName)
-
-	// Should we clear the directory so we start "fresh"?
-	outPath := filepath.Join(path, tmplName)
-	outDir := filepath.Dir(outPath)
-	err := os.MkdirAll(outDir, 0755) // Ensure directory exists.
+	data, err := renderTemplate(plan, tmplName)
 	if err != nil {
-		return errors.WithStack(err)
+		return err
 	}
+	return writeGeneratedFile(filepath.Join(path, tmplName), data)
+}
 
-	f, err := os.Create(outPath)
-	defer func() {
-		_ = f.Close()
-	}()
-	if err != nil {
+func renderTemplate(plan interface{}, tmplName string) ([]byte, error) {
+	embeddedPath := fmt.Sprintf("tmpl/%s.tmpl", tmplName)
+	t := template.Must(template.New(tmplName+".tmpl").Funcs(templateFuncs).ParseFS(tmplFS, embeddedPath))
+	buf := &bytes.Buffer{}
+	if err := t.Execute(buf, plan); err != nil {
+		return nil, errors.WithStack(err)
+	}
+	return buf.Bytes(), nil
+}
+
+// writeGeneratedFile writes data to path, creating its directory. It leaves
+// the file alone if it's already up to date, so that its modification time
+// only changes when its contents do.
+func writeGeneratedFile(path string, data []byte) error {
+	if current, err := os.ReadFile(path); err == nil && bytes.Equal(current, data) {
+		return nil
+	}
+	// Should we clear the directory so we start "fresh"?
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil { // Ensure directory exists.
 		return errors.WithStack(err)
 	}
-	t := template.Must(template.New(tmplName+".tmpl").Funcs(templateFuncs).ParseFS(tmplFS, embeddedPath))
-	return errors.WithStack(t.Execute(f, plan))
+	return errors.WithStack(os.WriteFile(path, data, 0644))
 }
 
 func toJSON(a any) string {
@@ -99,17 +156,15 @@ var templateFuncs = template.FuncMap{
 	"unifiedEnv": featureflag.UnifiedEnv.Enabled,
 }
 
-func makeFlakeFile(outPath string, plan *plansdk.ShellPlan) error {
+// makeFlakeFile makes nix able to use the flake.nix that renderShellFiles
+// generates in outPath/flake.
+func makeFlakeFile(outPath string) error {
 
 	if featureflag.Flakes.Disabled() {
 		return nil
 	}
 
 	flakeDir := filepath.Join(outPath, "flake")
-	err := writeFromTemplate(flakeDir, plan, "flake.nix")
-	if err != nil {
-		return errors.WithStack(err)
-	}
 
 	if !isProjectInGitRepo(outPath) {
 		// if we are not in a git repository, then carry on
@@ -127,7 +182,7 @@ func makeFlakeFile(outPath string, plan *plansdk.ShellPlan) error {
 		cmd.Stdout = os.Stdout
 		cmd.Stderr = os.Stderr
 	}
-	err = cmd.Run()
+	err := cmd.Run()
 	if err != nil {
 		return errors.WithStack(err)
 	}
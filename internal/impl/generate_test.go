@@ -0,0 +1,120 @@
+// Copyright 2023 Jetpack Technologies Inc and contributors. All rights reserved.
+// Use of this source code is governed by the license in the LICENSE file.
+
+package impl
+
+import (
+	"bytes"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.jetpack.io/devbox/internal/planner/plansdk"
+)
+
+func TestUnfreePackagesTemplates(t *testing.T) {
+	tests := []struct {
+		name          string
+		plan          *plansdk.ShellPlan
+		wantPredicate string
+	}{
+		{
+			name: "AllowAllUnfree",
+			plan: &plansdk.ShellPlan{},
+		},
+		{
+			name: "RestrictUnfree",
+			plan: &plansdk.ShellPlan{
+				RestrictUnfree: true,
+				UnfreePackages: []string{"vscode", "terraform"},
+			},
+			wantPredicate: `[ "vscode" "terraform" ];`,
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			test.plan.NixpkgsInfo = &plansdk.NixpkgsInfo{URL: "https://example.com/nixpkgs.tar.gz"}
+			test.plan.DevPackages = []string{"vscode"}
+			dir := t.TempDir()
+			for _, name := range []string{"flake.nix", "shell.nix", "development.nix"} {
+				require.NoError(t, writeFromTemplate(dir, test.plan, name))
+				data, err := os.ReadFile(filepath.Join(dir, name))
+				require.NoError(t, err)
+				if test.wantPredicate == "" {
+					assert.NotContains(t, string(data), "allowUnfreePredicate", name)
+					continue
+				}
+				assert.Contains(t, string(data), "allowUnfreePredicate", name)
+				assert.Contains(t, string(data), test.wantPredicate, name)
+			}
+		})
+	}
+}
+
+func TestPinnedPackagesTemplates(t *testing.T) {
+	plan := &plansdk.ShellPlan{
+		NixpkgsInfo: &plansdk.NixpkgsInfo{URL: "https://example.com/nixpkgs.tar.gz"},
+		DevPackages: []string{"go"},
+		PinnedPackages: []plansdk.PinnedPackage{{
+			Attribute:  "nodejs-18_x",
+			Commit:     "f80ac848e3d6f0c12c52758c0f25c10c97ca3b62",
+			NixpkgsURL: "https://example.com/pinned.tar.gz",
+		}, {
+			Attribute:  "python310",
+			Commit:     "f80ac848e3d6f0c12c52758c0f25c10c97ca3b62",
+			NixpkgsURL: "https://example.com/pinned.tar.gz",
+		}},
+	}
+	dir := t.TempDir()
+	for _, name := range []string{"shell.nix", "development.nix"} {
+		require.NoError(t, writeFromTemplate(dir, plan, name))
+		data, err := os.ReadFile(filepath.Join(dir, name))
+		require.NoError(t, err)
+		assert.Contains(t, string(data), `"https://example.com/pinned.tar.gz"`, name)
+		assert.Contains(t, string(data), ").nodejs-18_x", name)
+	}
+
+	// The flake makes each pinned nixpkgs an input once, so that flake.lock
+	// records its hash.
+	require.NoError(t, writeFromTemplate(dir, plan, "flake.nix"))
+	data, err := os.ReadFile(filepath.Join(dir, "flake.nix"))
+	require.NoError(t, err)
+	flake := string(data)
+	input := `nixpkgs-f80ac848e3d6f0c12c52758c0f25c10c97ca3b62.url = "https://example.com/pinned.tar.gz";`
+	assert.Equal(t, 1, strings.Count(flake, input))
+	assert.Contains(t, flake, "inputs.nixpkgs-f80ac848e3d6f0c12c52758c0f25c10c97ca3b62.legacyPackages.${system}.nodejs-18_x")
+	assert.NotContains(t, flake, "fetchTarball")
+}
+
+func TestCheckGeneratedFiles(t *testing.T) {
+	dir := t.TempDir()
+	_, err := InitConfig(dir, io.Discard)
+	require.NoError(t, err)
+	out := &bytes.Buffer{}
+	box, err := Open(dir, out)
+	require.NoError(t, err)
+
+	// Files that haven't been generated yet aren't out of date.
+	assert.NoError(t, box.CheckGeneratedFiles())
+	out.Reset()
+	require.NoError(t, box.Generate())
+	assert.Empty(t, out.String())
+	assert.NoError(t, box.CheckGeneratedFiles())
+
+	shellNix := filepath.Join(dir, ".devbox/gen/shell.nix")
+	require.NoError(t, os.WriteFile(shellNix, []byte("# stale\n"), 0o644))
+	err = box.CheckGeneratedFiles()
+	assert.ErrorContains(t, err, filepath.FromSlash(".devbox/gen/shell.nix"))
+	data, err := os.ReadFile(shellNix)
+	require.NoError(t, err)
+	assert.Equal(t, "# stale\n", string(data), "--check shouldn't change the files")
+
+	out.Reset()
+	require.NoError(t, box.Generate())
+	assert.Contains(t, out.String(), "regenerated these files")
+	assert.NoError(t, box.CheckGeneratedFiles())
+}
@@ -0,0 +1,62 @@
+// Copyright 2023 Jetpack Technologies Inc and contributors. All rights reserved.
+// Use of this source code is governed by the license in the LICENSE file.
+
+package impl
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/pkg/errors"
+)
+
+// gitignoreEntry is the line that devbox init offers to add to the project's
+// .gitignore.
+const gitignoreEntry = ".devbox/"
+
+// offerGitignore adds gitignoreEntry to the .gitignore in dir if the user
+// agrees and the file doesn't already ignore .devbox.
+func offerGitignore(dir string, w io.Writer, confirm confirmFunc) error {
+	path := filepath.Join(dir, ".gitignore")
+	data, err := os.ReadFile(path)
+	if err != nil && !errors.Is(err, os.ErrNotExist) {
+		return errors.WithStack(err)
+	}
+	if ignoresDevboxDir(string(data)) {
+		return nil
+	}
+	add, err := confirmOrNo(confirm, fmt.Sprintf("Add %s to %s?", gitignoreEntry, path), true)
+	if err != nil || !add {
+		return err
+	}
+
+	entry := gitignoreEntry + "\n"
+	if len(data) > 0 && !strings.HasSuffix(string(data), "\n") {
+		entry = "\n" + entry
+	}
+	f, err := os.OpenFile(path, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0o644)
+	if err != nil {
+		return errors.WithStack(err)
+	}
+	defer f.Close()
+	if _, err := f.WriteString(entry); err != nil {
+		return errors.WithStack(err)
+	}
+	fmt.Fprintf(w, "Added %s to %s\n", gitignoreEntry, path)
+	return errors.WithStack(f.Close())
+}
+
+// ignoresDevboxDir reports whether a .gitignore with content has a line that
+// ignores the .devbox directory at the root of the project.
+func ignoresDevboxDir(content string) bool {
+	for _, line := range strings.Split(content, "\n") {
+		switch strings.TrimSpace(line) {
+		case ".devbox", ".devbox/", "/.devbox", "/.devbox/":
+			return true
+		}
+	}
+	return false
+}
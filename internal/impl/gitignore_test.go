@@ -0,0 +1,81 @@
+// Copyright 2023 Jetpack Technologies Inc and contributors. All rights reserved.
+// Use of this source code is governed by the license in the LICENSE file.
+
+package impl
+
+import (
+	"io"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestOfferGitignore(t *testing.T) {
+	tests := []struct {
+		name string
+		// content and want are the .gitignore before and after. An empty
+		// string means that there's no .gitignore.
+		content string
+		confirm bool
+		asked   bool
+		want    string
+	}{
+		{
+			name:    "NoGitignore",
+			confirm: true,
+			asked:   true,
+			want:    ".devbox/\n",
+		},
+		{
+			name:    "NoTrailingNewline",
+			content: "node_modules",
+			confirm: true,
+			asked:   true,
+			want:    "node_modules\n.devbox/\n",
+		},
+		{
+			name:    "AlreadyIgnored",
+			content: "node_modules/\n/.devbox\n",
+			confirm: true,
+			want:    "node_modules/\n/.devbox\n",
+		},
+		{
+			name:    "Declined",
+			content: "node_modules/\n",
+			asked:   true,
+			want:    "node_modules/\n",
+		},
+		{
+			name:  "DeclinedNoGitignore",
+			asked: true,
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			dir := t.TempDir()
+			path := filepath.Join(dir, ".gitignore")
+			if test.content != "" {
+				require.NoError(t, os.WriteFile(path, []byte(test.content), 0o644))
+			}
+			asked := false
+			confirm := func(question string, defaultYes bool) (bool, error) {
+				asked = true
+				assert.True(t, defaultYes)
+				return test.confirm, nil
+			}
+
+			require.NoError(t, offerGitignore(dir, io.Discard, confirm))
+			assert.Equal(t, test.asked, asked)
+			data, err := os.ReadFile(path)
+			if test.want == "" {
+				assert.ErrorIs(t, err, os.ErrNotExist)
+				return
+			}
+			require.NoError(t, err)
+			assert.Equal(t, test.want, string(data))
+		})
+	}
+}
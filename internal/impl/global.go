@@ -33,6 +33,9 @@ const currentGlobalProfile = "default"
 func (d *Devbox) AddGlobal(pkgs ...string) error {
 	// validate all packages exist. Don't install anything if any are missing
 	for _, pkg := range pkgs {
+		if _, _, ok := parseVersionedPackage(pkg); ok {
+			return usererr.New("Global packages can't have a version: %s", pkg)
+		}
 		if !nix.FlakesPkgExists(plansdk.DefaultNixpkgsCommit, pkg) {
 			return nix.ErrPackageNotFound
 		}
@@ -146,7 +149,7 @@ func (d *Devbox) addFromPull(pullCfg *Config) error {
 }
 
 func GlobalDataPath() (string, error) {
-	path := xdg.DataSubpath(filepath.Join("devbox/global", currentGlobalProfile))
+	path := xdg.DevboxDataSubpath(filepath.Join("global", currentGlobalProfile))
 	if err := os.MkdirAll(path, 0755); err != nil {
 		return "", errors.WithStack(err)
 	}
@@ -166,7 +169,7 @@ func globalBinPath() (string, error) {
 	if err != nil {
 		return "", err
 	}
-	currentPath := xdg.DataSubpath("devbox/global/current")
+	currentPath := xdg.DevboxDataSubpath("global/current")
 	// For now default is always current. In the future we will support multiple
 	// and allow user to switch.
 	if err := os.Symlink(nixProfilePath, currentPath); err != nil && !os.IsExist(err) {
@@ -0,0 +1,141 @@
+// Copyright 2023 Jetpack Technologies Inc and contributors. All rights reserved.
+// Use of this source code is governed by the license in the LICENSE file.
+
+package impl
+
+import (
+	"strings"
+
+	"go.jetpack.io/devbox/internal/boxcli/usererr"
+	"go.jetpack.io/devbox/internal/impl/shellcmd"
+)
+
+// InitTemplate describes a template that devbox init can start a project
+// from.
+type InitTemplate struct {
+	Name        string
+	Description string
+}
+
+// initTemplate is a curated starting point for a project in a language: its
+// packages, an init hook and the scripts that projects in the language
+// usually have.
+type initTemplate struct {
+	InitTemplate
+	packages []string
+	initHook []string
+	scripts  map[string]string
+}
+
+// initTemplates are the templates that devbox init --template accepts, sorted
+// by name.
+var initTemplates = []initTemplate{
+	{
+		InitTemplate: InitTemplate{Name: "go", Description: "Go with a project-local GOPATH"},
+		packages:     []string{"go"},
+		initHook: []string{
+			"export GOPATH=$PWD/.devbox/go",
+			"export PATH=$GOPATH/bin:$PATH",
+		},
+		scripts: map[string]string{
+			"build": "go build ./...",
+			"test":  "go test ./...",
+			"run":   "go run .",
+		},
+	},
+	{
+		InitTemplate: InitTemplate{Name: "java", Description: "Java with Maven"},
+		packages:     []string{"jdk", "maven"},
+		initHook: []string{
+			"export JAVA_HOME=$(dirname $(dirname $(readlink -f $(command -v java))))",
+		},
+		scripts: map[string]string{
+			"build": "mvn package",
+			"test":  "mvn test",
+		},
+	},
+	{
+		InitTemplate: InitTemplate{Name: "nodejs", Description: "Node.js with npm"},
+		packages:     []string{"nodejs"},
+		initHook: []string{
+			"export PATH=$PWD/node_modules/.bin:$PATH",
+		},
+		scripts: map[string]string{
+			"install": "npm install",
+			"start":   "npm start",
+			"test":    "npm test",
+		},
+	},
+	{
+		InitTemplate: InitTemplate{Name: "python", Description: "Python 3 with a virtual environment in .venv"},
+		packages:     []string{"python3"},
+		initHook: []string{
+			"[ -d .venv ] || python3 -m venv .venv",
+			". .venv/bin/activate",
+		},
+		scripts: map[string]string{
+			"install": "pip install -r requirements.txt",
+			"test":    "python -m pytest",
+		},
+	},
+	{
+		InitTemplate: InitTemplate{Name: "ruby", Description: "Ruby with Bundler installing gems into vendor/bundle"},
+		packages:     []string{"ruby", "bundler"},
+		initHook: []string{
+			"bundle config set --local path vendor/bundle",
+		},
+		scripts: map[string]string{
+			"install": "bundle install",
+			"test":    "bundle exec rake test",
+		},
+	},
+	{
+		InitTemplate: InitTemplate{Name: "rust", Description: "Rust with Cargo and a project-local CARGO_HOME"},
+		packages:     []string{"rustc", "cargo"},
+		initHook: []string{
+			"export CARGO_HOME=$PWD/.devbox/cargo",
+			"export PATH=$CARGO_HOME/bin:$PATH",
+		},
+		scripts: map[string]string{
+			"build": "cargo build",
+			"test":  "cargo test",
+			"run":   "cargo run",
+		},
+	},
+}
+
+// InitTemplates returns the templates that devbox init can start a project
+// from, sorted by name.
+func InitTemplates() []InitTemplate {
+	templates := make([]InitTemplate, 0, len(initTemplates))
+	for _, t := range initTemplates {
+		templates = append(templates, t.InitTemplate)
+	}
+	return templates
+}
+
+func findInitTemplate(name string) (*initTemplate, error) {
+	names := []string{}
+	for i := range initTemplates {
+		if initTemplates[i].Name == name {
+			return &initTemplates[i], nil
+		}
+		names = append(names, initTemplates[i].Name)
+	}
+	return nil, usererr.New(
+		"Unknown template %q. The templates are: %s", name, strings.Join(names, ", "))
+}
+
+// apply adds the template's packages, init hook and scripts to cfg.
+func (t *initTemplate) apply(cfg *Config) {
+	cfg.RawPackages = append(cfg.RawPackages, t.packages...)
+	cfg.Shell.InitHook = shellcmd.Commands{Cmds: append([]string{}, t.initHook...)}
+	if cfg.Shell.Scripts == nil {
+		cfg.Shell.Scripts = map[string]*Script{}
+	}
+	for name, cmd := range t.scripts {
+		cfg.Shell.Scripts[name] = &Script{
+			Commands: shellcmd.Commands{MarshalAs: shellcmd.CmdString, Cmds: []string{cmd}},
+		}
+	}
+}
@@ -0,0 +1,343 @@
+// Copyright 2023 Jetpack Technologies Inc and contributors. All rights reserved.
+// Use of this source code is governed by the license in the LICENSE file.
+
+package impl
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/pkg/errors"
+	"github.com/samber/lo"
+	"go.jetpack.io/devbox/internal/boxcli/usererr"
+	"go.jetpack.io/devbox/internal/cuecfg"
+	"go.jetpack.io/devbox/internal/fileutil"
+	"go.jetpack.io/devbox/internal/nix"
+	"go.jetpack.io/devbox/internal/ux"
+	"golang.org/x/exp/maps"
+	"golang.org/x/exp/slices"
+)
+
+const (
+	// lockfileName is the name of the file that records the store paths that
+	// each package in devbox.json resolved to.
+	lockfileName    = "devbox.lock"
+	lockfileVersion = "1"
+)
+
+// Lockfile records the nix store paths that the project's packages resolved
+// to, so that every machine installs byte-identical packages.
+type Lockfile struct {
+	LockfileVersion string                    `json:"lockfile_version"`
+	Packages        map[string]*LockedPackage `json:"packages"`
+}
+
+// LockedPackage is the nixpkgs commit and attribute that a package resolved
+// from, and the store paths of its outputs.
+type LockedPackage struct {
+	Commit    string         `json:"commit"`
+	Attribute string         `json:"attribute"`
+	Outputs   []LockedOutput `json:"outputs"`
+}
+
+// LockedOutput is a store path and the hash of its contents.
+type LockedOutput struct {
+	StorePath string `json:"store_path"`
+	NarHash   string `json:"nar_hash"`
+}
+
+func (p *LockedPackage) storePaths() []string {
+	paths := make([]string, 0, len(p.Outputs))
+	for _, out := range p.Outputs {
+		paths = append(paths, out.StorePath)
+	}
+	return paths
+}
+
+// readLockfile reads the project's lockfile. It returns nil if the project
+// doesn't have one.
+func readLockfile(projectDir string) (*Lockfile, error) {
+	return readLockfilePath(filepath.Join(projectDir, lockfileName))
+}
+
+// readLockfilePath reads the lockfile at path. It returns nil if the file
+// doesn't exist.
+func readLockfilePath(path string) (*Lockfile, error) {
+	data, err := os.ReadFile(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, errors.WithStack(err)
+	}
+	lock := &Lockfile{}
+	if err := json.Unmarshal(data, lock); err != nil {
+		return nil, usererr.WithUserMessage(err, "%s is not valid JSON", path)
+	}
+	if lock.Packages == nil {
+		lock.Packages = map[string]*LockedPackage{}
+	}
+	return lock, nil
+}
+
+// pinLockedPackages pins each package in the lockfile at path to the nixpkgs
+// commit and attribute it's locked to there, so that adding it installs the
+// same store paths as in the other project. It returns the packages.
+func (d *Devbox) pinLockedPackages(path string) ([]string, error) {
+	lock, err := readLockfilePath(path)
+	if err != nil {
+		return nil, err
+	}
+	if lock == nil {
+		return nil, usererr.New("Lockfile %s doesn't exist", path)
+	}
+	if len(lock.Packages) == 0 {
+		return nil, usererr.New("%s doesn't lock any packages", path)
+	}
+	pkgs := maps.Keys(lock.Packages)
+	sort.Strings(pkgs)
+	for _, pkg := range pkgs {
+		locked := lock.Packages[pkg]
+		if locked.Commit == "" || locked.Attribute == "" {
+			return nil, usererr.New("%s doesn't have the commit and attribute of %s", path, pkg)
+		}
+		if locked.Commit == d.cfg.Nixpkgs.Commit && locked.Attribute == pkg {
+			delete(d.cfg.packagePins, pkg)
+			continue
+		}
+		pin := PinnedPackage{Attribute: locked.Attribute, Commit: locked.Commit}
+		if locked.Attribute == pkg {
+			pin.Attribute = ""
+		}
+		d.cfg.setPackagePin(pkg, pin)
+	}
+	return pkgs, nil
+}
+
+func (l *Lockfile) save(projectDir string) error {
+	data, err := cuecfg.MarshalJSON(l)
+	if err != nil {
+		return err
+	}
+	path := filepath.Join(projectDir, lockfileName)
+	return errors.WithStack(os.WriteFile(path, append(data, '\n'), 0o644))
+}
+
+// lockedPackage returns the lock of pkg if it's up to date with devbox.json.
+func (d *Devbox) lockedPackage(lock *Lockfile, pkg string) (*LockedPackage, bool) {
+	if lock == nil {
+		return nil, false
+	}
+	locked, ok := lock.Packages[pkg]
+	if !ok {
+		return nil, false
+	}
+	commit, attribute := d.packageRef(pkg)
+	if locked.Commit != commit || locked.Attribute != attribute || len(locked.Outputs) == 0 {
+		return nil, false
+	}
+	return locked, true
+}
+
+// lockablePackages returns the packages in devbox.json that are locked: the
+// project's own packages and the packages in its active package groups.
+func (d *Devbox) lockablePackages() []string {
+	return lo.Uniq(append(d.cfg.localPackages(), d.cfg.groupPackages(d.packageGroups)...))
+}
+
+// staleLockedPackages returns the packages in devbox.json that lock is
+// missing or out of date for, and the packages that lock has but devbox.json
+// doesn't. The lockfile is current when both are empty. Packages in package
+// groups that aren't active keep their lock, but aren't checked.
+func (d *Devbox) staleLockedPackages(lock *Lockfile) (stale, extra []string) {
+	pkgs := d.lockablePackages()
+	for _, pkg := range pkgs {
+		if _, ok := d.lockedPackage(lock, pkg); !ok {
+			stale = append(stale, pkg)
+		}
+	}
+	if lock != nil {
+		allGroups := d.cfg.groupPackages(maps.Keys(d.cfg.packageGroups()))
+		for pkg := range lock.Packages {
+			if !slices.Contains(pkgs, pkg) && !slices.Contains(allGroups, pkg) {
+				extra = append(extra, pkg)
+			}
+		}
+	}
+	sort.Strings(extra)
+	return stale, extra
+}
+
+// resolveLockedOutputs builds a package and returns its outputs.
+func (d *Devbox) resolveLockedOutputs(commit, attribute string) ([]LockedOutput, error) {
+	paths, err := d.nix.BuildPackages(d.writer, commit, attribute)
+	if err != nil {
+		return nil, err
+	}
+	infos, err := d.nix.PathInfo(paths...)
+	if err != nil {
+		return nil, err
+	}
+	outputs := make([]LockedOutput, 0, len(infos))
+	for _, info := range infos {
+		outputs = append(outputs, LockedOutput{StorePath: info.Path, NarHash: info.NarHash})
+	}
+	return outputs, nil
+}
+
+// updateLockfile locks the packages that aren't locked yet or whose lock is
+// out of date, and removes the packages that are no longer in devbox.json.
+// Packages that are already locked keep their store paths. The lockfile is
+// only written if it changed.
+func (d *Devbox) updateLockfile(lock *Lockfile) error {
+	stale, extra := d.staleLockedPackages(lock)
+	if len(stale) == 0 && len(extra) == 0 && lock != nil {
+		return nil
+	}
+	if lock == nil {
+		lock = &Lockfile{Packages: map[string]*LockedPackage{}}
+	}
+	lock.LockfileVersion = lockfileVersion
+
+	for _, pkg := range extra {
+		delete(lock.Packages, pkg)
+	}
+	for _, pkg := range stale {
+		commit, attribute := d.packageRef(pkg)
+		outputs, err := d.resolveLockedOutputs(commit, attribute)
+		if err != nil {
+			return usererr.WithUserMessage(err, "Unable to lock package %s", pkg)
+		}
+		lock.Packages[pkg] = &LockedPackage{
+			Commit:    commit,
+			Attribute: attribute,
+			Outputs:   outputs,
+		}
+	}
+	return lock.save(d.projectDir)
+}
+
+// realiseLockedPackages downloads the locked store paths that aren't in the
+// nix store yet, and returns the store paths of each package whose lock is
+// current and whose paths are all in the store, so that the package can be
+// installed from exactly those paths. Packages whose lock is out of date are
+// left out, and so are packages whose paths can't be downloaded, which are
+// installed from nixpkgs instead.
+func (d *Devbox) realiseLockedPackages(lock *Lockfile) map[string][]string {
+	locked := map[string][]string{}
+	missing := map[string][]string{}
+	for _, pkg := range d.lockablePackages() {
+		lockedPkg, ok := d.lockedPackage(lock, pkg)
+		if !ok {
+			continue
+		}
+		locked[pkg] = lockedPkg.storePaths()
+		missing[pkg] = lo.Filter(locked[pkg], func(path string, _ int) bool {
+			return !fileutil.Exists(path)
+		})
+		if len(missing[pkg]) == 0 {
+			delete(missing, pkg)
+		}
+	}
+	if len(missing) == 0 {
+		return locked
+	}
+	paths := lo.Flatten(maps.Values(missing))
+	sort.Strings(paths)
+	cacheFlags := nix.BinaryCacheFlags(d.cfg.binaryCaches())
+	if err := d.nix.RealiseStorePaths(d.writer, cacheFlags, paths...); err != nil {
+		ux.Fwarning(d.writer, "unable to download the store paths in %s: %v\n", lockfileName, err)
+		for pkg := range missing {
+			delete(locked, pkg)
+		}
+	}
+	return locked
+}
+
+// checkFrozenLockfile returns an error if the project's lockfile is missing
+// or out of date with devbox.json.
+func (d *Devbox) checkFrozenLockfile() (*Lockfile, error) {
+	lock, err := readLockfile(d.projectDir)
+	if err != nil {
+		return nil, err
+	}
+	if lock == nil {
+		return nil, usererr.New(
+			"%s is missing. Run `devbox install` without --frozen to create it.", lockfileName)
+	}
+	stale, extra := d.staleLockedPackages(lock)
+	if len(stale) > 0 || len(extra) > 0 {
+		return nil, usererr.New(
+			"%s is out of date with devbox.json (%s). Run `devbox install` without --frozen to update it.",
+			lockfileName,
+			strings.Join(append(stale, extra...), ", "),
+		)
+	}
+	return lock, nil
+}
+
+// CompareLockfile resolves each of the project's packages as it's configured
+// now, and compares its store paths with the ones in devbox.lock. It returns
+// an error listing the packages that drifted from the lock, for example
+// because nixpkgs.channel moved to a newer commit.
+func (d *Devbox) CompareLockfile() error {
+	lock, err := readLockfile(d.projectDir)
+	if err != nil {
+		return err
+	}
+	if lock == nil {
+		return usererr.New("%s is missing. Run `devbox install` to create it.", lockfileName)
+	}
+	drifted := []string{}
+	for _, pkg := range d.lockablePackages() {
+		commit, attribute := d.packageRef(pkg)
+		outputs, err := d.resolveLockedOutputs(commit, attribute)
+		if err != nil {
+			return usererr.WithUserMessage(err, "Unable to resolve package %s", pkg)
+		}
+		got := (&LockedPackage{Outputs: outputs}).storePaths()
+		locked, ok := lock.Packages[pkg]
+		switch {
+		case !ok:
+			drifted = append(drifted, fmt.Sprintf(
+				"%s resolves to %s, but isn't in %s", pkg, strings.Join(got, ", "), lockfileName))
+		case !slices.Equal(got, locked.storePaths()):
+			drifted = append(drifted, fmt.Sprintf(
+				"%s resolves to %s, but %s has %s",
+				pkg, strings.Join(got, ", "), lockfileName, strings.Join(locked.storePaths(), ", ")))
+		}
+	}
+	if len(drifted) > 0 {
+		return usererr.New(
+			"The environment drifted from %s:\n  %s", lockfileName, strings.Join(drifted, "\n  "))
+	}
+	fmt.Fprintf(d.writer, "The environment matches %s.\n", lockfileName)
+	return nil
+}
+
+// verifyLockedPackages checks that each package resolves to the store paths
+// in lock.
+func (d *Devbox) verifyLockedPackages(lock *Lockfile) error {
+	for _, pkg := range d.lockablePackages() {
+		locked, _ := d.lockedPackage(lock, pkg)
+		outputs, err := d.resolveLockedOutputs(locked.Commit, locked.Attribute)
+		if err != nil {
+			return err
+		}
+		got := (&LockedPackage{Outputs: outputs}).storePaths()
+		if !slices.Equal(got, locked.storePaths()) {
+			return usererr.New(
+				"Package %s resolved to %s, but %s has %s",
+				pkg,
+				strings.Join(got, ", "),
+				lockfileName,
+				strings.Join(locked.storePaths(), ", "),
+			)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,349 @@
+// Copyright 2023 Jetpack Technologies Inc and contributors. All rights reserved.
+// Use of this source code is governed by the license in the LICENSE file.
+
+package impl
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/pkg/errors"
+	"github.com/samber/lo"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.jetpack.io/devbox/internal/nix"
+)
+
+// lockingNix is a fakeNix that builds each package to
+// /nix/store/<first 8 characters of the commit>-<attribute>, with the NAR hash
+// sha256-<attribute>.
+func lockingNix() *fakeNix {
+	return &fakeNix{
+		buildPackages: func(w io.Writer, commit string, pkgs ...string) ([]string, error) {
+			return lo.Map(pkgs, func(pkg string, _ int) string {
+				return "/nix/store/" + commit[:8] + "-" + pkg
+			}), nil
+		},
+		pathInfo: func(paths ...string) ([]nix.StorePathInfo, error) {
+			return lo.Map(paths, func(path string, _ int) nix.StorePathInfo {
+				_, attribute, _ := strings.Cut(filepath.Base(path), "-")
+				return nix.StorePathInfo{Path: path, NarHash: "sha256-" + attribute}
+			}), nil
+		},
+	}
+}
+
+func TestUpdateLockfile(t *testing.T) {
+	const (
+		commit      = "af9e00071d0971eb292fd5abef334e66eda3cb69"
+		otherCommit = "f80ac848e3d6f0c12c52758c0f25c10c97ca3b62"
+	)
+	resolved := []string{}
+	client := lockingNix()
+	build := client.buildPackages
+	client.buildPackages = func(w io.Writer, commit string, pkgs ...string) ([]string, error) {
+		resolved = append(resolved, pkgs...)
+		return build(w, commit, pkgs...)
+	}
+
+	d := &Devbox{
+		cfg:        &Config{RawPackages: []string{"go", "ripgrep"}},
+		projectDir: t.TempDir(),
+		writer:     &bytes.Buffer{},
+		nix:        client,
+	}
+	d.cfg.Nixpkgs.Commit = commit
+
+	_, err := d.checkFrozenLockfile()
+	assert.Error(t, err, "lockfile is missing")
+
+	require.NoError(t, d.updateLockfile(nil))
+	assert.Equal(t, []string{"go", "ripgrep"}, resolved)
+	lock, err := d.checkFrozenLockfile()
+	require.NoError(t, err)
+	assert.Equal(t, lockfileVersion, lock.LockfileVersion)
+	assert.Equal(t, &LockedPackage{
+		Commit:    commit,
+		Attribute: "go",
+		Outputs:   []LockedOutput{{StorePath: "/nix/store/af9e0007-go", NarHash: "sha256-go"}},
+	}, lock.Packages["go"])
+
+	// Only the packages that changed are locked again.
+	resolved = nil
+	d.cfg.RawPackages = []string{"go", "jq"}
+	d.cfg.packagePins = map[string]PinnedPackage{"go": {Commit: otherCommit}}
+	_, err = d.checkFrozenLockfile()
+	assert.Error(t, err, "lockfile is out of date")
+	require.NoError(t, d.updateLockfile(lock))
+	assert.Equal(t, []string{"go", "jq"}, resolved)
+
+	lock, err = readLockfile(d.projectDir)
+	require.NoError(t, err)
+	assert.Len(t, lock.Packages, 2)
+	assert.NotContains(t, lock.Packages, "ripgrep")
+	assert.Equal(t, otherCommit, lock.Packages["go"].Commit)
+
+	// A current lockfile isn't written again.
+	resolved = nil
+	require.NoError(t, d.updateLockfile(lock))
+	assert.Empty(t, resolved)
+	require.NoError(t, d.verifyLockedPackages(lock))
+}
+
+func TestUpdateLockfilePackageGroups(t *testing.T) {
+	const commit = "af9e00071d0971eb292fd5abef334e66eda3cb69"
+	d := &Devbox{
+		cfg: &Config{
+			RawPackages:   []string{"go"},
+			PackageGroups: map[string][]string{"docs": {"mdbook"}},
+		},
+		projectDir: t.TempDir(),
+		writer:     &bytes.Buffer{},
+		nix:        lockingNix(),
+	}
+	d.cfg.Nixpkgs.Commit = commit
+
+	// Active groups are locked along with the project's packages.
+	require.NoError(t, d.activatePackageGroups([]string{"docs"}))
+	require.NoError(t, d.updateLockfile(nil))
+	lock, err := readLockfile(d.projectDir)
+	require.NoError(t, err)
+	assert.Contains(t, lock.Packages, "mdbook")
+
+	// Without the group, its lock is kept but the lockfile is still current.
+	d.packageGroups = nil
+	stale, extra := d.staleLockedPackages(lock)
+	assert.Empty(t, stale)
+	assert.Empty(t, extra)
+}
+
+func TestInstallLockedStorePaths(t *testing.T) {
+	const (
+		commit      = "af9e00071d0971eb292fd5abef334e66eda3cb69"
+		otherCommit = "f80ac848e3d6f0c12c52758c0f25c10c97ca3b62"
+	)
+	out := &bytes.Buffer{}
+	d := &Devbox{
+		cfg:        &Config{RawPackages: []string{"go", "jq", "ripgrep"}},
+		projectDir: t.TempDir(),
+		writer:     out,
+	}
+	d.cfg.Nixpkgs.Commit = commit
+	lock := &Lockfile{
+		LockfileVersion: lockfileVersion,
+		Packages: map[string]*LockedPackage{
+			"go": {
+				Commit:    commit,
+				Attribute: "go",
+				Outputs:   []LockedOutput{{StorePath: "/nix/store/af9e0007-go", NarHash: "sha256-go"}},
+			},
+			// jq's lock is out of date, so it's installed from nixpkgs.
+			"jq": {
+				Commit:    otherCommit,
+				Attribute: "jq",
+				Outputs:   []LockedOutput{{StorePath: "/nix/store/f80ac848-jq", NarHash: "sha256-jq"}},
+			},
+			"ripgrep": {
+				Commit:    commit,
+				Attribute: "ripgrep",
+				Outputs: []LockedOutput{
+					{StorePath: "/nix/store/af9e0007-ripgrep", NarHash: "sha256-ripgrep"},
+					{StorePath: "/nix/store/af9e0007-ripgrep-man", NarHash: "sha256-ripgrep-man"},
+				},
+			},
+		},
+	}
+	require.NoError(t, lock.save(d.projectDir))
+
+	// The profile lists packages installed from a store path without an
+	// attribute path.
+	profile := []string{}
+	realised := []string{}
+	realiseErr := errors.New("no binary cache has them")
+	d.nix = &fakeNix{
+		realiseStorePaths: func(w io.Writer, extraFlags []string, paths ...string) error {
+			realised = append(realised, paths...)
+			return realiseErr
+		},
+		profileListItems: func(w io.Writer, profileDir string) ([]*nix.NixProfileListItem, error) {
+			items := []*nix.NixProfileListItem{}
+			for i, line := range profile {
+				item, err := nix.ParseProfileListItem(fmt.Sprintf("%d %s", i, line))
+				if err != nil {
+					return nil, err
+				}
+				items = append(items, item)
+			}
+			return items, nil
+		},
+		profileInstall: func(args *nix.ProfileInstallArgs) error {
+			if len(args.StorePaths) == 0 {
+				ref := "github:NixOS/nixpkgs/" + args.NixpkgsCommit + "#legacyPackages.x86_64-linux." + args.Package
+				profile = append(profile, fmt.Sprintf("%s %s /nix/store/%s-%s", ref, ref, args.NixpkgsCommit[:8], args.Package))
+			}
+			for _, path := range args.StorePaths {
+				profile = append(profile, "- - "+path)
+			}
+			return os.MkdirAll(args.ProfilePath, 0o755)
+		},
+		removeFromProfile: func(w io.Writer, profileDir, ref string) error {
+			profile = lo.Reject(profile, func(line string, _ int) bool {
+				return strings.HasSuffix(line, " "+ref) || strings.Contains(line, "#"+ref+" ")
+			})
+			return nil
+		},
+	}
+
+	// Packages whose store paths can't be downloaded aren't installed from
+	// them.
+	assert.Empty(t, d.realiseLockedPackages(lock))
+	assert.Equal(t, []string{
+		"/nix/store/af9e0007-go",
+		"/nix/store/af9e0007-ripgrep",
+		"/nix/store/af9e0007-ripgrep-man",
+	}, realised)
+	assert.Contains(t, out.String(), "unable to download the store paths in devbox.lock")
+
+	realiseErr = nil
+	locked := d.realiseLockedPackages(lock)
+	assert.Equal(t, map[string][]string{
+		"go":      {"/nix/store/af9e0007-go"},
+		"ripgrep": {"/nix/store/af9e0007-ripgrep", "/nix/store/af9e0007-ripgrep-man"},
+	}, locked)
+
+	require.NoError(t, d.addPackagesToProfile(ensure, locked))
+	assert.ElementsMatch(t, []string{
+		"- - /nix/store/af9e0007-go",
+		"github:NixOS/nixpkgs/af9e00071d0971eb292fd5abef334e66eda3cb69#legacyPackages.x86_64-linux.jq " +
+			"github:NixOS/nixpkgs/af9e00071d0971eb292fd5abef334e66eda3cb69#legacyPackages.x86_64-linux.jq " +
+			"/nix/store/af9e0007-jq",
+		"- - /nix/store/af9e0007-ripgrep",
+		"- - /nix/store/af9e0007-ripgrep-man",
+	}, profile)
+
+	// The packages installed from their store paths are found by the
+	// attribute that devbox.lock has for them.
+	pending, err := d.pendingPackagesForInstallation()
+	require.NoError(t, err)
+	assert.Empty(t, pending)
+
+	// Removing a package removes each of its store paths.
+	require.NoError(t, d.removePackagesFromProfile([]string{"ripgrep"}))
+	assert.Len(t, profile, 2)
+	assert.NotContains(t, out.String(), "doesn't match devbox.json")
+}
+
+func TestCompareLockfile(t *testing.T) {
+	const commit = "af9e00071d0971eb292fd5abef334e66eda3cb69"
+	w := &bytes.Buffer{}
+	d := &Devbox{
+		cfg:        &Config{RawPackages: []string{"go", "ripgrep"}},
+		projectDir: t.TempDir(),
+		writer:     w,
+		nix:        lockingNix(),
+	}
+	d.cfg.Nixpkgs.Commit = commit
+
+	err := d.CompareLockfile()
+	assert.ErrorContains(t, err, "devbox.lock is missing")
+
+	// go was locked from an older commit, so it resolves to a different path.
+	lock := &Lockfile{
+		LockfileVersion: lockfileVersion,
+		Packages: map[string]*LockedPackage{
+			"go": {
+				Commit:    commit,
+				Attribute: "go",
+				Outputs:   []LockedOutput{{StorePath: "/nix/store/f80ac848-go", NarHash: "sha256-go"}},
+			},
+			"ripgrep": {
+				Commit:    commit,
+				Attribute: "ripgrep",
+				Outputs:   []LockedOutput{{StorePath: "/nix/store/af9e0007-ripgrep", NarHash: "sha256-ripgrep"}},
+			},
+		},
+	}
+	require.NoError(t, lock.save(d.projectDir))
+	err = d.CompareLockfile()
+	require.Error(t, err)
+	assert.Contains(t, err.Error(),
+		"go resolves to /nix/store/af9e0007-go, but devbox.lock has /nix/store/f80ac848-go")
+	assert.NotContains(t, err.Error(), "ripgrep")
+
+	lock.Packages["go"].Outputs[0].StorePath = "/nix/store/af9e0007-go"
+	require.NoError(t, lock.save(d.projectDir))
+	require.NoError(t, d.CompareLockfile())
+	assert.Contains(t, w.String(), "The environment matches devbox.lock.")
+}
+
+func TestAddFromLockfile(t *testing.T) {
+	const (
+		commit      = "af9e00071d0971eb292fd5abef334e66eda3cb69"
+		otherCommit = "f80ac848e3d6f0c12c52758c0f25c10c97ca3b62"
+	)
+	t.Setenv("XDG_DATA_HOME", t.TempDir())
+	other := &Lockfile{
+		LockfileVersion: lockfileVersion,
+		Packages: map[string]*LockedPackage{
+			"go": {
+				Commit:    otherCommit,
+				Attribute: "go",
+				Outputs:   []LockedOutput{{StorePath: "/nix/store/f80ac848-go", NarHash: "sha256-go"}},
+			},
+			"nodejs@18": {
+				Commit:    otherCommit,
+				Attribute: "nodejs-18_x",
+				Outputs:   []LockedOutput{{StorePath: "/nix/store/f80ac848-nodejs-18_x", NarHash: "sha256-nodejs-18_x"}},
+			},
+			"ripgrep": {
+				Commit:    commit,
+				Attribute: "ripgrep",
+				Outputs:   []LockedOutput{{StorePath: "/nix/store/af9e0007-ripgrep", NarHash: "sha256-ripgrep"}},
+			},
+		},
+	}
+	otherDir := t.TempDir()
+	require.NoError(t, other.save(otherDir))
+
+	installed := []string{}
+	client := profileNix(&installed)
+	locking := lockingNix()
+	client.buildPackages = locking.buildPackages
+	client.pathInfo = locking.pathInfo
+	client.pkgInfo = func(commit, pkg string) (*nix.Info, bool) {
+		return &nix.Info{NixName: pkg, Name: pkg}, true
+	}
+	dir := t.TempDir()
+	err := os.WriteFile(filepath.Join(dir, configFilename), []byte(fmt.Sprintf(`{
+  "packages": [],
+  "nixpkgs": {"commit": %q}
+}`, commit)), 0o644)
+	require.NoError(t, err)
+	box, err := Open(dir, io.Discard, withNixClient(client))
+	require.NoError(t, err)
+
+	require.NoError(t, box.Add(nil, WithLockfile(filepath.Join(otherDir, lockfileName))))
+	cfg, err := ReadConfig(filepath.Join(dir, configFilename))
+	require.NoError(t, err)
+	assert.Equal(t, []string{"go", "nodejs@18", "ripgrep"}, cfg.RawPackages)
+
+	// The packages are pinned and locked the same way as in the other
+	// project.
+	lock, err := readLockfile(dir)
+	require.NoError(t, err)
+	require.NotNil(t, lock)
+	for pkg, want := range other.Packages {
+		got, ok := lock.Packages[pkg]
+		require.True(t, ok, pkg)
+		assert.Equal(t, want.Commit, got.Commit, pkg)
+		assert.Equal(t, want.Attribute, got.Attribute, pkg)
+		assert.Equal(t, want.Outputs, got.Outputs, pkg)
+	}
+	_, pinned := cfg.pinnedPackage("ripgrep")
+	assert.False(t, pinned)
+}
@@ -0,0 +1,85 @@
+// Copyright 2023 Jetpack Technologies Inc and contributors. All rights reserved.
+// Use of this source code is governed by the license in the LICENSE file.
+
+package impl
+
+import (
+	"path/filepath"
+	"strings"
+
+	"github.com/fatih/color"
+	"go.jetpack.io/devbox/internal/debug"
+)
+
+// networkFSTypes are filesystem types that are mounted over the network. Nix
+// operations on them are very slow and can leave the profile corrupted.
+var networkFSTypes = map[string]bool{
+	"afpfs":  true,
+	"afs":    true,
+	"cifs":   true,
+	"ncpfs":  true,
+	"nfs":    true,
+	"smb":    true,
+	"smb2":   true,
+	"smbfs":  true,
+	"v9fs":   true, // Also used for Windows drives mounted in WSL.
+	"webdav": true,
+}
+
+// syncedFolders are path components of folders that desktop sync clients
+// (such as Dropbox and OneDrive) continuously upload, which races with nix
+// writing to the profile.
+var syncedFolders = []string{
+	"Dropbox",
+	"Google Drive",
+	"Library/CloudStorage",
+	"Library/Mobile Documents",
+	"OneDrive",
+}
+
+// warnIfNetworkFilesystem prints a single warning if the project directory or
+// its .devbox directory is on a network filesystem or in a cloud-synced
+// folder.
+func (d *Devbox) warnIfNetworkFilesystem() {
+	dirs := []string{d.projectDir, filepath.Join(d.projectDir, ".devbox")}
+	for _, dir := range dirs {
+		if folder := syncedFolder(dir); folder != "" {
+			color.New(color.FgYellow).Fprintf(
+				d.writer,
+				"Warning: this project is in a folder synced by %s. Nix operations in .devbox "+
+					"can be very slow and the sync can corrupt the nix profile. Consider moving "+
+					"the project outside of the synced folder.\n",
+				folder,
+			)
+			return
+		}
+		typ, err := d.fsType(dir)
+		if err != nil {
+			// The directory may not exist yet.
+			debug.Log("Unable to detect the filesystem type of %s: %v", dir, err)
+			continue
+		}
+		if networkFSTypes[typ] {
+			color.New(color.FgYellow).Fprintf(
+				d.writer,
+				"Warning: this project is on a network filesystem (%s). Nix operations in .devbox "+
+					"can be very slow and may corrupt the nix profile. Consider moving the project "+
+					"to a local disk.\n",
+				typ,
+			)
+			return
+		}
+	}
+}
+
+// syncedFolder returns the synced folder that dir is in, or an empty string if
+// it isn't in one.
+func syncedFolder(dir string) string {
+	path := filepath.ToSlash(dir) + "/"
+	for _, folder := range syncedFolders {
+		if strings.Contains(path, "/"+folder+"/") || strings.Contains(path, "/"+folder+" ") {
+			return folder
+		}
+	}
+	return ""
+}
@@ -0,0 +1,56 @@
+// Copyright 2023 Jetpack Technologies Inc and contributors. All rights reserved.
+// Use of this source code is governed by the license in the LICENSE file.
+
+package impl
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestWarnIfNetworkFilesystem(t *testing.T) {
+	tests := []struct {
+		name       string
+		projectDir string
+		fsType     string
+		wantWarn   string
+	}{
+		{
+			name:       "NetworkMount",
+			projectDir: "/mnt/share/project",
+			fsType:     "nfs",
+			wantWarn:   "network filesystem (nfs)",
+		},
+		{
+			name:       "LocalDisk",
+			projectDir: "/home/user/project",
+			fsType:     "ext4",
+		},
+		{
+			name:       "SyncedFolder",
+			projectDir: "/Users/user/Dropbox (Personal)/project",
+			fsType:     "apfs",
+			wantWarn:   "synced by Dropbox",
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			buf := &bytes.Buffer{}
+			d := &Devbox{
+				projectDir: test.projectDir,
+				writer:     buf,
+				fsType:     func(string) (string, error) { return test.fsType, nil },
+			}
+			d.warnIfNetworkFilesystem()
+			if test.wantWarn == "" {
+				assert.Empty(t, buf.String())
+				return
+			}
+			assert.Contains(t, buf.String(), test.wantWarn)
+			assert.Equal(t, 1, strings.Count(buf.String(), "Warning:"), "should only warn once")
+		})
+	}
+}
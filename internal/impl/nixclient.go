@@ -0,0 +1,111 @@
+// Copyright 2023 Jetpack Technologies Inc and contributors. All rights reserved.
+// Use of this source code is governed by the license in the LICENSE file.
+
+package impl
+
+import (
+	"io"
+	"os/exec"
+
+	"go.jetpack.io/devbox/internal/nix"
+	"go.jetpack.io/devbox/internal/searcher"
+)
+
+// nixClient is the part of nix that Devbox uses to look up, build and verify
+// packages. Devbox uses nixCLI, and tests use a fake so they don't need nix.
+type nixClient interface {
+	PkgInfo(commit, pkg string) (*nix.Info, bool)
+	PackageNames(commit string) ([]string, error)
+	LatestNixpkgsCommit(channel string) (string, error)
+	PrefetchNixpkgs(w io.Writer, commit string) error
+	PrintDevEnv(args *nix.PrintDevEnvArgs) (*nix.VarsAndFuncs, error)
+	BuildPackages(w io.Writer, commit string, pkgs ...string) ([]string, error)
+	OutPaths(commit, pkg string) ([]string, error)
+	PathInfo(paths ...string) ([]nix.StorePathInfo, error)
+	StoreClosure(store string, paths ...string) ([]nix.StorePathInfo, error)
+	StoreBinaries(store, storePath string) ([]string, error)
+	RealiseStorePaths(w io.Writer, extraFlags []string, paths ...string) error
+	VerifySignatures(paths, trustedKeys []string) (*nix.VerifyResult, error)
+	ProfileListItems(w io.Writer, profileDir string) ([]*nix.NixProfileListItem, error)
+	ProfileInstall(args *nix.ProfileInstallArgs) error
+	RemoveFromProfile(w io.Writer, profileDir, attrPath string) error
+}
+
+// nixCLI is the nixClient that runs the nix command.
+type nixCLI struct{}
+
+func (nixCLI) PkgInfo(commit, pkg string) (*nix.Info, bool) {
+	return nix.PkgInfo(commit, pkg)
+}
+
+func (nixCLI) PackageNames(commit string) ([]string, error) {
+	return nix.PackageNames(commit)
+}
+
+func (nixCLI) LatestNixpkgsCommit(channel string) (string, error) {
+	return nix.LatestNixpkgsCommit(channel)
+}
+
+func (nixCLI) PrefetchNixpkgs(w io.Writer, commit string) error {
+	return nix.PrefetchNixpkgs(w, commit)
+}
+
+func (nixCLI) PrintDevEnv(args *nix.PrintDevEnvArgs) (*nix.VarsAndFuncs, error) {
+	return nix.PrintDevEnv(args)
+}
+
+func (nixCLI) BuildPackages(w io.Writer, commit string, pkgs ...string) ([]string, error) {
+	return nix.BuildPackages(w, commit, pkgs...)
+}
+
+func (nixCLI) OutPaths(commit, pkg string) ([]string, error) {
+	return nix.OutPaths(commit, pkg)
+}
+
+func (nixCLI) PathInfo(paths ...string) ([]nix.StorePathInfo, error) {
+	return nix.PathInfo(paths...)
+}
+
+func (nixCLI) StoreClosure(store string, paths ...string) ([]nix.StorePathInfo, error) {
+	return nix.StoreClosure(store, paths...)
+}
+
+func (nixCLI) StoreBinaries(store, storePath string) ([]string, error) {
+	return nix.StoreBinaries(store, storePath)
+}
+
+func (nixCLI) RealiseStorePaths(w io.Writer, extraFlags []string, paths ...string) error {
+	return nix.RealiseStorePaths(w, extraFlags, paths...)
+}
+
+func (nixCLI) VerifySignatures(paths, trustedKeys []string) (*nix.VerifyResult, error) {
+	return nix.VerifySignatures(paths, trustedKeys)
+}
+
+func (nixCLI) ProfileListItems(w io.Writer, profileDir string) ([]*nix.NixProfileListItem, error) {
+	return nix.ProfileListItems(w, profileDir)
+}
+
+func (nixCLI) ProfileInstall(args *nix.ProfileInstallArgs) error {
+	return nix.ProfileInstall(args)
+}
+
+// RemoveFromProfile removes the package with the attribute path attrPath from
+// the nix profile in profileDir.
+func (nixCLI) RemoveFromProfile(w io.Writer, profileDir, attrPath string) error {
+	// TODO: unify this with nix.ProfileRemove
+	cmd := exec.Command("nix", "profile", "remove",
+		"--profile", profileDir,
+		attrPath,
+	)
+	cmd.Args = append(cmd.Args, nix.ExperimentalFlags()...)
+	cmd.Stdout = w
+	cmd.Stderr = w
+	return cmd.Run()
+}
+
+// versionResolver finds the nixpkgs commit that provides a version of a
+// package. It's implemented by *searcher.Client.
+type versionResolver interface {
+	Resolve(name, version string) (*searcher.PackageVersion, error)
+}
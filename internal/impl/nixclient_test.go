@@ -0,0 +1,131 @@
+// Copyright 2023 Jetpack Technologies Inc and contributors. All rights reserved.
+// Use of this source code is governed by the license in the LICENSE file.
+
+package impl
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"strings"
+
+	"github.com/samber/lo"
+	"go.jetpack.io/devbox/internal/nix"
+	"go.jetpack.io/devbox/internal/searcher"
+)
+
+// fakeNix is a nixClient for tests. Each method calls the field with the same
+// name, so a test only sets the ones it expects to be called.
+type fakeNix struct {
+	pkgInfo             func(commit, pkg string) (*nix.Info, bool)
+	packageNames        func(commit string) ([]string, error)
+	latestNixpkgsCommit func(channel string) (string, error)
+	prefetchNixpkgs     func(w io.Writer, commit string) error
+	printDevEnv         func(args *nix.PrintDevEnvArgs) (*nix.VarsAndFuncs, error)
+	buildPackages       func(w io.Writer, commit string, pkgs ...string) ([]string, error)
+	outPaths            func(commit, pkg string) ([]string, error)
+	pathInfo            func(paths ...string) ([]nix.StorePathInfo, error)
+	storeClosure        func(store string, paths ...string) ([]nix.StorePathInfo, error)
+	storeBinaries       func(store, storePath string) ([]string, error)
+	realiseStorePaths   func(w io.Writer, extraFlags []string, paths ...string) error
+	verifySignatures    func(paths, trustedKeys []string) (*nix.VerifyResult, error)
+	profileListItems    func(w io.Writer, profileDir string) ([]*nix.NixProfileListItem, error)
+	profileInstall      func(args *nix.ProfileInstallArgs) error
+	removeFromProfile   func(w io.Writer, profileDir, attrPath string) error
+}
+
+func (f *fakeNix) PkgInfo(commit, pkg string) (*nix.Info, bool) {
+	return f.pkgInfo(commit, pkg)
+}
+
+func (f *fakeNix) PackageNames(commit string) ([]string, error) {
+	return f.packageNames(commit)
+}
+
+func (f *fakeNix) LatestNixpkgsCommit(channel string) (string, error) {
+	return f.latestNixpkgsCommit(channel)
+}
+
+func (f *fakeNix) PrefetchNixpkgs(w io.Writer, commit string) error {
+	return f.prefetchNixpkgs(w, commit)
+}
+
+func (f *fakeNix) PrintDevEnv(args *nix.PrintDevEnvArgs) (*nix.VarsAndFuncs, error) {
+	return f.printDevEnv(args)
+}
+
+func (f *fakeNix) BuildPackages(w io.Writer, commit string, pkgs ...string) ([]string, error) {
+	return f.buildPackages(w, commit, pkgs...)
+}
+
+func (f *fakeNix) OutPaths(commit, pkg string) ([]string, error) {
+	return f.outPaths(commit, pkg)
+}
+
+func (f *fakeNix) PathInfo(paths ...string) ([]nix.StorePathInfo, error) {
+	return f.pathInfo(paths...)
+}
+
+func (f *fakeNix) StoreClosure(store string, paths ...string) ([]nix.StorePathInfo, error) {
+	return f.storeClosure(store, paths...)
+}
+
+func (f *fakeNix) StoreBinaries(store, storePath string) ([]string, error) {
+	return f.storeBinaries(store, storePath)
+}
+
+func (f *fakeNix) RealiseStorePaths(w io.Writer, extraFlags []string, paths ...string) error {
+	return f.realiseStorePaths(w, extraFlags, paths...)
+}
+
+func (f *fakeNix) VerifySignatures(paths, trustedKeys []string) (*nix.VerifyResult, error) {
+	return f.verifySignatures(paths, trustedKeys)
+}
+
+func (f *fakeNix) ProfileListItems(w io.Writer, profileDir string) ([]*nix.NixProfileListItem, error) {
+	return f.profileListItems(w, profileDir)
+}
+
+func (f *fakeNix) ProfileInstall(args *nix.ProfileInstallArgs) error {
+	return f.profileInstall(args)
+}
+
+func (f *fakeNix) RemoveFromProfile(w io.Writer, profileDir, attrPath string) error {
+	return f.removeFromProfile(w, profileDir, attrPath)
+}
+
+// profileNix is a fakeNix whose nix profile has the packages in installed.
+// Installing and removing packages changes installed, and installing the first
+// package creates the profile directory.
+func profileNix(installed *[]string) *fakeNix {
+	const attrPathPrefix = "legacyPackages.x86_64-linux."
+	return &fakeNix{
+		profileListItems: func(w io.Writer, profileDir string) ([]*nix.NixProfileListItem, error) {
+			items := []*nix.NixProfileListItem{}
+			for i, pkg := range *installed {
+				ref := "github:NixOS/nixpkgs/af9e00071d0971eb292fd5abef334e66eda3cb69#" + attrPathPrefix + pkg
+				item, err := nix.ParseProfileListItem(fmt.Sprintf("%d %s %s /nix/store/abc-%s", i, ref, ref, pkg))
+				if err != nil {
+					return nil, err
+				}
+				items = append(items, item)
+			}
+			return items, nil
+		},
+		profileInstall: func(args *nix.ProfileInstallArgs) error {
+			*installed = append(*installed, args.Package)
+			return os.MkdirAll(args.ProfilePath, 0o755)
+		},
+		removeFromProfile: func(w io.Writer, profileDir, attrPath string) error {
+			*installed = lo.Without(*installed, strings.TrimPrefix(attrPath, attrPathPrefix))
+			return nil
+		},
+	}
+}
+
+// resolverFunc is a versionResolver that calls the function.
+type resolverFunc func(name, version string) (*searcher.PackageVersion, error)
+
+func (f resolverFunc) Resolve(name, version string) (*searcher.PackageVersion, error) {
+	return f(name, version)
+}
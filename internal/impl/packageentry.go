@@ -0,0 +1,132 @@
+// Copyright 2023 Jetpack Technologies Inc and contributors. All rights reserved.
+// Use of this source code is governed by the license in the LICENSE file.
+
+package impl
+
+import (
+	"encoding/json"
+
+	"github.com/pkg/errors"
+	"go.jetpack.io/devbox/internal/debug"
+	"go.jetpack.io/devbox/internal/nix"
+	"golang.org/x/exp/slices"
+)
+
+// packageEntry is an element of the packages array in devbox.json. It's
+// either a package name, or an object with the name, the nixpkgs commit that
+// the package comes from, and the systems it's installed on. Packages with a
+// version also have the version and attribute that devbox resolved them to:
+//
+//	"packages": [
+//	  "go",
+//	  {"name": "python", "commit": "af9e0007..."},
+//	  {"name": "nodejs@18", "version": "18.16.0", "attribute": "nodejs-18_x", "commit": "f80ac848..."},
+//	  {"name": "strace", "platforms": ["x86_64-linux", "aarch64-linux"]}
+//	]
+type packageEntry struct {
+	Name      string   `json:"name"`
+	Version   string   `json:"version,omitempty"`
+	Attribute string   `json:"attribute,omitempty"`
+	Commit    string   `json:"commit,omitempty"`
+	Platforms []string `json:"platforms,omitempty"`
+}
+
+func (p *packageEntry) UnmarshalJSON(data []byte) error {
+	if err := json.Unmarshal(data, &p.Name); err == nil {
+		return nil
+	}
+	type entry packageEntry
+	if err := json.Unmarshal(data, (*entry)(p)); err != nil {
+		return errors.New("packages in devbox.json must be strings or objects with a name")
+	}
+	return nil
+}
+
+func (p packageEntry) MarshalJSON() ([]byte, error) {
+	if p.Version == "" && p.Attribute == "" && p.Commit == "" && len(p.Platforms) == 0 {
+		return json.Marshal(p.Name)
+	}
+	type entry packageEntry
+	return json.Marshal(entry(p))
+}
+
+// configJSON is how a Config is encoded in devbox.json. The packages array is
+// decoded into RawPackages, which only has the package names, packagePins and
+// packagePlatforms. Packages comes first so that it stays at the top of
+// devbox.json, where it is in Config.
+type configJSON struct {
+	Packages []packageEntry `json:"packages"`
+	*configFields
+}
+
+// configFields has the fields of Config without its methods, so that
+// configJSON doesn't recurse.
+type configFields Config
+
+// toJSON returns the value that cfg is encoded as in devbox.json.
+func (c *Config) toJSON() *configJSON {
+	aux := &configJSON{configFields: (*configFields)(c)}
+	if c.RawPackages != nil {
+		aux.Packages = make([]packageEntry, 0, len(c.RawPackages))
+		for _, pkg := range c.RawPackages {
+			pin := c.packagePins[pkg]
+			aux.Packages = append(aux.Packages, packageEntry{
+				Name:      pkg,
+				Version:   pin.Version,
+				Attribute: pin.Attribute,
+				Commit:    pin.Commit,
+				Platforms: c.packagePlatforms[pkg],
+			})
+		}
+	}
+	return aux
+}
+
+// fromJSON sets the packages of the config that aux was decoded into.
+func (aux *configJSON) fromJSON() {
+	c := (*Config)(aux.configFields)
+	c.RawPackages = nil
+	c.packagePins = nil
+	c.packagePlatforms = nil
+	if aux.Packages == nil {
+		return
+	}
+	c.RawPackages = make([]string, 0, len(aux.Packages))
+	for _, p := range aux.Packages {
+		c.RawPackages = append(c.RawPackages, p.Name)
+		if p.Version != "" || p.Attribute != "" || p.Commit != "" {
+			c.setPackagePin(p.Name, PinnedPackage{
+				Version:   p.Version,
+				Attribute: p.Attribute,
+				Commit:    p.Commit,
+			})
+		}
+		if len(p.Platforms) > 0 {
+			c.setPackagePlatforms(p.Name, p.Platforms)
+		}
+	}
+}
+
+// setPackagePlatforms restricts pkg to the nix systems in platforms. An empty
+// platforms installs pkg on every system.
+func (c *Config) setPackagePlatforms(pkg string, platforms []string) {
+	if len(platforms) == 0 {
+		delete(c.packagePlatforms, pkg)
+		return
+	}
+	if c.packagePlatforms == nil {
+		c.packagePlatforms = map[string][]string{}
+	}
+	c.packagePlatforms[pkg] = platforms
+}
+
+// supportsSystem reports whether pkg is installed on the current nix system.
+// Packages without platforms are installed on every system.
+func (c *Config) supportsSystem(pkg string) bool {
+	platforms, ok := c.packagePlatforms[pkg]
+	if !ok || slices.Contains(platforms, nix.System()) {
+		return true
+	}
+	debug.Log("Skipping package %s, which is only installed on %v and not on %s", pkg, platforms, nix.System())
+	return false
+}
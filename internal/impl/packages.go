@@ -1,17 +1,26 @@
 package impl
 
 import (
+	"encoding/json"
 	"fmt"
+	"io/fs"
 	"os"
-	"os/exec"
 	"path/filepath"
+	"sort"
+	"strconv"
 	"strings"
 
+	"github.com/fatih/color"
 	"github.com/pkg/errors"
+	"github.com/samber/lo"
 	"go.jetpack.io/devbox/internal/boxcli/featureflag"
+	"go.jetpack.io/devbox/internal/boxcli/usererr"
 	"go.jetpack.io/devbox/internal/debug"
 	"go.jetpack.io/devbox/internal/fileutil"
 	"go.jetpack.io/devbox/internal/nix"
+	"go.jetpack.io/devbox/internal/ux"
+	"golang.org/x/exp/maps"
+	"golang.org/x/exp/slices"
 )
 
 // packages.go has functions for adding, removing and getting info about nix packages
@@ -38,10 +47,114 @@ func (d *Devbox) profileBinPath() (string, error) {
 	return filepath.Join(profileDir, "bin"), nil
 }
 
+// profileBinDir returns the bin directory of the project's nix profile. Unlike
+// profileBinPath, it doesn't check or create the profile.
+func (d *Devbox) profileBinDir() string {
+	return filepath.Join(d.projectDir, nix.ProfilePath, "bin")
+}
+
+// InstallOption configures Install.
+type InstallOption func(*installOptions)
+
+type installOptions struct {
+	frozen        bool
+	packageGroups []string
+}
+
+// WithFrozenLockfile makes Install fail if devbox.lock is missing or out of
+// date with devbox.json, or if a package doesn't resolve to its locked store
+// paths. The lockfile is never changed.
+func WithFrozenLockfile() InstallOption {
+	return func(o *installOptions) {
+		o.frozen = true
+	}
+}
+
+// WithInstallPackageGroups also installs the packages in the package groups
+// from devbox.json.
+func WithInstallPackageGroups(groups ...string) InstallOption {
+	return func(o *installOptions) {
+		o.packageGroups = append(o.packageGroups, groups...)
+	}
+}
+
+// Install installs the project's packages into its nix profile and updates
+// devbox.lock, without starting a shell or running anything. It prints how
+// many packages were installed.
+func (d *Devbox) Install(opts ...InstallOption) error {
+	installOpts := &installOptions{}
+	for _, opt := range opts {
+		opt(installOpts)
+	}
+	if err := d.activatePackageGroups(installOpts.packageGroups); err != nil {
+		return err
+	}
+
+	var lock *Lockfile
+	if installOpts.frozen {
+		var err error
+		if lock, err = d.checkFrozenLockfile(); err != nil {
+			return err
+		}
+	}
+
+	// The legacy non-flakes profile is always installed as a whole, so only
+	// flakes can tell which packages are new.
+	var pending []string
+	if featureflag.Flakes.Enabled() {
+		var err error
+		if pending, err = d.pendingPackagesForInstallation(); err != nil {
+			return err
+		}
+	}
+	if err := d.ensurePackagesAreInstalled(ensure); err != nil {
+		return err
+	}
+	if installOpts.frozen {
+		if err := d.verifyLockedPackages(lock); err != nil {
+			return err
+		}
+	}
+
+	d.printInstallSummary(len(d.packages()), pending)
+	return nil
+}
+
+// printInstallSummary prints how many of the project's total packages were
+// installed, and which ones were new.
+func (d *Devbox) printInstallSummary(total int, installed []string) {
+	switch {
+	case total == 0:
+		fmt.Fprintln(d.writer, "There are no packages to install.")
+	case featureflag.Flakes.Disabled():
+		fmt.Fprintf(d.writer, "%s installed.\n", pluralizePackages(total))
+	case len(installed) == 0:
+		fmt.Fprintf(d.writer, "%s already installed.\n", pluralizePackages(total))
+	default:
+		fmt.Fprintf(
+			d.writer,
+			"Installed %s: %s. %d already installed.\n",
+			pluralizePackages(len(installed)),
+			strings.Join(installed, ", "),
+			total-len(installed),
+		)
+	}
+}
+
+func pluralizePackages(n int) string {
+	if n == 1 {
+		return "1 package"
+	}
+	return fmt.Sprintf("%d packages", n)
+}
+
 // addPackagesToProfile inspects the packages in devbox.json, checks which of them
 // are missing from the nix profile, and then installs each package individually into the
-// nix profile.
-func (d *Devbox) addPackagesToProfile(mode installMode) error {
+// nix profile. Packages in the profile that aren't in devbox.json are removed,
+// and a warning says how the profile differed when that's unexpected. The
+// packages in locked are installed from their store paths in devbox.lock
+// instead of from nixpkgs, so that they're byte-identical on every machine.
+func (d *Devbox) addPackagesToProfile(mode installMode, locked map[string][]string) error {
 	if featureflag.Flakes.Disabled() {
 		return nil
 	}
@@ -49,10 +162,30 @@ func (d *Devbox) addPackagesToProfile(mode installMode) error {
 		return nil
 	}
 
-	pkgs, err := d.pendingPackagesForInstallation()
+	profileDir, err := d.profilePath()
 	if err != nil {
 		return err
 	}
+	_, err = os.Lstat(profileDir)
+	newProfile := errors.Is(err, fs.ErrNotExist)
+
+	installed, err := d.profilePackages()
+	if err != nil {
+		return err
+	}
+	pkgs, extra := d.profileDiff(maps.Keys(installed))
+	// A new package is expected to be missing when it's being added, and
+	// every package is missing from a profile that doesn't exist yet.
+	if !newProfile && (len(extra) > 0 || (mode == ensure && len(pkgs) > 0)) {
+		ux.Fwarning(d.writer, "%s\n", profileDriftMessage(pkgs, extra))
+	}
+	for _, name := range extra {
+		for _, ref := range installed[name] {
+			if err := d.nix.RemoveFromProfile(d.writer, profileDir, ref); err != nil {
+				return err
+			}
+		}
+	}
 
 	if len(pkgs) == 0 {
 		return nil
@@ -66,25 +199,27 @@ func (d *Devbox) addPackagesToProfile(mode installMode) error {
 	}
 	fmt.Fprintf(d.writer, "\n%s\n\n", msg)
 
-	profileDir, err := d.profilePath()
-	if err != nil {
-		return err
-	}
-
+	cacheFlags := nix.BinaryCacheFlags(d.cfg.binaryCaches())
 	total := len(pkgs)
 	for idx, pkg := range pkgs {
 		stepNum := idx + 1
 
 		stepMsg := fmt.Sprintf("[%d/%d] %s", stepNum, total, pkg)
+		commit, attribute := d.packageRef(pkg)
 
-		if err := nix.ProfileInstall(&nix.ProfileInstallArgs{
+		if err := d.nix.ProfileInstall(&nix.ProfileInstallArgs{
 			CustomStepMessage: stepMsg,
-			ExtraFlags:        []string{"--priority", d.getPackagePriority(pkg)},
-			NixpkgsCommit:     d.cfg.Nixpkgs.Commit,
-			Package:           pkg,
+			ExtraFlags:        append([]string{"--priority", d.getPackagePriority(pkg)}, cacheFlags...),
+			NixpkgsCommit:     commit,
+			Package:           attribute,
 			ProfilePath:       profileDir,
+			DisallowUnfree:    !d.cfg.unfreeAllowed(pkg),
+			StorePaths:        locked[pkg],
 			Writer:            d.writer,
 		}); err != nil {
+			if errors.Is(err, nix.ErrPackageUnfree) {
+				return unfreePackageError(err, pkg)
+			}
 			return err
 		}
 	}
@@ -102,44 +237,127 @@ func (d *Devbox) removePackagesFromProfile(pkgs []string) error {
 		return err
 	}
 
-	items, err := nix.ProfileListItems(d.writer, profileDir)
+	installed, err := d.profilePackages()
 	if err != nil {
 		return err
 	}
 
-	nameToAttributePath := map[string]string{}
+	for _, pkg := range pkgs {
+		_, attribute := d.packageRef(pkg)
+		refs, ok := installed[attribute]
+		if !ok {
+			return errors.Errorf("Did not find AttributePath for package: %s", pkg)
+		}
+		for _, ref := range refs {
+			if err := d.nix.RemoveFromProfile(d.writer, profileDir, ref); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// profilePackages returns the references that remove each package in the
+// project's nix profile from it, keyed by package name. A package installed
+// from nixpkgs has its attribute path, and a package installed from the store
+// paths in devbox.lock has those store paths.
+func (d *Devbox) profilePackages() (map[string][]string, error) {
+	profileDir, err := d.profilePath()
+	if err != nil {
+		return nil, err
+	}
+
+	items, err := d.nix.ProfileListItems(d.writer, profileDir)
+	if err != nil {
+		return nil, err
+	}
+	lock, err := readLockfile(d.projectDir)
+	if err != nil {
+		return nil, err
+	}
+
+	installed := map[string][]string{}
 	for _, item := range items {
-		attrPath, err := item.AttributePath()
+		name, err := profileItemPackage(item, lock)
 		if err != nil {
-			return err
+			return nil, err
 		}
-		name, err := item.PackageName()
-		if err != nil {
-			return err
+		ref := item.StorePath()
+		if !item.InstalledFromStorePath() {
+			if ref, err = item.AttributePath(); err != nil {
+				return nil, err
+			}
 		}
-		nameToAttributePath[name] = attrPath
+		installed[name] = append(installed[name], ref)
 	}
+	debug.Log("Packages in the nix profile: %v", installed)
+	return installed, nil
+}
 
-	for _, pkg := range pkgs {
-		attrPath, ok := nameToAttributePath[pkg]
-		if !ok {
-			return errors.Errorf("Did not find AttributePath for package: %s", pkg)
+// profileItemPackage returns the name of the package that item installed.
+// Items that were installed from a store path don't have an attribute path,
+// so they're named after the attribute that devbox.lock locked the store
+// path for. A store path that isn't in the lock is named after the store path
+// itself, so that it's removed from the profile like any package that
+// devbox.json doesn't have.
+func profileItemPackage(item *nix.NixProfileListItem, lock *Lockfile) (string, error) {
+	if !item.InstalledFromStorePath() {
+		return item.PackageName()
+	}
+	if lock != nil {
+		for _, locked := range lock.Packages {
+			if slices.Contains(locked.storePaths(), item.StorePath()) {
+				return locked.Attribute, nil
+			}
 		}
+	}
+	_, name, _ := strings.Cut(filepath.Base(item.StorePath()), "-")
+	return name, nil
+}
 
-		// TODO: unify this with nix.ProfileRemove
-		cmd := exec.Command("nix", "profile", "remove",
-			"--profile", profileDir,
-			attrPath,
-		)
-		cmd.Args = append(cmd.Args, nix.ExperimentalFlags()...)
-		cmd.Stdout = d.writer
-		cmd.Stderr = d.writer
-		err = cmd.Run()
-		if err != nil {
-			return err
+// profileDiff compares the names of the packages that are installed in the
+// project's nix profile with the packages in devbox.json. missing are the
+// packages in devbox.json that aren't installed, and extra are the installed
+// packages that devbox.json doesn't have, such as the ones left behind by an
+// interrupted install or removal. Packages in package groups that aren't
+// active aren't missing, but they aren't extra either, since they're only
+// installed when their group is.
+func (d *Devbox) profileDiff(installed []string) (missing, extra []string) {
+	wanted := map[string]bool{}
+	missing = []string{}
+	for _, pkg := range d.packages() {
+		_, attribute := d.packageRef(pkg)
+		wanted[attribute] = true
+		if !slices.Contains(installed, attribute) {
+			missing = append(missing, pkg)
 		}
 	}
-	return nil
+	for _, pkg := range d.cfg.groupPackages(maps.Keys(d.cfg.packageGroups())) {
+		_, attribute := d.packageRef(pkg)
+		wanted[attribute] = true
+	}
+	for _, name := range installed {
+		if !wanted[name] {
+			extra = append(extra, name)
+		}
+	}
+	sort.Strings(extra)
+	return missing, extra
+}
+
+// profileDriftMessage describes how the nix profile differs from devbox.json.
+func profileDriftMessage(missing, extra []string) string {
+	diffs := []string{}
+	if len(missing) > 0 {
+		diffs = append(diffs, fmt.Sprintf("%s %s installed",
+			strings.Join(missing, ", "), lo.Ternary(len(missing) == 1, "isn't", "aren't")))
+	}
+	if len(extra) > 0 {
+		diffs = append(diffs, fmt.Sprintf("%s %s installed but not in devbox.json",
+			strings.Join(extra, ", "), lo.Ternary(len(extra) == 1, "is", "are")))
+	}
+	return fmt.Sprintf("the nix profile doesn't match devbox.json: %s. Devbox is updating the profile.",
+		strings.Join(diffs, ", and "))
 }
 
 func (d *Devbox) pendingPackagesForInstallation() ([]string, error) {
@@ -147,32 +365,425 @@ func (d *Devbox) pendingPackagesForInstallation() ([]string, error) {
 		return nil, errors.New("Not implemented for legacy non-flakes devbox")
 	}
 
+	installed, err := d.profilePackages()
+	if err != nil {
+		return nil, err
+	}
+	pending, _ := d.profileDiff(maps.Keys(installed))
+	return pending, nil
+}
+
+// PackageBinaries returns the names of the binaries that each installed
+// package puts on the PATH, keyed by package name.
+func (d *Devbox) PackageBinaries() (map[string][]string, error) {
+	if featureflag.Flakes.Disabled() {
+		return nil, errors.New("Not implemented for legacy non-flakes devbox")
+	}
+
 	profileDir, err := d.profilePath()
 	if err != nil {
 		return nil, err
 	}
 
-	items, err := nix.ProfileListItems(d.writer, profileDir)
+	items, err := d.nix.ProfileListItems(d.writer, profileDir)
+	if err != nil {
+		return nil, err
+	}
+	lock, err := readLockfile(d.projectDir)
 	if err != nil {
 		return nil, err
 	}
 
-	installed := map[string]bool{}
+	if d.storePathBinaries == nil {
+		d.storePathBinaries = map[string][]string{}
+	}
+	result := map[string][]string{}
 	for _, item := range items {
-		packageName, err := item.PackageName()
+		pkg, err := profileItemPackage(item, lock)
 		if err != nil {
 			return nil, err
 		}
-		installed[packageName] = true
+		storePath := item.StorePath()
+		binaries, ok := d.storePathBinaries[storePath]
+		if !ok {
+			if binaries, err = storePathBinaries(storePath); err != nil {
+				return nil, err
+			}
+			d.storePathBinaries[storePath] = binaries
+		}
+		// A package installed from its locked store paths has an item
+		// for each output.
+		result[pkg] = append(result[pkg], binaries...)
 	}
+	return result, nil
+}
 
-	pending := []string{}
-	for _, pkg := range d.packages() {
-		if _, ok := installed[pkg]; !ok {
-			pending = append(pending, pkg)
+// storePathBinaries returns the names of the executables in the bin
+// directory of a nix store path.
+func storePathBinaries(storePath string) ([]string, error) {
+	entries, err := os.ReadDir(filepath.Join(storePath, "bin"))
+	if errors.Is(err, fs.ErrNotExist) {
+		return []string{}, nil
+	}
+	if err != nil {
+		return nil, errors.WithStack(err)
+	}
+	binaries := []string{}
+	for _, entry := range entries {
+		// Follow symlinks, which are common in store paths that wrap other
+		// packages' binaries.
+		info, err := os.Stat(filepath.Join(storePath, "bin", entry.Name()))
+		if err != nil || info.IsDir() || info.Mode()&0o111 == 0 {
+			continue
 		}
+		binaries = append(binaries, entry.Name())
 	}
-	return pending, nil
+	return binaries, nil
+}
+
+// checkPackageMeta warns about packages that are marked as broken in nixpkgs,
+// and makes sure that the project allows the packages that have an unfree
+// license. If the project sets allow_unfree to false, unfree packages are
+// added to unfree_packages when allowUnfree is true or the user agrees to it,
+// and an error is returned otherwise.
+func (d *Devbox) checkPackageMeta(pkgs []string, infos map[string]*nix.Info, allowUnfree bool) error {
+	for _, pkg := range pkgs {
+		info := infos[pkg]
+		if info.Broken {
+			ux.Fwarning(
+				d.writer,
+				"%s is marked as broken in nixpkgs and will probably fail to install.\n",
+				pkg,
+			)
+		}
+		if !info.Unfree || d.cfg.unfreeAllowed(pkg) {
+			continue
+		}
+		allow := allowUnfree
+		if !allow {
+			var err error
+			allow, err = confirmOrNo(d.confirm, fmt.Sprintf(
+				"%s has an unfree license and this project sets allow_unfree to false. "+
+					"Allow it by adding it to unfree_packages in devbox.json?",
+				pkg,
+			), false)
+			if err != nil {
+				return err
+			}
+		}
+		if !allow {
+			return unfreePackageError(nix.ErrPackageUnfree, pkg)
+		}
+		d.cfg.UnfreePackages = append(d.cfg.UnfreePackages, pkg)
+		fmt.Fprintf(d.writer, "Added %s to unfree_packages in devbox.json.\n", pkg)
+	}
+	return nil
+}
+
+// unfreePackageError explains how to allow an unfree package that failed to
+// install because the project sets allow_unfree to false.
+func unfreePackageError(err error, pkg string) error {
+	return usererr.WithUserMessage(
+		err,
+		"%s has an unfree license and this project sets allow_unfree to false. "+
+			"To allow it, add it to unfree_packages in devbox.json:\n\n"+
+			"  \"unfree_packages\": [\"%s\"]",
+		pkg, pkg,
+	)
+}
+
+// binaryConflict is a binary that two packages both put on the PATH.
+type binaryConflict struct {
+	binary   string
+	existing string
+	added    string
+}
+
+// checkBinaryConflicts refuses to add the packages in pkgs that provide a
+// binary that an installed package, or another package in pkgs, already
+// provides. Only one of them ends up on the PATH, which is a common source of
+// "wrong version" surprises. It builds pkgs to find their binaries, so Add
+// only calls it for --strict. Otherwise, warnBinaryConflicts finds the
+// conflicts in the profile after the packages are installed.
+func (d *Devbox) checkBinaryConflicts(pkgs []string) error {
+	if featureflag.Flakes.Disabled() {
+		return nil
+	}
+	newPkgs := lo.Filter(pkgs, func(pkg string, _ int) bool {
+		return !slices.Contains(d.cfg.RawPackages, pkg)
+	})
+	if len(newPkgs) == 0 {
+		return nil
+	}
+
+	installed := map[string][]string{}
+	if fileutil.Exists(filepath.Join(d.projectDir, nix.ProfilePath)) {
+		var err error
+		if installed, err = d.PackageBinaries(); err != nil {
+			return err
+		}
+	}
+	added := map[string][]string{}
+	for _, pkg := range newPkgs {
+		commit, attribute := d.packageRef(pkg)
+		storePaths, err := d.nix.BuildPackages(d.writer, commit, attribute)
+		if err != nil {
+			return usererr.WithUserMessage(err, "Unable to build package: %s", pkg)
+		}
+		for _, storePath := range storePaths {
+			binaries, err := storePathBinaries(storePath)
+			if err != nil {
+				return err
+			}
+			added[pkg] = append(added[pkg], binaries...)
+		}
+	}
+
+	conflicts := findBinaryConflicts(installed, newPkgs, added)
+	if len(conflicts) == 0 {
+		return nil
+	}
+	return usererr.New(
+		"Not adding packages because they provide binaries that other packages "+
+			"already provide:\n  %s\nRemove the conflicting packages or run without --strict.",
+		formatBinaryConflicts(conflicts),
+	)
+}
+
+// warnBinaryConflicts warns about the packages in pkgs, which were just
+// installed, that provide a binary that another package in the profile
+// already provides. Their binaries are read from the profile, so nothing
+// needs to be built.
+func (d *Devbox) warnBinaryConflicts(pkgs []string) error {
+	if featureflag.Flakes.Disabled() || len(pkgs) == 0 {
+		return nil
+	}
+	installed, err := d.PackageBinaries()
+	if err != nil {
+		return err
+	}
+	// The profile names packages by their attribute, which is the package
+	// itself unless it's pinned.
+	added := map[string][]string{}
+	for _, pkg := range pkgs {
+		_, attribute := d.packageRef(pkg)
+		added[pkg] = installed[attribute]
+		delete(installed, attribute)
+	}
+
+	conflicts := findBinaryConflicts(installed, pkgs, added)
+	if len(conflicts) == 0 {
+		return nil
+	}
+	color.New(color.FgYellow).Fprintf(
+		d.writer,
+		"Warning: these packages provide the same binaries, and only one of each will be on the PATH:\n  %s\n",
+		formatBinaryConflicts(conflicts),
+	)
+	return nil
+}
+
+func formatBinaryConflicts(conflicts []binaryConflict) string {
+	lines := []string{}
+	for _, c := range conflicts {
+		lines = append(lines, fmt.Sprintf(
+			"%s and %s both provide %s", c.existing, c.added, c.binary))
+	}
+	return strings.Join(lines, "\n  ")
+}
+
+// findBinaryConflicts returns the binaries in added that are already provided
+// by a package in installed or by a package earlier in addedPkgs.
+func findBinaryConflicts(
+	installed map[string][]string,
+	addedPkgs []string,
+	added map[string][]string,
+) []binaryConflict {
+	providers := map[string]string{}
+	installedPkgs := lo.Keys(installed)
+	slices.Sort(installedPkgs)
+	for _, pkg := range installedPkgs {
+		for _, binary := range installed[pkg] {
+			if _, ok := providers[binary]; !ok {
+				providers[binary] = pkg
+			}
+		}
+	}
+
+	conflicts := []binaryConflict{}
+	for _, pkg := range addedPkgs {
+		for _, binary := range lo.Uniq(added[pkg]) {
+			provider, ok := providers[binary]
+			if !ok {
+				providers[binary] = pkg
+				continue
+			}
+			if provider != pkg {
+				conflicts = append(conflicts, binaryConflict{
+					binary:   binary,
+					existing: provider,
+					added:    pkg,
+				})
+			}
+		}
+	}
+	return conflicts
+}
+
+// resetBrokenProfile checks whether the project's nix profile refers to store
+// paths that no longer exist, which can happen if a previous install was
+// interrupted or the store was garbage collected. If so, it removes the
+// profile's link to its current generation so that the next install rebuilds
+// it from devbox.json in a new generation. The old generations are kept so
+// that RollbackProfile can switch back to one if the rebuild fails. It
+// reports whether the profile was reset.
+func (d *Devbox) resetBrokenProfile() (bool, error) {
+	profileDir := filepath.Join(d.projectDir, nix.ProfilePath)
+	if !profileIsBroken(profileDir) {
+		return false, nil
+	}
+	ux.Fwarning(
+		d.writer,
+		"the nix profile in %s is broken. Devbox will try to repair it by rebuilding it from %s.\n",
+		filepath.Dir(profileDir),
+		filepath.Base(d.configPath),
+	)
+	if err := os.Remove(profileDir); err != nil && !errors.Is(err, fs.ErrNotExist) {
+		return false, errors.WithStack(err)
+	}
+	return true, nil
+}
+
+// RollbackProfile switches the project's nix profile back to the newest
+// generation before the current one whose store paths all still exist. If
+// the profile doesn't point to a generation, such as after a repair that
+// failed, it switches to the newest generation that isn't broken.
+func (d *Devbox) RollbackProfile() error {
+	profileDir := filepath.Join(d.projectDir, nix.ProfilePath)
+	generations, err := profileGenerations(profileDir)
+	if err != nil {
+		return err
+	}
+	current := -1
+	if target, err := os.Readlink(profileDir); err == nil {
+		if !filepath.IsAbs(target) {
+			target = filepath.Join(filepath.Dir(profileDir), target)
+		}
+		current = generationNumber(profileDir, target)
+	}
+
+	for i := len(generations) - 1; i >= 0; i-- {
+		gen := generations[i]
+		if current >= 0 && gen >= current {
+			continue
+		}
+		link := generationLink(profileDir, gen)
+		if profileIsBroken(link) {
+			continue
+		}
+		// Replace the link atomically, like nix does, so the profile
+		// never disappears.
+		tmp := profileDir + ".tmp"
+		_ = os.Remove(tmp)
+		if err := os.Symlink(filepath.Base(link), tmp); err != nil {
+			return errors.WithStack(err)
+		}
+		if err := os.Rename(tmp, profileDir); err != nil {
+			return errors.WithStack(err)
+		}
+		fmt.Fprintf(d.writer, "Switched the nix profile to generation %d.\n", gen)
+		return nil
+	}
+	return usererr.New(
+		"The nix profile in %s has no earlier generation that works. Remove %[1]s and run devbox install to rebuild it.",
+		filepath.Dir(profileDir),
+	)
+}
+
+// profileGenerations returns the numbers of the generations of the profile at
+// profileDir, in ascending order.
+func profileGenerations(profileDir string) ([]int, error) {
+	links, err := filepath.Glob(profileDir + "-*-link")
+	if err != nil {
+		return nil, errors.WithStack(err)
+	}
+	generations := []int{}
+	for _, link := range links {
+		if gen := generationNumber(profileDir, link); gen >= 0 {
+			generations = append(generations, gen)
+		}
+	}
+	sort.Ints(generations)
+	return generations, nil
+}
+
+// generationNumber returns the number of the generation that link points to,
+// or -1 if link isn't a generation of the profile at profileDir.
+func generationNumber(profileDir, link string) int {
+	num := strings.TrimSuffix(strings.TrimPrefix(link, profileDir+"-"), "-link")
+	gen, err := strconv.Atoi(num)
+	if err != nil || num == link {
+		return -1
+	}
+	return gen
+}
+
+func generationLink(profileDir string, gen int) string {
+	return fmt.Sprintf("%s-%d-link", profileDir, gen)
+}
+
+// profileIsBroken reports whether the profile at profileDir exists but points
+// to a missing store path, or lists packages whose store paths are missing.
+func profileIsBroken(profileDir string) bool {
+	if _, err := os.Lstat(profileDir); err != nil {
+		// No profile yet, so there's nothing to repair.
+		return false
+	}
+	if _, err := os.Stat(profileDir); err != nil {
+		return true
+	}
+
+	data, err := os.ReadFile(filepath.Join(profileDir, "manifest.json"))
+	if err != nil {
+		// Legacy (non-flakes) profiles don't have a manifest.json.
+		return false
+	}
+	for _, storePath := range manifestStorePaths(data) {
+		if _, err := os.Stat(storePath); err != nil {
+			return true
+		}
+	}
+	return false
+}
+
+// manifestStorePaths returns the store paths of the elements in a nix profile
+// manifest.json. Depending on the nix version, the elements are either an
+// array or an object keyed by element name.
+func manifestStorePaths(data []byte) []string {
+	type element struct {
+		StorePaths []string `json:"storePaths"`
+	}
+	manifest := struct {
+		Elements json.RawMessage `json:"elements"`
+	}{}
+	if err := json.Unmarshal(data, &manifest); err != nil {
+		return nil
+	}
+
+	var elements []element
+	if err := json.Unmarshal(manifest.Elements, &elements); err != nil {
+		byName := map[string]element{}
+		if err := json.Unmarshal(manifest.Elements, &byName); err != nil {
+			return nil
+		}
+		elements = lo.Values(byName)
+	}
+
+	storePaths := []string{}
+	for _, e := range elements {
+		storePaths = append(storePaths, e.StorePaths...)
+	}
+	return storePaths
 }
 
 // This sets the priority of non-devbox.json packages to be slightly lower (higher number)
@@ -206,18 +817,20 @@ func resetProfileDirForFlakes(profileDir string) (err error) {
 		return errors.WithStack(err)
 	}
 
-	needsReset := false
-	if featureflag.Flakes.Enabled() {
-		// older nix profiles have a manifest.nix file present
-		needsReset = fileutil.Exists(filepath.Join(dir, "manifest.nix"))
-	} else {
-		// newer flake nix profiles have a manifest.json file present
-		needsReset = fileutil.Exists(filepath.Join(dir, "manifest.json"))
-	}
-
-	if !needsReset {
+	if !profileFormatMismatch(dir) {
 		return nil
 	}
 
 	return errors.WithStack(os.Remove(profileDir))
 }
+
+// profileFormatMismatch reports whether the profile at dir was created with
+// the Flakes feature set differently than it is now.
+func profileFormatMismatch(dir string) bool {
+	if featureflag.Flakes.Enabled() {
+		// older nix profiles have a manifest.nix file present
+		return fileutil.Exists(filepath.Join(dir, "manifest.nix"))
+	}
+	// newer flake nix profiles have a manifest.json file present
+	return fileutil.Exists(filepath.Join(dir, "manifest.json"))
+}
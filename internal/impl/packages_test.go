@@ -0,0 +1,357 @@
+// Copyright 2023 Jetpack Technologies Inc and contributors. All rights reserved.
+// Use of this source code is governed by the license in the LICENSE file.
+
+package impl
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.jetpack.io/devbox/internal/nix"
+)
+
+func TestStorePathBinaries(t *testing.T) {
+	storePath := filepath.Join(t.TempDir(), "abc123-ripgrep-13.0.0")
+	binDir := filepath.Join(storePath, "bin")
+	require.NoError(t, os.MkdirAll(filepath.Join(binDir, "subdir"), 0o755))
+	require.NoError(t, os.WriteFile(filepath.Join(binDir, "rg"), []byte("#!/bin/sh\n"), 0o755))
+	require.NoError(t, os.WriteFile(filepath.Join(binDir, "README"), []byte("docs"), 0o644))
+	require.NoError(t, os.Symlink("rg", filepath.Join(binDir, "ripgrep")))
+
+	binaries, err := storePathBinaries(storePath)
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"rg", "ripgrep"}, binaries)
+
+	binaries, err = storePathBinaries(filepath.Join(t.TempDir(), "no-bin"))
+	assert.NoError(t, err)
+	assert.Empty(t, binaries)
+}
+
+func TestResetBrokenProfile(t *testing.T) {
+	storeDir := t.TempDir()
+	existing := filepath.Join(storeDir, "abc-ripgrep-13.0.0")
+	require.NoError(t, os.Mkdir(existing, 0o755))
+	missing := filepath.Join(storeDir, "def-jq-1.6")
+
+	t.Run("healthy profile", func(t *testing.T) {
+		projectDir := t.TempDir()
+		profile := writeProfileGeneration(t, projectDir, storeDir, 1, existing)
+		d := &Devbox{projectDir: projectDir, writer: &bytes.Buffer{}}
+
+		repaired, err := d.resetBrokenProfile()
+		assert.NoError(t, err)
+		assert.False(t, repaired)
+		assert.FileExists(t, filepath.Join(profile, "manifest.json"))
+	})
+
+	t.Run("missing store path", func(t *testing.T) {
+		projectDir := t.TempDir()
+		profile := writeProfileGeneration(t, projectDir, storeDir, 1, existing, missing)
+		out := &bytes.Buffer{}
+		d := &Devbox{projectDir: projectDir, configPath: filepath.Join(projectDir, "devbox.json"), writer: out}
+
+		repaired, err := d.resetBrokenProfile()
+		assert.NoError(t, err)
+		assert.True(t, repaired)
+		assert.Contains(t, out.String(), "try to repair it by rebuilding it from devbox.json")
+		_, err = os.Lstat(profile)
+		assert.ErrorIs(t, err, os.ErrNotExist)
+		// The generation is kept so the profile can be rolled back to it.
+		_, err = os.Lstat(profile + "-1-link")
+		assert.NoError(t, err)
+	})
+
+	t.Run("dangling profile link", func(t *testing.T) {
+		projectDir := t.TempDir()
+		profile := filepath.Join(projectDir, nix.ProfilePath)
+		require.NoError(t, os.MkdirAll(filepath.Dir(profile), 0o755))
+		require.NoError(t, os.Symlink(filepath.Join(storeDir, "gone"), profile))
+		d := &Devbox{projectDir: projectDir, writer: &bytes.Buffer{}}
+
+		repaired, err := d.resetBrokenProfile()
+		assert.NoError(t, err)
+		assert.True(t, repaired)
+		_, err = os.Lstat(profile)
+		assert.ErrorIs(t, err, os.ErrNotExist)
+	})
+}
+
+func TestRollbackProfile(t *testing.T) {
+	storeDir := t.TempDir()
+	existing := filepath.Join(storeDir, "abc-ripgrep-13.0.0")
+	require.NoError(t, os.Mkdir(existing, 0o755))
+	missing := filepath.Join(storeDir, "def-jq-1.6")
+
+	projectDir := t.TempDir()
+	writeProfileGeneration(t, projectDir, storeDir, 1, existing)
+	writeProfileGeneration(t, projectDir, storeDir, 2, existing, missing)
+	profile := writeProfileGeneration(t, projectDir, storeDir, 3, existing, missing)
+	out := &bytes.Buffer{}
+	d := &Devbox{projectDir: projectDir, writer: out}
+
+	// Generation 2 is broken too, so the rollback skips it.
+	require.NoError(t, d.RollbackProfile())
+	assert.Equal(t, "Switched the nix profile to generation 1.\n", out.String())
+	target, err := os.Readlink(profile)
+	require.NoError(t, err)
+	assert.Equal(t, filepath.Base(profile)+"-1-link", target)
+
+	// There's nothing before generation 1.
+	assert.ErrorContains(t, d.RollbackProfile(), "has no earlier generation that works")
+
+	// After a failed repair, the profile doesn't point to any generation.
+	require.NoError(t, os.Remove(profile))
+	out.Reset()
+	require.NoError(t, d.RollbackProfile())
+	assert.Equal(t, "Switched the nix profile to generation 1.\n", out.String())
+}
+
+// writeProfileGeneration creates generation gen of the project's profile,
+// whose manifest lists storePaths, and points the profile at it.
+func writeProfileGeneration(t *testing.T, projectDir, storeDir string, gen int, storePaths ...string) string {
+	profile := filepath.Join(projectDir, nix.ProfilePath)
+	require.NoError(t, os.MkdirAll(filepath.Dir(profile), 0o755))
+	generation, err := os.MkdirTemp(storeDir, "profile")
+	require.NoError(t, err)
+	manifest, err := json.Marshal(map[string]any{
+		"version":  2,
+		"elements": []map[string]any{{"storePaths": storePaths}},
+	})
+	require.NoError(t, err)
+	require.NoError(t, os.WriteFile(filepath.Join(generation, "manifest.json"), manifest, 0o644))
+	link := fmt.Sprintf("%s-%d-link", profile, gen)
+	require.NoError(t, os.Symlink(generation, link))
+	_ = os.Remove(profile)
+	require.NoError(t, os.Symlink(filepath.Base(link), profile))
+	return profile
+}
+
+func TestFindBinaryConflicts(t *testing.T) {
+	tests := []struct {
+		name      string
+		installed map[string][]string
+		addedPkgs []string
+		added     map[string][]string
+		want      []binaryConflict
+	}{
+		{
+			name:      "InstalledPackageProvidesBinary",
+			installed: map[string][]string{"python310": {"python", "python3.10"}},
+			addedPkgs: []string{"python311"},
+			added:     map[string][]string{"python311": {"python", "python3.11"}},
+			want:      []binaryConflict{{binary: "python", existing: "python310", added: "python311"}},
+		},
+		{
+			name:      "AddedPackagesProvideSameBinary",
+			installed: map[string][]string{"ripgrep": {"rg"}},
+			addedPkgs: []string{"python310", "python311"},
+			added: map[string][]string{
+				"python310": {"python", "python3.10"},
+				"python311": {"python", "python3.11"},
+			},
+			want: []binaryConflict{{binary: "python", existing: "python310", added: "python311"}},
+		},
+		{
+			name:      "NoConflicts",
+			installed: map[string][]string{"ripgrep": {"rg"}},
+			addedPkgs: []string{"jq"},
+			added:     map[string][]string{"jq": {"jq"}},
+			want:      []binaryConflict{},
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			got := findBinaryConflicts(test.installed, test.addedPkgs, test.added)
+			assert.Equal(t, test.want, got)
+		})
+	}
+}
+
+func TestAddWarnsAboutBinaryConflicts(t *testing.T) {
+	t.Setenv("XDG_DATA_HOME", t.TempDir())
+	installed := []string{}
+	client := profileNix(&installed)
+	client.pkgInfo = func(commit, pkg string) (*nix.Info, bool) {
+		return &nix.Info{NixName: pkg, Name: pkg}, true
+	}
+	client.pathInfo = func(paths ...string) ([]nix.StorePathInfo, error) {
+		return []nix.StorePathInfo{{Path: paths[0]}}, nil
+	}
+	built := []string{}
+	client.buildPackages = func(w io.Writer, commit string, pkgs ...string) ([]string, error) {
+		built = append(built, pkgs...)
+		return []string{t.TempDir()}, nil
+	}
+
+	dir := t.TempDir()
+	_, err := InitConfig(dir, io.Discard)
+	require.NoError(t, err)
+	out := &bytes.Buffer{}
+	box, err := Open(dir, out, withNixClient(client))
+	require.NoError(t, err)
+	box.storePathBinaries = map[string][]string{
+		"/nix/store/abc-vim":    {"vim", "vimdiff"},
+		"/nix/store/abc-neovim": {"nvim", "vimdiff"},
+	}
+
+	require.NoError(t, box.Add([]string{"vim"}))
+	require.NoError(t, box.Add([]string{"neovim"}))
+	assert.Contains(t, out.String(), "vim and neovim both provide vimdiff")
+	// Without --strict, the binaries are read from the profile instead of
+	// building the packages before they're added, so each package is only
+	// built once, to lock it.
+	assert.Equal(t, []string{"vim", "neovim"}, built)
+}
+
+func TestPrintInstallSummary(t *testing.T) {
+	tests := []struct {
+		total     int
+		installed []string
+		want      string
+	}{
+		{total: 0, want: "There are no packages to install.\n"},
+		{total: 1, want: "1 package already installed.\n"},
+		{total: 3, installed: []string{"go"}, want: "Installed 1 package: go. 2 already installed.\n"},
+		{total: 2, installed: []string{"go", "jq"}, want: "Installed 2 packages: go, jq. 0 already installed.\n"},
+	}
+	for _, test := range tests {
+		t.Run(test.want, func(t *testing.T) {
+			out := &bytes.Buffer{}
+			d := &Devbox{writer: out}
+			d.printInstallSummary(test.total, test.installed)
+			assert.Equal(t, test.want, out.String())
+		})
+	}
+}
+
+func TestProfileDiff(t *testing.T) {
+	t.Setenv("XDG_DATA_HOME", t.TempDir())
+	d := &Devbox{
+		cfg:    &Config{RawPackages: []string{"go", "ripgrep", "jq"}},
+		writer: &bytes.Buffer{},
+	}
+
+	missing, extra := d.profileDiff([]string{"ripgrep", "mdbook", "go", "act"})
+	assert.Equal(t, []string{"jq"}, missing)
+	assert.Equal(t, []string{"act", "mdbook"}, extra)
+
+	missing, extra = d.profileDiff([]string{"jq", "go", "ripgrep"})
+	assert.Empty(t, missing)
+	assert.Empty(t, extra)
+}
+
+func TestAddPackagesToProfile(t *testing.T) {
+	t.Setenv("XDG_DATA_HOME", t.TempDir())
+	installed := []string{}
+	client := profileNix(&installed)
+	out := &bytes.Buffer{}
+	d := &Devbox{
+		cfg: &Config{
+			RawPackages:   []string{"go", "jq"},
+			PackageGroups: map[string][]string{"docs": {"mdbook"}},
+		},
+		projectDir: t.TempDir(),
+		writer:     out,
+		nix:        client,
+	}
+
+	// A profile that doesn't exist yet is missing every package, which
+	// isn't worth a warning.
+	require.NoError(t, d.addPackagesToProfile(ensure, nil))
+	assert.Equal(t, []string{"go", "jq"}, installed)
+	assert.NotContains(t, out.String(), "doesn't match devbox.json")
+
+	// Packages of package groups that aren't active are left installed.
+	installed = append(installed, "mdbook")
+	out.Reset()
+	require.NoError(t, d.addPackagesToProfile(ensure, nil))
+	assert.Equal(t, []string{"go", "jq", "mdbook"}, installed)
+	assert.Empty(t, out.String())
+
+	// Packages that aren't in devbox.json are removed and missing ones are
+	// installed, with a warning.
+	installed = []string{"go", "act"}
+	out.Reset()
+	require.NoError(t, d.addPackagesToProfile(ensure, nil))
+	assert.Equal(t, []string{"go", "jq"}, installed)
+	assert.Contains(t, out.String(), profileDriftMessage([]string{"jq"}, []string{"act"}))
+}
+
+func TestProfileDriftMessage(t *testing.T) {
+	assert.Equal(t,
+		"the nix profile doesn't match devbox.json: jq isn't installed. Devbox is updating the profile.",
+		profileDriftMessage([]string{"jq"}, nil))
+	assert.Equal(t,
+		"the nix profile doesn't match devbox.json: go, jq aren't installed, "+
+			"and mdbook is installed but not in devbox.json. Devbox is updating the profile.",
+		profileDriftMessage([]string{"go", "jq"}, []string{"mdbook"}))
+	assert.Equal(t,
+		"the nix profile doesn't match devbox.json: act, mdbook are installed but not in devbox.json. "+
+			"Devbox is updating the profile.",
+		profileDriftMessage(nil, []string{"act", "mdbook"}))
+}
+
+func TestCheckPackageMeta(t *testing.T) {
+	disallowUnfree := false
+	tests := []struct {
+		name        string
+		allowUnfree *bool
+		flag        bool
+		confirm     bool
+		info        nix.Info
+		wantErr     bool
+		wantUnfree  []string
+		wantWarning bool
+	}{
+		{name: "free", allowUnfree: &disallowUnfree},
+		{name: "unfree allowed by default", info: nix.Info{Unfree: true}},
+		{
+			name:        "unfree with --allow-unfree",
+			allowUnfree: &disallowUnfree,
+			flag:        true,
+			info:        nix.Info{Unfree: true},
+			wantUnfree:  []string{"vscode"},
+		},
+		{
+			name:        "unfree confirmed",
+			allowUnfree: &disallowUnfree,
+			confirm:     true,
+			info:        nix.Info{Unfree: true},
+			wantUnfree:  []string{"vscode"},
+		},
+		{
+			name:        "unfree declined",
+			allowUnfree: &disallowUnfree,
+			info:        nix.Info{Unfree: true},
+			wantErr:     true,
+		},
+		{name: "broken", info: nix.Info{Broken: true}, wantWarning: true},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			out := &bytes.Buffer{}
+			d := &Devbox{
+				cfg:     &Config{AllowUnfree: test.allowUnfree},
+				writer:  out,
+				confirm: func(string, bool) (bool, error) { return test.confirm, nil },
+			}
+			info := test.info
+			err := d.checkPackageMeta(
+				[]string{"vscode"}, map[string]*nix.Info{"vscode": &info}, test.flag)
+			if test.wantErr {
+				assert.ErrorIs(t, err, nix.ErrPackageUnfree)
+			} else {
+				assert.NoError(t, err)
+			}
+			assert.Equal(t, test.wantUnfree, d.cfg.UnfreePackages)
+			assert.Equal(t, test.wantWarning, bytes.Contains(out.Bytes(), []byte("broken")))
+		})
+	}
+}
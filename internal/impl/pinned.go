@@ -0,0 +1,132 @@
+// Copyright 2023 Jetpack Technologies Inc and contributors. All rights reserved.
+// Use of this source code is governed by the license in the LICENSE file.
+
+package impl
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/pkg/errors"
+	"go.jetpack.io/devbox/internal/boxcli/usererr"
+	"go.jetpack.io/devbox/internal/nix"
+	"go.jetpack.io/devbox/internal/searcher"
+)
+
+// PinnedPackage is the nixpkgs commit that provides a package instead of the
+// project's. A package added with a version, such as "nodejs@18", also
+// records the attribute and version it resolved to.
+type PinnedPackage struct {
+	// Version is the full version that the package resolved to, such as
+	// 18.16.0 for nodejs@18.
+	Version string
+
+	// Attribute is the nixpkgs attribute that provides the package. It's
+	// empty if the attribute is the package name.
+	Attribute string
+
+	Commit string
+}
+
+// parseVersionedPackage splits a package such as "nodejs@18" into its name and
+// version. ok is false if pkg doesn't have a version.
+func parseVersionedPackage(pkg string) (name, version string, ok bool) {
+	name, version, ok = strings.Cut(pkg, "@")
+	if !ok || name == "" || version == "" {
+		return pkg, "", false
+	}
+	return name, version, true
+}
+
+// pinPackages resolves each package in pkgs that has a version and isn't
+// pinned yet, and records its pin in the config. It returns the packages it
+// pinned. If any version can't be resolved, the config is left unchanged.
+func (d *Devbox) pinPackages(pkgs []string) ([]string, error) {
+	pins := map[string]PinnedPackage{}
+	for _, pkg := range pkgs {
+		name, version, ok := parseVersionedPackage(pkg)
+		if !ok {
+			continue
+		}
+		if _, pinned := d.cfg.pinnedPackage(pkg); pinned {
+			continue
+		}
+		resolved, err := d.resolver.Resolve(name, version)
+		if errors.Is(err, searcher.ErrVersionNotFound) {
+			return nil, usererr.New("No nixpkgs commit provides version %s of %s", version, name)
+		}
+		if err != nil {
+			return nil, usererr.WithUserMessage(err, "Unable to resolve %s", pkg)
+		}
+		fmt.Fprintf(d.writer, "Resolved %s to %s %s from nixpkgs commit %s.\n",
+			pkg, resolved.AttributePath, resolved.Version, resolved.CommitHash)
+		pins[pkg] = PinnedPackage{
+			Version:   resolved.Version,
+			Attribute: resolved.AttributePath,
+			Commit:    resolved.CommitHash,
+		}
+	}
+
+	pinned := []string{}
+	for pkg, pin := range pins {
+		d.cfg.setPackagePin(pkg, pin)
+		pinned = append(pinned, pkg)
+	}
+	return pinned, nil
+}
+
+// unpinPackages removes the pins of pkgs from the config.
+func (d *Devbox) unpinPackages(pkgs []string) {
+	for _, pkg := range pkgs {
+		delete(d.cfg.packagePins, pkg)
+	}
+}
+
+// setPackagePin makes pkg come from the nixpkgs commit in pin.
+func (c *Config) setPackagePin(pkg string, pin PinnedPackage) {
+	if c.packagePins == nil {
+		c.packagePins = map[string]PinnedPackage{}
+	}
+	c.packagePins[pkg] = pin
+}
+
+// pinnedPackage returns the pin of pkg, looking in the configs this one
+// extends if it isn't pinned in this one.
+func (c *Config) pinnedPackage(pkg string) (PinnedPackage, bool) {
+	layers := c.layers()
+	for i := len(layers) - 1; i >= 0; i-- {
+		cfg := layers[i]
+		if pin, ok := cfg.packagePins[pkg]; ok {
+			return pin, true
+		}
+	}
+	return PinnedPackage{}, false
+}
+
+// packageRef returns the nixpkgs commit and attribute that provide pkg. For
+// most packages that's the project's nixpkgs commit and the package itself,
+// unless devbox.json overrides the package's commit.
+func (d *Devbox) packageRef(pkg string) (commit, attribute string) {
+	pin, ok := d.cfg.pinnedPackage(pkg)
+	if !ok {
+		return d.cfg.Nixpkgs.Commit, pkg
+	}
+	if pin.Attribute == "" {
+		return pin.Commit, pkg
+	}
+	return pin.Commit, pin.Attribute
+}
+
+// pkgInfo is nix.PkgInfo for a package in the project, which may be pinned
+// to its own nixpkgs commit.
+func (d *Devbox) pkgInfo(pkg string) (*nix.Info, bool) {
+	commit, attribute := d.packageRef(pkg)
+	return d.nix.PkgInfo(commit, attribute)
+}
+
+// pkgExists is nix.PkgExists for a package in the project, which may be
+// pinned to its own nixpkgs commit.
+func (d *Devbox) pkgExists(pkg string) bool {
+	_, found := d.pkgInfo(pkg)
+	return found
+}
@@ -0,0 +1,82 @@
+// Copyright 2023 Jetpack Technologies Inc and contributors. All rights reserved.
+// Use of this source code is governed by the license in the LICENSE file.
+
+package impl
+
+import (
+	"bytes"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.jetpack.io/devbox/internal/searcher"
+)
+
+func TestParseVersionedPackage(t *testing.T) {
+	tests := []struct {
+		pkg         string
+		wantName    string
+		wantVersion string
+		wantOK      bool
+	}{
+		{pkg: "nodejs@18", wantName: "nodejs", wantVersion: "18", wantOK: true},
+		{pkg: "python@3.10.8", wantName: "python", wantVersion: "3.10.8", wantOK: true},
+		{pkg: "nodejs", wantName: "nodejs"},
+		{pkg: "nodejs@", wantName: "nodejs@"},
+		{pkg: "@18", wantName: "@18"},
+	}
+	for _, test := range tests {
+		t.Run(test.pkg, func(t *testing.T) {
+			name, version, ok := parseVersionedPackage(test.pkg)
+			assert.Equal(t, test.wantName, name)
+			assert.Equal(t, test.wantVersion, version)
+			assert.Equal(t, test.wantOK, ok)
+		})
+	}
+}
+
+func TestPinPackages(t *testing.T) {
+	resolver := resolverFunc(func(name, version string) (*searcher.PackageVersion, error) {
+		if name != "nodejs" {
+			return nil, searcher.ErrVersionNotFound
+		}
+		return &searcher.PackageVersion{
+			Name:          name,
+			Version:       "18.16.0",
+			CommitHash:    "f80ac848e3d6f0c12c52758c0f25c10c97ca3b62",
+			AttributePath: "nodejs-18_x",
+		}, nil
+	})
+
+	d := &Devbox{cfg: &Config{}, writer: &bytes.Buffer{}, resolver: resolver}
+	d.cfg.Nixpkgs.Commit = "af9e00071d0971eb292fd5abef334e66eda3cb69"
+
+	pinned, err := d.pinPackages([]string{"go", "nodejs@18"})
+	require.NoError(t, err)
+	assert.Equal(t, []string{"nodejs@18"}, pinned)
+	assert.Equal(t, PinnedPackage{
+		Version:   "18.16.0",
+		Attribute: "nodejs-18_x",
+		Commit:    "f80ac848e3d6f0c12c52758c0f25c10c97ca3b62",
+	}, d.cfg.packagePins["nodejs@18"])
+
+	commit, attribute := d.packageRef("nodejs@18")
+	assert.Equal(t, "f80ac848e3d6f0c12c52758c0f25c10c97ca3b62", commit)
+	assert.Equal(t, "nodejs-18_x", attribute)
+	commit, attribute = d.packageRef("go")
+	assert.Equal(t, "af9e00071d0971eb292fd5abef334e66eda3cb69", commit)
+	assert.Equal(t, "go", attribute)
+
+	// Packages that are already pinned aren't resolved again.
+	pinned, err = d.pinPackages([]string{"nodejs@18"})
+	require.NoError(t, err)
+	assert.Empty(t, pinned)
+
+	// A version that can't be resolved leaves the config unchanged.
+	_, err = d.pinPackages([]string{"nodejs@20", "python@1"})
+	assert.Error(t, err)
+	assert.Len(t, d.cfg.packagePins, 1)
+
+	d.unpinPackages([]string{"nodejs@18"})
+	assert.Empty(t, d.cfg.packagePins)
+}
@@ -0,0 +1,263 @@
+// Copyright 2023 Jetpack Technologies Inc and contributors. All rights reserved.
+// Use of this source code is governed by the license in the LICENSE file.
+
+package impl
+
+import (
+	"encoding/base64"
+	"encoding/hex"
+	"fmt"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/pkg/errors"
+	"github.com/samber/lo"
+	"go.jetpack.io/devbox/internal/boxcli/featureflag"
+	"go.jetpack.io/devbox/internal/boxcli/usererr"
+	"go.jetpack.io/devbox/internal/build"
+	"go.jetpack.io/devbox/internal/cuecfg"
+	"go.jetpack.io/devbox/internal/fileutil"
+	"go.jetpack.io/devbox/internal/nix"
+)
+
+// ProfileExportFormat is an output format for ExportProfile.
+type ProfileExportFormat string
+
+const (
+	// ProfileExportJSON is devbox's own JSON manifest format.
+	ProfileExportJSON ProfileExportFormat = "json"
+	// ProfileExportSPDX is an SPDX 2.3 JSON document.
+	ProfileExportSPDX ProfileExportFormat = "spdx"
+	// ProfileExportCycloneDX is a CycloneDX 1.4 JSON BOM.
+	ProfileExportCycloneDX ProfileExportFormat = "cyclonedx"
+)
+
+// ProfileExportFormats lists the supported values for ProfileExportFormat.
+var ProfileExportFormats = []ProfileExportFormat{
+	ProfileExportJSON,
+	ProfileExportSPDX,
+	ProfileExportCycloneDX,
+}
+
+// ParseProfileExportFormat validates a user-provided export format name.
+func ParseProfileExportFormat(s string) (ProfileExportFormat, error) {
+	names := make([]string, len(ProfileExportFormats))
+	for i, f := range ProfileExportFormats {
+		if string(f) == s {
+			return f, nil
+		}
+		names[i] = string(f)
+	}
+	return "", usererr.New(
+		"Unsupported export format %q. Valid formats are: %s", s, strings.Join(names, ", "))
+}
+
+// profileManifest lists every store path in the closure of the project's
+// profile.
+type profileManifest struct {
+	StorePaths []profileManifestEntry `json:"store_paths"`
+}
+
+type profileManifestEntry struct {
+	Path    string `json:"path"`
+	Name    string `json:"name"`
+	Version string `json:"version,omitempty"`
+	NarHash string `json:"nar_hash"`
+	NarSize int64  `json:"nar_size"`
+	// Installed is true for the packages installed into the profile, as
+	// opposed to their dependencies.
+	Installed bool `json:"installed"`
+}
+
+// ExportProfile returns a manifest of every store path in the closure of the
+// project's nix profile, in the given format.
+func (d *Devbox) ExportProfile(format ProfileExportFormat) ([]byte, error) {
+	closure, installed, err := d.profileClosure("devbox profile export")
+	if err != nil {
+		return nil, err
+	}
+	manifest := newProfileManifest(closure, installed)
+
+	switch format {
+	case ProfileExportSPDX:
+		return cuecfg.MarshalJSON(manifest.spdx(filepath.Base(d.projectDir), time.Now()))
+	case ProfileExportCycloneDX:
+		return cuecfg.MarshalJSON(manifest.cycloneDX(filepath.Base(d.projectDir), time.Now()))
+	default:
+		return cuecfg.MarshalJSON(manifest)
+	}
+}
+
+// profileClosure returns every store path in the closure of the project's
+// nix profile, and the set of store paths that are installed into the
+// profile (as opposed to their dependencies). command names the devbox
+// command that needs the closure, for error messages.
+func (d *Devbox) profileClosure(command string) ([]nix.StorePathInfo, map[string]bool, error) {
+	if featureflag.Flakes.Disabled() {
+		return nil, nil, usererr.New("%s requires DEVBOX_FEATURE_FLAKES to be enabled", command)
+	}
+	profileDir := filepath.Join(d.projectDir, nix.ProfilePath)
+	if !fileutil.Exists(profileDir) {
+		return nil, nil, usererr.New(
+			"This project doesn't have a nix profile yet. Run devbox shell or devbox add to create one.")
+	}
+
+	items, err := d.nix.ProfileListItems(d.writer, profileDir)
+	if err != nil {
+		return nil, nil, err
+	}
+	installed := map[string]bool{}
+	for _, item := range items {
+		installed[item.StorePath()] = true
+	}
+
+	// The profile itself is a store path in its own closure, but it isn't a
+	// package so it's left out.
+	profileStorePath, err := filepath.EvalSymlinks(profileDir)
+	if err != nil {
+		return nil, nil, errors.WithStack(err)
+	}
+	closure, err := nix.Closure(profileStorePath)
+	if err != nil {
+		return nil, nil, err
+	}
+	closure = lo.Filter(closure, func(info nix.StorePathInfo, _ int) bool {
+		return info.Path != profileStorePath
+	})
+	return closure, installed, nil
+}
+
+func newProfileManifest(closure []nix.StorePathInfo, installed map[string]bool) *profileManifest {
+	manifest := &profileManifest{StorePaths: []profileManifestEntry{}}
+	for _, info := range closure {
+		name, version := info.NameAndVersion()
+		manifest.StorePaths = append(manifest.StorePaths, profileManifestEntry{
+			Path:      info.Path,
+			Name:      name,
+			Version:   version,
+			NarHash:   info.NarHash,
+			NarSize:   info.NarSize,
+			Installed: installed[info.Path],
+		})
+	}
+	return manifest
+}
+
+func (m *profileManifest) spdx(project string, created time.Time) map[string]any {
+	packages := []map[string]any{}
+	relationships := []map[string]any{}
+	for i, entry := range m.StorePaths {
+		id := fmt.Sprintf("SPDXRef-Package-%d", i)
+		pkg := map[string]any{
+			"SPDXID":           id,
+			"name":             entry.Name,
+			"versionInfo":      entry.Version,
+			"downloadLocation": "NOASSERTION",
+			"filesAnalyzed":    false,
+			"comment":          entry.Path,
+		}
+		if digest := sha256Hex(entry.NarHash); digest != "" {
+			pkg["checksums"] = []map[string]string{
+				{"algorithm": "SHA256", "checksumValue": digest},
+			}
+		}
+		packages = append(packages, pkg)
+		if entry.Installed {
+			relationships = append(relationships, map[string]any{
+				"spdxElementId":      "SPDXRef-DOCUMENT",
+				"relationshipType":   "DESCRIBES",
+				"relatedSpdxElement": id,
+			})
+		}
+	}
+	return map[string]any{
+		"spdxVersion":       "SPDX-2.3",
+		"dataLicense":       "CC0-1.0",
+		"SPDXID":            "SPDXRef-DOCUMENT",
+		"name":              project,
+		"documentNamespace": "https://www.jetpack.io/devbox/spdx/" + project + "-" + uuid.NewString(),
+		"creationInfo": map[string]any{
+			"created":  created.UTC().Format(time.RFC3339),
+			"creators": []string{"Tool: devbox-" + build.Version},
+		},
+		"packages":      packages,
+		"relationships": relationships,
+	}
+}
+
+func (m *profileManifest) cycloneDX(project string, created time.Time) map[string]any {
+	components := []map[string]any{}
+	for _, entry := range m.StorePaths {
+		component := map[string]any{
+			"type":    "application",
+			"bom-ref": entry.Path,
+			"name":    entry.Name,
+			"version": entry.Version,
+			"scope":   lo.Ternary(entry.Installed, "required", "optional"),
+		}
+		if digest := sha256Hex(entry.NarHash); digest != "" {
+			component["hashes"] = []map[string]string{{"alg": "SHA-256", "content": digest}}
+		}
+		components = append(components, component)
+	}
+	return map[string]any{
+		"bomFormat":    "CycloneDX",
+		"specVersion":  "1.4",
+		"serialNumber": "urn:uuid:" + uuid.NewString(),
+		"version":      1,
+		"metadata": map[string]any{
+			"timestamp": created.UTC().Format(time.RFC3339),
+			"tools":     []map[string]string{{"name": "devbox", "version": build.Version}},
+			"component": map[string]string{"type": "application", "name": project},
+		},
+		"components": components,
+	}
+}
+
+// sha256Hex converts a nix sha256 hash, either in nix's base32 format
+// (sha256:<base32>) or in SRI format (sha256-<base64>), to hex. It returns an
+// empty string if the hash isn't a sha256 hash in one of those formats.
+func sha256Hex(hash string) string {
+	if strings.HasPrefix(hash, "sha256-") {
+		b, err := base64.StdEncoding.DecodeString(strings.TrimPrefix(hash, "sha256-"))
+		if err != nil {
+			return ""
+		}
+		return hex.EncodeToString(b)
+	}
+	if strings.HasPrefix(hash, "sha256:") {
+		b, err := nixBase32Decode(strings.TrimPrefix(hash, "sha256:"))
+		if err != nil {
+			return ""
+		}
+		return hex.EncodeToString(b)
+	}
+	return ""
+}
+
+// nixBase32Alphabet is the alphabet of nix's base32 encoding, which omits the
+// letters e, o, u and t.
+const nixBase32Alphabet = "0123456789abcdfghijklmnpqrsvwxyz"
+
+// nixBase32Decode decodes nix's base32 encoding, which (unlike RFC 4648) uses
+// its own alphabet and processes the input from the end.
+func nixBase32Decode(s string) ([]byte, error) {
+	out := make([]byte, len(s)*5/8)
+	for n := 0; n < len(s); n++ {
+		digit := strings.IndexByte(nixBase32Alphabet, s[len(s)-n-1])
+		if digit < 0 {
+			return nil, errors.Errorf("invalid character %q in nix base32 string", s[len(s)-n-1])
+		}
+		b := n * 5
+		i, j := b/8, b%8
+		out[i] |= byte(digit << j)
+		if i+1 < len(out) {
+			out[i+1] |= byte(digit >> (8 - j))
+		} else if digit>>(8-j) != 0 {
+			return nil, errors.Errorf("invalid nix base32 string %q", s)
+		}
+	}
+	return out, nil
+}
@@ -0,0 +1,64 @@
+// Copyright 2023 Jetpack Technologies Inc and contributors. All rights reserved.
+// Use of this source code is governed by the license in the LICENSE file.
+
+package impl
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.jetpack.io/devbox/internal/nix"
+)
+
+func TestNewProfileManifest(t *testing.T) {
+	closure := []nix.StorePathInfo{
+		{
+			Path:    "/nix/store/0c7c2n0l7qkbcpiinyxzixfhb2wz4dcv-glibc-2.35-224",
+			NarHash: "sha256-47DEQpj8HBSa+/TImW+5JCeuQeRkm5NMpJWZG3hSuFU=",
+			NarSize: 30000,
+		},
+		{
+			Path:    "/nix/store/n7mnb6qqfcndv7l2cbsmx9c9h2m4gq0x-ripgrep-13.0.0",
+			NarHash: "sha256:1b0r0gfrjaw7v7ccaqxfkbhj2q8bkq2x6w5dhvssa5sa3v8bqa7r",
+			NarSize: 4000,
+		},
+	}
+	installed := map[string]bool{closure[1].Path: true}
+
+	manifest := newProfileManifest(closure, installed)
+	require.Len(t, manifest.StorePaths, 2)
+	assert.Equal(t, profileManifestEntry{
+		Path:      closure[1].Path,
+		Name:      "ripgrep",
+		Version:   "13.0.0",
+		NarHash:   closure[1].NarHash,
+		NarSize:   4000,
+		Installed: true,
+	}, manifest.StorePaths[1])
+	assert.Equal(t, "glibc", manifest.StorePaths[0].Name)
+	assert.Equal(t, "2.35-224", manifest.StorePaths[0].Version)
+	assert.False(t, manifest.StorePaths[0].Installed)
+
+	spdx := manifest.spdx("myproject", time.Now())
+	assert.Equal(t, "SPDX-2.3", spdx["spdxVersion"])
+	assert.Len(t, spdx["packages"], 2)
+	assert.Len(t, spdx["relationships"], 1)
+
+	cdx := manifest.cycloneDX("myproject", time.Now())
+	components := cdx["components"].([]map[string]any)
+	require.Len(t, components, 2)
+	assert.Equal(t, "ripgrep", components[1]["name"])
+	assert.Equal(t, "13.0.0", components[1]["version"])
+	assert.Equal(t, "required", components[1]["scope"])
+}
+
+func TestSHA256Hex(t *testing.T) {
+	// The sha256 of the empty string in hex, SRI and nix base32 formats.
+	const want = "e3b0c44298fc1c149afbf4c8996fb92427ae41e4649b934ca495991b7852b855"
+	assert.Equal(t, want, sha256Hex("sha256-47DEQpj8HBSa+/TImW+5JCeuQeRkm5NMpJWZG3hSuFU="))
+	assert.Equal(t, want, sha256Hex("sha256:0mdqa9w1p6cmli6976v4wi0sw9r4p5prkj7lzfd1877wk11c9c73"))
+	assert.Equal(t, "", sha256Hex("md5:abc"))
+	assert.Equal(t, "", sha256Hex("sha256:not-base32!"))
+}
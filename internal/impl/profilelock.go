@@ -0,0 +1,98 @@
+// Copyright 2023 Jetpack Technologies Inc and contributors. All rights reserved.
+// Use of this source code is governed by the license in the LICENSE file.
+
+package impl
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/pkg/errors"
+	"go.jetpack.io/devbox/internal/boxcli/usererr"
+	"go.jetpack.io/devbox/internal/debug"
+)
+
+// profileLockFile is locked while devbox changes the project's nix profile.
+const profileLockFile = ".devbox/profile.lock"
+
+// defaultProfileLockTimeout is how long devbox waits for another devbox
+// process to finish changing the project's profile.
+const defaultProfileLockTimeout = 10 * time.Minute
+
+// profileLockRetryInterval is how often devbox checks whether the lock is free.
+const profileLockRetryInterval = 250 * time.Millisecond
+
+// lockProfile takes a lock on the project's .devbox directory so that only one
+// devbox process at a time changes the project's nix profile, and returns the
+// function that releases it. If another process has the lock, it waits for up
+// to d.profileLockTimeout. Once it has the lock, it reads the config again. The
+// lock can be taken again while it's held, and is released when every unlock
+// function has been called.
+func (d *Devbox) lockProfile() (unlock func(), err error) {
+	unlock = func() {
+		d.profileLockDepth--
+		if d.profileLockDepth > 0 {
+			return
+		}
+		if err := unlockFile(d.profileLock); err != nil {
+			debug.Log("unable to unlock %s: %v", d.profileLock.Name(), err)
+		}
+		d.profileLock.Close()
+		d.profileLock = nil
+	}
+	if d.profileLockDepth > 0 {
+		d.profileLockDepth++
+		return unlock, nil
+	}
+
+	path := filepath.Join(d.projectDir, profileLockFile)
+	if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+		return nil, errors.WithStack(err)
+	}
+	f, err := os.OpenFile(path, os.O_CREATE|os.O_RDWR, 0o644)
+	if err != nil {
+		return nil, errors.WithStack(err)
+	}
+
+	deadline := time.Now().Add(d.profileLockTimeout)
+	waiting := false
+	for {
+		locked, err := tryLockFile(f)
+		if err != nil {
+			f.Close()
+			return nil, errors.WithStack(err)
+		}
+		if locked {
+			break
+		}
+		if time.Now().After(deadline) {
+			f.Close()
+			return nil, usererr.New(
+				"another devbox operation is in progress in %s, and it didn't finish within %s. "+
+					"Try again once it's done.", d.projectDir, d.profileLockTimeout)
+		}
+		if !waiting {
+			waiting = true
+			fmt.Fprintln(d.writer, "Waiting for another devbox operation in this project to finish...")
+		}
+		time.Sleep(profileLockRetryInterval)
+	}
+
+	d.profileLock = f
+	d.profileLockDepth = 1
+
+	// Another devbox process may have changed the config since it was read,
+	// such as by adding a package, and saving the config that was read
+	// before would undo that.
+	if d.configPath != "" {
+		cfg, err := readProjectConfig(d.configPath, d.projectDir, d.nix)
+		if err != nil {
+			unlock()
+			return nil, err
+		}
+		d.cfg = cfg
+	}
+	return unlock, nil
+}
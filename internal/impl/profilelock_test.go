@@ -0,0 +1,80 @@
+// Copyright 2023 Jetpack Technologies Inc and contributors. All rights reserved.
+// Use of this source code is governed by the license in the LICENSE file.
+
+//go:build !windows
+
+package impl
+
+import (
+	"bytes"
+	"io"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.jetpack.io/devbox/internal/nix"
+)
+
+func TestLockProfile(t *testing.T) {
+	dir := t.TempDir()
+	_, err := InitConfig(dir, io.Discard)
+	require.NoError(t, err)
+	first, err := Open(dir, io.Discard)
+	require.NoError(t, err)
+	out := &bytes.Buffer{}
+	second, err := Open(dir, out)
+	require.NoError(t, err)
+	second.profileLockTimeout = 100 * time.Millisecond
+
+	unlock, err := first.lockProfile()
+	require.NoError(t, err)
+	// The process that holds the lock can take it again.
+	unlockAgain, err := first.lockProfile()
+	require.NoError(t, err)
+
+	_, err = second.lockProfile()
+	assert.ErrorContains(t, err, "another devbox operation is in progress")
+	assert.Contains(t, out.String(), "Waiting for another devbox operation")
+
+	// The lock is only released once every lock is unlocked.
+	unlockAgain()
+	_, err = second.lockProfile()
+	assert.Error(t, err)
+	unlock()
+	unlockSecond, err := second.lockProfile()
+	require.NoError(t, err)
+	unlockSecond()
+}
+
+func TestLockProfileRereadsConfig(t *testing.T) {
+	t.Setenv("XDG_DATA_HOME", t.TempDir())
+	installed := []string{}
+	client := profileNix(&installed)
+	client.pkgInfo = func(commit, pkg string) (*nix.Info, bool) {
+		return &nix.Info{NixName: pkg, Name: pkg}, true
+	}
+	client.buildPackages = func(w io.Writer, commit string, pkgs ...string) ([]string, error) {
+		return []string{t.TempDir()}, nil
+	}
+	client.pathInfo = func(paths ...string) ([]nix.StorePathInfo, error) {
+		return []nix.StorePathInfo{{Path: paths[0]}}, nil
+	}
+
+	dir := t.TempDir()
+	_, err := InitConfig(dir, io.Discard)
+	require.NoError(t, err)
+	// Both processes read devbox.json before either adds a package.
+	first, err := Open(dir, io.Discard, withNixClient(client))
+	require.NoError(t, err)
+	second, err := Open(dir, io.Discard, withNixClient(client))
+	require.NoError(t, err)
+
+	require.NoError(t, first.Add([]string{"hello"}))
+	require.NoError(t, second.Add([]string{"ripgrep"}))
+	cfg, err := ReadConfig(filepath.Join(dir, configFilename))
+	require.NoError(t, err)
+	assert.Equal(t, []string{"hello", "ripgrep"}, cfg.RawPackages)
+	assert.Equal(t, []string{"hello", "ripgrep"}, installed)
+}
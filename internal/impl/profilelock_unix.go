@@ -0,0 +1,25 @@
+//go:build !windows
+
+package impl
+
+import (
+	"os"
+	"syscall"
+
+	"github.com/pkg/errors"
+)
+
+// tryLockFile takes an exclusive lock on f without waiting for it, and reports
+// whether it got it. The lock is released when f is closed, or when the
+// process exits.
+func tryLockFile(f *os.File) (bool, error) {
+	err := syscall.Flock(int(f.Fd()), syscall.LOCK_EX|syscall.LOCK_NB)
+	if errors.Is(err, syscall.EWOULDBLOCK) {
+		return false, nil
+	}
+	return err == nil, errors.WithStack(err)
+}
+
+func unlockFile(f *os.File) error {
+	return errors.WithStack(syscall.Flock(int(f.Fd()), syscall.LOCK_UN))
+}
@@ -0,0 +1,41 @@
+// Copyright 2023 Jetpack Technologies Inc and contributors. All rights reserved.
+// Use of this source code is governed by the license in the LICENSE file.
+
+package impl
+
+import (
+	"os"
+
+	"github.com/AlecAivazis/survey/v2"
+	"github.com/mattn/go-isatty"
+	"github.com/pkg/errors"
+)
+
+// errNoTerminal is returned by terminalConfirm when stdin isn't a terminal,
+// so there's no one to ask.
+var errNoTerminal = errors.New("stdin isn't a terminal")
+
+// confirmFunc asks the user a yes or no question. defaultYes is the answer
+// that's selected to begin with.
+type confirmFunc func(question string, defaultYes bool) (bool, error)
+
+// terminalConfirm is the confirmFunc that devbox uses outside of tests. It
+// returns errNoTerminal without asking if stdin isn't a terminal.
+func terminalConfirm(question string, defaultYes bool) (bool, error) {
+	if !isatty.IsTerminal(os.Stdin.Fd()) {
+		return false, errNoTerminal
+	}
+	answer := defaultYes
+	err := survey.AskOne(&survey.Confirm{Message: question, Default: defaultYes}, &answer)
+	return answer, errors.WithStack(err)
+}
+
+// confirmOrNo asks question with confirm, and answers no if there's no
+// terminal to ask on.
+func confirmOrNo(confirm confirmFunc, question string, defaultYes bool) (bool, error) {
+	answer, err := confirm(question, defaultYes)
+	if errors.Is(err, errNoTerminal) {
+		return false, nil
+	}
+	return answer, err
+}
@@ -0,0 +1,210 @@
+// Copyright 2023 Jetpack Technologies Inc and contributors. All rights reserved.
+// Use of this source code is governed by the license in the LICENSE file.
+
+package impl
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+
+	"github.com/pkg/errors"
+	"go.jetpack.io/devbox/internal/boxcli/usererr"
+	"go.jetpack.io/devbox/internal/fileutil"
+	"go.jetpack.io/devbox/internal/xdg"
+	"golang.org/x/exp/slices"
+)
+
+// remoteConfigUsage describes the remote configs that Open accepts in place of
+// a local path.
+const remoteConfigUsage = "Remote configs can be:\n\n" +
+	"  github:<owner>/<repo>[/<ref>][//<dir>]\n" +
+	"  git+<repository url>[//<dir>][?ref=<ref>]\n" +
+	"  https://<url of a devbox.json>"
+
+// remoteConfig is a devbox config in a git repository or at a URL. Open
+// fetches it into the cache and opens it from there.
+type remoteConfig struct {
+	// spec is the remote config as the user wrote it.
+	spec string
+
+	// repo is the URL of the git repository, and ref the branch, tag or
+	// commit to fetch from it. ref is empty for the default branch.
+	repo string
+	ref  string
+	// dir is the directory of the config in the repository.
+	dir string
+
+	// url is the URL of a config file to download. It's only set if repo
+	// isn't.
+	url string
+}
+
+// isRemoteConfig reports whether path refers to a remote config instead of a
+// local file or directory.
+func isRemoteConfig(path string) bool {
+	for _, prefix := range []string{"github:", "git+", "https://", "http://"} {
+		if strings.HasPrefix(path, prefix) {
+			return true
+		}
+	}
+	return false
+}
+
+// parseRemoteConfig parses a remote config in one of the forms described by
+// remoteConfigUsage.
+func parseRemoteConfig(spec string) (*remoteConfig, error) {
+	invalid := func(reason string) error {
+		return usererr.New("Invalid remote config %q: %s.\n\n%s", spec, reason, remoteConfigUsage)
+	}
+
+	switch {
+	case strings.HasPrefix(spec, "github:"):
+		repoPath, dir, _ := strings.Cut(strings.TrimPrefix(spec, "github:"), "//")
+		parts := strings.SplitN(repoPath, "/", 3)
+		if len(parts) < 2 || parts[0] == "" || parts[1] == "" {
+			return nil, invalid("expected github:<owner>/<repo>")
+		}
+		rc := &remoteConfig{
+			spec: spec,
+			repo: fmt.Sprintf("https://github.com/%s/%s.git", parts[0], parts[1]),
+			dir:  dir,
+		}
+		if len(parts) == 3 {
+			rc.ref = parts[2]
+		}
+		return rc, nil
+
+	case strings.HasPrefix(spec, "git+"):
+		u, err := url.Parse(strings.TrimPrefix(spec, "git+"))
+		if err != nil || u.Scheme == "" {
+			return nil, invalid("expected a repository URL after git+")
+		}
+		rc := &remoteConfig{spec: spec, ref: u.Query().Get("ref")}
+		u.RawQuery = ""
+		u.Path, rc.dir, _ = strings.Cut(u.Path, "//")
+		u.RawPath = ""
+		rc.repo = u.String()
+		return rc, nil
+
+	default:
+		u, err := url.Parse(spec)
+		if err != nil || u.Host == "" {
+			return nil, invalid("expected the URL of a devbox.json")
+		}
+		return &remoteConfig{spec: spec, url: spec}, nil
+	}
+}
+
+// cacheDir returns the directory that the config is fetched into. It's keyed
+// by the repository and ref, or by the URL, so that configs in different
+// directories of the same repository share a single fetch.
+func (rc *remoteConfig) cacheDir() string {
+	key := rc.url
+	if rc.repo != "" {
+		key = rc.repo + "#" + rc.ref
+	}
+	sum := sha256.Sum256([]byte(key))
+	return xdg.DevboxCacheSubpath(filepath.Join("remote", hex.EncodeToString(sum[:])[:16]))
+}
+
+// fetchRemoteConfig fetches the remote config spec into the cache, unless
+// it's already there, and returns the local path to open it from.
+func fetchRemoteConfig(spec string, w io.Writer) (string, error) {
+	rc, err := parseRemoteConfig(spec)
+	if err != nil {
+		return "", err
+	}
+
+	dest := rc.cacheDir()
+	if !fileutil.IsDir(dest) {
+		fmt.Fprintf(w, "Fetching %s\n", spec)
+		if err := os.MkdirAll(filepath.Dir(dest), 0o755); err != nil {
+			return "", errors.WithStack(err)
+		}
+		if rc.repo != "" {
+			err = fetchGitRepo(rc, dest)
+		} else {
+			err = downloadConfig(rc, dest)
+		}
+		if err != nil {
+			return "", err
+		}
+	}
+
+	path := filepath.Join(dest, filepath.FromSlash(rc.dir))
+	if !fileutil.Exists(path) {
+		return "", usererr.New("%s doesn't have a directory named %s", rc.repo, rc.dir)
+	}
+	return path, nil
+}
+
+// fetchGitRepo makes a shallow clone of the ref in rc's repository at dest,
+// without its .git directory.
+func fetchGitRepo(rc *remoteConfig, dest string) error {
+	if _, err := exec.LookPath("git"); err != nil {
+		return usererr.New("git is needed to fetch %s, but it isn't installed", rc.spec)
+	}
+
+	tmp, err := os.MkdirTemp(filepath.Dir(dest), ".fetch-")
+	if err != nil {
+		return errors.WithStack(err)
+	}
+	defer os.RemoveAll(tmp)
+
+	ref := rc.ref
+	if ref == "" {
+		ref = "HEAD"
+	}
+	for _, args := range [][]string{
+		{"init", "--quiet"},
+		{"fetch", "--quiet", "--depth", "1", rc.repo, ref},
+		{"checkout", "--quiet", "FETCH_HEAD"},
+	} {
+		cmd := exec.Command("git", append([]string{"-C", tmp}, args...)...)
+		if out, err := cmd.CombinedOutput(); err != nil {
+			return usererr.WithUserMessage(
+				errors.Wrapf(err, "git %s: %s", args[0], out),
+				"Unable to fetch %s from %s. Check that the repository and the ref %q exist, "+
+					"that you have access to them, and that you're online.",
+				rc.spec, rc.repo, ref,
+			)
+		}
+	}
+	if err := os.RemoveAll(filepath.Join(tmp, ".git")); err != nil {
+		return errors.WithStack(err)
+	}
+	return errors.WithStack(os.Rename(tmp, dest))
+}
+
+// downloadConfig downloads the config file at rc's URL into dest.
+func downloadConfig(rc *remoteConfig, dest string) error {
+	res, err := http.Get(rc.url)
+	if err != nil {
+		return usererr.WithUserMessage(err, "Unable to download %s. Check that you're online.", rc.url)
+	}
+	defer res.Body.Close()
+	if res.StatusCode != http.StatusOK {
+		return usererr.New("Unable to download %s: %s", rc.url, res.Status)
+	}
+	data, err := io.ReadAll(res.Body)
+	if err != nil {
+		return errors.WithStack(err)
+	}
+
+	name := configFilename
+	if base := filepath.Base(res.Request.URL.Path); slices.Contains(configFilenames, base) {
+		name = base
+	}
+	if err := os.MkdirAll(dest, 0o755); err != nil {
+		return errors.WithStack(err)
+	}
+	return errors.WithStack(os.WriteFile(filepath.Join(dest, name), data, 0o644))
+}
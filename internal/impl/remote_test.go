@@ -0,0 +1,128 @@
+// Copyright 2023 Jetpack Technologies Inc and contributors. All rights reserved.
+// Use of this source code is governed by the license in the LICENSE file.
+
+package impl
+
+import (
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestParseRemoteConfig(t *testing.T) {
+	testCases := []struct {
+		spec    string
+		want    remoteConfig
+		wantErr bool
+	}{
+		{
+			spec: "github:jetpack-io/devbox",
+			want: remoteConfig{repo: "https://github.com/jetpack-io/devbox.git"},
+		},
+		{
+			spec: "github:jetpack-io/devbox/0.4.0//examples/go",
+			want: remoteConfig{
+				repo: "https://github.com/jetpack-io/devbox.git",
+				ref:  "0.4.0",
+				dir:  "examples/go",
+			},
+		},
+		{
+			spec: "github:jetpack-io/devbox/release/1.0",
+			want: remoteConfig{repo: "https://github.com/jetpack-io/devbox.git", ref: "release/1.0"},
+		},
+		{
+			spec: "git+https://example.com/team/envs.git//go?ref=main",
+			want: remoteConfig{repo: "https://example.com/team/envs.git", ref: "main", dir: "go"},
+		},
+		{
+			spec: "git+ssh://git@example.com/team/envs.git",
+			want: remoteConfig{repo: "ssh://git@example.com/team/envs.git"},
+		},
+		{
+			spec: "https://example.com/devbox.json",
+			want: remoteConfig{url: "https://example.com/devbox.json"},
+		},
+		{spec: "github:jetpack-io", wantErr: true},
+		{spec: "github:/devbox", wantErr: true},
+		{spec: "git+envs.git", wantErr: true},
+		{spec: "https://", wantErr: true},
+	}
+	for _, testCase := range testCases {
+		t.Run(testCase.spec, func(t *testing.T) {
+			got, err := parseRemoteConfig(testCase.spec)
+			if testCase.wantErr {
+				assert.Error(t, err)
+				return
+			}
+			require.NoError(t, err)
+			testCase.want.spec = testCase.spec
+			assert.Equal(t, testCase.want, *got)
+		})
+	}
+}
+
+func TestFetchRemoteConfigGit(t *testing.T) {
+	if _, err := exec.LookPath("git"); err != nil {
+		t.Skip("git isn't installed")
+	}
+	t.Setenv("XDG_CACHE_HOME", t.TempDir())
+
+	repoDir := t.TempDir()
+	require.NoError(t, os.MkdirAll(filepath.Join(repoDir, "envs", "go"), 0o755))
+	require.NoError(t, os.WriteFile(
+		filepath.Join(repoDir, "envs", "go", configFilename), []byte(`{"packages": ["go"]}`), 0o644))
+	for _, args := range [][]string{
+		{"init", "--quiet"},
+		{"add", "."},
+		{"-c", "user.name=test", "-c", "user.email=test@example.com", "commit", "--quiet", "-m", "init"},
+		{"tag", "v1"},
+	} {
+		cmd := exec.Command("git", append([]string{"-C", repoDir}, args...)...)
+		out, err := cmd.CombinedOutput()
+		require.NoError(t, err, string(out))
+	}
+
+	spec := "git+file://" + filepath.ToSlash(repoDir) + "//envs/go?ref=v1"
+	path, err := fetchRemoteConfig(spec, io.Discard)
+	require.NoError(t, err)
+	assert.FileExists(t, filepath.Join(path, configFilename))
+	assert.NoDirExists(t, filepath.Join(path, "..", "..", ".git"))
+
+	_, err = fetchRemoteConfig("git+file://"+filepath.ToSlash(repoDir)+"?ref=missing", io.Discard)
+	assert.ErrorContains(t, err, "git fetch")
+
+	// The fetched config is cached, so later fetches don't need the repo.
+	require.NoError(t, os.RemoveAll(repoDir))
+	cached, err := fetchRemoteConfig(spec, io.Discard)
+	require.NoError(t, err)
+	assert.Equal(t, path, cached)
+}
+
+func TestFetchRemoteConfigURL(t *testing.T) {
+	t.Setenv("XDG_CACHE_HOME", t.TempDir())
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/team/devbox.json" {
+			http.NotFound(w, r)
+			return
+		}
+		_, _ = w.Write([]byte(`{"packages": ["jq"]}`))
+	}))
+	defer server.Close()
+
+	path, err := fetchRemoteConfig(server.URL+"/team/devbox.json", io.Discard)
+	require.NoError(t, err)
+	cfg, err := ReadConfig(filepath.Join(path, configFilename))
+	require.NoError(t, err)
+	assert.Equal(t, []string{"jq"}, cfg.RawPackages)
+
+	_, err = fetchRemoteConfig(server.URL+"/missing.json", io.Discard)
+	assert.ErrorContains(t, err, "404")
+}
@@ -0,0 +1,321 @@
+// Copyright 2023 Jetpack Technologies Inc and contributors. All rights reserved.
+// Use of this source code is governed by the license in the LICENSE file.
+
+package impl
+
+import (
+	"encoding/json"
+	"fmt"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/pkg/errors"
+	"github.com/samber/lo"
+	"go.jetpack.io/devbox/internal/boxcli/usererr"
+	"go.jetpack.io/devbox/internal/cuecfg"
+	"go.jetpack.io/devbox/internal/fileutil"
+	"go.jetpack.io/devbox/internal/impl/shellcmd"
+)
+
+// Script is a named script in devbox.json. It can be written as a string or an
+// array of strings containing its commands, or as an object when it needs
+// additional settings:
+//
+//	"lint": {
+//	  "command": "golangci-lint run",
+//	  "description": "Lint the Go code",
+//	  "requires": ["golangci-lint"],
+//	  "env": {"GOFLAGS": "-mod=mod"}
+//	}
+type Script struct {
+	shellcmd.Commands
+
+	// Description explains what the script does. devbox run lists it next
+	// to the script's name.
+	Description string
+
+	// Requires lists packages that must be available while the script runs
+	// but that aren't added to the project's packages.
+	Requires []string
+
+	// Args declares the arguments the script accepts. Each one is exported to
+	// the script as an environment variable with the same name.
+	Args []ScriptArg
+
+	// Timeout is how long the script may run, as a duration such as "5m",
+	// before it's terminated. It overrides the shell's default_timeout.
+	Timeout string
+
+	// Environments overrides the script's commands in the named environments.
+	// devbox run selects one with --environment or DEVBOX_ENV.
+	Environments map[string]ScriptEnvironment
+
+	// Env sets env variables while the script runs, on top of the env in
+	// devbox.json. Values can reference other variables as $VAR or ${VAR}.
+	Env map[string]string
+
+	// isObject records whether the script was written in its object form so
+	// that it's saved back the same way.
+	isObject bool
+}
+
+// scriptObject is the JSON representation of a Script in its object form.
+type scriptObject struct {
+	Command     shellcmd.Commands `json:"command"`
+	Description string            `json:"description,omitempty"`
+	Requires    []string          `json:"requires,omitempty"`
+	Args        []ScriptArg       `json:"args,omitempty"`
+	Timeout     string            `json:"timeout,omitempty"`
+
+	Environments map[string]ScriptEnvironment `json:"environments,omitempty"`
+	Env          map[string]string            `json:"env,omitempty"`
+}
+
+// ScriptInfo describes a script in devbox.json.
+type ScriptInfo struct {
+	Name string
+	// Description is empty for scripts that are written as commands.
+	Description string
+	// Environments are the sorted names of the environments that override
+	// the script.
+	Environments []string
+}
+
+// ScriptEnvironment overrides a script in one environment.
+type ScriptEnvironment struct {
+	Command shellcmd.Commands `json:"command"`
+}
+
+// ScriptArg is an argument accepted by a script. Arguments can be given
+// positionally, in the order they're declared, or by name with --name=value.
+type ScriptArg struct {
+	Name     string `json:"name"`
+	Required bool   `json:"required,omitempty"`
+	Default  string `json:"default,omitempty"`
+}
+
+func (s *Script) toObject() scriptObject {
+	return scriptObject{
+		Command:     s.Commands,
+		Description: s.Description,
+		Requires:    s.Requires,
+		Args:        s.Args,
+		Timeout:     s.Timeout,
+
+		Environments: s.Environments,
+		Env:          s.Env,
+	}
+}
+
+// MarshalJSON marshals the script back to the form it was read in. Scripts
+// that only have commands are marshaled as a string or an array.
+func (s Script) MarshalJSON() ([]byte, error) {
+	if !s.isObject && s.Description == "" && len(s.Requires) == 0 && len(s.Args) == 0 && s.Timeout == "" &&
+		len(s.Environments) == 0 && len(s.Env) == 0 {
+		return s.Commands.MarshalJSON()
+	}
+	return cuecfg.MarshalJSON(s.toObject())
+}
+
+// UnmarshalJSON unmarshals a script from a string, an array of strings, or an
+// object.
+func (s *Script) UnmarshalJSON(data []byte) error {
+	if len(data) == 0 || data[0] != '{' {
+		s.isObject = false
+		return s.Commands.UnmarshalJSON(data)
+	}
+
+	obj := scriptObject{}
+	if err := json.Unmarshal(data, &obj); err != nil {
+		return errors.WithStack(err)
+	}
+	s.isObject = true
+	s.Commands = obj.Command
+	s.Description = obj.Description
+	s.Requires = obj.Requires
+	s.Args = obj.Args
+	s.Timeout = obj.Timeout
+	s.Environments = obj.Environments
+	s.Env = obj.Env
+	return nil
+}
+
+// EnvironmentNames returns the sorted names of the environments that override
+// the script.
+func (s *Script) EnvironmentNames() []string {
+	names := lo.Keys(s.Environments)
+	sort.Strings(names)
+	return names
+}
+
+// strictMode makes a script exit at its first failing command, including a
+// failing command in a pipeline, and when it references an unset variable.
+// pipefail is only enabled by shells that support it.
+const strictMode = "set -eu\n(set -o pipefail) 2>/dev/null && set -o pipefail\n"
+
+// scriptCommands returns the body of the file that cmds is written to.
+// Scripts with more than one command run in strictMode so that they stop at
+// the first one that fails. Single commands run as they are, which keeps the
+// behavior of existing one-line scripts.
+func scriptCommands(cmds shellcmd.Commands) string {
+	body := cmds.String()
+	lines := 0
+	for _, line := range strings.Split(body, "\n") {
+		if strings.TrimSpace(line) != "" {
+			lines++
+		}
+	}
+	if lines <= 1 {
+		return body
+	}
+	return strictMode + "\n" + body
+}
+
+// environmentScriptName returns the name that the override of the script
+// called name in environment is written to.
+func environmentScriptName(name, environment string) string {
+	return name + "@" + environment
+}
+
+// resolveArgs matches the arguments given to the script named name against
+// its declared Args. It returns the value of each declared argument, with
+// defaults applied, and the remaining arguments that should still be passed
+// to the script. Declared named arguments (--name=value) are removed from the
+// remaining arguments; positional ones are kept so that "$1" and friends
+// keep working. Flags that aren't declared are passed through as they are, so
+// that the script can hand them to the tool it runs, and don't fill
+// positional arguments.
+func (s *Script) resolveArgs(name string, args []string) (
+	values map[string]string, rest []string, err error,
+) {
+	values = map[string]string{}
+	if len(s.Args) == 0 {
+		return values, args, nil
+	}
+
+	declared := map[string]bool{}
+	for _, arg := range s.Args {
+		declared[arg.Name] = true
+	}
+
+	positional := 0
+	for _, arg := range args {
+		if argName, value, ok := strings.Cut(strings.TrimPrefix(arg, "--"), "="); ok &&
+			strings.HasPrefix(arg, "--") {
+			if declared[argName] {
+				values[argName] = value
+				continue
+			}
+			rest = append(rest, arg)
+			continue
+		}
+		rest = append(rest, arg)
+		if strings.HasPrefix(arg, "-") {
+			// A flag for the tool that the script runs, not a value.
+			continue
+		}
+		// Fill the next declared argument that wasn't already given by name.
+		for positional < len(s.Args) {
+			argName := s.Args[positional].Name
+			positional++
+			if _, ok := values[argName]; !ok {
+				values[argName] = arg
+				break
+			}
+		}
+	}
+
+	for _, arg := range s.Args {
+		if _, ok := values[arg.Name]; ok {
+			continue
+		}
+		if arg.Required {
+			return nil, nil, usererr.New(
+				"missing required argument %q for script %s\n%s", arg.Name, name, s.usage(name))
+		}
+		values[arg.Name] = arg.Default
+	}
+	return values, rest, nil
+}
+
+// timeout returns how long the script may run before it's terminated. A
+// timeout given on the command line takes precedence over the script's own
+// timeout, which takes precedence over defaultTimeout. It returns 0 if there's
+// no timeout.
+func (s *Script) timeout(defaultTimeout string, flagTimeout time.Duration) (
+	time.Duration, error,
+) {
+	if flagTimeout > 0 {
+		return flagTimeout, nil
+	}
+	timeout := defaultTimeout
+	if s.Timeout != "" {
+		timeout = s.Timeout
+	}
+	if timeout == "" {
+		return 0, nil
+	}
+	d, err := parseTimeout(timeout)
+	return d, errors.WithStack(err)
+}
+
+// parseTimeout parses a timeout from devbox.json, which must be a positive
+// duration.
+func parseTimeout(timeout string) (time.Duration, error) {
+	d, err := time.ParseDuration(timeout)
+	if err != nil {
+		return 0, errors.Errorf("invalid timeout %q: must be a duration such as \"30s\" or \"5m\"", timeout)
+	}
+	if d <= 0 {
+		return 0, errors.Errorf("invalid timeout %q: must be greater than zero", timeout)
+	}
+	return d, nil
+}
+
+// usage returns a usage line for the script showing its declared arguments.
+func (s *Script) usage(name string) string {
+	usage := "usage: devbox run " + name
+	for _, arg := range s.Args {
+		if arg.Required {
+			usage += fmt.Sprintf(" <%s>", arg.Name)
+		} else {
+			usage += fmt.Sprintf(" [%s]", arg.Name)
+		}
+	}
+	return usage
+}
+
+const (
+	// ScriptCwdRoot runs scripts in the project directory. It's the default.
+	ScriptCwdRoot = "root"
+	// ScriptCwdNearest runs scripts in the nearest directory, from the one
+	// devbox run was invoked in up to the project directory, that contains a
+	// package manifest such as package.json or go.mod.
+	ScriptCwdNearest = "nearest"
+)
+
+// packageManifests are the files that mark a directory as a package for
+// ScriptCwdNearest.
+var packageManifests = []string{"package.json", "go.mod", "Cargo.toml"}
+
+// nearestPackageDir returns the closest directory to dir, searching up to and
+// including projectDir, that contains one of packageManifests. It returns
+// projectDir if there's no such directory or dir isn't inside projectDir.
+func nearestPackageDir(dir, projectDir string) string {
+	rel, err := filepath.Rel(projectDir, dir)
+	if err != nil || rel == ".." || strings.HasPrefix(rel, "../") {
+		return projectDir
+	}
+	for cur := dir; ; cur = filepath.Dir(cur) {
+		for _, manifest := range packageManifests {
+			if fileutil.Exists(filepath.Join(cur, manifest)) {
+				return cur
+			}
+		}
+		if cur == projectDir || cur == filepath.Dir(cur) {
+			return projectDir
+		}
+	}
+}
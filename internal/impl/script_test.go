@@ -0,0 +1,365 @@
+// Copyright 2023 Jetpack Technologies Inc and contributors. All rights reserved.
+// Use of this source code is governed by the license in the LICENSE file.
+
+package impl
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.jetpack.io/devbox/internal/boxcli/usererr"
+	"go.jetpack.io/devbox/internal/impl/shellcmd"
+	"go.jetpack.io/devbox/internal/nix"
+)
+
+func TestScriptResolveArgs(t *testing.T) {
+	script := &Script{Args: []ScriptArg{
+		{Name: "env", Required: true},
+		{Name: "region", Default: "us-east-1"},
+	}}
+
+	testCases := []struct {
+		name       string
+		args       []string
+		wantValues map[string]string
+		wantRest   []string
+		wantErr    bool
+	}{
+		{
+			name:    "missing required arg",
+			args:    nil,
+			wantErr: true,
+		},
+		{
+			name:       "default applied",
+			args:       []string{"prod"},
+			wantValues: map[string]string{"env": "prod", "region": "us-east-1"},
+			wantRest:   []string{"prod"},
+		},
+		{
+			name:       "all positional",
+			args:       []string{"prod", "eu-west-1", "extra"},
+			wantValues: map[string]string{"env": "prod", "region": "eu-west-1"},
+			wantRest:   []string{"prod", "eu-west-1", "extra"},
+		},
+		{
+			name:       "named args",
+			args:       []string{"--region=eu-west-1", "--env=staging"},
+			wantValues: map[string]string{"env": "staging", "region": "eu-west-1"},
+		},
+		{
+			name:       "named and positional",
+			args:       []string{"--env=staging", "eu-west-1"},
+			wantValues: map[string]string{"env": "staging", "region": "eu-west-1"},
+			wantRest:   []string{"eu-west-1"},
+		},
+		{
+			name:       "undeclared flag is passed through",
+			args:       []string{"prod", "--zone=a", "--verbose"},
+			wantValues: map[string]string{"env": "prod", "region": "us-east-1"},
+			wantRest:   []string{"prod", "--zone=a", "--verbose"},
+		},
+	}
+
+	for _, testCase := range testCases {
+		t.Run(testCase.name, func(t *testing.T) {
+			values, rest, err := script.resolveArgs("deploy", testCase.args)
+			if testCase.wantErr {
+				assert.Error(t, err)
+				return
+			}
+			assert.NoError(t, err)
+			assert.Equal(t, testCase.wantValues, values)
+			assert.Equal(t, testCase.wantRest, rest)
+		})
+	}
+}
+
+func TestScriptTimeout(t *testing.T) {
+	testCases := []struct {
+		name           string
+		scriptTimeout  string
+		defaultTimeout string
+		flagTimeout    time.Duration
+		want           time.Duration
+		wantErr        bool
+	}{
+		{
+			name: "no timeout",
+		},
+		{
+			name:           "default timeout",
+			defaultTimeout: "10m",
+			want:           10 * time.Minute,
+		},
+		{
+			name:           "script overrides default",
+			scriptTimeout:  "30s",
+			defaultTimeout: "10m",
+			want:           30 * time.Second,
+		},
+		{
+			name:           "flag overrides script and default",
+			scriptTimeout:  "30s",
+			defaultTimeout: "10m",
+			flagTimeout:    time.Second,
+			want:           time.Second,
+		},
+		{
+			name:          "invalid duration",
+			scriptTimeout: "soon",
+			wantErr:       true,
+		},
+		{
+			name:          "zero duration",
+			scriptTimeout: "0s",
+			wantErr:       true,
+		},
+	}
+
+	for _, testCase := range testCases {
+		t.Run(testCase.name, func(t *testing.T) {
+			script := &Script{Timeout: testCase.scriptTimeout}
+			got, err := script.timeout(testCase.defaultTimeout, testCase.flagTimeout)
+			if testCase.wantErr {
+				assert.Error(t, err)
+				return
+			}
+			assert.NoError(t, err)
+			assert.Equal(t, testCase.want, got)
+		})
+	}
+}
+
+func TestRunScriptTimeoutFromConfig(t *testing.T) {
+	testCases := []struct {
+		name  string
+		shell string
+	}{
+		{
+			name:  "script timeout",
+			shell: `{"scripts": {"slow": {"command": "sleep 10", "timeout": "100ms"}}}`,
+		},
+		{
+			name:  "default timeout",
+			shell: `{"scripts": {"slow": "sleep 10"}, "default_timeout": "100ms"}`,
+		},
+	}
+
+	for _, testCase := range testCases {
+		t.Run(testCase.name, func(t *testing.T) {
+			t.Setenv("XDG_DATA_HOME", t.TempDir())
+			installed := []string{}
+			client := profileNix(&installed)
+			client.printDevEnv = func(args *nix.PrintDevEnvArgs) (*nix.VarsAndFuncs, error) {
+				vaf := &nix.VarsAndFuncs{}
+				err := json.Unmarshal([]byte(`{"variables": {"PATH": {"type": "exported", "value": "/usr/bin:/bin"}}}`), vaf)
+				return vaf, err
+			}
+			dir := t.TempDir()
+			err := os.WriteFile(filepath.Join(dir, configFilename), []byte(fmt.Sprintf(`{
+  "packages": [],
+  "shell": %s,
+  "nixpkgs": {"commit": "af9e00071d0971eb292fd5abef334e66eda3cb69"}
+}`, testCase.shell)), 0o644)
+			require.NoError(t, err)
+			out := &bytes.Buffer{}
+			box, err := Open(dir, out, withNixClient(client))
+			require.NoError(t, err)
+
+			start := time.Now()
+			err = box.RunScript("slow", nil)
+			assert.Less(t, time.Since(start), 5*time.Second)
+			assert.ErrorIs(t, err, nix.ErrTimeout)
+			var exitErr *usererr.ExitError
+			require.ErrorAs(t, err, &exitErr)
+			assert.Equal(t, nix.TimeoutExitCode, exitErr.ExitCode())
+			assert.Contains(t, out.String(), "slow timed out after 100ms and was terminated.")
+		})
+	}
+}
+
+func TestScriptCommands(t *testing.T) {
+	testCases := []struct {
+		name       string
+		cmds       []string
+		wantStrict bool
+	}{
+		{name: "single command", cmds: []string{"go build ./..."}},
+		{name: "blank lines around one command", cmds: []string{"", "go test ./...", "  "}},
+		{name: "array", cmds: []string{"go vet ./...", "go test ./..."}, wantStrict: true},
+		{name: "multi-line string", cmds: []string{"go vet ./...\ngo test ./..."}, wantStrict: true},
+	}
+	for _, testCase := range testCases {
+		t.Run(testCase.name, func(t *testing.T) {
+			got := scriptCommands(shellcmd.Commands{Cmds: testCase.cmds})
+			cmds := shellcmd.Commands{Cmds: testCase.cmds}
+			if testCase.wantStrict {
+				assert.Equal(t, strictMode+"\n"+cmds.String(), got)
+			} else {
+				assert.Equal(t, cmds.String(), got)
+			}
+		})
+	}
+}
+
+func TestScriptCommandsStopAtFirstFailure(t *testing.T) {
+	dir := t.TempDir()
+	out := filepath.Join(dir, "out.txt")
+	script := filepath.Join(dir, "script.sh")
+	body := scriptCommands(shellcmd.Commands{Cmds: []string{
+		"echo first >> " + out,
+		"false",
+		"echo second >> " + out,
+	}})
+	require.NoError(t, os.WriteFile(script, []byte(body), 0o755))
+
+	err := exec.Command("sh", script).Run()
+	assert.Error(t, err)
+	data, err := os.ReadFile(out)
+	require.NoError(t, err)
+	assert.Equal(t, "first\n", string(data))
+}
+
+func TestArbitraryCmd(t *testing.T) {
+	dir := t.TempDir()
+	require.NoError(t, os.WriteFile(filepath.Join(dir, "a.go"), nil, 0o644))
+
+	testCases := []struct {
+		name string
+		cmd  string
+		args []string
+		want string
+	}{
+		{
+			name: "pipeline and redirect",
+			cmd:  "printf '%s\\n' 'a  b' | tr a-z A-Z > out.txt",
+			want: "A  B\n",
+		},
+		{
+			name: "multiple lines",
+			cmd:  "echo first > out.txt\necho second >> out.txt",
+			want: "first\nsecond\n",
+		},
+		{
+			name: "quoted glob",
+			cmd:  "echo '*.go' *.go > out.txt",
+			want: "*.go a.go\n",
+		},
+		{
+			name: "separate args",
+			cmd:  "echo",
+			args: []string{"hello", "world", ">", "out.txt"},
+			want: "hello world\n",
+		},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			cmd := exec.Command("sh", "-c", arbitraryCmdBody)
+			cmd.Dir = dir
+			cmd.Env = append(os.Environ(), "DEVBOX_RUN_CMD="+arbitraryCmd(tc.cmd, tc.args))
+			out, err := cmd.CombinedOutput()
+			require.NoError(t, err, string(out))
+			data, err := os.ReadFile(filepath.Join(dir, "out.txt"))
+			require.NoError(t, err)
+			assert.Equal(t, tc.want, string(data))
+		})
+	}
+}
+
+func TestWarnIfScriptShadowsBinary(t *testing.T) {
+	binDir := t.TempDir()
+	require.NoError(t, os.WriteFile(filepath.Join(binDir, "ls"), nil, 0o755))
+	require.NoError(t, os.WriteFile(filepath.Join(binDir, "notes"), nil, 0o644))
+	require.NoError(t, os.WriteFile(filepath.Join(binDir, "test"), nil, 0o755))
+	pathList := strings.Join([]string{t.TempDir(), binDir}, string(os.PathListSeparator))
+
+	dir := t.TempDir()
+	_, err := InitConfig(dir, io.Discard)
+	require.NoError(t, err)
+	out := &bytes.Buffer{}
+	box, err := Open(dir, out)
+	require.NoError(t, err)
+
+	box.warnIfScriptShadowsBinary("ls", pathList)
+	assert.Contains(t, out.String(), fmt.Sprintf(
+		`the script "ls" in devbox.json runs instead of %s. To run %[1]s, use "devbox run -- command ls".`,
+		filepath.Join(binDir, "ls")))
+
+	// Files that aren't executable and shell builtins don't count.
+	out.Reset()
+	box.warnIfScriptShadowsBinary("notes", pathList)
+	box.warnIfScriptShadowsBinary("test", pathList)
+	box.warnIfScriptShadowsBinary("build", pathList)
+	assert.Empty(t, out.String())
+}
+
+func TestNearestPackageDir(t *testing.T) {
+	projectDir := t.TempDir()
+	pkgDir := filepath.Join(projectDir, "services", "api")
+	deepDir := filepath.Join(pkgDir, "internal", "handlers")
+	otherDir := filepath.Join(projectDir, "docs", "guides")
+	for _, dir := range []string{deepDir, otherDir} {
+		require.NoError(t, os.MkdirAll(dir, 0o755))
+	}
+	require.NoError(t, os.WriteFile(filepath.Join(pkgDir, "go.mod"), []byte("module api\n"), 0o644))
+
+	testCases := []struct {
+		name string
+		dir  string
+		want string
+	}{
+		{"package dir", pkgDir, pkgDir},
+		{"inside package", deepDir, pkgDir},
+		{"no package", otherDir, projectDir},
+		{"project root", projectDir, projectDir},
+		{"outside project", t.TempDir(), projectDir},
+	}
+	for _, testCase := range testCases {
+		t.Run(testCase.name, func(t *testing.T) {
+			assert.Equal(t, testCase.want, nearestPackageDir(testCase.dir, projectDir))
+		})
+	}
+}
+
+func TestListScripts(t *testing.T) {
+	cfg := &Config{}
+	data := `{
+  "test": "go test ./...",
+  "lint": {
+    "command": "golangci-lint run",
+    "description": "Lint the Go code"
+  },
+  "build": ["go build ./..."],
+  "deploy": {
+    "command": "./deploy.sh dev",
+    "environments": {
+      "staging": {"command": "./deploy.sh staging"},
+      "prod": {"command": "./deploy.sh prod"}
+    }
+  }
+}`
+	require.NoError(t, json.Unmarshal([]byte(data), &cfg.Shell.Scripts))
+	d := &Devbox{cfg: cfg}
+	assert.Equal(t, []ScriptInfo{
+		{Name: "build"},
+		{Name: "deploy", Environments: []string{"prod", "staging"}},
+		{Name: "lint", Description: "Lint the Go code"},
+		{Name: "test"},
+	}, d.ListScripts())
+
+	// Scripts keep their form when they're saved.
+	out, err := json.Marshal(cfg.Shell.Scripts)
+	require.NoError(t, err)
+	assert.JSONEq(t, data, string(out))
+}
@@ -0,0 +1,134 @@
+// Copyright 2023 Jetpack Technologies Inc and contributors. All rights reserved.
+// Use of this source code is governed by the license in the LICENSE file.
+
+package impl
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/samber/lo"
+	"go.jetpack.io/devbox/internal/debug"
+	"go.jetpack.io/devbox/internal/nix"
+	"golang.org/x/exp/slices"
+)
+
+// maxSuggestions is how many package names a "did you mean" hint lists.
+const maxSuggestions = 5
+
+// packageNotFoundError returns nix.ErrPackageNotFound for pkg, suggesting the
+// packages with the closest names if there are any.
+func (d *Devbox) packageNotFoundError(pkg string) error {
+	err := fmt.Errorf("%s: %w", pkg, nix.ErrPackageNotFound)
+	commit, attribute := d.packageRef(pkg)
+	if strings.ContainsAny(attribute, ":#/") {
+		// Flake references aren't nixpkgs attributes, so there's nothing
+		// to compare them to.
+		return err
+	}
+	names, listErr := d.nix.PackageNames(commit)
+	if listErr != nil {
+		debug.Log("unable to list packages for suggestions: %v", listErr)
+		return err
+	}
+	suggestions := closestPackageNames(attribute, names)
+	if len(suggestions) == 0 {
+		return err
+	}
+	return fmt.Errorf("%w. Did you mean %s?", err, strings.Join(suggestions, ", "))
+}
+
+// packagesNotFoundError combines the errors that packageNotFoundError returned
+// for each package that wasn't found into one error that lists them all.
+func packagesNotFoundError(errs []error) error {
+	if len(errs) == 1 {
+		return errs[0]
+	}
+	return &packagesNotFound{errs: errs}
+}
+
+// packagesNotFound is the error for adding several packages that weren't
+// found. It matches nix.ErrPackageNotFound.
+type packagesNotFound struct {
+	errs []error
+}
+
+func (e *packagesNotFound) Error() string {
+	lines := []string{fmt.Sprintf("%d packages weren't found, so none of the packages were added:", len(e.errs))}
+	for _, err := range e.errs {
+		lines = append(lines, "  "+err.Error())
+	}
+	return strings.Join(lines, "\n")
+}
+
+func (e *packagesNotFound) Unwrap() error {
+	return nix.ErrPackageNotFound
+}
+
+// closestPackageNames returns up to maxSuggestions of names that are within a
+// few edits of pkg, closest first. Only the first part of an attribute path,
+// such as python310Packages in python310Packages.pip, is compared, since names
+// are the top-level packages.
+func closestPackageNames(pkg string, names []string) []string {
+	first, rest, nested := strings.Cut(pkg, ".")
+	if nested && slices.Contains(names, first) {
+		// The mistake is in the nested attribute, which names don't have.
+		return nil
+	}
+	maxDistance := lo.Max([]int{1, len(first) / 3})
+
+	type candidate struct {
+		name     string
+		distance int
+	}
+	candidates := []candidate{}
+	lowerFirst := strings.ToLower(first)
+	for _, name := range names {
+		if len(name) > len(first)+maxDistance || len(name) < len(first)-maxDistance {
+			continue
+		}
+		if distance := editDistance(lowerFirst, strings.ToLower(name)); distance <= maxDistance {
+			candidates = append(candidates, candidate{name, distance})
+		}
+	}
+	slices.SortFunc(candidates, func(a, b candidate) bool {
+		if a.distance != b.distance {
+			return a.distance < b.distance
+		}
+		return a.name < b.name
+	})
+	if len(candidates) > maxSuggestions {
+		candidates = candidates[:maxSuggestions]
+	}
+
+	suggestions := make([]string, 0, len(candidates))
+	for _, c := range candidates {
+		if nested {
+			c.name += "." + rest
+		}
+		suggestions = append(suggestions, c.name)
+	}
+	return suggestions
+}
+
+// editDistance returns the Levenshtein distance between a and b: the number of
+// single-byte insertions, deletions or substitutions that turn a into b.
+func editDistance(a, b string) int {
+	prev := make([]int, len(b)+1)
+	curr := make([]int, len(b)+1)
+	for j := range prev {
+		prev[j] = j
+	}
+	for i := 1; i <= len(a); i++ {
+		curr[0] = i
+		for j := 1; j <= len(b); j++ {
+			cost := 1
+			if a[i-1] == b[j-1] {
+				cost = 0
+			}
+			curr[j] = lo.Min([]int{prev[j] + 1, curr[j-1] + 1, prev[j-1] + cost})
+		}
+		prev, curr = curr, prev
+	}
+	return prev[len(b)]
+}
@@ -0,0 +1,50 @@
+package impl
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"go.jetpack.io/devbox/internal/nix"
+)
+
+func TestEditDistance(t *testing.T) {
+	assert.Equal(t, 0, editDistance("go", "go"))
+	assert.Equal(t, 1, editDistance("nodej", "nodejs"))
+	assert.Equal(t, 2, editDistance("pyhton", "python"))
+	assert.Equal(t, 3, editDistance("", "abc"))
+	assert.Equal(t, 3, editDistance("kitten", "sitting"))
+}
+
+func TestClosestPackageNames(t *testing.T) {
+	names := []string{
+		"nodejs", "nodejs-18_x", "nodejs_18", "nodejs_20", "nodejs_16", "nodejs_14",
+		"python3", "python310Packages", "ripgrep", "go",
+	}
+	assert.Equal(t, []string{"nodejs"}, closestPackageNames("nodej", names))
+	assert.Equal(t, []string{"nodejs_18", "nodejs-18_x", "nodejs_14", "nodejs_16", "nodejs"}, closestPackageNames("nodejs-18", names))
+	assert.Equal(t, []string{"ripgrep"}, closestPackageNames("RipGrep", names))
+	assert.Len(t, closestPackageNames("nodejs_1", names), maxSuggestions)
+	assert.Empty(t, closestPackageNames("terraform", names))
+
+	// Only the top-level attribute is compared.
+	assert.Equal(t, []string{"python310Packages.pip"}, closestPackageNames("python31Packages.pip", names))
+	assert.Empty(t, closestPackageNames("python310Packages.pipp", names))
+}
+
+func TestPackageNotFoundError(t *testing.T) {
+	client := &fakeNix{packageNames: func(commit string) ([]string, error) {
+		return []string{"nodejs", "nodejs_18", "ripgrep"}, nil
+	}}
+
+	d := &Devbox{cfg: &Config{}, nix: client}
+	err := d.packageNotFoundError("nodej")
+	assert.ErrorIs(t, err, nix.ErrPackageNotFound)
+	assert.EqualError(t, err, "nodej: package not found. Did you mean nodejs?")
+
+	err = d.packageNotFoundError("terraform")
+	assert.ErrorIs(t, err, nix.ErrPackageNotFound)
+	assert.EqualError(t, err, "terraform: package not found")
+
+	err = d.packageNotFoundError("github:example/flake#tool")
+	assert.EqualError(t, err, "github:example/flake#tool: package not found")
+}
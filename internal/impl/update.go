@@ -0,0 +1,143 @@
+// Copyright 2023 Jetpack Technologies Inc and contributors. All rights reserved.
+// Use of this source code is governed by the license in the LICENSE file.
+
+package impl
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/fatih/color"
+	"go.jetpack.io/devbox/internal/boxcli/usererr"
+)
+
+// resolveNixpkgsChannel returns the latest commit of a nixpkgs channel, with an
+// error that says which channel couldn't be resolved.
+func resolveNixpkgsChannel(client nixClient, channel string) (string, error) {
+	commit, err := client.LatestNixpkgsCommit(channel)
+	if err != nil {
+		return "", usererr.WithUserMessage(err,
+			"Unable to find the latest commit of nixpkgs channel %s. "+
+				"Check that it's one of the channels listed on https://status.nixos.org", channel)
+	}
+	return commit, nil
+}
+
+// UpdateOption configures Update.
+type UpdateOption func(*updateOptions)
+
+type updateOptions struct {
+	dryRun bool
+}
+
+// WithUpdateDryRun makes Update only print the package versions that would
+// change, without changing devbox.json or the nix profile.
+func WithUpdateDryRun() UpdateOption {
+	return func(o *updateOptions) {
+		o.dryRun = true
+	}
+}
+
+// Update moves the project to the latest commit of its nixpkgs channel, or
+// nixpkgs-unstable if it doesn't have one, and installs the new versions of its
+// packages. If a package doesn't exist at the new commit,
+// nothing is changed.
+func (d *Devbox) Update(opts ...UpdateOption) error {
+	updateOpts := &updateOptions{}
+	for _, opt := range opts {
+		opt(updateOpts)
+	}
+
+	channel := d.cfg.Nixpkgs.updateChannel()
+	latest, err := resolveNixpkgsChannel(d.nix, channel)
+	if err != nil {
+		return err
+	}
+	original := d.cfg.Nixpkgs.Commit
+	if latest == original {
+		fmt.Fprintf(d.writer, "Already using the latest %s commit %s.\n", channel, latest)
+		return nil
+	}
+
+	before := d.packageVersions()
+	d.cfg.Nixpkgs.Commit = latest
+	after := d.packageVersions()
+
+	missing := []string{}
+	for _, pkg := range d.cfg.RawPackages {
+		if before[pkg] != "" && after[pkg] == "" {
+			missing = append(missing, pkg)
+		}
+	}
+	if len(missing) > 0 {
+		d.cfg.Nixpkgs.Commit = original
+		return usererr.New(
+			"Packages don't exist at nixpkgs commit %s: %s. devbox.json was not updated.",
+			latest,
+			strings.Join(missing, ", "),
+		)
+	}
+
+	fmt.Fprintf(d.writer, "Updating nixpkgs %s commit from %s to %s.\n", channel, original, latest)
+	d.printVersionChanges(before, after)
+	if updateOpts.dryRun {
+		d.cfg.Nixpkgs.Commit = original
+		fmt.Fprintln(d.writer, "Dry run: devbox.json and the nix profile weren't changed.")
+		return nil
+	}
+
+	if err := d.saveCfg(); err != nil {
+		return err
+	}
+	if err := d.ensurePackagesAreInstalled(ensure); err != nil {
+		color.New(color.FgRed).Fprintf(
+			d.writer,
+			"There was an error installing nix packages. The nixpkgs commit was not updated.\n",
+		)
+		d.cfg.Nixpkgs.Commit = original
+		_ = d.saveCfg() // ignore error to ensure we return the original error
+		return err
+	}
+	return nil
+}
+
+// packageVersions returns the version of each of the project's packages at
+// its current nixpkgs commit. Packages that can't be found have an empty
+// version.
+func (d *Devbox) packageVersions() map[string]string {
+	versions := map[string]string{}
+	for _, pkg := range d.cfg.RawPackages {
+		if info, found := d.pkgInfo(pkg); found {
+			versions[pkg] = info.Version
+		}
+	}
+	return versions
+}
+
+// printVersionChanges prints the packages whose version differs between
+// before and after.
+func (d *Devbox) printVersionChanges(before, after map[string]string) {
+	changed := false
+	for _, pkg := range d.cfg.RawPackages {
+		if before[pkg] == after[pkg] {
+			continue
+		}
+		if !changed {
+			fmt.Fprintln(d.writer, "\nPackage version changes:")
+			changed = true
+		}
+		fmt.Fprintf(d.writer, "  %s: %s -> %s\n", pkg, versionOrNone(before[pkg]), after[pkg])
+	}
+	if !changed {
+		fmt.Fprintln(d.writer, "No package versions changed.")
+		return
+	}
+	fmt.Fprintln(d.writer)
+}
+
+func versionOrNone(version string) string {
+	if version == "" {
+		return "(not found)"
+	}
+	return version
+}
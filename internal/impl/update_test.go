@@ -0,0 +1,92 @@
+// Copyright 2023 Jetpack Technologies Inc and contributors. All rights reserved.
+// Use of this source code is governed by the license in the LICENSE file.
+
+package impl
+
+import (
+	"bytes"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"go.jetpack.io/devbox/internal/nix"
+)
+
+func TestUpdate(t *testing.T) {
+	const (
+		oldCommit = "af9e00071d0971eb292fd5abef334e66eda3cb69"
+		newCommit = "f80ac848e3d6f0c12c52758c0f25c10c97ca3b62"
+	)
+	versions := map[string]map[string]string{
+		oldCommit: {"go": "1.19.4", "ripgrep": "13.0.0", "hello": "2.12"},
+		newCommit: {"go": "1.19.5", "ripgrep": "13.0.0"},
+	}
+	client := &fakeNix{
+		pkgInfo: func(commit, pkg string) (*nix.Info, bool) {
+			version, ok := versions[commit][pkg]
+			if !ok {
+				return nil, false
+			}
+			return &nix.Info{Name: pkg, Version: version}, true
+		},
+		latestNixpkgsCommit: func(channel string) (string, error) {
+			if channel == "nixos-22.11" {
+				return oldCommit, nil
+			}
+			return newCommit, nil
+		},
+	}
+
+	tests := []struct {
+		name       string
+		packages   []string
+		commit     string
+		channel    string
+		wantErr    bool
+		wantOutput []string
+	}{
+		{
+			name:       "DryRun",
+			packages:   []string{"go", "ripgrep"},
+			commit:     oldCommit,
+			wantOutput: []string{"go: 1.19.4 -> 1.19.5", "Dry run"},
+		},
+		{
+			name:     "PackageMissingAtNewCommit",
+			packages: []string{"go", "hello"},
+			commit:   oldCommit,
+			wantErr:  true,
+		},
+		{
+			name:       "AlreadyLatest",
+			packages:   []string{"go"},
+			commit:     newCommit,
+			wantOutput: []string{"Already using the latest"},
+		},
+		{
+			name:       "Channel",
+			packages:   []string{"go"},
+			commit:     oldCommit,
+			channel:    "nixos-22.11",
+			wantOutput: []string{"Already using the latest nixos-22.11 commit"},
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			out := &bytes.Buffer{}
+			d := &Devbox{cfg: &Config{RawPackages: test.packages}, writer: out, nix: client}
+			d.cfg.Nixpkgs = NixpkgsConfig{Commit: test.commit, Channel: test.channel}
+
+			err := d.Update(WithUpdateDryRun())
+			if test.wantErr {
+				assert.Error(t, err)
+			} else {
+				assert.NoError(t, err)
+			}
+			assert.Equal(t, test.commit, d.cfg.Nixpkgs.Commit)
+			for _, want := range test.wantOutput {
+				assert.Contains(t, out.String(), want)
+			}
+			assert.NotContains(t, out.String(), "ripgrep:")
+		})
+	}
+}
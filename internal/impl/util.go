@@ -1,6 +1,7 @@
 package impl
 
 import (
+	"fmt"
 	"os"
 	"path/filepath"
 
@@ -43,7 +44,7 @@ func utilityLookPath(binName string) (string, error) {
 }
 
 func utilityDataPath() (string, error) {
-	path := xdg.DataSubpath("devbox/util")
+	path := xdg.DevboxDataSubpath("util")
 	if err := os.MkdirAll(path, 0755); err != nil {
 		return "", errors.WithStack(err)
 	}
@@ -65,3 +66,17 @@ func utilityBinPath() (string, error) {
 	}
 	return filepath.Join(nixProfilePath, "bin"), nil
 }
+
+// formatBytes formats a size in bytes using binary (1024-based) units.
+func formatBytes(size int64) string {
+	const unit = 1024
+	if size < unit {
+		return fmt.Sprintf("%d B", size)
+	}
+	div, exp := int64(unit), 0
+	for n := size / unit; n >= unit; n /= unit {
+		div *= unit
+		exp++
+	}
+	return fmt.Sprintf("%.1f %ciB", float64(size)/float64(div), "KMGTPE"[exp])
+}
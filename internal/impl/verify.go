@@ -0,0 +1,46 @@
+// Copyright 2023 Jetpack Technologies Inc and contributors. All rights reserved.
+// Use of this source code is governed by the license in the LICENSE file.
+
+package impl
+
+import (
+	"fmt"
+
+	"github.com/samber/lo"
+	"go.jetpack.io/devbox/internal/boxcli/usererr"
+	"go.jetpack.io/devbox/internal/nix"
+)
+
+// VerifySignatures checks that every store path in the closure of the
+// project's nix profile is signed by a trusted public key. It returns an error
+// if any path is unsigned, untrusted or corrupted.
+func (d *Devbox) VerifySignatures() error {
+	closure, _, err := d.profileClosure("devbox packages verify-signatures")
+	if err != nil {
+		return err
+	}
+	paths := lo.Map(closure, func(info nix.StorePathInfo, _ int) string { return info.Path })
+	return d.verifyStorePathSignatures(paths, d.cfg.TrustedPublicKeys)
+}
+
+// verifyStorePathSignatures verifies paths and reports the ones that failed.
+func (d *Devbox) verifyStorePathSignatures(paths, trustedKeys []string) error {
+	result, err := d.nix.VerifySignatures(paths, trustedKeys)
+	if err != nil {
+		return err
+	}
+	if result.OK() {
+		fmt.Fprintf(d.writer, "All %d store paths are signed by a trusted key.\n", len(paths))
+		return nil
+	}
+	for _, path := range result.Untrusted {
+		fmt.Fprintf(d.writer, "untrusted: %s\n", path)
+	}
+	for _, path := range result.Corrupted {
+		fmt.Fprintf(d.writer, "corrupted: %s\n", path)
+	}
+	return usererr.New(
+		"%d of %d store paths failed verification: %d aren't signed by a trusted key and %d are corrupted.",
+		len(result.Untrusted)+len(result.Corrupted), len(paths), len(result.Untrusted), len(result.Corrupted),
+	)
+}
@@ -0,0 +1,37 @@
+// Copyright 2023 Jetpack Technologies Inc and contributors. All rights reserved.
+// Use of this source code is governed by the license in the LICENSE file.
+
+package impl
+
+import (
+	"bytes"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"go.jetpack.io/devbox/internal/nix"
+)
+
+func TestVerifyStorePathSignatures(t *testing.T) {
+	paths := []string{"/nix/store/abc-hello-2.12.1", "/nix/store/def-glibc-2.35"}
+	keys := []string{"cache.example.com-1:abc="}
+
+	var gotKeys []string
+	client := &fakeNix{verifySignatures: func(paths, trustedKeys []string) (*nix.VerifyResult, error) {
+		gotKeys = trustedKeys
+		return &nix.VerifyResult{Untrusted: []string{"/nix/store/abc-hello-2.12.1"}}, nil
+	}}
+	out := &bytes.Buffer{}
+	d := &Devbox{writer: out, nix: client}
+	err := d.verifyStorePathSignatures(paths, keys)
+	assert.Error(t, err)
+	assert.Equal(t, keys, gotKeys)
+	assert.Contains(t, out.String(), "untrusted: /nix/store/abc-hello-2.12.1")
+	assert.NotContains(t, out.String(), "glibc")
+
+	client.verifySignatures = func(paths, trustedKeys []string) (*nix.VerifyResult, error) {
+		return &nix.VerifyResult{}, nil
+	}
+	out.Reset()
+	assert.NoError(t, d.verifyStorePathSignatures(paths, keys))
+	assert.Contains(t, out.String(), "All 2 store paths are signed")
+}
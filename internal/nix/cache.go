@@ -0,0 +1,70 @@
+// Copyright 2023 Jetpack Technologies Inc and contributors. All rights reserved.
+// Use of this source code is governed by the license in the LICENSE file.
+
+package nix
+
+import (
+	"crypto/ed25519"
+	"encoding/base64"
+	"net/url"
+	"strings"
+
+	"github.com/pkg/errors"
+)
+
+// BinaryCache is a nix binary cache, such as a Cachix or S3 cache, that nix
+// can download packages from in addition to the ones it's configured with.
+type BinaryCache struct {
+	// URL is the cache's substituter URL, like https://example.cachix.org
+	// or s3://bucket.
+	URL string `json:"url"`
+	// PublicKey is the key that the cache's store paths are signed with,
+	// like example.cachix.org-1:<base64>. Nix only uses store paths that
+	// are signed by a trusted key.
+	PublicKey string `json:"public_key,omitempty"`
+}
+
+// Validate checks that the cache's URL and public key are well formed, so
+// that a typo is reported before nix starts building anything.
+func (c BinaryCache) Validate() error {
+	u, err := url.Parse(c.URL)
+	if err != nil || u.Scheme == "" || strings.ContainsAny(c.URL, " \t\n") {
+		return errors.Errorf("invalid binary cache URL %q: it must be a URL like https://example.cachix.org", c.URL)
+	}
+	if c.PublicKey == "" {
+		return nil
+	}
+	name, key, ok := strings.Cut(c.PublicKey, ":")
+	if !ok || name == "" || strings.ContainsAny(name, " \t\n") {
+		return errors.Errorf("invalid public key %q for binary cache %s: it must look like name:base64-key", c.PublicKey, c.URL)
+	}
+	decoded, err := base64.StdEncoding.DecodeString(key)
+	if err != nil || len(decoded) != ed25519.PublicKeySize {
+		return errors.Errorf(
+			"invalid public key %q for binary cache %s: the part after %q must be a base64-encoded %d-byte ed25519 key",
+			c.PublicKey, c.URL, name+":", ed25519.PublicKeySize)
+	}
+	return nil
+}
+
+// BinaryCacheFlags returns the flags that make a nix command use caches along
+// with the substituters and trusted keys that nix is already configured with.
+// Unless the user is a trusted user of the nix daemon, the daemon only uses the
+// caches that are also listed in its trusted-substituters setting.
+func BinaryCacheFlags(caches []BinaryCache) []string {
+	if len(caches) == 0 {
+		return nil
+	}
+	urls, keys := []string{}, []string{}
+	for _, c := range caches {
+		urls = append(urls, c.URL)
+		if c.PublicKey != "" {
+			keys = append(keys, c.PublicKey)
+		}
+	}
+	flags := []string{"--option", "extra-substituters", strings.Join(urls, " ")}
+	if len(keys) > 0 {
+		flags = append(flags, "--option", "extra-trusted-public-keys", strings.Join(keys, " "))
+	}
+	return flags
+}
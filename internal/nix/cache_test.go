@@ -0,0 +1,45 @@
+package nix
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestBinaryCacheValidate(t *testing.T) {
+	const key = "example.cachix.org-1:6NCHdD59X431o0gWypbMrAURkbJ16ZPMQFGspcDShjY="
+	cases := []struct {
+		cache   BinaryCache
+		wantErr bool
+	}{
+		{BinaryCache{URL: "https://example.cachix.org", PublicKey: key}, false},
+		{BinaryCache{URL: "s3://bucket?region=eu-west-1"}, false},
+		{BinaryCache{URL: "example.cachix.org", PublicKey: key}, true},
+		{BinaryCache{URL: "https://example.cachix.org other", PublicKey: key}, true},
+		{BinaryCache{URL: "https://example.cachix.org", PublicKey: "6NCHdD59X431o0gWypbMrAURkbJ16ZPMQFGspcDShjY="}, true},
+		{BinaryCache{URL: "https://example.cachix.org", PublicKey: "example:not base64"}, true},
+		{BinaryCache{URL: "https://example.cachix.org", PublicKey: "example:dG9vIHNob3J0"}, true},
+	}
+	for _, c := range cases {
+		if err := c.cache.Validate(); (err != nil) != c.wantErr {
+			t.Errorf("%+v.Validate() = %v, want error: %v", c.cache, err, c.wantErr)
+		}
+	}
+}
+
+func TestBinaryCacheFlags(t *testing.T) {
+	if flags := BinaryCacheFlags(nil); flags != nil {
+		t.Errorf("BinaryCacheFlags(nil) = %q, want nil", flags)
+	}
+
+	flags := BinaryCacheFlags([]BinaryCache{
+		{URL: "https://a.cachix.org", PublicKey: "a:key"},
+		{URL: "s3://b"},
+	})
+	want := []string{
+		"--option", "extra-substituters", "https://a.cachix.org s3://b",
+		"--option", "extra-trusted-public-keys", "a:key",
+	}
+	if !reflect.DeepEqual(flags, want) {
+		t.Errorf("BinaryCacheFlags() = %q, want %q", flags, want)
+	}
+}
@@ -57,7 +57,10 @@ func Install(writer io.Writer, daemon *bool) error {
 	done := make(chan struct{})
 	go func() {
 		var buf bytes.Buffer
-		_, err := io.Copy(io.MultiWriter(&buf, os.Stdout), r)
+		// The installer's output goes to writer (usually stderr) so it
+		// doesn't get mixed into the stdout of a command that's waiting for
+		// nix, such as devbox run.
+		_, err := io.Copy(io.MultiWriter(&buf, writer), r)
 		if err != nil {
 			fmt.Fprintln(writer, err)
 		}
@@ -80,6 +83,52 @@ func BinaryInstalled() bool {
 	return err == nil
 }
 
+// MinVersion is the oldest version of nix that devbox supports. Devbox relies on
+// the nix command and flakes, which nix 2.4 introduced.
+const MinVersion = "2.4"
+
+// Version returns the version of the installed nix, such as "2.13.3".
+func Version() (string, error) {
+	out, err := exec.Command("nix", "--version").Output()
+	if err != nil {
+		return "", errors.WithStack(err)
+	}
+	// The output looks like "nix (Nix) 2.13.3".
+	fields := strings.Fields(string(out))
+	if len(fields) == 0 {
+		return "", errors.Errorf("unexpected output from nix --version: %q", out)
+	}
+	return fields[len(fields)-1], nil
+}
+
+// VersionAtLeast reports whether the nix version is the same as or newer than
+// min. Only the leading numbers of each dot-separated part are compared, so
+// pre-release suffixes such as "2.4pre20211006" are ignored.
+func VersionAtLeast(version, min string) bool {
+	v, m := strings.Split(version, "."), strings.Split(min, ".")
+	for i := range m {
+		if i >= len(v) {
+			return false
+		}
+		vn, mn := leadingNumber(v[i]), leadingNumber(m[i])
+		if vn != mn {
+			return vn > mn
+		}
+	}
+	return true
+}
+
+func leadingNumber(s string) int {
+	n := 0
+	for _, r := range s {
+		if r < '0' || r > '9' {
+			break
+		}
+		n = n*10 + int(r-'0')
+	}
+	return n
+}
+
 func DirExists() bool {
 	_, err := os.Stat("/nix")
 	return err == nil
@@ -0,0 +1,24 @@
+package nix
+
+import "testing"
+
+func TestVersionAtLeast(t *testing.T) {
+	cases := []struct {
+		version string
+		min     string
+		want    bool
+	}{
+		{"2.13.3", "2.4", true},
+		{"2.4", "2.4", true},
+		{"2.4pre20211006_53e4794", "2.4", true},
+		{"2.3.16", "2.4", false},
+		{"3.0", "2.4", true},
+		{"1.11", "2.4", false},
+		{"2", "2.4", false},
+	}
+	for _, c := range cases {
+		if got := VersionAtLeast(c.version, c.min); got != c.want {
+			t.Errorf("VersionAtLeast(%q, %q) = %v, want %v", c.version, c.min, got, c.want)
+		}
+	}
+}
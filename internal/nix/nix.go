@@ -6,6 +6,7 @@ package nix
 import (
 	"encoding/json"
 	"fmt"
+	"io"
 	"os"
 	"os/exec"
 	"strings"
@@ -24,6 +25,11 @@ const ProfilePath = ".devbox/nix/profile/default"
 
 var ErrPackageNotFound = errors.New("package not found")
 var ErrPackageNotInstalled = errors.New("package not installed")
+var ErrPackageUnfree = errors.New("package has an unfree license")
+
+// unfreeLicenseError is the message nixpkgs fails with when evaluating an
+// unfree package that isn't allowed.
+const unfreeLicenseError = "has an unfree license"
 
 func PkgExists(nixpkgsCommit, pkg string) bool {
 	_, found := PkgInfo(nixpkgsCommit, pkg)
@@ -41,9 +47,20 @@ type Info struct {
 	// attribute key is different in flakes vs legacy so we should only use it
 	// if we know exactly which version we are using
 	attributeKey string
-	NixName      string
-	Name         string
-	Version      string
+	NixName      string `json:"-"`
+	Name         string `json:"name"`
+	Version      string `json:"version"`
+
+	// The rest of the fields are set from the package's meta attributes in
+	// nixpkgs.
+	Description string `json:"description,omitempty"`
+	Homepage    string `json:"homepage,omitempty"`
+	// License is the SPDX identifier of the package's license, or its name
+	// if it doesn't have one. Packages with several licenses have them
+	// separated by commas.
+	License string `json:"license,omitempty"`
+	Unfree  bool   `json:"unfree"`
+	Broken  bool   `json:"broken"`
 }
 
 func (i *Info) String() string {
@@ -77,7 +94,7 @@ func legacyPkgInfo(nixpkgsCommit, pkg string) (*Info, bool) {
 	if err != nil {
 		return nil, false
 	}
-	cmd := exec.Command("nix-env", "-qa", "-A", pkg, "-f", info.URL, "--json")
+	cmd := exec.Command("nix-env", "-qa", "-A", pkg, "-f", info.URL, "--json", "--meta")
 	return pkgInfo(cmd, pkg)
 }
 
@@ -89,7 +106,84 @@ func flakesPkgInfo(nixpkgsCommit, pkg string) (*Info, bool) {
 
 	cmd := exec.Command("nix", "search", "--json", exactPackage)
 	cmd.Args = append(cmd.Args, ExperimentalFlags()...)
-	return pkgInfo(cmd, pkg)
+	info, found := pkgInfo(cmd, pkg)
+	if found {
+		// nix search doesn't output meta, so it's evaluated separately.
+		info.setMeta(flakesPkgMeta(exactPackage))
+	}
+	return info, found
+}
+
+// flakesPkgMeta evaluates the meta attributes of the package at installable
+// that Info has. Evaluating meta doesn't fail for unfree or broken packages,
+// but if it fails for some other reason the package is reported as neither.
+func flakesPkgMeta(installable string) map[string]any {
+	cmd := exec.Command(
+		"nix", "eval", "--json", installable+".meta",
+		"--apply", "meta: { "+
+			"unfree = meta.unfree or false; "+
+			"broken = meta.broken or false; "+
+			"description = meta.description or null; "+
+			"homepage = meta.homepage or null; "+
+			"license = meta.license or null; }",
+	)
+	cmd.Args = append(cmd.Args, ExperimentalFlags()...)
+	cmd.Env = DefaultEnv()
+	debug.Log("running command: %s\n", cmd)
+	out, err := cmd.Output()
+	if err != nil {
+		debug.Log("unable to evaluate the meta of %s: %v", installable, err)
+		return nil
+	}
+	meta := map[string]any{}
+	if err := json.Unmarshal(out, &meta); err != nil {
+		return nil
+	}
+	return meta
+}
+
+// setMeta sets the fields of i that come from a package's meta attributes.
+func (i *Info) setMeta(meta map[string]any) {
+	i.Unfree, _ = meta["unfree"].(bool)
+	i.Broken, _ = meta["broken"].(bool)
+	if description, ok := meta["description"].(string); ok {
+		i.Description = description
+	}
+	// homepage is usually a URL, but some packages have a list of them.
+	switch homepage := meta["homepage"].(type) {
+	case string:
+		i.Homepage = homepage
+	case []any:
+		if len(homepage) > 0 {
+			i.Homepage, _ = homepage[0].(string)
+		}
+	}
+	i.License = licenseName(meta["license"])
+}
+
+// licenseName returns the name of a license in a package's meta. It can be
+// a license attribute set from nixpkgs' lib.licenses, a list of them, or a
+// plain string.
+func licenseName(license any) string {
+	switch license := license.(type) {
+	case string:
+		return license
+	case []any:
+		names := []string{}
+		for _, l := range license {
+			if name := licenseName(l); name != "" {
+				names = append(names, name)
+			}
+		}
+		return strings.Join(names, ", ")
+	case map[string]any:
+		for _, key := range []string{"spdxId", "shortName", "fullName"} {
+			if name, ok := license[key].(string); ok && name != "" {
+				return name
+			}
+		}
+	}
+	return ""
 }
 
 func pkgInfo(cmd *exec.Cmd, pkg string) (*Info, bool) {
@@ -121,6 +215,14 @@ func parseInfo(pkg string, data []byte) *Info {
 			Name:         result["pname"].(string),
 			Version:      result["version"].(string),
 		}
+		// nix search outputs the description, and nix-env outputs all of
+		// meta with --meta.
+		if description, ok := result["description"].(string); ok {
+			pkgInfo.Description = description
+		}
+		if meta, ok := result["meta"].(map[string]any); ok {
+			pkgInfo.setMeta(meta)
+		}
 
 		return pkgInfo
 	}
@@ -131,7 +233,15 @@ func DefaultEnv() []string {
 	return append(os.Environ(), "NIXPKGS_ALLOW_UNFREE=1")
 }
 
-type varsAndFuncs struct {
+// restrictedUnfreeEnv is DefaultEnv without the blanket allowance for unfree
+// packages, so that only the packages allowed by the nixpkgs config in the
+// generated nix files can be unfree.
+func restrictedUnfreeEnv() []string {
+	return append(os.Environ(), "NIXPKGS_ALLOW_UNFREE=0")
+}
+
+// VarsAndFuncs is the output of nix print-dev-env.
+type VarsAndFuncs struct {
 	Functions map[string]string   // the key is the name, the value is the body.
 	Variables map[string]variable // the key is the name.
 }
@@ -140,25 +250,54 @@ type variable struct {
 	Value any    // can be a string or an array of strings (iff type is array).
 }
 
+// PrintDevEnvArgs configures PrintDevEnv.
+type PrintDevEnvArgs struct {
+	NixShellFilePath  string
+	NixFlakesFilePath string
+	// RestrictUnfree makes evaluation fail with ErrPackageUnfree unless
+	// every unfree package is allowed by the nix files' nixpkgs config.
+	RestrictUnfree bool
+	// Offline computes the environment only from packages that are already
+	// in the nix store, without downloading anything. It fails if a package
+	// hasn't been realized yet.
+	Offline bool
+	// ExtraFlags are passed to nix as is, such as BinaryCacheFlags.
+	ExtraFlags []string
+}
+
 // PrintDevEnv calls `nix print-dev-env -f <path>` and returns its output. The output contains
 // all the environment variables and bash functions required to create a nix shell.
-func PrintDevEnv(nixShellFilePath, nixFlakesFilePath string) (*varsAndFuncs, error) {
+func PrintDevEnv(args *PrintDevEnvArgs) (*VarsAndFuncs, error) {
 	cmd := exec.Command("nix", "print-dev-env")
 	if featureflag.Flakes.Enabled() {
-		cmd.Args = append(cmd.Args, nixFlakesFilePath)
+		cmd.Args = append(cmd.Args, args.NixFlakesFilePath)
 	} else {
-		cmd.Args = append(cmd.Args, "-f", nixShellFilePath)
+		cmd.Args = append(cmd.Args, "-f", args.NixShellFilePath)
 	}
 	cmd.Args = append(cmd.Args, ExperimentalFlags()...)
+	if args.Offline {
+		// Nix still builds the environment derivation itself, but
+		// without substituters any package that isn't in the store
+		// makes it fail instead of being downloaded.
+		cmd.Args = append(cmd.Args, "--offline")
+	}
+	cmd.Args = append(cmd.Args, args.ExtraFlags...)
 	cmd.Args = append(cmd.Args, "--impure", "--json")
 	debug.Log("Running print-dev-env cmd: %s\n", cmd)
 	cmd.Env = DefaultEnv()
+	if args.RestrictUnfree {
+		cmd.Env = restrictedUnfreeEnv()
+	}
 	out, err := cmd.Output()
+	var exitErr *exec.ExitError
+	if errors.As(err, &exitErr) && strings.Contains(string(exitErr.Stderr), unfreeLicenseError) {
+		return nil, errors.WithStack(ErrPackageUnfree)
+	}
 	if err != nil {
 		return nil, errors.Wrapf(err, "Command: %s", cmd)
 	}
 
-	var vaf varsAndFuncs
+	var vaf VarsAndFuncs
 	err = json.Unmarshal(out, &vaf)
 	if err != nil {
 		return nil, errors.WithStack(err)
@@ -166,6 +305,65 @@ func PrintDevEnv(nixShellFilePath, nixFlakesFilePath string) (*varsAndFuncs, err
 	return &vaf, nil
 }
 
+// BuildPackages builds (or downloads from a binary cache) pkgs from the given
+// nixpkgs commit without installing them into any profile. It returns the nix
+// store paths of the packages' outputs.
+func BuildPackages(w io.Writer, nixpkgsCommit string, pkgs ...string) ([]string, error) {
+	cmd := exec.Command("nix", "build", "--no-link", "--print-out-paths", "--impure")
+	for _, pkg := range pkgs {
+		cmd.Args = append(cmd.Args, FlakeNixpkgs(nixpkgsCommit)+"#"+pkg)
+	}
+	cmd.Args = append(cmd.Args, ExperimentalFlags()...)
+	cmd.Env = DefaultEnv()
+	cmd.Stderr = w
+	debug.Log("Running cmd: %s\n", cmd)
+	out, err := cmd.Output()
+	if err != nil {
+		return nil, errors.Wrapf(err, "Command: %s", cmd)
+	}
+	return strings.Fields(string(out)), nil
+}
+
+// OutPaths evaluates pkg from the given nixpkgs commit and returns the store
+// paths of the outputs that installing it would add to a profile. Unlike
+// BuildPackages, nothing is built or downloaded.
+func OutPaths(nixpkgsCommit, pkg string) ([]string, error) {
+	cmd := exec.Command("nix", "eval", "--json", "--impure",
+		FlakeNixpkgs(nixpkgsCommit)+"#"+pkg,
+		"--apply", `p: map (o: p.${o}.outPath) (p.meta.outputsToInstall or [ "out" ])`,
+	)
+	cmd.Args = append(cmd.Args, ExperimentalFlags()...)
+	cmd.Env = DefaultEnv()
+	debug.Log("Running cmd: %s\n", cmd)
+	out, err := cmd.Output()
+	if err != nil {
+		return nil, errors.Wrapf(err, "Command: %s", cmd)
+	}
+	paths := []string{}
+	if err := json.Unmarshal(out, &paths); err != nil {
+		return nil, errors.WithStack(err)
+	}
+	return paths, nil
+}
+
+// RealiseStorePaths makes paths available in the local nix store, downloading
+// them from a binary cache if they aren't already there. extraFlags, such as
+// BinaryCacheFlags, are passed to nix as is.
+func RealiseStorePaths(w io.Writer, extraFlags []string, paths ...string) error {
+	cmd := exec.Command("nix", "build", "--no-link")
+	cmd.Args = append(cmd.Args, paths...)
+	cmd.Args = append(cmd.Args, ExperimentalFlags()...)
+	cmd.Args = append(cmd.Args, extraFlags...)
+	cmd.Env = DefaultEnv()
+	cmd.Stdout = w
+	cmd.Stderr = w
+	debug.Log("Running cmd: %s\n", cmd)
+	if err := cmd.Run(); err != nil {
+		return errors.Wrapf(err, "Command: %s", cmd)
+	}
+	return nil
+}
+
 // FlakeNixpkgs returns a flakes-compatible reference to the nixpkgs registry.
 // TODO savil. Ensure this works with the nixed cache service.
 func FlakeNixpkgs(commit string) string {
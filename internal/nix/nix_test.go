@@ -13,3 +13,97 @@ func TestPkgExists(t *testing.T) {
 		t.Errorf("got PkgExists(%q) = true, want false.", pkg)
 	}
 }
+
+func TestParseInfoMeta(t *testing.T) {
+	tests := []struct {
+		name       string
+		data       string
+		wantUnfree bool
+		wantBroken bool
+	}{
+		{
+			name: "no meta",
+			data: `{"legacyPackages.x86_64-linux.hello": {"pname": "hello", "version": "2.12.1"}}`,
+		},
+		{
+			name:       "unfree",
+			data:       `{"vscode": {"pname": "vscode", "version": "1.77.0", "meta": {"unfree": true, "broken": false}}}`,
+			wantUnfree: true,
+		},
+		{
+			name:       "broken",
+			data:       `{"hello": {"pname": "hello", "version": "2.12.1", "meta": {"broken": true}}}`,
+			wantBroken: true,
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			info := parseInfo("pkg", []byte(test.data))
+			if info == nil {
+				t.Fatal("got nil info")
+			}
+			if info.Unfree != test.wantUnfree || info.Broken != test.wantBroken {
+				t.Errorf("got Unfree = %v, Broken = %v, want Unfree = %v, Broken = %v",
+					info.Unfree, info.Broken, test.wantUnfree, test.wantBroken)
+			}
+		})
+	}
+}
+
+func TestParseInfoDescriptionHomepageLicense(t *testing.T) {
+	tests := []struct {
+		name            string
+		data            string
+		wantDescription string
+		wantHomepage    string
+		wantLicense     string
+	}{
+		{
+			name:            "nix search",
+			data:            `{"legacyPackages.x86_64-linux.jq": {"pname": "jq", "version": "1.6", "description": "A lightweight JSON processor"}}`,
+			wantDescription: "A lightweight JSON processor",
+		},
+		{
+			name: "nix-env meta",
+			data: `{"jq": {"pname": "jq", "version": "1.6", "meta": {
+				"description": "A lightweight JSON processor",
+				"homepage": "https://stedolan.github.io/jq/",
+				"license": {"spdxId": "MIT", "fullName": "MIT License", "free": true}
+			}}}`,
+			wantDescription: "A lightweight JSON processor",
+			wantHomepage:    "https://stedolan.github.io/jq/",
+			wantLicense:     "MIT",
+		},
+		{
+			name: "several homepages and licenses",
+			data: `{"perl": {"pname": "perl", "version": "5.36.0", "meta": {
+				"homepage": ["https://www.perl.org/", "https://www.cpan.org/"],
+				"license": [{"spdxId": "Artistic-1.0-Perl"}, {"fullName": "GNU General Public License v1.0 or later"}]
+			}}}`,
+			wantHomepage: "https://www.perl.org/",
+			wantLicense:  "Artistic-1.0-Perl, GNU General Public License v1.0 or later",
+		},
+		{
+			name:        "license string",
+			data:        `{"foo": {"pname": "foo", "version": "1.0", "meta": {"license": "unfree"}}}`,
+			wantLicense: "unfree",
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			info := parseInfo("pkg", []byte(test.data))
+			if info == nil {
+				t.Fatal("got nil info")
+			}
+			if info.Description != test.wantDescription {
+				t.Errorf("got Description = %q, want %q", info.Description, test.wantDescription)
+			}
+			if info.Homepage != test.wantHomepage {
+				t.Errorf("got Homepage = %q, want %q", info.Homepage, test.wantHomepage)
+			}
+			if info.License != test.wantLicense {
+				t.Errorf("got License = %q, want %q", info.License, test.wantLicense)
+			}
+		})
+	}
+}
@@ -5,9 +5,12 @@ import (
 	"fmt"
 	"io"
 	"io/fs"
+	"net/http"
 	"os"
 	"os/exec"
 	"path/filepath"
+	"strings"
+	"time"
 
 	"github.com/fatih/color"
 	"github.com/pkg/errors"
@@ -15,6 +18,12 @@ import (
 	"go.jetpack.io/devbox/internal/xdg"
 )
 
+// PrefetchNixpkgs downloads the nixpkgs flake at commit, unless it's already in
+// the nix store. It fails if the commit can't be fetched.
+func PrefetchNixpkgs(w io.Writer, commit string) error {
+	return ensureNixpkgsPrefetched(w, commit)
+}
+
 // ensureNixpkgsPrefetched runs the prefetch step to download the flake of the registry
 func ensureNixpkgsPrefetched(w io.Writer, commit string) error {
 	// Look up the cached map of commitHash:nixStoreLocation
@@ -107,6 +116,33 @@ func saveToNixpkgsCommitFile(commit string, commitToLocation map[string]string)
 }
 
 func nixpkgsCommitFilePath() string {
-	cacheDir := xdg.CacheSubpath("devbox")
-	return filepath.Join(cacheDir, "nixpkgs.json")
+	return xdg.DevboxCacheSubpath("nixpkgs.json")
+}
+
+// UnstableChannel is the nixpkgs channel that devbox's default nixpkgs commit
+// comes from.
+const UnstableChannel = "nixpkgs-unstable"
+
+// LatestNixpkgsCommit returns the commit that a nixpkgs channel, such as
+// UnstableChannel, currently points to.
+func LatestNixpkgsCommit(channel string) (string, error) {
+	url := fmt.Sprintf("https://channels.nixos.org/%s/git-revision", channel)
+	client := &http.Client{Timeout: 30 * time.Second}
+	res, err := client.Get(url)
+	if err != nil {
+		return "", errors.WithStack(err)
+	}
+	defer res.Body.Close()
+	if res.StatusCode != http.StatusOK {
+		return "", errors.Errorf("GET %s: %s", url, res.Status)
+	}
+	body, err := io.ReadAll(res.Body)
+	if err != nil {
+		return "", errors.WithStack(err)
+	}
+	commit := strings.TrimSpace(string(body))
+	if commit == "" {
+		return "", errors.Errorf("GET %s: empty response", url)
+	}
+	return commit, nil
 }
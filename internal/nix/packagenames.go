@@ -0,0 +1,63 @@
+// Copyright 2023 Jetpack Technologies Inc and contributors. All rights reserved.
+// Use of this source code is governed by the license in the LICENSE file.
+
+package nix
+
+import (
+	"encoding/json"
+	"os"
+	"os/exec"
+	"path/filepath"
+
+	"github.com/pkg/errors"
+	"go.jetpack.io/devbox/internal/debug"
+	"go.jetpack.io/devbox/internal/xdg"
+)
+
+// PackageNames returns the names of the top-level packages in nixpkgs at
+// nixpkgsCommit for the current system. A commit's packages never change, so
+// the names are cached after the first call.
+func PackageNames(nixpkgsCommit string) ([]string, error) {
+	cachePath := ""
+	if nixpkgsCommit != "" {
+		cachePath = xdg.DevboxCacheSubpath(
+			filepath.Join("package-names", nixpkgsCommit+"-"+System()+".json"))
+		if data, err := os.ReadFile(cachePath); err == nil {
+			var names []string
+			if err := json.Unmarshal(data, &names); err == nil {
+				return names, nil
+			}
+		}
+	}
+
+	flake := FlakeNixpkgs(nixpkgsCommit)
+	if nixpkgsCommit == "" {
+		flake = "nixpkgs"
+	}
+	cmd := exec.Command(
+		"nix", "eval", "--json", flake+"#legacyPackages."+System(),
+		"--apply", "builtins.attrNames",
+	)
+	cmd.Args = append(cmd.Args, ExperimentalFlags()...)
+	out, err := cmd.Output()
+	if err != nil {
+		return nil, errors.Wrapf(err, "Command: %s", cmd)
+	}
+	var names []string
+	if err := json.Unmarshal(out, &names); err != nil {
+		return nil, errors.WithStack(err)
+	}
+
+	// The cache is only an optimization, so failing to write it isn't an
+	// error.
+	if cachePath != "" {
+		err := os.MkdirAll(filepath.Dir(cachePath), 0o755)
+		if err == nil {
+			err = os.WriteFile(cachePath, out, 0o644)
+		}
+		if err != nil {
+			debug.Log("unable to cache package names: %v", err)
+		}
+	}
+	return names, nil
+}
@@ -0,0 +1,149 @@
+// Copyright 2023 Jetpack Technologies Inc and contributors. All rights reserved.
+// Use of this source code is governed by the license in the LICENSE file.
+
+package nix
+
+import (
+	"bytes"
+	"encoding/json"
+	"os/exec"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/pkg/errors"
+	"go.jetpack.io/devbox/internal/debug"
+)
+
+// StorePathInfo describes a path in the nix store.
+type StorePathInfo struct {
+	Path    string `json:"path"`
+	NarHash string `json:"narHash"`
+	NarSize int64  `json:"narSize"`
+}
+
+// Name returns the name of the store path without the /nix/store prefix and
+// hash. For example, /nix/store/<hash>-ripgrep-13.0.0 becomes ripgrep-13.0.0.
+func (p StorePathInfo) Name() string {
+	base := filepath.Base(p.Path)
+	if _, name, found := strings.Cut(base, "-"); found {
+		return name
+	}
+	return base
+}
+
+// NameAndVersion splits Name into the package name and its version, following
+// the nix convention that the version starts at the first dash followed by a
+// digit. For example, ripgrep-13.0.0 becomes ripgrep and 13.0.0. The version
+// is empty if the name doesn't have one.
+func (p StorePathInfo) NameAndVersion() (string, string) {
+	name := p.Name()
+	for i := 0; i < len(name)-1; i++ {
+		if name[i] == '-' && name[i+1] >= '0' && name[i+1] <= '9' {
+			return name[:i], name[i+1:]
+		}
+	}
+	return name, ""
+}
+
+// Closure returns the closure of paths, which are the paths themselves and
+// every store path they depend on, sorted by path.
+func Closure(paths ...string) ([]StorePathInfo, error) {
+	return pathInfo("" /*store*/, true /*recursive*/, paths...)
+}
+
+// StoreClosure is Closure for paths in another store, such as a binary cache
+// URL. It lets devbox look up paths that haven't been downloaded yet. An empty
+// store is the local nix store.
+func StoreClosure(store string, paths ...string) ([]StorePathInfo, error) {
+	return pathInfo(store, true /*recursive*/, paths...)
+}
+
+// PathInfo returns the info of each of paths, sorted by path.
+func PathInfo(paths ...string) ([]StorePathInfo, error) {
+	return pathInfo("" /*store*/, false /*recursive*/, paths...)
+}
+
+func pathInfo(store string, recursive bool, paths ...string) ([]StorePathInfo, error) {
+	cmd := exec.Command("nix", "path-info", "--json")
+	if recursive {
+		cmd.Args = append(cmd.Args, "--recursive")
+	}
+	if store != "" {
+		cmd.Args = append(cmd.Args, "--store", store)
+	}
+	cmd.Args = append(cmd.Args, paths...)
+	cmd.Args = append(cmd.Args, ExperimentalFlags()...)
+	cmd.Env = DefaultEnv()
+	debug.Log("Running cmd: %s\n", cmd)
+	out, err := cmd.Output()
+	if err != nil {
+		return nil, errors.Wrapf(err, "Command: %s", cmd)
+	}
+	return parsePathInfo(out)
+}
+
+// parsePathInfo parses the output of "nix path-info --json". Older versions
+// of nix print an array of objects, while newer versions print an object keyed
+// by store path.
+func parsePathInfo(data []byte) ([]StorePathInfo, error) {
+	var infos []StorePathInfo
+	if err := json.Unmarshal(data, &infos); err != nil {
+		byPath := map[string]StorePathInfo{}
+		if err := json.Unmarshal(data, &byPath); err != nil {
+			return nil, errors.WithStack(err)
+		}
+		for path, info := range byPath {
+			info.Path = path
+			infos = append(infos, info)
+		}
+	}
+	sort.Slice(infos, func(i, j int) bool { return infos[i].Path < infos[j].Path })
+	return infos, nil
+}
+
+// StoreBinaries returns the names of the entries in the bin directory of
+// storePath in store, which may be a binary cache URL. Unlike reading the
+// directory, it works for paths that haven't been downloaded yet. An empty
+// store is the local nix store.
+func StoreBinaries(store, storePath string) ([]string, error) {
+	cmd := exec.Command("nix", "store", "ls", "--json", storePath+"/bin")
+	if store != "" {
+		cmd.Args = append(cmd.Args, "--store", store)
+	}
+	cmd.Args = append(cmd.Args, ExperimentalFlags()...)
+	cmd.Env = DefaultEnv()
+	debug.Log("Running cmd: %s\n", cmd)
+	var stderr bytes.Buffer
+	cmd.Stderr = &stderr
+	out, err := cmd.Output()
+	if err != nil {
+		// Packages such as libraries don't have a bin directory.
+		if strings.Contains(stderr.String(), "does not exist") {
+			return []string{}, nil
+		}
+		return nil, errors.Wrapf(err, "Command: %s: %s", cmd, stderr.String())
+	}
+	return parseStoreLs(out)
+}
+
+// parseStoreLs returns the names of the regular files and symlinks in the
+// directory listing printed by "nix store ls --json", sorted by name.
+func parseStoreLs(data []byte) ([]string, error) {
+	var dir struct {
+		Entries map[string]struct {
+			Type string `json:"type"`
+		} `json:"entries"`
+	}
+	if err := json.Unmarshal(data, &dir); err != nil {
+		return nil, errors.WithStack(err)
+	}
+	names := []string{}
+	for name, entry := range dir.Entries {
+		if entry.Type == "regular" || entry.Type == "symlink" {
+			names = append(names, name)
+		}
+	}
+	sort.Strings(names)
+	return names, nil
+}
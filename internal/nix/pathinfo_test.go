@@ -0,0 +1,60 @@
+// Copyright 2023 Jetpack Technologies Inc and contributors. All rights reserved.
+// Use of this source code is governed by the license in the LICENSE file.
+
+package nix
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestParsePathInfo(t *testing.T) {
+	want := []StorePathInfo{
+		{Path: "/nix/store/aaaa-glibc-2.35-224", NarSize: 30000},
+		{Path: "/nix/store/bbbb-ripgrep-13.0.0", NarSize: 4000},
+	}
+
+	testCases := map[string]string{
+		"array": `[
+			{"path": "/nix/store/bbbb-ripgrep-13.0.0", "narSize": 4000, "valid": true},
+			{"path": "/nix/store/aaaa-glibc-2.35-224", "narSize": 30000, "valid": true}
+		]`,
+		"object": `{
+			"/nix/store/bbbb-ripgrep-13.0.0": {"narSize": 4000},
+			"/nix/store/aaaa-glibc-2.35-224": {"narSize": 30000}
+		}`,
+	}
+	for name, data := range testCases {
+		t.Run(name, func(t *testing.T) {
+			infos, err := parsePathInfo([]byte(data))
+			assert.NoError(t, err)
+			assert.Equal(t, want, infos)
+			assert.Equal(t, "ripgrep-13.0.0", infos[1].Name())
+		})
+	}
+}
+
+func TestStorePathNameAndVersion(t *testing.T) {
+	testCases := map[string][2]string{
+		"/nix/store/aaaa-ripgrep-13.0.0":        {"ripgrep", "13.0.0"},
+		"/nix/store/aaaa-glibc-2.35-224":        {"glibc", "2.35-224"},
+		"/nix/store/aaaa-python3.10-pip-22.3.1": {"python3.10-pip", "22.3.1"},
+		"/nix/store/aaaa-hook":                  {"hook", ""},
+	}
+	for path, want := range testCases {
+		name, version := StorePathInfo{Path: path}.NameAndVersion()
+		assert.Equal(t, want, [2]string{name, version}, path)
+	}
+}
+
+func TestParseStoreLs(t *testing.T) {
+	data := `{"type": "directory", "entries": {
+		"rg": {"type": "regular", "size": 5000, "executable": true},
+		"egrep": {"type": "symlink", "target": "grep"},
+		"share": {"type": "directory"}
+	}}`
+	names, err := parseStoreLs([]byte(data))
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"egrep", "rg"}, names)
+}
@@ -57,7 +57,7 @@ func ProfileListItems(writer io.Writer, profileDir string) ([]*NixProfileListIte
 
 	for scanner.Scan() {
 		line := scanner.Text()
-		item, err := parseNixProfileListItem(line)
+		item, err := ParseProfileListItem(line)
 		if err != nil {
 			return nil, err
 		}
@@ -88,9 +88,9 @@ type NixProfileListItem struct {
 	nixStorePath string
 }
 
-// parseNixProfileListItem reads each line of output (from `nix profile list`) and converts
+// ParseProfileListItem reads each line of output (from `nix profile list`) and converts
 // into a golang struct. Refer to NixProfileListItem struct definition for explanation of each field.
-func parseNixProfileListItem(line string) (*NixProfileListItem, error) {
+func ParseProfileListItem(line string) (*NixProfileListItem, error) {
 
 	scanner := bufio.NewScanner(strings.NewReader(line))
 	scanner.Split(bufio.ScanWords)
@@ -149,6 +149,15 @@ func (item *NixProfileListItem) AttributePath() (string, error) {
 	return attrPath, nil
 }
 
+// InstalledFromStorePath reports whether the item was installed from a nix
+// store path instead of a flake, in which case it has no attribute path.
+//
+// For example, nix profile list prints such an item as
+// 0 - - /nix/store/kzyxfh2kmrq7bcpzsay3kmhqgzimmxd7-go-1.19.5
+func (item *NixProfileListItem) InstalledFromStorePath() bool {
+	return !strings.Contains(item.lockedReference, "#")
+}
+
 // PackageName parses the package name from the NixProfileListItem.lockedReference
 //
 // For example:
@@ -174,6 +183,11 @@ func (item *NixProfileListItem) PackageName() (string, error) {
 	return packageName, nil
 }
 
+// StorePath returns the nix store path of the package.
+func (item *NixProfileListItem) StorePath() string {
+	return item.nixStorePath
+}
+
 // String serializes the NixProfileListItem back into the format printed by `nix profile list`
 func (item *NixProfileListItem) String() string {
 	return fmt.Sprintf("%d %s %s %s",
@@ -190,13 +204,24 @@ type ProfileInstallArgs struct {
 	NixpkgsCommit     string
 	Package           string
 	ProfilePath       string
-	Writer            io.Writer
+	// DisallowUnfree makes the install fail with ErrPackageUnfree if the
+	// package has an unfree license, instead of allowing it.
+	DisallowUnfree bool
+	// StorePaths, if set, are installed instead of Package from
+	// NixpkgsCommit, for example the store paths recorded in devbox.lock.
+	// They must already be in the nix store.
+	StorePaths []string
+	Writer     io.Writer
 }
 
 // ProfileInstall calls nix profile install with default profile
 func ProfileInstall(args *ProfileInstallArgs) error {
-	if err := ensureNixpkgsPrefetched(args.Writer, args.NixpkgsCommit); err != nil {
-		return err
+	installables := args.StorePaths
+	if len(installables) == 0 {
+		if err := ensureNixpkgsPrefetched(args.Writer, args.NixpkgsCommit); err != nil {
+			return err
+		}
+		installables = []string{FlakeNixpkgs(args.NixpkgsCommit) + "#" + args.Package}
 	}
 	stepMsg := args.Package
 	if args.CustomStepMessage != "" {
@@ -209,12 +234,15 @@ func ProfileInstall(args *ProfileInstallArgs) error {
 	cmd := exec.Command("nix", "profile", "install",
 		"--profile", args.ProfilePath,
 		"--impure", // Needed to allow flags from environment to be used.
-		FlakeNixpkgs(args.NixpkgsCommit)+"#"+args.Package,
 	)
+	cmd.Args = append(cmd.Args, installables...)
 	cmd.Args = append(cmd.Args, ExperimentalFlags()...)
 	cmd.Args = append(cmd.Args, args.ExtraFlags...)
 
 	cmd.Env = DefaultEnv()
+	if args.DisallowUnfree {
+		cmd.Env = restrictedUnfreeEnv()
+	}
 	cmd.Stdout = &PackageInstallWriter{args.Writer}
 	var stderr bytes.Buffer
 	cmd.Stderr = io.MultiWriter(&stderr, cmd.Stdout)
@@ -223,6 +251,11 @@ func ProfileInstall(args *ProfileInstallArgs) error {
 		if strings.Contains(stderr.String(), "does not provide attribute") {
 			return ErrPackageNotFound
 		}
+		if strings.Contains(stderr.String(), unfreeLicenseError) {
+			fmt.Fprintf(args.Writer, "%s: ", stepMsg)
+			color.New(color.FgRed).Fprintf(args.Writer, "Fail\n")
+			return errors.WithStack(ErrPackageUnfree)
+		}
 
 		fmt.Fprintf(args.Writer, "%s: ", stepMsg)
 		color.New(color.FgRed).Fprintf(args.Writer, "Fail\n")
@@ -66,7 +66,7 @@ func TestNixProfileListItem(t *testing.T) {
 
 func testItem(t *testing.T, line string, expected expectedTestData) {
 
-	item, err := parseNixProfileListItem(line)
+	item, err := ParseProfileListItem(line)
 	if err != nil {
 		t.Fatalf("unexpected error %v", err)
 	}
@@ -97,3 +97,22 @@ func testItem(t *testing.T, line string, expected expectedTestData) {
 		t.Errorf("expected package name %s but got %s", expected.packageName, gotPackageName)
 	}
 }
+
+func TestNixProfileListItemInstalledFromStorePath(t *testing.T) {
+	testCases := map[string]bool{
+		"0 - - /nix/store/w0lyimyyxxfl3gw40n46rpn1yjrl3q85-go-1.19.3": true,
+		"0 github:NixOS/nixpkgs/52e3e80afff4b16ccb7c52e9f0f5220552f03d04#legacyPackages.x86_64-darwin.go_1_19 " +
+			"github:NixOS/nixpkgs/52e3e80afff4b16ccb7c52e9f0f5220552f03d04#legacyPackages.x86_64-darwin.go_1_19 " +
+			"/nix/store/w0lyimyyxxfl3gw40n46rpn1yjrl3q85-go-1.19.3": false,
+	}
+
+	for line, expected := range testCases {
+		item, err := ParseProfileListItem(line)
+		if err != nil {
+			t.Fatalf("unexpected error %v", err)
+		}
+		if got := item.InstalledFromStorePath(); got != expected {
+			t.Errorf("expected InstalledFromStorePath() to be %t for %q but got %t", expected, line, got)
+		}
+	}
+}
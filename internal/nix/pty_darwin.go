@@ -0,0 +1,56 @@
+package nix
+
+import (
+	"bytes"
+	"os"
+	"syscall"
+	"unsafe"
+
+	"github.com/pkg/errors"
+	"golang.org/x/sys/unix"
+)
+
+// openPTY opens a new pseudo-terminal and returns its master and slave ends.
+// It does what posix_openpt, grantpt, unlockpt and ptsname do in libc.
+func openPTY() (master, slave *os.File, err error) {
+	master, err = os.OpenFile("/dev/ptmx", os.O_RDWR|unix.O_NOCTTY|unix.O_CLOEXEC, 0)
+	if err != nil {
+		return nil, nil, errors.WithStack(err)
+	}
+	fd := int(master.Fd())
+	if err := unix.IoctlSetInt(fd, unix.TIOCPTYGRANT, 0); err != nil {
+		master.Close()
+		return nil, nil, errors.Wrap(err, "grant pty")
+	}
+	if err := unix.IoctlSetInt(fd, unix.TIOCPTYUNLK, 0); err != nil {
+		master.Close()
+		return nil, nil, errors.Wrap(err, "unlock pty")
+	}
+	name, err := ptsname(fd)
+	if err != nil {
+		master.Close()
+		return nil, nil, err
+	}
+	slave, err = os.OpenFile(name, os.O_RDWR|unix.O_NOCTTY, 0)
+	if err != nil {
+		master.Close()
+		return nil, nil, errors.WithStack(err)
+	}
+	return master, slave, nil
+}
+
+// ptsname returns the path of the slave end of the pseudo-terminal whose
+// master is fd. The TIOCPTYGNAME ioctl fills a 128-byte buffer, which none of
+// the unix package's ioctl helpers take.
+func ptsname(fd int) (string, error) {
+	buf := make([]byte, 128)
+	_, _, errno := syscall.Syscall(
+		syscall.SYS_IOCTL, uintptr(fd), uintptr(unix.TIOCPTYGNAME), uintptr(unsafe.Pointer(&buf[0])))
+	if errno != 0 {
+		return "", errors.Wrap(errno, "get pty name")
+	}
+	if i := bytes.IndexByte(buf, 0); i >= 0 {
+		buf = buf[:i]
+	}
+	return string(buf), nil
+}
@@ -0,0 +1,11 @@
+//go:build !linux && !darwin && !windows
+
+package nix
+
+import "os"
+
+// openPTY isn't implemented outside of Linux and macOS, so scripts run
+// without a pseudo-terminal.
+func openPTY() (master, slave *os.File, err error) {
+	return nil, nil, errPTYUnsupported
+}
@@ -0,0 +1,113 @@
+//go:build !windows
+
+package nix
+
+import (
+	"io"
+	"os"
+	"os/exec"
+	"os/signal"
+	"syscall"
+	"time"
+
+	"go.jetpack.io/devbox/internal/debug"
+	"golang.org/x/sys/unix"
+	"golang.org/x/term"
+)
+
+// ptyDrainTimeout is how long relay's stop function waits for the rest of a
+// script's output after the script exits. Processes that the script left
+// running in the background can keep the pseudo-terminal open indefinitely.
+const ptyDrainTimeout = time.Second
+
+// ptyTerminal is a pseudo-terminal that a command runs in, with devbox
+// relaying between it and devbox's own terminal.
+type ptyTerminal struct {
+	master *os.File
+	slave  *os.File
+}
+
+// attachPTY makes cmd run in a new session whose controlling terminal is a new
+// pseudo-terminal. cmd's stdin and stdout, and its stderr if devbox's stderr is
+// a terminal, are connected to the pseudo-terminal, which gets the same size
+// as devbox's terminal.
+func attachPTY(cmd *exec.Cmd) (*ptyTerminal, error) {
+	master, slave, err := openPTY()
+	if err != nil {
+		return nil, err
+	}
+	t := &ptyTerminal{master: master, slave: slave}
+	t.resize()
+
+	cmd.Stdin = slave
+	cmd.Stdout = slave
+	if term.IsTerminal(int(os.Stderr.Fd())) {
+		cmd.Stderr = slave
+	}
+	if cmd.SysProcAttr == nil {
+		cmd.SysProcAttr = &syscall.SysProcAttr{}
+	}
+	// The command leads its own session, and therefore its own process
+	// group, so it must not also ask for a new process group.
+	cmd.SysProcAttr.Setpgid = false
+	cmd.SysProcAttr.Setsid = true
+	cmd.SysProcAttr.Setctty = true
+	// Ctty is the command's stdin.
+	cmd.SysProcAttr.Ctty = 0
+	return t, nil
+}
+
+// relay copies devbox's stdin to the pseudo-terminal and the pseudo-terminal's
+// output to devbox's stdout, with devbox's terminal in raw mode so that
+// keystrokes such as Ctrl-C reach the command's terminal unchanged. It must be
+// called after the command starts. The returned function waits for the rest
+// of the command's output and restores devbox's terminal.
+func (t *ptyTerminal) relay() func() {
+	// Only the command should have the slave open, so that reading from the
+	// master fails once the command exits.
+	t.slave.Close()
+
+	oldState, err := term.MakeRaw(int(os.Stdin.Fd()))
+	if err != nil {
+		debug.Log("Unable to put the terminal in raw mode: %v", err)
+	}
+
+	winch := make(chan os.Signal, 1)
+	signal.Notify(winch, syscall.SIGWINCH)
+	go func() {
+		for range winch {
+			t.resize()
+		}
+	}()
+
+	// This stops when devbox exits. Stopping it sooner would require
+	// interrupting a read from stdin.
+	go func() { _, _ = io.Copy(t.master, os.Stdin) }()
+	done := make(chan struct{})
+	go func() {
+		_, _ = io.Copy(os.Stdout, t.master)
+		close(done)
+	}()
+
+	return func() {
+		select {
+		case <-done:
+		case <-time.After(ptyDrainTimeout):
+		}
+		signal.Stop(winch)
+		close(winch)
+		if oldState != nil {
+			_ = term.Restore(int(os.Stdin.Fd()), oldState)
+		}
+		t.master.Close()
+	}
+}
+
+// resize makes the pseudo-terminal the same size as devbox's terminal.
+func (t *ptyTerminal) resize() {
+	size, err := unix.IoctlGetWinsize(int(os.Stdout.Fd()), unix.TIOCGWINSZ)
+	if err != nil {
+		return
+	}
+	_ = unix.IoctlSetWinsize(int(t.master.Fd()), unix.TIOCSWINSZ, size)
+}
@@ -4,14 +4,70 @@ import (
 	"fmt"
 	"os"
 	"os/exec"
+	"sync/atomic"
+	"time"
 
+	"github.com/mattn/go-isatty"
 	"github.com/pkg/errors"
 	"go.jetpack.io/devbox/internal/boxcli/usererr"
 	"go.jetpack.io/devbox/internal/debug"
 )
 
-func RunScript(projectDir string, cmdWithArgs string, env map[string]string) error {
-	if cmdWithArgs == "" {
+// TimeoutExitCode is the exit code of a script that RunScript terminated
+// because it ran longer than its timeout. It matches the timeout command from
+// coreutils.
+const TimeoutExitCode = 124
+
+// ErrTimeout is returned, wrapped in a usererr.ExitError with TimeoutExitCode,
+// when a script runs longer than its timeout.
+var ErrTimeout = errors.New("script timed out")
+
+// errPTYUnsupported is returned by attachPTY on platforms where devbox can't
+// open pseudo-terminals.
+var errPTYUnsupported = errors.New("pseudo-terminals aren't supported on this platform")
+
+// timeoutGracePeriod is how long a script has to exit after it's asked to
+// terminate on timeout before it's killed.
+const timeoutGracePeriod = 10 * time.Second
+
+// RunScriptOption customizes how RunScript runs the command before it is
+// started. It returns an error if the option isn't supported.
+type RunScriptOption func(r *scriptRunner) error
+
+// scriptRunner is the command that RunScript executes along with settings that
+// control how it's run.
+type scriptRunner struct {
+	cmd *exec.Cmd
+	// script is the shell code that sh runs. Options can change it before
+	// the command starts.
+	script  string
+	timeout time.Duration
+	// isolated is true if the command runs in new namespaces, which the
+	// kernel can refuse to create.
+	isolated bool
+	// pty is true if the command should run in a pseudo-terminal when
+	// devbox runs in a terminal.
+	pty bool
+}
+
+// RunScript runs script with sh in the given environment. args are passed to
+// the script as its positional parameters without being split or evaluated
+// by the shell, so the script can forward them with "$@".
+//
+// The command's stdin, stdout and stderr are devbox's own file descriptors
+// rather than pipes, so its output reaches the terminal or CI log byte-for-byte
+// and unbuffered, in the same order the command wrote it. Tools that parse
+// structured output (TAP, JUnit, JSON) depend on this, so RunScriptOptions
+// must not wrap them. The exception is WithPTY, which only applies when
+// devbox's stdin and stdout are a terminal.
+func RunScript(
+	projectDir string,
+	script string,
+	args []string,
+	env map[string]string,
+	opts ...RunScriptOption,
+) error {
+	if script == "" {
 		return errors.New("attempted to run an empty command or script")
 	}
 
@@ -25,18 +81,115 @@ func RunScript(projectDir string, cmdWithArgs string, env map[string]string) err
 	if err != nil {
 		shPath = "/bin/sh"
 	}
-	cmd := exec.Command(shPath, "-c", cmdWithArgs)
+	cmd := exec.Command(shPath)
 	cmd.Env = envPairs
 	cmd.Dir = projectDir
 	cmd.Stdin = os.Stdin
 	cmd.Stdout = os.Stdout
 	cmd.Stderr = os.Stderr
+	r := &scriptRunner{cmd: cmd, script: script}
+	for _, opt := range opts {
+		if err := opt(r); err != nil {
+			return err
+		}
+	}
+	// The argument after the script is $0, so args start at $1.
+	cmd.Args = append([]string{shPath, "-c", r.script, "sh"}, args...)
+	var pty *ptyTerminal
+	if r.pty && isatty.IsTerminal(os.Stdin.Fd()) && isatty.IsTerminal(os.Stdout.Fd()) {
+		pty, err = attachPTY(cmd)
+		if err != nil {
+			// The command still works without a pseudo-terminal, it
+			// just doesn't get one of its own.
+			debug.Log("Running the command without a pseudo-terminal: %v", err)
+			pty = nil
+		}
+	}
+	if r.timeout > 0 && pty == nil {
+		// Run the script in its own process group so that a timeout also
+		// terminates any processes it started. The terminal may have been
+		// handed to the group even if the script fails to start.
+		restoreTerminal := setProcessGroup(cmd)
+		defer restoreTerminal()
+	}
 
 	debug.Log("Executing: %v", cmd.Args)
-	err = cmd.Run()
+	err = cmd.Start()
+	if err != nil && r.isolated {
+		// The process never started, which most likely means the kernel
+		// refused to create the namespaces requested by one of the options.
+		return usererr.WithUserMessage(
+			err,
+			"Unable to start the command in an isolated environment. "+
+				"This usually means unprivileged user namespaces are disabled on this system.",
+		)
+	}
+	if err != nil {
+		return errors.WithStack(err)
+	}
+	if pty != nil {
+		stopRelay := pty.relay()
+		defer stopRelay()
+	}
+
+	// devbox waits for the command to exit instead of being terminated by
+	// the signals that are meant for it, so that it exits with the
+	// command's status.
+	stopForwarding := forwardSignals(cmd)
+	defer stopForwarding()
+
+	var timedOut atomic.Bool
+	var timer *time.Timer
+	stopKill := make(chan func(), 1)
+	if r.timeout > 0 {
+		timer = time.AfterFunc(r.timeout, func() {
+			timedOut.Store(true)
+			stopKill <- terminateProcessGroup(cmd, timeoutGracePeriod)
+		})
+	}
+	err = cmd.Wait()
+	if timer != nil && !timer.Stop() {
+		// The script timed out and has exited since, so it no longer
+		// needs to be killed.
+		(<-stopKill)()
+	}
+	if timedOut.Load() {
+		return errors.WithStack(usererr.NewExitError(
+			errors.Wrapf(ErrTimeout, "timed out after %s", r.timeout), TimeoutExitCode))
+	}
 	if err != nil {
 		// Report error as exec error when executing scripts.
 		err = usererr.NewExecError(err)
 	}
 	return errors.WithStack(err)
 }
+
+// WithTimeout terminates the script, and any processes it started, if it runs
+// longer than timeout. RunScript then returns an error with TimeoutExitCode.
+func WithTimeout(timeout time.Duration) RunScriptOption {
+	return func(r *scriptRunner) error {
+		r.timeout = timeout
+		return nil
+	}
+}
+
+// WithPTY runs the script in a new pseudo-terminal when devbox's stdin and
+// stdout are a terminal. The script gets a session of its own, so terminating
+// it can't leave devbox's terminal in raw mode or with another foreground
+// process group. Pseudo-terminals are supported on Linux and macOS. On other
+// platforms, and when devbox isn't running in a terminal, the script uses
+// devbox's stdin, stdout and stderr like it would without this option.
+func WithPTY() RunScriptOption {
+	return func(r *scriptRunner) error {
+		r.pty = true
+		return nil
+	}
+}
+
+// WithDir runs the script in dir instead of the project directory.
+func WithDir(dir string) RunScriptOption {
+	return func(r *scriptRunner) error {
+		r.cmd.Dir = dir
+		return nil
+	}
+}
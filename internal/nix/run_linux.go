@@ -0,0 +1,40 @@
+package nix
+
+import (
+	"os"
+	"syscall"
+)
+
+// capNetAdmin is CAP_NET_ADMIN from linux/capability.h.
+const capNetAdmin = 12
+
+// WithNoNetwork runs the command in a new network namespace, which has no
+// interfaces other than an unconfigured loopback device. The network namespace
+// is nested in a new user namespace so that devbox doesn't need to run as root.
+//
+// If allowLoopback is true, the loopback device is brought up before the
+// command runs so that it can still talk to services it starts itself.
+func WithNoNetwork(allowLoopback bool) RunScriptOption {
+	return func(r *scriptRunner) error {
+		cmd := r.cmd
+		r.isolated = true
+		cmd.SysProcAttr = &syscall.SysProcAttr{
+			Cloneflags: syscall.CLONE_NEWUSER | syscall.CLONE_NEWNET,
+			// Map the current user to itself so that files created by the
+			// command are owned by the user running devbox.
+			UidMappings: []syscall.SysProcIDMap{
+				{ContainerID: os.Getuid(), HostID: os.Getuid(), Size: 1},
+			},
+			GidMappings: []syscall.SysProcIDMap{
+				{ContainerID: os.Getgid(), HostID: os.Getgid(), Size: 1},
+			},
+		}
+		if allowLoopback {
+			// CAP_NET_ADMIN only applies to the new namespaces, so it doesn't
+			// give the command any extra privileges on the host.
+			cmd.SysProcAttr.AmbientCaps = []uintptr{capNetAdmin}
+			r.script = "ip link set lo up || exit 1\n" + r.script
+		}
+		return nil
+	}
+}
@@ -0,0 +1,260 @@
+package nix
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"syscall"
+	"testing"
+	"time"
+
+	"go.jetpack.io/devbox/internal/boxcli/usererr"
+	"golang.org/x/sys/unix"
+)
+
+// dialAddrEnv tells TestRunScriptNoNetworkHelper which address to dial when the
+// test binary is re-executed as a script.
+const dialAddrEnv = "DEVBOX_TEST_DIAL_ADDR"
+
+func TestRunScriptNoNetwork(t *testing.T) {
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal("Error listening on loopback:", err)
+	}
+	defer ln.Close()
+	go func() {
+		for {
+			conn, err := ln.Accept()
+			if err != nil {
+				return
+			}
+			conn.Close()
+		}
+	}()
+
+	script := fmt.Sprintf("%s -test.run=TestRunScriptNoNetworkHelper", os.Args[0])
+	env := map[string]string{dialAddrEnv: ln.Addr().String()}
+
+	if err := RunScript(t.TempDir(), script, nil, env); err != nil {
+		t.Fatal("Expected script to reach the network without WithNoNetwork, got error:", err)
+	}
+
+	err = RunScript(t.TempDir(), script, nil, env, WithNoNetwork(false))
+	var exitErr *usererr.ExitError
+	if err != nil && !errors.As(err, &exitErr) {
+		t.Skip("Network namespaces are not available:", err)
+	}
+	if err == nil {
+		t.Error("Expected script to fail to reach the network with WithNoNetwork.")
+	}
+}
+
+// TestRunScriptNoNetworkHelper isn't a real test. It's the script that
+// TestRunScriptNoNetwork runs, and it exits non-zero if it can't connect to
+// the address in dialAddrEnv.
+func TestRunScriptNoNetworkHelper(t *testing.T) {
+	addr := os.Getenv(dialAddrEnv)
+	if addr == "" {
+		return
+	}
+	conn, err := net.DialTimeout("tcp", addr, time.Second)
+	if err != nil {
+		os.Exit(1)
+	}
+	conn.Close()
+	os.Exit(0)
+}
+
+func TestRunScriptPTY(t *testing.T) {
+	// Run devbox itself in a pseudo-terminal, which the test reads the
+	// script's output from.
+	master, slave, err := openPTY()
+	if err != nil {
+		t.Fatal("Error opening a pty:", err)
+	}
+	defer master.Close()
+	defer slave.Close()
+	size := &unix.Winsize{Row: 40, Col: 100}
+	if err := unix.IoctlSetWinsize(int(slave.Fd()), unix.TIOCSWINSZ, size); err != nil {
+		t.Fatal(err)
+	}
+	output := make(chan []byte)
+	go func() {
+		for {
+			buf := make([]byte, 1024)
+			n, err := master.Read(buf)
+			if err != nil {
+				close(output)
+				return
+			}
+			output <- buf[:n]
+		}
+	}()
+
+	stdin, stdout := os.Stdin, os.Stdout
+	os.Stdin, os.Stdout = slave, slave
+	defer func() {
+		os.Stdin, os.Stdout = stdin, stdout
+	}()
+
+	// The script has a timeout, so it runs in its own process group and
+	// can't use devbox's terminal. It still has a terminal of the same size.
+	script := `[ -t 0 ] && [ -t 1 ] && echo "tty $(stty size)"`
+	env := map[string]string{"PATH": os.Getenv("PATH")}
+	err = RunScript(t.TempDir(), script, nil, env, WithTimeout(time.Minute), WithPTY())
+	os.Stdin, os.Stdout = stdin, stdout
+	if err != nil {
+		t.Fatal("Got RunScript error:", err)
+	}
+
+	// The pty doesn't reach EOF because devbox keeps reading its stdin, so
+	// wait for the output instead.
+	got := ""
+	timeout := time.After(10 * time.Second)
+	for !strings.Contains(got, "tty 40 100") {
+		select {
+		case data, ok := <-output:
+			if !ok {
+				t.Fatalf("Got script output %q, want it to contain %q", got, "tty 40 100")
+			}
+			got += string(data)
+		case <-timeout:
+			t.Fatalf("Got script output %q, want it to contain %q", got, "tty 40 100")
+		}
+	}
+}
+
+func TestRunScriptPTYNotATerminal(t *testing.T) {
+	out, err := os.Create(filepath.Join(t.TempDir(), "output"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer out.Close()
+	stdout := os.Stdout
+	os.Stdout = out
+	defer func() {
+		os.Stdout = stdout
+	}()
+
+	// Without a terminal, the script's output goes straight to devbox's
+	// stdout.
+	err = RunScript(t.TempDir(), `[ -t 1 ] || echo "not a tty"`, nil, map[string]string{}, WithPTY())
+	os.Stdout = stdout
+	if err != nil {
+		t.Fatal("Got RunScript error:", err)
+	}
+	got, err := os.ReadFile(out.Name())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(got) != "not a tty\n" {
+		t.Errorf("Got script output %q, want %q", got, "not a tty\n")
+	}
+}
+
+// foregroundDirEnv tells TestRunScriptTimeoutForegroundHelper which directory
+// to write its results to when the test binary is re-executed in a terminal.
+const foregroundDirEnv = "DEVBOX_TEST_FOREGROUND_DIR"
+
+func TestRunScriptTimeoutForeground(t *testing.T) {
+	master, slave, err := openPTY()
+	if err != nil {
+		t.Fatal("Error opening a pty:", err)
+	}
+	defer master.Close()
+
+	// Run devbox, as the helper, in a new session whose controlling
+	// terminal is the pty.
+	dir := t.TempDir()
+	cmd := exec.Command(os.Args[0], "-test.run=TestRunScriptTimeoutForegroundHelper")
+	cmd.Env = append(os.Environ(), foregroundDirEnv+"="+dir)
+	cmd.Stdin, cmd.Stdout, cmd.Stderr = slave, slave, slave
+	cmd.SysProcAttr = &syscall.SysProcAttr{Setsid: true, Setctty: true, Ctty: 0}
+	if err := cmd.Start(); err != nil {
+		t.Fatal(err)
+	}
+	slave.Close()
+	output := make(chan string)
+	go func() {
+		got, _ := io.ReadAll(master)
+		output <- string(got)
+	}()
+	if _, err := master.Write([]byte("hello\n")); err != nil {
+		t.Fatal(err)
+	}
+
+	err = cmd.Wait()
+	got := <-output
+	if err != nil {
+		t.Fatalf("Got helper error %v with output:\n%s", err, got)
+	}
+	line, err := os.ReadFile(filepath.Join(dir, "line"))
+	if err != nil {
+		t.Fatalf("Got error %v reading the script's input, with output:\n%s", err, got)
+	}
+	if string(line) != "hello\n" {
+		t.Errorf("Got script input %q, want %q", line, "hello\n")
+	}
+}
+
+// TestRunScriptTimeoutForegroundHelper isn't a real test. It's devbox running
+// in the terminal that TestRunScriptTimeoutForeground opens. It runs a script
+// with a timeout that reads a line from the terminal and starts a background
+// process, and exits non-zero if the timeout doesn't terminate both or doesn't
+// give the terminal back.
+func TestRunScriptTimeoutForegroundHelper(t *testing.T) {
+	dir := os.Getenv(foregroundDirEnv)
+	if dir == "" {
+		return
+	}
+	fail := func(format string, args ...any) {
+		fmt.Fprintf(os.Stderr, format+"\n", args...)
+		os.Exit(1)
+	}
+
+	script := `read line && echo "$line" > "$DIR/line"; sleep 60 & echo $! > "$DIR/pid"; wait`
+	env := map[string]string{"DIR": dir, "PATH": os.Getenv("PATH")}
+	err := RunScript(dir, script, nil, env, WithTimeout(2*time.Second))
+	if !errors.Is(err, ErrTimeout) {
+		fail("Got RunScript error %v, want ErrTimeout.", err)
+	}
+	if fg, err := unix.IoctlGetInt(0, unix.TIOCGPGRP); err != nil || fg != syscall.Getpgrp() {
+		fail("Got foreground process group %d (error %v), want devbox's %d.", fg, err, syscall.Getpgrp())
+	}
+
+	data, err := os.ReadFile(filepath.Join(dir, "pid"))
+	if err != nil {
+		fail("The script didn't start its background process: %v", err)
+	}
+	pid, err := strconv.Atoi(strings.TrimSpace(string(data)))
+	if err != nil {
+		fail("Got invalid pid: %v", err)
+	}
+	deadline := time.Now().Add(5 * time.Second)
+	for processRunning(pid) {
+		if time.Now().After(deadline) {
+			fail("The script's background process %d is still running after the timeout.", pid)
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	os.Exit(0)
+}
+
+// processRunning reports whether the process pid is running. A process that
+// exited but hasn't been reaped yet isn't running.
+func processRunning(pid int) bool {
+	stat, err := os.ReadFile(fmt.Sprintf("/proc/%d/stat", pid))
+	if err != nil {
+		return false
+	}
+	// The state follows the command name, which is in parentheses.
+	fields := strings.Fields(string(stat[bytes.LastIndexByte(stat, ')')+1:]))
+	return len(fields) > 0 && fields[0] != "Z"
+}
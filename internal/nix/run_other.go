@@ -0,0 +1,15 @@
+//go:build !linux
+
+package nix
+
+import (
+	"go.jetpack.io/devbox/internal/boxcli/usererr"
+)
+
+// WithNoNetwork is only supported on Linux, where network namespaces are
+// available.
+func WithNoNetwork(allowLoopback bool) RunScriptOption {
+	return func(r *scriptRunner) error {
+		return usererr.New("Running without network access is only supported on Linux.")
+	}
+}
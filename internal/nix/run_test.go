@@ -0,0 +1,97 @@
+package nix
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"go.jetpack.io/devbox/internal/boxcli/usererr"
+)
+
+func TestRunScriptOutputOrder(t *testing.T) {
+	// Point stdout and stderr at the same file. If RunScript copied the
+	// command's output through pipes, writes to the two streams could be
+	// reordered or held back until the command exits.
+	out, err := os.Create(filepath.Join(t.TempDir(), "output"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer out.Close()
+	stdout, stderr := os.Stdout, os.Stderr
+	os.Stdout, os.Stderr = out, out
+	defer func() {
+		os.Stdout, os.Stderr = stdout, stderr
+	}()
+
+	script := `for i in 1 2 3; do echo "out $i"; echo "err $i" >&2; done; printf partial`
+	err = RunScript(t.TempDir(), script, nil, map[string]string{})
+	os.Stdout, os.Stderr = stdout, stderr
+	if err != nil {
+		t.Fatal("Got RunScript error:", err)
+	}
+
+	got, err := os.ReadFile(out.Name())
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := "out 1\nerr 1\nout 2\nerr 2\nout 3\nerr 3\npartial"
+	if string(got) != want {
+		t.Errorf("Got script output in the wrong order or incomplete.\ngot:  %q\nwant: %q", got, want)
+	}
+}
+
+func TestRunScriptArgs(t *testing.T) {
+	dir := t.TempDir()
+	scriptPath := filepath.Join(dir, "script.sh")
+	outPath := filepath.Join(dir, "output")
+	// Like devbox's generated scripts, the file has no shebang.
+	body := `for arg in "$@"; do printf '%s\n' "$arg"; done > "$OUT"`
+	if err := os.WriteFile(scriptPath, []byte(body), 0o755); err != nil {
+		t.Fatal(err)
+	}
+
+	args := []string{scriptPath, "--flag", "value with spaces", "$HOME", `"quoted"`, ""}
+	err := RunScript(dir, `"$@"`, args, map[string]string{"OUT": outPath})
+	if err != nil {
+		t.Fatal("Got RunScript error:", err)
+	}
+	got, err := os.ReadFile(outPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := "--flag\nvalue with spaces\n$HOME\n\"quoted\"\n\n"
+	if string(got) != want {
+		t.Errorf("Got script args %q, want %q", got, want)
+	}
+}
+
+func TestRunScriptTimeout(t *testing.T) {
+	start := time.Now()
+	err := RunScript(t.TempDir(), "sleep 10; echo done", nil, map[string]string{}, WithTimeout(100*time.Millisecond))
+	if elapsed := time.Since(start); elapsed > 5*time.Second {
+		t.Errorf("Got script terminated after %s, want it terminated soon after its timeout.", elapsed)
+	}
+	if !errors.Is(err, ErrTimeout) {
+		t.Fatalf("Got RunScript error %v, want ErrTimeout.", err)
+	}
+	var exitErr *usererr.ExitError
+	if !errors.As(err, &exitErr) {
+		t.Fatalf("Got RunScript error %v, want a usererr.ExitError.", err)
+	}
+	if got := exitErr.ExitCode(); got != TimeoutExitCode {
+		t.Errorf("Got exit code %d, want %d.", got, TimeoutExitCode)
+	}
+}
+
+func TestRunScriptTimeoutNotReached(t *testing.T) {
+	err := RunScript(t.TempDir(), "exit 3", nil, map[string]string{}, WithTimeout(time.Minute))
+	var exitErr *usererr.ExitError
+	if !errors.As(err, &exitErr) {
+		t.Fatalf("Got RunScript error %v, want a usererr.ExitError.", err)
+	}
+	if got := exitErr.ExitCode(); got != 3 {
+		t.Errorf("Got exit code %d, want the script's own exit code 3.", got)
+	}
+}
@@ -0,0 +1,107 @@
+//go:build !windows
+
+package nix
+
+import (
+	"os"
+	"os/exec"
+	"os/signal"
+	"syscall"
+	"time"
+
+	"github.com/mattn/go-isatty"
+	"golang.org/x/sys/unix"
+)
+
+// setProcessGroup makes cmd the leader of a new process group, so that
+// terminateProcessGroup can signal every process it starts.
+//
+// Only the terminal's foreground process group can read from it, and a
+// command in any other group is stopped by SIGTTIN as soon as it reads its
+// input. So if cmd's stdin is devbox's controlling terminal and devbox is in
+// the foreground, cmd's new group becomes the terminal's foreground group. The
+// returned function makes devbox's process group the foreground group again,
+// and must be called once cmd has exited.
+func setProcessGroup(cmd *exec.Cmd) (restore func()) {
+	if cmd.SysProcAttr == nil {
+		cmd.SysProcAttr = &syscall.SysProcAttr{}
+	}
+	cmd.SysProcAttr.Setpgid = true
+
+	tty, ok := cmd.Stdin.(*os.File)
+	if !ok || !isatty.IsTerminal(tty.Fd()) {
+		return func() {}
+	}
+	// This fails if the terminal isn't devbox's controlling terminal, and
+	// returns another group if devbox runs in the background. Either way
+	// the terminal doesn't stop cmd from reading it.
+	fg, err := unix.IoctlGetInt(int(tty.Fd()), unix.TIOCGPGRP)
+	if err != nil || fg != syscall.Getpgrp() {
+		return func() {}
+	}
+	cmd.SysProcAttr.Foreground = true
+	cmd.SysProcAttr.Ctty = int(tty.Fd())
+	return func() {
+		// devbox is in the background until it takes the terminal back,
+		// and the terminal would stop it with SIGTTOU for doing so.
+		signal.Ignore(syscall.SIGTTOU)
+		defer signal.Reset(syscall.SIGTTOU)
+		_ = unix.IoctlSetPointerInt(int(tty.Fd()), unix.TIOCSPGRP, syscall.Getpgrp())
+	}
+}
+
+// ownProcessGroup reports whether cmd runs in its own process group or
+// session, which cmd's process leads.
+func ownProcessGroup(cmd *exec.Cmd) bool {
+	return cmd.SysProcAttr != nil && (cmd.SysProcAttr.Setpgid || cmd.SysProcAttr.Setsid)
+}
+
+// terminateProcessGroup sends SIGTERM to the process group led by cmd, and
+// SIGKILL if it's still running after gracePeriod. cmd must lead its own
+// process group, as setProcessGroup and attachPTY make it. The returned
+// function cancels the SIGKILL, and must be called once cmd has exited so
+// that a process group that reuses cmd's pid isn't killed.
+func terminateProcessGroup(cmd *exec.Cmd, gracePeriod time.Duration) (stop func()) {
+	pgid := cmd.Process.Pid
+	_ = syscall.Kill(-pgid, syscall.SIGTERM)
+	timer := time.AfterFunc(gracePeriod, func() {
+		_ = syscall.Kill(-pgid, syscall.SIGKILL)
+	})
+	return func() { timer.Stop() }
+}
+
+// forwardSignals relays the signals that would terminate devbox to cmd until
+// the returned function is called.
+//
+// SIGTERM and SIGHUP are usually sent to devbox alone, for example by CI
+// runners and process supervisors, so they're always forwarded. SIGINT and
+// SIGQUIT usually come from the terminal, which already sends them to every
+// process in the foreground process group, including cmd. Forwarding them too
+// would make programs that quit forcefully on a second interrupt do so on the
+// first one, so they're only forwarded when cmd runs in its own process group
+// or session and the terminal can't reach it.
+func forwardSignals(cmd *exec.Cmd) func() {
+	ownGroup := ownProcessGroup(cmd)
+	sigs := make(chan os.Signal, 1)
+	signal.Notify(sigs, syscall.SIGINT, syscall.SIGQUIT, syscall.SIGTERM, syscall.SIGHUP)
+	done := make(chan struct{})
+	go func() {
+		for {
+			select {
+			case sig := <-sigs:
+				switch {
+				case ownGroup:
+					_ = syscall.Kill(-cmd.Process.Pid, sig.(syscall.Signal))
+				case sig == syscall.SIGTERM || sig == syscall.SIGHUP:
+					_ = cmd.Process.Signal(sig)
+				}
+			case <-done:
+				return
+			}
+		}
+	}()
+	return func() {
+		signal.Stop(sigs)
+		close(done)
+	}
+}
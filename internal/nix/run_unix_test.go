@@ -0,0 +1,77 @@
+//go:build !windows
+
+package nix
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"syscall"
+	"testing"
+	"time"
+
+	"go.jetpack.io/devbox/internal/boxcli/usererr"
+)
+
+func TestRunScriptKilledBySignal(t *testing.T) {
+	err := RunScript(t.TempDir(), "kill -TERM $$", nil, map[string]string{})
+	var exitErr *usererr.ExitError
+	if !errors.As(err, &exitErr) {
+		t.Fatalf("Got RunScript error %v, want a usererr.ExitError.", err)
+	}
+	if got, want := exitErr.ExitCode(), 128+int(syscall.SIGTERM); got != want {
+		t.Errorf("Got exit code %d, want %d like a shell reports a script killed by SIGTERM.", got, want)
+	}
+}
+
+func TestRunScriptForwardsSignals(t *testing.T) {
+	tests := []struct {
+		name string
+		sig  syscall.Signal
+		opts []RunScriptOption
+	}{
+		{name: "SIGTERM", sig: syscall.SIGTERM},
+		{name: "SIGHUP", sig: syscall.SIGHUP},
+		// With a timeout the script runs in its own process group, where
+		// the terminal's SIGINT can't reach it.
+		{name: "SIGINTOwnProcessGroup", sig: syscall.SIGINT, opts: []RunScriptOption{WithTimeout(time.Minute)}},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			ready := filepath.Join(t.TempDir(), "ready")
+			script := `trap 'exit 7' INT TERM HUP; touch "$READY"; while :; do sleep 0.05; done`
+			errc := make(chan error, 1)
+			go func() {
+				errc <- RunScript(t.TempDir(), script, nil, map[string]string{"READY": ready}, test.opts...)
+			}()
+
+			// Signal devbox itself once the script has set its trap.
+			deadline := time.Now().Add(10 * time.Second)
+			for {
+				if _, err := os.Stat(ready); err == nil {
+					break
+				}
+				if time.Now().After(deadline) {
+					t.Fatal("Timed out waiting for the script to start.")
+				}
+				time.Sleep(10 * time.Millisecond)
+			}
+			if err := syscall.Kill(os.Getpid(), test.sig); err != nil {
+				t.Fatal(err)
+			}
+
+			var exitErr *usererr.ExitError
+			select {
+			case err := <-errc:
+				if !errors.As(err, &exitErr) {
+					t.Fatalf("Got RunScript error %v, want a usererr.ExitError.", err)
+				}
+			case <-time.After(10 * time.Second):
+				t.Fatal("Timed out waiting for the script to exit after it was signaled.")
+			}
+			if got := exitErr.ExitCode(); got != 7 {
+				t.Errorf("Got exit code %d, want 7 from the script's trap.", got)
+			}
+		})
+	}
+}
@@ -0,0 +1,42 @@
+package nix
+
+import (
+	"os"
+	"os/exec"
+	"os/signal"
+	"time"
+)
+
+// setProcessGroup is a no-op on Windows, which doesn't have process groups
+// that can be signaled.
+func setProcessGroup(cmd *exec.Cmd) (restore func()) {
+	return func() {}
+}
+
+// terminateProcessGroup kills cmd. On Windows, processes it started keep
+// running.
+func terminateProcessGroup(cmd *exec.Cmd, gracePeriod time.Duration) (stop func()) {
+	_ = cmd.Process.Kill()
+	return func() {}
+}
+
+// forwardSignals keeps devbox running on Ctrl-C until the returned function is
+// called. Windows sends Ctrl-C to every process attached to the console,
+// including cmd, so there's nothing to forward.
+func forwardSignals(cmd *exec.Cmd) func() {
+	sigs := make(chan os.Signal, 1)
+	signal.Notify(sigs, os.Interrupt)
+	return func() { signal.Stop(sigs) }
+}
+
+// ptyTerminal isn't implemented on Windows, so scripts run without a
+// pseudo-terminal.
+type ptyTerminal struct{}
+
+func attachPTY(cmd *exec.Cmd) (*ptyTerminal, error) {
+	return nil, errPTYUnsupported
+}
+
+func (t *ptyTerminal) relay() func() {
+	return func() {}
+}
@@ -0,0 +1,95 @@
+// Copyright 2023 Jetpack Technologies Inc and contributors. All rights reserved.
+// Use of this source code is governed by the license in the LICENSE file.
+
+package nix
+
+import (
+	"encoding/json"
+	"os/exec"
+	"strings"
+
+	"github.com/pkg/errors"
+	"go.jetpack.io/devbox/internal/debug"
+	"golang.org/x/exp/slices"
+)
+
+// SearchResult is a package that Search found.
+type SearchResult struct {
+	// Package is the package's attribute in nixpkgs, which is what devbox
+	// add takes, such as postgresql_15.
+	Package     string `json:"package"`
+	Name        string `json:"name"`
+	Version     string `json:"version"`
+	Description string `json:"description,omitempty"`
+}
+
+// Search returns the packages in nixpkgs at nixpkgsCommit whose attribute or
+// description matches every word in query. Packages named exactly like the
+// query come first, then the ones whose attribute contains it, and the rest
+// are sorted by attribute.
+func Search(nixpkgsCommit, query string) ([]SearchResult, error) {
+	flake := FlakeNixpkgs(nixpkgsCommit)
+	if nixpkgsCommit == "" {
+		flake = "nixpkgs"
+	}
+	cmd := exec.Command("nix", "search", "--json", flake)
+	cmd.Args = append(cmd.Args, strings.Fields(query)...)
+	cmd.Args = append(cmd.Args, ExperimentalFlags()...)
+	cmd.Env = DefaultEnv()
+	debug.Log("running command: %s\n", cmd)
+	out, err := cmd.Output()
+	var exitErr *exec.ExitError
+	if errors.As(err, &exitErr) && strings.Contains(string(exitErr.Stderr), "no results") {
+		return []SearchResult{}, nil
+	}
+	if err != nil {
+		return nil, errors.Wrapf(err, "Command: %s", cmd)
+	}
+	return parseSearchResults(out, query)
+}
+
+func parseSearchResults(data []byte, query string) ([]SearchResult, error) {
+	var raw map[string]struct {
+		Pname       string `json:"pname"`
+		Version     string `json:"version"`
+		Description string `json:"description"`
+	}
+	if err := json.Unmarshal(data, &raw); err != nil {
+		return nil, errors.WithStack(err)
+	}
+
+	results := make([]SearchResult, 0, len(raw))
+	for key, r := range raw {
+		// Keys look like legacyPackages.x86_64-linux.postgresql_15.
+		attribute := key
+		if parts := strings.SplitN(key, ".", 3); len(parts) == 3 && parts[0] == "legacyPackages" {
+			attribute = parts[2]
+		}
+		results = append(results, SearchResult{
+			Package:     attribute,
+			Name:        r.Pname,
+			Version:     r.Version,
+			Description: r.Description,
+		})
+	}
+
+	query = strings.ToLower(strings.TrimSpace(query))
+	rank := func(r SearchResult) int {
+		attribute := strings.ToLower(r.Package)
+		switch {
+		case attribute == query:
+			return 0
+		case strings.Contains(attribute, query):
+			return 1
+		default:
+			return 2
+		}
+	}
+	slices.SortFunc(results, func(a, b SearchResult) bool {
+		if ra, rb := rank(a), rank(b); ra != rb {
+			return ra < rb
+		}
+		return a.Package < b.Package
+	})
+	return results, nil
+}
@@ -0,0 +1,36 @@
+package nix
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestParseSearchResults(t *testing.T) {
+	data := []byte(`{
+		"legacyPackages.x86_64-linux.pgcli": {"pname": "pgcli", "version": "3.5.0", "description": "Command-line interface for PostgreSQL"},
+		"legacyPackages.x86_64-linux.postgresql_15": {"pname": "postgresql", "version": "15.3", "description": "A powerful, open source object-relational database system"},
+		"legacyPackages.x86_64-linux.postgresql": {"pname": "postgresql", "version": "14.8", "description": "A powerful, open source object-relational database system"},
+		"legacyPackages.x86_64-linux.python310Packages.psycopg2": {"pname": "psycopg2", "version": "2.9.6", "description": "PostgreSQL database adapter for the Python programming language"}
+	}`)
+	results, err := parseSearchResults(data, "postgresql")
+	if err != nil {
+		t.Fatal(err)
+	}
+	got := []string{}
+	for _, r := range results {
+		got = append(got, r.Package)
+	}
+	want := []string{"postgresql", "postgresql_15", "pgcli", "python310Packages.psycopg2"}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("Got packages %v, want %v", got, want)
+	}
+	wantFirst := SearchResult{
+		Package:     "postgresql",
+		Name:        "postgresql",
+		Version:     "14.8",
+		Description: "A powerful, open source object-relational database system",
+	}
+	if results[0] != wantFirst {
+		t.Errorf("Got first result %+v, want %+v", results[0], wantFirst)
+	}
+}
@@ -30,7 +30,9 @@ var shellrcTmpl = template.Must(template.New("shellrc").Parse(shellrcText))
 
 //go:embed shellrc_fish.tmpl
 var fishrcText string
-var fishrcTmpl = template.Must(template.New("shellrc_fish").Parse(fishrcText))
+var fishrcTmpl = template.Must(template.New("shellrc_fish").
+	Funcs(template.FuncMap{"fishquote": fishQuote}).
+	Parse(fishrcText))
 
 type name string
 
@@ -63,6 +65,15 @@ type DevboxShell struct {
 
 	// UserInitHook contains commands that will run at shell startup.
 	UserInitHook string
+	// UserPreInitHook contains commands that run at shell startup before
+	// devbox sets up the shell's environment.
+	UserPreInitHook string
+	// UserShellHook contains commands that run after UserInitHook, but only
+	// in interactive shells.
+	UserShellHook string
+	// UserRunHook contains commands that run after UserInitHook, but only in
+	// shells that run a script.
+	UserRunHook string
 
 	ScriptName    string
 	ScriptCommand string
@@ -73,30 +84,52 @@ type DevboxShell struct {
 
 	// shellStartTime is the unix timestamp for when the command was invoked
 	shellStartTime string
+
+	// terminalTitle is the title to give the terminal window (and the tmux or
+	// screen window) of an interactive shell. It's empty if disabled.
+	terminalTitle string
+
+	// inheritRC sources the user's shellrc after the environment is set up
+	// instead of before it.
+	inheritRC bool
+
+	// offline keeps nix from downloading anything while the shell starts.
+	offline bool
+
+	// promptPrefix is prepended to the prompt of interactive shells. If
+	// it's nil, DefaultPromptPrefix is used. If it's empty, the prompt
+	// isn't changed.
+	promptPrefix *string
 }
 
+// DefaultPromptPrefix is prepended to the prompt of devbox shells unless
+// WithPromptPrefix sets a different one.
+const DefaultPromptPrefix = "(devbox)"
+
 type ShellOption func(*DevboxShell)
 
 // NewDevboxShell initializes the DevboxShell struct so it can be used to start a shell environment
 // for the devbox project.
 func NewDevboxShell(nixpkgsCommitHash string, opts ...ShellOption) (*DevboxShell, error) {
-	shPath, err := shellPath(nixpkgsCommitHash)
-	if err != nil {
-		return nil, err
-	}
-	sh := initShellBinaryFields(shPath)
-
+	sh := &DevboxShell{}
 	for _, opt := range opts {
 		opt(sh)
 	}
 
+	shPath, err := shellPath(nixpkgsCommitHash, sh.offline)
+	if err != nil {
+		return nil, err
+	}
+	sh.initShellBinaryFields(shPath)
+
 	debug.Log("Recognized shell as: %s", sh.binPath)
 	debug.Log("Looking for user's shell init file at: %s", sh.userShellrcPath)
 	return sh, nil
 }
 
-// shellPath returns the path to a shell binary, or error if none found.
-func shellPath(nixpkgsCommitHash string) (path string, err error) {
+// shellPath returns the path to a shell binary, or error if none found. If
+// offline is true, nix doesn't download bash if it isn't in the store yet.
+func shellPath(nixpkgsCommitHash string, offline bool) (path string, err error) {
 	defer func() {
 		if err != nil {
 			path = filepath.Clean(path)
@@ -119,6 +152,9 @@ func shellPath(nixpkgsCommitHash string) (path string, err error) {
 			fmt.Sprintf("%s#bash", FlakeNixpkgs(nixpkgsCommitHash)),
 		)
 		cmd.Args = append(cmd.Args, ExperimentalFlags()...)
+		if offline {
+			cmd.Args = append(cmd.Args, "--offline")
+		}
 		out, err := cmd.Output()
 		if err != nil {
 			return "", errors.WithStack(err)
@@ -157,9 +193,8 @@ func shellPath(nixpkgsCommitHash string) (path string, err error) {
 
 // initShellBinaryFields initializes the fields specific to the shell binary that will be used
 // for the devbox shell.
-func initShellBinaryFields(path string) *DevboxShell {
-
-	shell := &DevboxShell{binPath: path}
+func (s *DevboxShell) initShellBinaryFields(path string) {
+	s.binPath = path
 	base := filepath.Base(path)
 	// Login shell
 	if base[0] == '-' {
@@ -167,30 +202,29 @@ func initShellBinaryFields(path string) *DevboxShell {
 	}
 	switch base {
 	case "bash":
-		shell.name = shBash
-		shell.userShellrcPath = rcfilePath(".bashrc")
+		s.name = shBash
+		s.userShellrcPath = rcfilePath(".bashrc")
 	case "zsh":
-		shell.name = shZsh
-		shell.userShellrcPath = rcfilePath(".zshrc")
+		s.name = shZsh
+		s.userShellrcPath = rcfilePath(".zshrc")
 	case "ksh":
-		shell.name = shKsh
-		shell.userShellrcPath = rcfilePath(".kshrc")
+		s.name = shKsh
+		s.userShellrcPath = rcfilePath(".kshrc")
 	case "fish":
-		shell.name = shFish
-		shell.userShellrcPath = fishConfig()
+		s.name = shFish
+		s.userShellrcPath = fishConfig()
 	case "dash", "ash", "shell":
-		shell.name = shPosix
-		shell.userShellrcPath = os.Getenv("ENV")
+		s.name = shPosix
+		s.userShellrcPath = os.Getenv("ENV")
 
 		// Just make up a name if there isn't already an init file set
 		// so we have somewhere to put a new one.
-		if shell.userShellrcPath == "" {
-			shell.userShellrcPath = ".shinit"
+		if s.userShellrcPath == "" {
+			s.userShellrcPath = ".shinit"
 		}
 	default:
-		shell.name = shUnknown
+		s.name = shUnknown
 	}
-	return shell
 }
 
 // If/once we end up making plugins the same as devbox.json we probably want
@@ -248,6 +282,41 @@ func WithShellStartTime(time string) ShellOption {
 	}
 }
 
+// WithTerminalTitle sets the title of the terminal window and, when running
+// inside tmux or screen, the name of the current window.
+func WithTerminalTitle(title string) ShellOption {
+	return func(s *DevboxShell) {
+		s.terminalTitle = title
+	}
+}
+
+// WithPromptPrefix prepends prefix, followed by a space, to the user's prompt
+// instead of DefaultPromptPrefix. If prefix is empty, the prompt isn't
+// changed.
+func WithPromptPrefix(prefix string) ShellOption {
+	return func(s *DevboxShell) {
+		s.promptPrefix = &prefix
+	}
+}
+
+// WithInheritRC sources the user's shellrc after devbox sets up the
+// environment, so that its aliases and functions can use the project's
+// packages. The shellrc can't change PATH. Fish always loads the user's
+// config itself, so this has no effect on it.
+func WithInheritRC() ShellOption {
+	return func(s *DevboxShell) {
+		s.inheritRC = true
+	}
+}
+
+// WithOffline makes the shell start without nix downloading anything. If it
+// needs something that isn't in the nix store yet, it fails instead.
+func WithOffline() ShellOption {
+	return func(s *DevboxShell) {
+		s.offline = true
+	}
+}
+
 // rcfilePath returns the absolute path for an rcfile, which is usually in the
 // user's home directory. It doesn't guarantee that the file exists.
 func rcfilePath(basename string) string {
@@ -486,45 +555,84 @@ func (s *DevboxShell) writeDevboxShellrc() (path string, err error) {
 			if !ok {
 				continue
 			}
+			if s.name == shFish {
+				// fish's export splits PATH-like variables on colons,
+				// like other shells expect.
+				fmt.Fprintf(&strb, "export %s=%s\n", k, fishQuote(v))
+				continue
+			}
 			strb.WriteString("export ")
 			strb.WriteString(k)
 			strb.WriteString(`="`)
-			for _, r := range v {
-				switch r {
-				// Special characters inside double quotes:
-				// https://pubs.opengroup.org/onlinepubs/009604499/utilities/xcu_chap02.html#tag_02_02_03
-				case '$', '`', '"', '\\', '\n':
-					strb.WriteRune('\\')
-				}
-				strb.WriteRune(r)
-			}
+			strb.WriteString(escapeDoubleQuoted(v))
 			strb.WriteString("\"\n")
 		}
 		exportEnv = strings.TrimSpace(strb.String())
 	}
 
+	// Local shellrc snippets only customize interactive shells, so they're
+	// left out when the shell is running a script.
+	localShellrcs := []string{}
+	terminalTitle := ""
+	shellHook, runHook := "", strings.TrimSpace(s.UserRunHook)
+	if s.ScriptCommand == "" {
+		shellHook, runHook = strings.TrimSpace(s.UserShellHook), ""
+		localShellrcs = s.localShellrcPaths()
+		if s.terminalTitle != "" {
+			terminalTitle = shellescape.Quote(s.terminalTitle)
+		}
+	}
+
+	promptPrefix := DefaultPromptPrefix
+	if s.promptPrefix != nil {
+		promptPrefix = *s.promptPrefix
+	}
+	if promptPrefix != "" {
+		if s.name == shFish {
+			promptPrefix = fishQuote(promptPrefix)
+		} else {
+			// The template puts the prefix in double quotes so that
+			// the user's $PS1 is expanded after it.
+			promptPrefix = escapeDoubleQuoted(promptPrefix)
+		}
+	}
+
 	err = tmpl.Execute(shellrcf, struct {
 		ProjectDir       string
 		OriginalInit     string
 		OriginalInitPath string
 		UserHook         string
+		PreInitHook      string
+		ShellHook        string
+		RunHook          string
 		PluginInitHook   string
 		PathPrepend      string
 		ScriptCommand    string
 		ShellStartTime   string
 		HistoryFile      string
 		ExportEnv        string
+		LocalShellrcs    []string
+		TerminalTitle    string
+		InheritRC        bool
+		PromptPrefix     string
 	}{
 		ProjectDir:       s.projectDir,
 		OriginalInit:     string(bytes.TrimSpace(userShellrc)),
 		OriginalInitPath: s.userShellrcPath,
 		UserHook:         strings.TrimSpace(s.UserInitHook),
+		PreInitHook:      strings.TrimSpace(s.UserPreInitHook),
+		ShellHook:        shellHook,
+		RunHook:          runHook,
 		PluginInitHook:   strings.TrimSpace(s.pluginInitHook),
 		PathPrepend:      pathPrepend,
 		ScriptCommand:    strings.TrimSpace(s.ScriptCommand),
 		ShellStartTime:   s.shellStartTime,
 		HistoryFile:      strings.TrimSpace(s.historyFile),
 		ExportEnv:        exportEnv,
+		LocalShellrcs:    localShellrcs,
+		TerminalTitle:    terminalTitle,
+		InheritRC:        s.inheritRC,
+		PromptPrefix:     promptPrefix,
 	})
 	if err != nil {
 		return "", fmt.Errorf("execute shellrc template: %v", err)
@@ -534,6 +642,51 @@ func (s *DevboxShell) writeDevboxShellrc() (path string, err error) {
 	return path, nil
 }
 
+// escapeDoubleQuoted escapes the characters that are special inside double
+// quotes in POSIX shells, so that s can be put inside them as is.
+func escapeDoubleQuoted(s string) string {
+	strb := strings.Builder{}
+	for _, r := range s {
+		switch r {
+		// Special characters inside double quotes:
+		// https://pubs.opengroup.org/onlinepubs/009604499/utilities/xcu_chap02.html#tag_02_02_03
+		case '$', '`', '"', '\\', '\n':
+			strb.WriteRune('\\')
+		}
+		strb.WriteRune(r)
+	}
+	return strb.String()
+}
+
+// fishQuote quotes s as a single fish argument. Inside single quotes, fish
+// only treats backslashes and single quotes specially.
+func fishQuote(s string) string {
+	s = strings.ReplaceAll(s, `\`, `\\`)
+	s = strings.ReplaceAll(s, `'`, `\'`)
+	return "'" + s + "'"
+}
+
+// localShellrcPaths returns the per-user shellrc snippets that exist for this
+// shell, in the order they should be sourced. The user-wide file in
+// ~/.config/devbox comes first so that the project's git-ignored
+// .devbox/shell.local.sh has the last say. Fish can't source POSIX shell
+// scripts, so it uses files with a .fish extension instead.
+func (s *DevboxShell) localShellrcPaths() []string {
+	userPath := xdg.DevboxConfigSubpath("shellrc")
+	projectPath := filepath.Join(s.projectDir, ".devbox/shell.local.sh")
+	if s.name == shFish {
+		userPath += ".fish"
+		projectPath = filepath.Join(s.projectDir, ".devbox/shell.local.fish")
+	}
+	paths := []string{}
+	for _, path := range []string{userPath, projectPath} {
+		if _, err := os.Stat(path); err == nil {
+			paths = append(paths, path)
+		}
+	}
+	return paths
+}
+
 // linkShellStartupFiles will link files used by the shell for initialization.
 // We choose to link instead of copy so that changes made outside can be reflected
 // within the devbox shell.
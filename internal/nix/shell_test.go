@@ -136,3 +136,366 @@ func TestCleanEnvPath(t *testing.T) {
 		})
 	}
 }
+
+func TestWriteDevboxShellrcLocalShellrc(t *testing.T) {
+	configDir := t.TempDir()
+	t.Setenv("XDG_CONFIG_HOME", configDir)
+	userShellrc := filepath.Join(configDir, "devbox/shellrc")
+	projectDir := t.TempDir()
+	localShellrc := filepath.Join(projectDir, ".devbox/shell.local.sh")
+	for _, path := range []string{userShellrc, localShellrc} {
+		if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(path, []byte("echo local\n"), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	s := &DevboxShell{
+		name:         shBash,
+		projectDir:   projectDir,
+		UserInitHook: "echo hook",
+		profileDir:   "./.devbox/profile",
+	}
+	gotPath, err := s.writeDevboxShellrc()
+	if err != nil {
+		t.Fatal("Got writeDevboxShellrc error:", err)
+	}
+	b, err := os.ReadFile(gotPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	shellrc := string(b)
+	hook := strings.Index(shellrc, "echo hook")
+	user := strings.Index(shellrc, `. "`+userShellrc+`"`)
+	local := strings.LastIndex(shellrc, `. "`+localShellrc+`"`)
+	if hook < 0 || user < 0 || local < 0 {
+		t.Fatalf("Generated shellrc is missing the hook or local shellrcs:\n%s", shellrc)
+	}
+	if !(hook < user && user < local) {
+		t.Errorf("Got local shellrcs sourced out of order, want user hook, then %s, then %s last:\n%s",
+			userShellrc, localShellrc, shellrc)
+	}
+
+	// Scripts run non-interactively, so they shouldn't source the local
+	// shellrcs.
+	s.ScriptCommand = "echo script"
+	gotPath, err = s.writeDevboxShellrc()
+	if err != nil {
+		t.Fatal("Got writeDevboxShellrc error:", err)
+	}
+	b, err = os.ReadFile(gotPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if strings.Contains(string(b), localShellrc) {
+		t.Errorf("Got local shellrc sourced in a script shell:\n%s", b)
+	}
+}
+
+func TestWriteDevboxShellrcHooks(t *testing.T) {
+	for _, shell := range []name{shBash, shFish} {
+		t.Run(string(shell), func(t *testing.T) {
+			s := &DevboxShell{
+				name:            shell,
+				projectDir:      t.TempDir(),
+				UserInitHook:    "echo init",
+				UserPreInitHook: "echo pre-init",
+				UserShellHook:   "echo shell",
+				UserRunHook:     "echo run",
+				profileDir:      "./.devbox/profile",
+			}
+			for _, script := range []string{"", "echo script"} {
+				s.ScriptCommand = script
+				gotPath, err := s.writeDevboxShellrc()
+				if err != nil {
+					t.Fatal("Got writeDevboxShellrc error:", err)
+				}
+				b, err := os.ReadFile(gotPath)
+				if err != nil {
+					t.Fatal(err)
+				}
+				shellrc := string(b)
+
+				want := []string{"echo pre-init", "Devbox Post-init Hook", "echo init", "echo shell"}
+				unwanted := "echo run"
+				if script != "" {
+					want[3], unwanted = "echo run", "echo shell"
+				}
+				last := -1
+				for _, w := range want {
+					i := strings.Index(shellrc, w)
+					if i <= last {
+						t.Fatalf("Got %q missing or out of order, want %q:\n%s", w, want, shellrc)
+					}
+					last = i
+				}
+				if strings.Contains(shellrc, unwanted) {
+					t.Errorf("Got %q in shellrc with ScriptCommand %q:\n%s", unwanted, script, shellrc)
+				}
+			}
+		})
+	}
+}
+
+func TestWriteDevboxShellrcTerminalTitle(t *testing.T) {
+	tests := []struct {
+		name          string
+		shell         name
+		terminalTitle string
+		scriptCommand string
+		want          []string
+	}{
+		{
+			name:          "Bash",
+			shell:         shBash,
+			terminalTitle: "my project",
+			want: []string{
+				`printf '\033]0;%s\007' 'my project'`,
+				`tmux rename-window 'my project'`,
+			},
+		},
+		{
+			name:          "Fish",
+			shell:         shFish,
+			terminalTitle: "my project",
+			want: []string{
+				"function fish_title\n        echo 'my project'",
+				`tmux rename-window 'my project'`,
+			},
+		},
+		{
+			name:  "Disabled",
+			shell: shBash,
+		},
+		{
+			name:          "Script",
+			shell:         shBash,
+			terminalTitle: "my project",
+			scriptCommand: "echo script",
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			s := &DevboxShell{
+				name:          test.shell,
+				projectDir:    "path/to/projectDir",
+				profileDir:    "./.devbox/profile",
+				terminalTitle: test.terminalTitle,
+				ScriptCommand: test.scriptCommand,
+			}
+			gotPath, err := s.writeDevboxShellrc()
+			if err != nil {
+				t.Fatal("Got writeDevboxShellrc error:", err)
+			}
+			b, err := os.ReadFile(gotPath)
+			if err != nil {
+				t.Fatal(err)
+			}
+			shellrc := string(b)
+			if len(test.want) == 0 && strings.Contains(shellrc, "rename-window") {
+				t.Errorf("Got terminal title in shellrc, want none:\n%s", shellrc)
+			}
+			for _, want := range test.want {
+				if !strings.Contains(shellrc, want) {
+					t.Errorf("Got shellrc without %q:\n%s", want, shellrc)
+				}
+			}
+		})
+	}
+}
+
+func TestWriteDevboxShellrcPromptPrefix(t *testing.T) {
+	prefix := func(p string) *string { return &p }
+	tests := []struct {
+		name         string
+		shell        name
+		promptPrefix *string
+		want         string
+	}{
+		{
+			name:  "Default",
+			shell: shBash,
+			want:  `export PS1="(devbox) $PS1"`,
+		},
+		{
+			name:         "Custom",
+			shell:        shBash,
+			promptPrefix: prefix(`\[\e[32m\]$project\[\e[0m\]`),
+			want:         `export PS1="\\[\\e[32m\\]\$project\\[\\e[0m\\] $PS1"`,
+		},
+		{
+			name:         "Disabled",
+			shell:        shBash,
+			promptPrefix: prefix(""),
+		},
+		{
+			name:         "Fish",
+			shell:        shFish,
+			promptPrefix: prefix("📦 it's devbox"),
+			want:         `echo '📦 it\'s devbox' (__devbox_fish_prompt_orig)`,
+		},
+		{
+			name:         "FishDisabled",
+			shell:        shFish,
+			promptPrefix: prefix(""),
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			s := &DevboxShell{
+				name:         test.shell,
+				projectDir:   "path/to/projectDir",
+				profileDir:   "./.devbox/profile",
+				promptPrefix: test.promptPrefix,
+			}
+			gotPath, err := s.writeDevboxShellrc()
+			if err != nil {
+				t.Fatal("Got writeDevboxShellrc error:", err)
+			}
+			b, err := os.ReadFile(gotPath)
+			if err != nil {
+				t.Fatal(err)
+			}
+			shellrc := string(b)
+			if test.want == "" {
+				if strings.Contains(shellrc, "PS1") || strings.Contains(shellrc, "fish_prompt") {
+					t.Errorf("Got prompt prefix in shellrc, want none:\n%s", shellrc)
+				}
+				return
+			}
+			if !strings.Contains(shellrc, test.want) {
+				t.Errorf("Got shellrc without %q:\n%s", test.want, shellrc)
+			}
+		})
+	}
+}
+
+func TestWriteDevboxShellrcInheritRC(t *testing.T) {
+	userShellrc := filepath.Join(t.TempDir(), ".bashrc")
+	if err := os.WriteFile(userShellrc, []byte("alias ll='ls -l'\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	sourceRC := `. "` + userShellrc + `"`
+
+	for _, inheritRC := range []bool{false, true} {
+		s := &DevboxShell{
+			name:            shBash,
+			projectDir:      "path/to/projectDir",
+			profileDir:      "./.devbox/profile",
+			userShellrcPath: userShellrc,
+			inheritRC:       inheritRC,
+		}
+		gotPath, err := s.writeDevboxShellrc()
+		if err != nil {
+			t.Fatal("Got writeDevboxShellrc error:", err)
+		}
+		b, err := os.ReadFile(gotPath)
+		if err != nil {
+			t.Fatal(err)
+		}
+		shellrc := string(b)
+		if strings.Count(shellrc, sourceRC) != 1 {
+			t.Fatalf("Got shellrc that doesn't source %s exactly once:\n%s", userShellrc, shellrc)
+		}
+
+		// The user's shellrc runs before devbox sets PATH by default, and
+		// after it with inheritRC, in which case PATH is restored.
+		rc := strings.Index(shellrc, sourceRC)
+		path := strings.Index(shellrc, `PATH="./.devbox/profile/bin:$PATH"`)
+		if !inheritRC && rc > path {
+			t.Errorf("Got user shellrc sourced after PATH is set, want before:\n%s", shellrc)
+		}
+		if inheritRC {
+			restore := strings.Index(shellrc, `PATH="$__devbox_path"`)
+			prompt := strings.Index(shellrc, `export PS1=`)
+			if !(path < rc && rc < restore && restore < prompt) {
+				t.Errorf("Got user shellrc sourced out of order, want it after PATH is set "+
+					"and before PATH is restored and the prompt is set:\n%s", shellrc)
+			}
+		}
+	}
+}
+
+func TestWriteDevboxShellrcHistoryFile(t *testing.T) {
+	s := &DevboxShell{
+		name:        shBash,
+		projectDir:  "path/to/projectDir",
+		profileDir:  "./.devbox/profile",
+		historyFile: "path/to/projectDir/.devbox/shell_history",
+	}
+	gotPath, err := s.writeDevboxShellrc()
+	if err != nil {
+		t.Fatal("Got writeDevboxShellrc error:", err)
+	}
+	b, err := os.ReadFile(gotPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	shellrc := string(b)
+	for _, want := range []string{
+		`HISTFILE="path/to/projectDir/.devbox/shell_history"`,
+		"shopt -s histappend",
+		`PROMPT_COMMAND="history -a${PROMPT_COMMAND:+; $PROMPT_COMMAND}"`,
+		"setopt APPEND_HISTORY INC_APPEND_HISTORY",
+	} {
+		if !strings.Contains(shellrc, want) {
+			t.Errorf("Got shellrc without %q:\n%s", want, shellrc)
+		}
+	}
+
+	// Without a history file, the shell's own history settings are left
+	// alone.
+	s.historyFile = ""
+	gotPath, err = s.writeDevboxShellrc()
+	if err != nil {
+		t.Fatal("Got writeDevboxShellrc error:", err)
+	}
+	b, err = os.ReadFile(gotPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if strings.Contains(string(b), "HISTFILE") || strings.Contains(string(b), "histappend") {
+		t.Errorf("Got shellrc that sets up history without a history file:\n%s", b)
+	}
+}
+
+func TestWriteDevboxShellrcFish(t *testing.T) {
+	t.Setenv("DEVBOX_FEATURE_UNIFIED_ENV", "1")
+	s := &DevboxShell{
+		name:       shFish,
+		projectDir: "path/to/projectDir",
+		profileDir: "./.devbox/profile",
+		env: []string{
+			"PATH=/nix/store/abc-go/bin:/usr/bin",
+			`quote=they said, 'lasers' \o/`,
+		},
+		UserInitHook:   `export GOPATH="$PWD/.go"`,
+		pluginInitHook: `echo "Welcome to the devbox!"`,
+		ScriptCommand:  "echo 'script'",
+	}
+	gotPath, err := s.writeDevboxShellrc()
+	if err != nil {
+		t.Fatal("Got writeDevboxShellrc error:", err)
+	}
+	b, err := os.ReadFile(gotPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	shellrc := string(b)
+	for _, want := range []string{
+		`export PATH='/nix/store/abc-go/bin:/usr/bin'`,
+		`export quote='they said, \'lasers\' \\o/'`,
+		`sh -c 'export GOPATH="$PWD/.go"'`,
+		`sh -c 'echo "Welcome to the devbox!"'`,
+		`sh -c 'echo \'script\''`,
+	} {
+		if !strings.Contains(shellrc, want) {
+			t.Errorf("Got fish shellrc without %q:\n%s", want, shellrc)
+		}
+	}
+	if strings.Contains(shellrc, "$shellHook") {
+		t.Errorf("Got fish shellrc that evaluates the bash shellHook:\n%s", shellrc)
+	}
+}
@@ -0,0 +1,24 @@
+// Copyright 2023 Jetpack Technologies Inc and contributors. All rights reserved.
+// Use of this source code is governed by the license in the LICENSE file.
+
+package nix
+
+import "runtime"
+
+// Systems are the nix systems that devbox runs on.
+var Systems = []string{"aarch64-darwin", "aarch64-linux", "x86_64-darwin", "x86_64-linux"}
+
+// System returns the nix system of the current machine, such as x86_64-linux
+// or aarch64-darwin.
+func System() string {
+	arch := runtime.GOARCH
+	switch arch {
+	case "amd64":
+		arch = "x86_64"
+	case "arm64":
+		arch = "aarch64"
+	case "386":
+		arch = "i686"
+	}
+	return arch + "-" + runtime.GOOS
+}
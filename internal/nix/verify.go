@@ -0,0 +1,71 @@
+// Copyright 2023 Jetpack Technologies Inc and contributors. All rights reserved.
+// Use of this source code is governed by the license in the LICENSE file.
+
+package nix
+
+import (
+	"bytes"
+	"os/exec"
+	"regexp"
+	"strings"
+
+	"github.com/pkg/errors"
+	"go.jetpack.io/devbox/internal/debug"
+)
+
+// VerifyResult lists the store paths that failed verification.
+type VerifyResult struct {
+	// Untrusted paths aren't signed by any of the trusted public keys.
+	Untrusted []string
+	// Corrupted paths don't match the hash they were registered with.
+	Corrupted []string
+}
+
+// OK reports whether every path passed verification.
+func (r *VerifyResult) OK() bool {
+	return len(r.Untrusted) == 0 && len(r.Corrupted) == 0
+}
+
+// VerifySignatures runs nix store verify on paths to check that each one is
+// signed by a trusted public key. If trustedKeys is empty, nix's configured
+// trusted-public-keys are used. Paths built locally are always trusted.
+func VerifySignatures(paths []string, trustedKeys []string) (*VerifyResult, error) {
+	cmd := exec.Command("nix", "store", "verify", "--no-contents")
+	if len(trustedKeys) > 0 {
+		cmd.Args = append(cmd.Args, "--option", "trusted-public-keys", strings.Join(trustedKeys, " "))
+	}
+	cmd.Args = append(cmd.Args, ExperimentalFlags()...)
+	cmd.Args = append(cmd.Args, paths...)
+	cmd.Env = DefaultEnv()
+	var stderr bytes.Buffer
+	cmd.Stderr = &stderr
+	debug.Log("Running cmd: %s\n", cmd)
+	err := cmd.Run()
+
+	result := parseVerifyOutput(stderr.String())
+	var exitErr *exec.ExitError
+	if err != nil && (!errors.As(err, &exitErr) || result.OK()) {
+		// nix store verify exits with an error when a path fails
+		// verification, so it's only a real error if no path was reported.
+		return nil, errors.Wrapf(err, "Command: %s: %s", cmd, stderr.String())
+	}
+	return result, nil
+}
+
+var (
+	untrustedPathRe = regexp.MustCompile(`path '([^']+)' is untrusted`)
+	corruptedPathRe = regexp.MustCompile(`path '([^']+)' was modified`)
+)
+
+// parseVerifyOutput parses the paths that failed verification from the stderr
+// of nix store verify.
+func parseVerifyOutput(stderr string) *VerifyResult {
+	result := &VerifyResult{}
+	for _, match := range untrustedPathRe.FindAllStringSubmatch(stderr, -1) {
+		result.Untrusted = append(result.Untrusted, match[1])
+	}
+	for _, match := range corruptedPathRe.FindAllStringSubmatch(stderr, -1) {
+		result.Corrupted = append(result.Corrupted, match[1])
+	}
+	return result
+}
@@ -0,0 +1,24 @@
+// Copyright 2023 Jetpack Technologies Inc and contributors. All rights reserved.
+// Use of this source code is governed by the license in the LICENSE file.
+
+package nix
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestParseVerifyOutput(t *testing.T) {
+	stderr := `error: path '/nix/store/abc-hello-2.12.1' is untrusted
+error: path '/nix/store/def-jq-1.6' was modified! expected hash 'sha256:aaa', got 'sha256:bbb'
+error: path '/nix/store/ghi-glibc-2.35' is untrusted
+3 paths checked, 2 untrusted, 1 corrupted
+`
+	result := parseVerifyOutput(stderr)
+	assert.Equal(t, []string{"/nix/store/abc-hello-2.12.1", "/nix/store/ghi-glibc-2.35"}, result.Untrusted)
+	assert.Equal(t, []string{"/nix/store/def-jq-1.6"}, result.Corrupted)
+	assert.False(t, result.OK())
+
+	assert.True(t, parseVerifyOutput("3 paths checked\n").OK())
+}
@@ -4,14 +4,17 @@
 package plansdk
 
 import (
+	"encoding/json"
 	"fmt"
 	"net/http"
 	"os"
+	"path/filepath"
 	"time"
 
 	"github.com/imdario/mergo"
 	"go.jetpack.io/devbox/internal/cuecfg"
 	"go.jetpack.io/devbox/internal/pkgslice"
+	"go.jetpack.io/devbox/internal/xdg"
 )
 
 type PlanError struct {
@@ -38,6 +41,31 @@ type ShellPlan struct {
 	// GeneratedFiles is a map of name => content for files that should be generated
 	// in the .devbox/gen directory. (Use string to make it marshalled version nicer.)
 	GeneratedFiles map[string]string `json:"generated_files,omitempty"`
+	// RestrictUnfree only allows the unfree packages in UnfreePackages,
+	// instead of allowing all unfree packages. Set by devbox.json.
+	RestrictUnfree bool     `json:"restrict_unfree,omitempty"`
+	UnfreePackages []string `cue:"[...string]" json:"unfree_packages,omitempty"`
+	// PinnedPackages come from their own nixpkgs instead of NixpkgsInfo.
+	// Set by devbox.json.
+	PinnedPackages []PinnedPackage `json:"pinned_packages,omitempty"`
+}
+
+// PinnedPackage is a package attribute and the nixpkgs it comes from.
+type PinnedPackage struct {
+	Attribute  string `json:"attribute"`
+	Commit     string `json:"commit"`
+	NixpkgsURL string `json:"nixpkgs_url"`
+}
+
+// PinnedNixpkgs returns the URL of each nixpkgs commit that PinnedPackages
+// come from, keyed by commit. flake.nix makes each of them an input, so that
+// flake.lock records its hash.
+func (p *ShellPlan) PinnedNixpkgs() map[string]string {
+	nixpkgs := map[string]string{}
+	for _, pkg := range p.PinnedPackages {
+		nixpkgs[pkg.Commit] = pkg.NixpkgsURL
+	}
+	return nixpkgs
 }
 
 type Planner interface {
@@ -94,7 +122,7 @@ type NixpkgsInfo struct {
 const DefaultNixpkgsCommit = "f80ac848e3d6f0c12c52758c0f25c10c97ca3b62"
 
 func GetNixpkgsInfo(commitHash string) (*NixpkgsInfo, error) {
-	mirror := nixpkgsMirrorURL(commitHash)
+	mirror := nixpkgsMirrorURL(commitHash, mirrorHasTarball)
 	if mirror != "" {
 		return &NixpkgsInfo{
 			URL: mirror,
@@ -105,19 +133,59 @@ func GetNixpkgsInfo(commitHash string) (*NixpkgsInfo, error) {
 	}, nil
 }
 
-func nixpkgsMirrorURL(commitHash string) string {
+// nixpkgsMirrorURL returns the Devbox Cloud mirror's URL for a nixpkgs commit,
+// or "" if there's no mirror or hasTarball reports that it doesn't have the
+// commit.
+func nixpkgsMirrorURL(commitHash string, hasTarball func(mirrorURL string) bool) string {
 	// Use DEVBOX_REGION as a hint to see if we're in Devbox Cloud.
 	if os.Getenv("DEVBOX_REGION") == "" {
 		return ""
 	}
 
-	// Check that the mirror is responsive and has the tar file. We can't
-	// leave this up to Nix because fetchTarball will retry indefinitely.
-	client := &http.Client{Timeout: 3 * time.Second}
+	// Mirrors that were found before are cached, so that devbox doesn't
+	// need the network to find them again, such as in an offline shell.
+	mirrors := readNixpkgsMirrors()
+	if mirrorURL, ok := mirrors[commitHash]; ok {
+		return mirrorURL
+	}
 	mirrorURL := fmt.Sprintf("http://[fdaa:0:a780:0:1::2]:8081/nixos/nixpkgs/archive/%s.tar.gz", commitHash)
-	resp, err := client.Head(mirrorURL)
-	if err != nil || resp.StatusCode != http.StatusOK {
+	if !hasTarball(mirrorURL) {
 		return ""
 	}
+	mirrors[commitHash] = mirrorURL
+	if data, err := json.Marshal(mirrors); err == nil {
+		_ = os.MkdirAll(filepath.Dir(nixpkgsMirrorsPath()), 0o755)
+		_ = os.WriteFile(nixpkgsMirrorsPath(), data, 0o644)
+	}
 	return mirrorURL
 }
+
+// mirrorHasTarball checks that the mirror is responsive and has the tar file.
+// We can't leave this up to Nix because fetchTarball will retry indefinitely.
+func mirrorHasTarball(mirrorURL string) bool {
+	client := &http.Client{Timeout: 3 * time.Second}
+	resp, err := client.Head(mirrorURL)
+	if err != nil {
+		return false
+	}
+	resp.Body.Close()
+	return resp.StatusCode == http.StatusOK
+}
+
+// nixpkgsMirrorsPath is where the nixpkgs mirror URLs are cached, keyed by
+// commit.
+func nixpkgsMirrorsPath() string {
+	return xdg.DevboxCacheSubpath("nixpkgs-mirrors.json")
+}
+
+func readNixpkgsMirrors() map[string]string {
+	mirrors := map[string]string{}
+	data, err := os.ReadFile(nixpkgsMirrorsPath())
+	if err != nil {
+		return mirrors
+	}
+	if err := json.Unmarshal(data, &mirrors); err != nil {
+		return map[string]string{}
+	}
+	return mirrors
+}
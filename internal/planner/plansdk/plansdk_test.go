@@ -70,3 +70,32 @@ func TestMergeShellPlans(t *testing.T) {
 	assert.NoError(t, err)
 	assert.Equal(t, expected, actual)
 }
+
+func TestNixpkgsMirrorCache(t *testing.T) {
+	t.Setenv("XDG_CACHE_HOME", t.TempDir())
+	t.Setenv("DEVBOX_REGION", "sjc")
+
+	const commit = "f80ac848e3d6f0c12c52758c0f25c10c97ca3b62"
+	checks := 0
+	hasTarball := func(string) bool {
+		checks++
+		return true
+	}
+	url := nixpkgsMirrorURL(commit, hasTarball)
+	assert.Contains(t, url, "8081/nixos/nixpkgs/archive/"+commit)
+
+	// The mirror is cached, so it's found without checking it again, such
+	// as when there's no network.
+	noTarball := func(string) bool {
+		checks++
+		return false
+	}
+	assert.Equal(t, url, nixpkgsMirrorURL(commit, noTarball))
+	assert.Equal(t, 1, checks)
+	info, err := GetNixpkgsInfo(commit)
+	assert.NoError(t, err)
+	assert.Equal(t, url, info.URL)
+
+	// Other commits aren't mirrored if the mirror doesn't have them.
+	assert.Empty(t, nixpkgsMirrorURL("af9e00071d0971eb292fd5abef334e66eda3cb69", noTarball))
+}
@@ -39,6 +39,12 @@ func getConfigIfAny(pkg, projectDir string) (*config, error) {
 	return nil, nil
 }
 
+// Exists reports whether devbox has a plugin for pkg.
+func Exists(pkg, projectDir string) (bool, error) {
+	cfg, err := getConfigIfAny(pkg, projectDir)
+	return cfg != nil, err
+}
+
 func getFileContent(contentPath string) ([]byte, error) {
 	return plugins.BuiltIn.ReadFile(contentPath)
 }
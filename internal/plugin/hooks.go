@@ -1,7 +1,28 @@
 package plugin
 
+// InitHook is a command in the init hook of a package's plugin.
+type InitHook struct {
+	// Plugin is the name of the plugin, like pip.
+	Plugin string
+	Cmd    string
+}
+
 func InitHooks(pkgs []string, projectDir string) ([]string, error) {
+	pluginHooks, err := InitHooksByPlugin(pkgs, projectDir)
+	if err != nil {
+		return nil, err
+	}
 	hooks := []string{}
+	for _, hook := range pluginHooks {
+		hooks = append(hooks, hook.Cmd)
+	}
+	return hooks, nil
+}
+
+// InitHooksByPlugin is like InitHooks, but it also returns the plugin that each
+// command comes from.
+func InitHooksByPlugin(pkgs []string, projectDir string) ([]InitHook, error) {
+	hooks := []InitHook{}
 	for _, pkg := range pkgs {
 		c, err := getConfigIfAny(pkg, projectDir)
 		if err != nil {
@@ -10,7 +31,9 @@ func InitHooks(pkgs []string, projectDir string) ([]string, error) {
 		if c == nil {
 			continue
 		}
-		hooks = append(hooks, c.Shell.InitHook.Cmds...)
+		for _, cmd := range c.Shell.InitHook.Cmds {
+			hooks = append(hooks, InitHook{Plugin: c.Name, Cmd: cmd})
+		}
 	}
 	return hooks, nil
 }
@@ -5,6 +5,7 @@ import (
 	"io"
 	"os"
 	"path/filepath"
+	"sort"
 	"strings"
 
 	"github.com/fatih/color"
@@ -53,6 +54,66 @@ func PrintReadme(
 	return err
 }
 
+// PrintContributions prints a short summary of what the plugin for pkg adds to
+// the devbox environment, so users know there's more to explore. It prints
+// nothing if pkg doesn't have a plugin.
+func PrintContributions(pkg, projectDir string, w io.Writer) error {
+	cfg, err := getConfigIfAny(pkg, projectDir)
+	if err != nil {
+		return err
+	}
+	if cfg == nil {
+		return nil
+	}
+
+	contributions := []string{}
+	if len(cfg.Env) > 0 {
+		contributions = append(contributions, "environment variables: "+sortedKeys(cfg.Env))
+	}
+	if len(cfg.Services) > 0 {
+		names := []string{}
+		for name := range cfg.Services {
+			names = append(names, name)
+		}
+		sort.Strings(names)
+		contributions = append(contributions, "services: "+strings.Join(names, ", "))
+	}
+	helpers := []string{}
+	for name, src := range cfg.CreateFiles {
+		if src != "" {
+			helpers = append(helpers, filepath.Base(name))
+		}
+	}
+	if len(helpers) > 0 {
+		sort.Strings(helpers)
+		contributions = append(contributions, "helper files: "+strings.Join(helpers, ", "))
+	}
+	if len(cfg.Shell.InitHook.Cmds) > 0 {
+		contributions = append(contributions, "an init hook that runs when the shell starts")
+	}
+	if len(contributions) == 0 {
+		return nil
+	}
+
+	_, err = fmt.Fprintf(
+		w,
+		"\n%s is configured by the %s plugin, which provides:\n  * %s\n",
+		pkg,
+		cfg.Name,
+		strings.Join(contributions, "\n  * "),
+	)
+	return errors.WithStack(err)
+}
+
+func sortedKeys(m map[string]string) string {
+	keys := make([]string, 0, len(m))
+	for k := range m {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	return strings.Join(keys, ", ")
+}
+
 func printReadme(cfg *config, w io.Writer, markdown bool) error {
 	if cfg.Readme == "" {
 		return nil
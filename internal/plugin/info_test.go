@@ -0,0 +1,24 @@
+package plugin
+
+import (
+	"bytes"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestPrintContributions(t *testing.T) {
+	projectDir := t.TempDir()
+
+	buf := &bytes.Buffer{}
+	err := PrintContributions("postgresql", projectDir, buf)
+	assert.NoError(t, err)
+	assert.Contains(t, buf.String(), "postgresql is configured by the postgresql plugin")
+	assert.Contains(t, buf.String(), "environment variables: PGDATA, PGHOST")
+	assert.Contains(t, buf.String(), "services: postgresql")
+
+	buf.Reset()
+	err = PrintContributions("hello", projectDir, buf)
+	assert.NoError(t, err)
+	assert.Empty(t, buf.String(), "packages without a plugin should print nothing")
+}
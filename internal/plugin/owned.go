@@ -0,0 +1,100 @@
+package plugin
+
+import (
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/pkg/errors"
+	"go.jetpack.io/devbox/internal/cuecfg"
+)
+
+// ownedFilesPath records the files that each package's plugin created in the
+// virtenv, so that they can be removed along with the package.
+const ownedFilesPath = ".devbox/virtenv/.owned-files.json"
+
+// ownedFiles maps each package to the files its plugin created in the
+// virtenv. Paths are relative to the project directory.
+type ownedFiles map[string][]string
+
+func readOwnedFiles(projectDir string) (ownedFiles, error) {
+	owned := ownedFiles{}
+	data, err := os.ReadFile(filepath.Join(projectDir, ownedFilesPath))
+	if errors.Is(err, os.ErrNotExist) {
+		return owned, nil
+	}
+	if err != nil {
+		return nil, errors.WithStack(err)
+	}
+	if err := json.Unmarshal(data, &owned); err != nil {
+		return nil, errors.WithStack(err)
+	}
+	return owned, nil
+}
+
+func (o ownedFiles) save(projectDir string) error {
+	path := filepath.Join(projectDir, ownedFilesPath)
+	if len(o) == 0 {
+		if err := os.Remove(path); err != nil && !errors.Is(err, os.ErrNotExist) {
+			return errors.WithStack(err)
+		}
+		return nil
+	}
+	data, err := cuecfg.MarshalJSON(o)
+	if err != nil {
+		return err
+	}
+	if err := createDir(filepath.Dir(path)); err != nil {
+		return err
+	}
+	return errors.WithStack(os.WriteFile(path, data, 0644))
+}
+
+// recordOwnedFiles replaces the files owned by pkg with paths. Paths outside
+// the virtenv, like the ones in devbox.d, belong to the user and aren't
+// recorded.
+func recordOwnedFiles(projectDir, pkg string, paths []string) error {
+	owned, err := readOwnedFiles(projectDir)
+	if err != nil {
+		return err
+	}
+	files := []string{}
+	for _, path := range paths {
+		rel, err := filepath.Rel(projectDir, path)
+		if err != nil || !inVirtenv(rel) {
+			continue
+		}
+		files = append(files, rel)
+	}
+	sort.Strings(files)
+	if len(files) == 0 {
+		delete(owned, pkg)
+	} else {
+		owned[pkg] = files
+	}
+	return owned.save(projectDir)
+}
+
+// inVirtenv reports whether path, relative to the project directory, is
+// inside the virtenv.
+func inVirtenv(path string) bool {
+	return strings.HasPrefix(filepath.ToSlash(path), VirtenvPath+"/")
+}
+
+// removeFile removes the file at path and then any of its parent directories
+// in the virtenv that are left empty.
+func removeFile(projectDir, path string) error {
+	err := os.Remove(filepath.Join(projectDir, path))
+	if err != nil && !errors.Is(err, os.ErrNotExist) {
+		return errors.WithStack(err)
+	}
+	for dir := filepath.Dir(path); inVirtenv(dir); dir = filepath.Dir(dir) {
+		// Remove fails if the directory isn't empty.
+		if os.Remove(filepath.Join(projectDir, dir)) != nil {
+			break
+		}
+	}
+	return nil
+}
@@ -18,6 +18,10 @@ import (
 )
 
 const (
+	// ConfigDir is the directory in a project where plugins put the config
+	// files that users can edit.
+	ConfigDir = devboxDirName
+
 	devboxDirName       = "devbox.d"
 	devboxHiddenDirName = ".devbox"
 	VirtenvBinPath      = ".devbox/virtenv/bin"
@@ -49,6 +53,7 @@ func (m *Manager) CreateFilesAndShowReadme(pkg, projectDir string) error {
 	}
 
 	debug.Log("Creating files for package %q create files", pkg)
+	created := []string{}
 	for filePath, contentPath := range cfg.CreateFiles {
 
 		if !m.shouldCreateFile(filePath) {
@@ -68,38 +73,30 @@ func (m *Manager) CreateFilesAndShowReadme(pkg, projectDir string) error {
 		}
 
 		debug.Log("Creating file %q", filePath)
-		content, err := getFileContent(contentPath)
-		if err != nil {
-			return errors.WithStack(err)
-		}
-		t, err := template.New(filePath + "-template").Parse(string(content))
+		content, err := renderFile(pkg, projectDir, filePath, contentPath)
 		if err != nil {
-			return errors.WithStack(err)
-		}
-		var buf bytes.Buffer
-		if err = t.Execute(&buf, map[string]string{
-			"DevboxConfigDir":      projectDir,
-			"DevboxDir":            filepath.Join(projectDir, devboxDirName, pkg),
-			"DevboxDirRoot":        filepath.Join(projectDir, devboxDirName),
-			"DevboxProfileDefault": filepath.Join(projectDir, nix.ProfilePath),
-			"Virtenv":              filepath.Join(projectDir, devboxHiddenDirName, "virtenv", pkg),
-		}); err != nil {
-			return errors.WithStack(err)
+			return err
 		}
 		var fileMode fs.FileMode = 0644
 		if strings.Contains(filePath, "bin/") {
 			fileMode = 0755
 		}
 
-		if err := os.WriteFile(filePath, buf.Bytes(), fileMode); err != nil {
+		if err := os.WriteFile(filePath, content, fileMode); err != nil {
 			return errors.WithStack(err)
 		}
+		created = append(created, filePath)
 		if fileMode == 0755 {
-			if err := createSymlink(projectDir, filePath); err != nil {
+			link, err := createSymlink(projectDir, filePath)
+			if err != nil {
 				return err
 			}
+			created = append(created, link)
 		}
 	}
+	if err := recordOwnedFiles(projectDir, pkg, created); err != nil {
+		return err
+	}
 	return createEnvFile(pkg, projectDir)
 
 }
@@ -155,6 +152,30 @@ func createEnvFile(pkg, projectDir string) error {
 	return nil
 }
 
+// renderFile returns the content of a file that the plugin of pkg creates at
+// filePath, with the template in contentPath filled in for projectDir.
+func renderFile(pkg, projectDir, filePath, contentPath string) ([]byte, error) {
+	content, err := getFileContent(contentPath)
+	if err != nil {
+		return nil, errors.WithStack(err)
+	}
+	t, err := template.New(filePath + "-template").Parse(string(content))
+	if err != nil {
+		return nil, errors.WithStack(err)
+	}
+	var buf bytes.Buffer
+	if err = t.Execute(&buf, map[string]string{
+		"DevboxConfigDir":      projectDir,
+		"DevboxDir":            filepath.Join(projectDir, devboxDirName, pkg),
+		"DevboxDirRoot":        filepath.Join(projectDir, devboxDirName),
+		"DevboxProfileDefault": filepath.Join(projectDir, nix.ProfilePath),
+		"Virtenv":              filepath.Join(projectDir, devboxHiddenDirName, "virtenv", pkg),
+	}); err != nil {
+		return nil, errors.WithStack(err)
+	}
+	return buf.Bytes(), nil
+}
+
 func buildConfig(pkg, projectDir, content string) (*config, error) {
 	cfg := &config{}
 	t, err := template.New(pkg + "-template").Parse(content)
@@ -187,25 +208,27 @@ func createDir(path string) error {
 	return nil
 }
 
-func createSymlink(root, filePath string) error {
+// createSymlink links filePath into the virtenv bin directory, and returns
+// the path of the link.
+func createSymlink(root, filePath string) (string, error) {
 	name := filepath.Base(filePath)
 	newname := filepath.Join(root, VirtenvPath, "bin", name)
 
 	// Create bin path just in case it doesn't exist
 	if err := os.MkdirAll(filepath.Join(root, VirtenvPath, "/bin"), 0755); err != nil {
-		return errors.WithStack(err)
+		return "", errors.WithStack(err)
 	}
 
 	if _, err := os.Lstat(newname); err == nil {
 		if err = os.Remove(newname); err != nil {
-			return errors.WithStack(err)
+			return "", errors.WithStack(err)
 		}
 	}
 
 	if err := os.Symlink(filePath, newname); err != nil {
-		return errors.WithStack(err)
+		return "", errors.WithStack(err)
 	}
-	return nil
+	return newname, nil
 }
 
 func (m *Manager) shouldCreateFile(filePath string) bool {
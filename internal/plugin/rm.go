@@ -3,33 +3,78 @@ package plugin
 import (
 	"os"
 	"path/filepath"
+	"sort"
 
 	"github.com/pkg/errors"
+	"github.com/samber/lo"
 )
 
+// Remove deletes the virtenv files of pkgs: each package's virtenv directory,
+// and the files its plugin created elsewhere in the virtenv, such as the
+// symlinks in the virtenv bin directory. Files that are also owned by a
+// package that's still installed are kept.
 func Remove(projectDir string, pkgs []string) error {
+	owned, err := readOwnedFiles(projectDir)
+	if err != nil {
+		return err
+	}
+	removed := map[string]bool{}
+	for _, pkg := range pkgs {
+		for _, path := range owned[pkg] {
+			removed[path] = true
+		}
+		delete(owned, pkg)
+	}
+	for _, paths := range owned {
+		for _, path := range paths {
+			delete(removed, path)
+		}
+	}
+	paths := lo.Keys(removed)
+	sort.Strings(paths)
+	for _, path := range paths {
+		if err := removeFile(projectDir, path); err != nil {
+			return err
+		}
+	}
+
 	for _, pkg := range pkgs {
 		if err := os.RemoveAll(filepath.Join(projectDir, VirtenvPath, pkg)); err != nil {
 			return errors.WithStack(err)
 		}
 	}
-	return nil
+	return owned.save(projectDir)
 }
 
 func RemoveInvalidSymlinks(projectDir string) error {
+	invalid, err := InvalidSymlinks(projectDir)
+	if err != nil {
+		return err
+	}
+	for _, path := range invalid {
+		os.Remove(path)
+	}
+	return nil
+}
+
+// InvalidSymlinks returns the paths of the symlinks in the virtenv bin
+// directory whose targets no longer exist. RemoveInvalidSymlinks removes
+// them.
+func InvalidSymlinks(projectDir string) ([]string, error) {
 	binPath := filepath.Join(projectDir, VirtenvBinPath)
 	if _, err := os.Stat(binPath); errors.Is(err, os.ErrNotExist) {
-		return nil
+		return nil, nil
 	}
 	dirEntry, err := os.ReadDir(binPath)
 	if err != nil {
-		return errors.WithStack(err)
+		return nil, errors.WithStack(err)
 	}
+	invalid := []string{}
 	for _, entry := range dirEntry {
-		_, err := os.Stat(filepath.Join(projectDir, VirtenvPath, "bin", entry.Name()))
-		if errors.Is(err, os.ErrNotExist) {
-			os.Remove(filepath.Join(projectDir, VirtenvPath, "bin", entry.Name()))
+		path := filepath.Join(projectDir, VirtenvPath, "bin", entry.Name())
+		if _, err := os.Stat(path); errors.Is(err, os.ErrNotExist) {
+			invalid = append(invalid, path)
 		}
 	}
-	return nil
+	return invalid, nil
 }
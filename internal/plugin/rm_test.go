@@ -0,0 +1,51 @@
+package plugin
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestRemove(t *testing.T) {
+	projectDir := t.TempDir()
+	m := NewManager()
+	for _, pkg := range []string{"python310Packages.pip", "nginx"} {
+		require.NoError(t, m.CreateFilesAndShowReadme(pkg, projectDir))
+	}
+	link := filepath.Join(projectDir, VirtenvBinPath, "venvShellHook.sh")
+	_, err := os.Lstat(link)
+	require.NoError(t, err)
+
+	require.NoError(t, Remove(projectDir, []string{"python310Packages.pip"}))
+
+	assert.NoDirExists(t, filepath.Join(projectDir, VirtenvPath, "python310Packages.pip"))
+	_, err = os.Lstat(link)
+	assert.ErrorIs(t, err, os.ErrNotExist)
+	assert.NoDirExists(t, filepath.Join(projectDir, VirtenvBinPath))
+	assert.FileExists(t, filepath.Join(projectDir, VirtenvPath, "nginx", "process-compose.yaml"))
+
+	owned, err := readOwnedFiles(projectDir)
+	require.NoError(t, err)
+	assert.Equal(t, ownedFiles{"nginx": {".devbox/virtenv/nginx/process-compose.yaml"}}, owned)
+
+	require.NoError(t, Remove(projectDir, []string{"nginx"}))
+	assert.NoFileExists(t, filepath.Join(projectDir, ownedFilesPath))
+}
+
+func TestRemoveKeepsSharedFiles(t *testing.T) {
+	projectDir := t.TempDir()
+	m := NewManager()
+	for _, pkg := range []string{"python310Packages.pip", "python311Packages.pip"} {
+		require.NoError(t, m.CreateFilesAndShowReadme(pkg, projectDir))
+	}
+
+	// Both plugins link their hook to the same name in the bin directory, so
+	// the link stays while one of them is still installed.
+	require.NoError(t, Remove(projectDir, []string{"python310Packages.pip"}))
+	_, err := os.Lstat(filepath.Join(projectDir, VirtenvBinPath, "venvShellHook.sh"))
+	assert.NoError(t, err)
+	assert.DirExists(t, filepath.Join(projectDir, VirtenvPath, "python311Packages.pip"))
+}
@@ -10,7 +10,12 @@ import (
 type Services map[string]service
 
 type service struct {
-	config  *config
+	config *config
+	// pkg and projectDir are the package whose plugin declares the
+	// service, and the project it's in.
+	pkg        string
+	projectDir string
+
 	Name    string `json:"name"`
 	RawPort string `json:"port"`
 	Start   string `json:"start"`
@@ -33,6 +38,21 @@ func (s *service) ProcessComposeYaml() (string, bool) {
 	return "", false
 }
 
+// ProcessComposeContent returns the content of the service's
+// process-compose.yaml, as the plugin would create it in the project. It
+// returns nil if the service doesn't have one.
+func (s *service) ProcessComposeContent() ([]byte, error) {
+	file, ok := s.ProcessComposeYaml()
+	if !ok {
+		return nil, nil
+	}
+	contentPath := s.config.CreateFiles[file]
+	if contentPath == "" {
+		return nil, nil
+	}
+	return renderFile(s.pkg, s.projectDir, file, contentPath)
+}
+
 func GetServices(pkgs []string, projectDir string) (Services, error) {
 	services := map[string]service{}
 	for _, pkg := range pkgs {
@@ -46,6 +66,8 @@ func GetServices(pkgs []string, projectDir string) (Services, error) {
 		for name, svc := range c.Services {
 			svc.Name = name
 			svc.config = c
+			svc.pkg = pkg
+			svc.projectDir = projectDir
 			services[name] = svc
 		}
 	}
@@ -0,0 +1,91 @@
+// Copyright 2023 Jetpack Technologies Inc and contributors. All rights reserved.
+// Use of this source code is governed by the license in the LICENSE file.
+
+// Package searcher looks up which nixpkgs commit provides a particular version
+// of a package, using the devbox package search service.
+package searcher
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/url"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+// DefaultHost is the package search service that devbox uses unless
+// DEVBOX_SEARCH_HOST is set.
+const DefaultHost = "https://search.devbox.sh"
+
+// hostEnvVar overrides DefaultHost, for example to use a mirror of the search
+// service.
+const hostEnvVar = "DEVBOX_SEARCH_HOST"
+
+// ErrVersionNotFound is returned by Resolve when no nixpkgs commit provides
+// the requested version of a package.
+var ErrVersionNotFound = errors.New("package version not found")
+
+// PackageVersion is a version of a package along with the nixpkgs commit and
+// attribute that provide it.
+type PackageVersion struct {
+	Name string `json:"name"`
+	// Version is the full version of the package, such as 18.16.0 when
+	// resolving nodejs@18.
+	Version       string `json:"version"`
+	CommitHash    string `json:"commit_hash"`
+	AttributePath string `json:"attribute_path"`
+}
+
+// Client is a client for the package search service.
+type Client struct {
+	host       string
+	httpClient *http.Client
+}
+
+// NewClient returns a client for the search service at DEVBOX_SEARCH_HOST, or
+// DefaultHost if it isn't set.
+func NewClient() *Client {
+	host := os.Getenv(hostEnvVar)
+	if host == "" {
+		host = DefaultHost
+	}
+	return &Client{
+		host:       strings.TrimSuffix(host, "/"),
+		httpClient: &http.Client{Timeout: 30 * time.Second},
+	}
+}
+
+// Resolve returns the newest version of the package called name that matches
+// version, along with the nixpkgs commit that provides it. version can be a
+// prefix of the full version, so that "18" matches 18.16.0.
+func (c *Client) Resolve(name, version string) (*PackageVersion, error) {
+	query := url.Values{}
+	query.Set("name", name)
+	query.Set("version", version)
+	endpoint := c.host + "/v1/resolve?" + query.Encode()
+
+	res, err := c.httpClient.Get(endpoint)
+	if err != nil {
+		return nil, errors.WithStack(err)
+	}
+	defer res.Body.Close()
+	if res.StatusCode == http.StatusNotFound {
+		return nil, errors.Wrapf(ErrVersionNotFound, "%s@%s", name, version)
+	}
+	if res.StatusCode != http.StatusOK {
+		return nil, errors.Errorf("GET %s: %s", endpoint, res.Status)
+	}
+
+	pkg := &PackageVersion{}
+	if err := json.NewDecoder(res.Body).Decode(pkg); err != nil {
+		return nil, errors.Wrapf(err, "GET %s: invalid response", endpoint)
+	}
+	if pkg.CommitHash == "" || pkg.AttributePath == "" {
+		return nil, errors.Errorf(
+			"GET %s: response is missing the nixpkgs commit or attribute", endpoint)
+	}
+	return pkg, nil
+}
@@ -0,0 +1,53 @@
+// Copyright 2023 Jetpack Technologies Inc and contributors. All rights reserved.
+// Use of this source code is governed by the license in the LICENSE file.
+
+package searcher
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/pkg/errors"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestResolve(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/v1/resolve" {
+			http.NotFound(w, r)
+			return
+		}
+		name, version := r.URL.Query().Get("name"), r.URL.Query().Get("version")
+		switch {
+		case name == "nodejs" && version == "18":
+			_ = json.NewEncoder(w).Encode(PackageVersion{
+				Name:          "nodejs",
+				Version:       "18.16.0",
+				CommitHash:    "f91ee3065de91a3531329a674a45ddcb3467a650",
+				AttributePath: "nodejs_18",
+			})
+		case name == "broken":
+			_, _ = w.Write([]byte(`{"name": "broken", "version": "1.0"}`))
+		default:
+			http.NotFound(w, r)
+		}
+	}))
+	defer server.Close()
+	t.Setenv(hostEnvVar, server.URL+"/")
+	client := NewClient()
+
+	pkg, err := client.Resolve("nodejs", "18")
+	require.NoError(t, err)
+	assert.Equal(t, "18.16.0", pkg.Version)
+	assert.Equal(t, "f91ee3065de91a3531329a674a45ddcb3467a650", pkg.CommitHash)
+	assert.Equal(t, "nodejs_18", pkg.AttributePath)
+
+	_, err = client.Resolve("nodejs", "1")
+	assert.True(t, errors.Is(err, ErrVersionNotFound), "got error %v, want ErrVersionNotFound", err)
+
+	_, err = client.Resolve("broken", "1.0")
+	assert.Error(t, err)
+}
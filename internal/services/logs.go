@@ -0,0 +1,181 @@
+// Copyright 2023 Jetpack Technologies Inc and contributors. All rights reserved.
+// Use of this source code is governed by the license in the LICENSE file.
+
+package services
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strconv"
+	"time"
+
+	"github.com/pkg/errors"
+	"go.jetpack.io/devbox/internal/boxcli/usererr"
+	"golang.org/x/exp/maps"
+	"golang.org/x/exp/slices"
+)
+
+// logFollowLines is how many of a process's most recent lines are fetched
+// each time Logs checks for new output. Lines that are written faster than
+// that between two checks are skipped.
+const logFollowLines = 1000
+
+// defaultLogPollInterval is how often Logs checks for new output when it
+// follows it.
+const defaultLogPollInterval = 500 * time.Millisecond
+
+// LogsOpts configures Logs.
+type LogsOpts struct {
+	// Lines is how many of each process's most recent lines to write.
+	Lines int
+	// Follow makes Logs keep writing new lines until its context is done.
+	Follow bool
+
+	// pollInterval is how often Logs checks for new output when it follows
+	// it. It defaults to defaultLogPollInterval.
+	pollInterval time.Duration
+}
+
+// processLogs returns up to limit of the most recent lines that a process
+// wrote, oldest first.
+func (localProbe) processLogs(ctx context.Context, port, name string, limit int) ([]string, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, fmt.Sprintf(
+		"http://localhost:%s/process/logs/%s/0/%d", port, url.PathEscape(name), limit), nil)
+	if err != nil {
+		return nil, errors.WithStack(err)
+	}
+	res, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return nil, errors.WithStack(err)
+	}
+	defer res.Body.Close()
+	if res.StatusCode != http.StatusOK {
+		return nil, errors.Errorf("GET %s: %s", req.URL, res.Status)
+	}
+	return parseProcessLogs(res.Body)
+}
+
+func parseProcessLogs(body io.Reader) ([]string, error) {
+	logs := struct {
+		Logs []string `json:"logs"`
+	}{}
+	if err := json.NewDecoder(body).Decode(&logs); err != nil {
+		return nil, errors.WithStack(err)
+	}
+	return logs.Logs, nil
+}
+
+// Logs writes the most recent output of the processes that the process manager
+// runs for serviceNames, or of all of its processes if serviceNames is empty.
+// When there's more than one process, each line starts with the name of the
+// process that wrote it.
+func Logs(
+	ctx context.Context,
+	serviceNames []string,
+	pmOpts *ProcessManagerOpts,
+	opts LogsOpts,
+	w io.Writer,
+) error {
+	port := pmOpts.port()
+	probe := pmOpts.serviceProbe()
+	states, running := probe.processStates(ctx, port)
+	if !running {
+		return usererr.New(
+			"The process manager isn't running on port %s. Start it with `devbox services manager`.", port)
+	}
+	names := slices.Clone(serviceNames)
+	if len(names) == 0 {
+		names = maps.Keys(states)
+		slices.Sort(names)
+	}
+	for _, name := range names {
+		if _, ok := states[name]; !ok {
+			return usererr.New("The process manager doesn't run a service named %s", name)
+		}
+	}
+	if len(names) == 0 {
+		fmt.Fprintln(w, "The process manager isn't running any services")
+		return nil
+	}
+
+	lines := opts.Lines
+	if lines <= 0 {
+		lines = logFollowLines
+	}
+	seen := map[string][]string{}
+	for _, name := range names {
+		logs, err := probe.processLogs(ctx, port, name, lines)
+		if err != nil {
+			return usererr.WithUserMessage(err, "Unable to get the logs of service %s", name)
+		}
+		writeLogLines(w, names, name, logs)
+		seen[name] = logs
+	}
+	if !opts.Follow {
+		return nil
+	}
+
+	pollInterval := opts.pollInterval
+	if pollInterval <= 0 {
+		pollInterval = defaultLogPollInterval
+	}
+	ticker := time.NewTicker(pollInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return nil
+		case <-ticker.C:
+		}
+		for _, name := range names {
+			logs, err := probe.processLogs(ctx, port, name, logFollowLines)
+			if ctx.Err() != nil {
+				return nil
+			}
+			if err != nil {
+				return usererr.WithUserMessage(err,
+					"Unable to get the logs of service %s. The process manager may have stopped.", name)
+			}
+			writeLogLines(w, names, name, newLogLines(seen[name], logs))
+			seen[name] = logs
+		}
+	}
+}
+
+// writeLogLines writes lines that the process name wrote, starting each one
+// with the name if there's more than one process in names.
+func writeLogLines(w io.Writer, names []string, name string, lines []string) {
+	width := 0
+	for _, n := range names {
+		if len(n) > width {
+			width = len(n)
+		}
+	}
+	for _, line := range lines {
+		if len(names) > 1 {
+			fmt.Fprintf(w, "%-"+strconv.Itoa(width)+"s | ", name)
+		}
+		fmt.Fprintln(w, line)
+	}
+}
+
+// newLogLines returns the lines at the end of cur that weren't in prev, where
+// both are the most recent lines of the same process. The start of cur
+// overlaps the end of prev, unless more lines were written in between than cur
+// holds.
+func newLogLines(prev, cur []string) []string {
+	overlap := len(prev)
+	if len(cur) < overlap {
+		overlap = len(cur)
+	}
+	for ; overlap > 0; overlap-- {
+		if slices.Equal(prev[len(prev)-overlap:], cur[:overlap]) {
+			break
+		}
+	}
+	return cur[overlap:]
+}
@@ -0,0 +1,94 @@
+// Copyright 2023 Jetpack Technologies Inc and contributors. All rights reserved.
+// Use of this source code is governed by the license in the LICENSE file.
+
+package services
+
+import (
+	"bytes"
+	"context"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestParseProcessLogs(t *testing.T) {
+	logs, err := parseProcessLogs(strings.NewReader(`{"logs": ["starting", "ready"]}`))
+	require.NoError(t, err)
+	assert.Equal(t, []string{"starting", "ready"}, logs)
+
+	_, err = parseProcessLogs(strings.NewReader("not json"))
+	assert.Error(t, err)
+}
+
+func TestNewLogLines(t *testing.T) {
+	testCases := []struct {
+		name      string
+		prev, cur []string
+		want      []string
+	}{
+		{"first", nil, []string{"a", "b"}, []string{"a", "b"}},
+		{"unchanged", []string{"a", "b"}, []string{"a", "b"}, []string{}},
+		{"appended", []string{"a", "b"}, []string{"a", "b", "c"}, []string{"c"}},
+		{"rolled over", []string{"a", "b", "c"}, []string{"b", "c", "d"}, []string{"d"}},
+		{"repeated lines", []string{"x", "x"}, []string{"x", "x", "x"}, []string{"x"}},
+		{"no overlap", []string{"a", "b"}, []string{"c", "d"}, []string{"c", "d"}},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			assert.Equal(t, tc.want, newLogLines(tc.prev, tc.cur))
+		})
+	}
+}
+
+func TestLogs(t *testing.T) {
+	probe := &fakeProbe{states: func() (map[string]string, bool) { return nil, false }}
+	pmOpts := &ProcessManagerOpts{probe: probe}
+	err := Logs(context.Background(), nil, pmOpts, LogsOpts{Lines: 10}, &bytes.Buffer{})
+	assert.ErrorContains(t, err, "process manager isn't running on port 8280")
+
+	probe.states = func() (map[string]string, bool) {
+		return map[string]string{"web": "Running", "db": "Running"}, true
+	}
+	logs := map[string][]string{"web": {"listening on :8080"}, "db": {"ready"}}
+	probe.logs = func(name string) ([]string, error) { return logs[name], nil }
+
+	err = Logs(context.Background(), []string{"worker"}, pmOpts, LogsOpts{Lines: 10}, &bytes.Buffer{})
+	assert.ErrorContains(t, err, "doesn't run a service named worker")
+
+	out := &bytes.Buffer{}
+	require.NoError(t, Logs(context.Background(), []string{"web"}, pmOpts, LogsOpts{Lines: 10}, out))
+	assert.Equal(t, "listening on :8080\n", out.String())
+
+	out.Reset()
+	require.NoError(t, Logs(context.Background(), nil, pmOpts, LogsOpts{Lines: 10}, out))
+	assert.Equal(t, "db  | ready\nweb | listening on :8080\n", out.String())
+}
+
+func TestLogsFollow(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	calls := 0
+	probe := &fakeProbe{states: func() (map[string]string, bool) {
+		return map[string]string{"web": "Running"}, true
+	}}
+	probe.logs = func(name string) ([]string, error) {
+		calls++
+		switch calls {
+		case 1:
+			return []string{"a"}, nil
+		case 2:
+			return []string{"a", "b"}, nil
+		default:
+			cancel()
+			return []string{"a", "b"}, nil
+		}
+	}
+
+	out := &bytes.Buffer{}
+	opts := LogsOpts{Lines: 10, Follow: true, pollInterval: time.Millisecond}
+	require.NoError(t, Logs(ctx, []string{"web"}, &ProcessManagerOpts{probe: probe}, opts, out))
+	assert.Equal(t, "a\nb\n", out.String())
+}
@@ -2,26 +2,88 @@ package services
 
 import (
 	"context"
+	"net"
 	"os"
 	"os/exec"
+	"strconv"
 
+	"go.jetpack.io/devbox/internal/boxcli/usererr"
 	"go.jetpack.io/devbox/internal/plugin"
 )
 
+// DefaultProcessComposePort is the port that the process manager serves its
+// API on unless the project sets another one.
+const DefaultProcessComposePort = 8280
+
+// ProcessManagerOpts configures the process manager.
+type ProcessManagerOpts struct {
+	// Port is the port that process-compose serves its API on. It defaults
+	// to DefaultProcessComposePort.
+	Port int
+	// File is a process-compose.yaml that's loaded after the services'
+	// files, so that it can override them.
+	File string
+
+	// probe checks on the process manager and services. It defaults to
+	// localProbe.
+	probe serviceProbe
+}
+
+func (o *ProcessManagerOpts) port() string {
+	if o == nil || o.Port == 0 {
+		return strconv.Itoa(DefaultProcessComposePort)
+	}
+	return strconv.Itoa(o.Port)
+}
+
+func (o *ProcessManagerOpts) serviceProbe() serviceProbe {
+	if o == nil || o.probe == nil {
+		return localProbe{}
+	}
+	return o.probe
+}
+
 func StartProcessManager(
 	ctx context.Context,
 	processComposePath string,
 	services plugin.Services,
+	opts *ProcessManagerOpts,
 ) error {
-	flags := []string{"-p", "8280"}
+	port := opts.port()
+	if err := checkPortAvailable(port); err != nil {
+		return err
+	}
+	flags := []string{"-p", port}
 	for _, s := range services {
 		if file, hasComposeYaml := s.ProcessComposeYaml(); hasComposeYaml {
 			flags = append(flags, "-f", file)
 		}
 	}
+	if opts != nil && opts.File != "" {
+		if _, err := os.Stat(opts.File); err != nil {
+			return usererr.WithUserMessage(err, "Unable to read process-compose file %s", opts.File)
+		}
+		flags = append(flags, "-f", opts.File)
+	}
 	cmd := exec.Command(processComposePath, flags...)
 	cmd.Stdout = os.Stdout
 	cmd.Stderr = os.Stderr
 	cmd.Stdin = os.Stdin
 	return cmd.Run()
 }
+
+// checkPortAvailable returns an error if something, such as the process
+// manager of another project, already listens on port, so that the user gets
+// a clear error before process-compose starts any processes.
+func checkPortAvailable(port string) error {
+	l, err := net.Listen("tcp", ":"+port)
+	if err != nil {
+		return usererr.WithUserMessage(
+			err,
+			"Port %s is already in use, possibly by the process manager of another project. "+
+				"Set process_compose.port in devbox.json to use a different port.",
+			port,
+		)
+	}
+	return l.Close()
+}
@@ -0,0 +1,27 @@
+package services
+
+import (
+	"net"
+	"strconv"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestCheckPortAvailable(t *testing.T) {
+	l, err := net.Listen("tcp", ":0")
+	require.NoError(t, err)
+	port := strconv.Itoa(l.Addr().(*net.TCPAddr).Port)
+
+	assert.ErrorContains(t, checkPortAvailable(port), "process_compose.port")
+	require.NoError(t, l.Close())
+	assert.NoError(t, checkPortAvailable(port))
+}
+
+func TestProcessManagerOptsPort(t *testing.T) {
+	var opts *ProcessManagerOpts
+	assert.Equal(t, "8280", opts.port())
+	assert.Equal(t, "8280", (&ProcessManagerOpts{}).port())
+	assert.Equal(t, "9000", (&ProcessManagerOpts{Port: 9000}).port())
+}
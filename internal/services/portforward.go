@@ -0,0 +1,126 @@
+package services
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"net"
+	"strconv"
+	"strings"
+
+	"github.com/pkg/errors"
+	"go.jetpack.io/devbox/internal/boxcli/usererr"
+	"go.jetpack.io/devbox/internal/plugin"
+)
+
+// PortMapping describes how a service's port is reachable from the host.
+type PortMapping struct {
+	Service    string
+	LocalPort  string
+	RemotePort string
+}
+
+// IsDirect returns true if the service is reachable on the same port it
+// listens on, so there's nothing to forward.
+func (m *PortMapping) IsDirect() bool {
+	return m.LocalPort == m.RemotePort
+}
+
+func (m *PortMapping) String() string {
+	return fmt.Sprintf("localhost:%s -> %s:%s", m.LocalPort, m.Service, m.RemotePort)
+}
+
+// ParsePortMapping derives the port mapping for a service. The remote port
+// defaults to the port declared by the service's plugin. spec is optional and
+// may be "local" or "local:remote" to override either side of the mapping.
+func ParsePortMapping(services plugin.Services, name, spec string) (*PortMapping, error) {
+	svc, found := services[name]
+	if !found {
+		return nil, usererr.New("Service %q not found", name)
+	}
+	remote, err := svc.Port()
+	if err != nil {
+		return nil, errors.WithStack(err)
+	}
+
+	local := remote
+	if spec != "" {
+		var remoteOverride string
+		var hasRemote bool
+		local, remoteOverride, hasRemote = strings.Cut(spec, ":")
+		if hasRemote {
+			remote = remoteOverride
+		}
+	}
+	if remote == "" {
+		return nil, usererr.New(
+			"Service %q doesn't declare a port. Specify one with `devbox services port-forward %s <local>:<remote>`",
+			name,
+			name,
+		)
+	}
+	if local == "" {
+		local = remote
+	}
+	for _, port := range []string{local, remote} {
+		if n, err := strconv.Atoi(port); err != nil || n <= 0 || n > 65535 {
+			return nil, usererr.New("Invalid port %q for service %q", port, name)
+		}
+	}
+	return &PortMapping{Service: name, LocalPort: local, RemotePort: remote}, nil
+}
+
+// PortForward makes the service available on mapping.LocalPort. Services run as
+// host processes, so if the local and remote ports match it only reports where
+// the service is listening. Otherwise it proxies connections until ctx is done.
+func PortForward(ctx context.Context, mapping *PortMapping, w io.Writer) error {
+	if mapping.IsDirect() {
+		fmt.Fprintf(w, "Service %q is listening on localhost:%s\n", mapping.Service, mapping.RemotePort)
+		return nil
+	}
+
+	ln, err := net.Listen("tcp", net.JoinHostPort("localhost", mapping.LocalPort))
+	if err != nil {
+		return usererr.WithUserMessage(err, "Unable to listen on local port %s", mapping.LocalPort)
+	}
+	go func() {
+		<-ctx.Done()
+		ln.Close()
+	}()
+
+	fmt.Fprintf(w, "Forwarding %s. Press Ctrl-C to stop.\n", mapping)
+	remoteAddr := net.JoinHostPort("localhost", mapping.RemotePort)
+	for {
+		conn, err := ln.Accept()
+		if err != nil {
+			if ctx.Err() != nil {
+				return nil
+			}
+			return errors.WithStack(err)
+		}
+		go forwardConn(conn, remoteAddr, w)
+	}
+}
+
+func forwardConn(local net.Conn, remoteAddr string, w io.Writer) {
+	defer local.Close()
+	remote, err := net.Dial("tcp", remoteAddr)
+	if err != nil {
+		fmt.Fprintf(w, "Error connecting to %s: %s\n", remoteAddr, err)
+		return
+	}
+	defer remote.Close()
+
+	// Stop as soon as either side closes. The deferred Closes unblock the
+	// other copy.
+	done := make(chan struct{}, 2)
+	go func() {
+		_, _ = io.Copy(remote, local)
+		done <- struct{}{}
+	}()
+	go func() {
+		_, _ = io.Copy(local, remote)
+		done <- struct{}{}
+	}()
+	<-done
+}
@@ -0,0 +1,79 @@
+package services
+
+import (
+	"encoding/json"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"go.jetpack.io/devbox/internal/plugin"
+)
+
+func TestParsePortMapping(t *testing.T) {
+	t.Setenv("PGPORT", "5433")
+	var svcs plugin.Services
+	err := json.Unmarshal([]byte(`{
+		"postgresql": {"port": "5432"},
+		"redis": {"port": "$PGPORT"},
+		"worker": {}
+	}`), &svcs)
+	assert.NoError(t, err)
+
+	testCases := []struct {
+		name        string
+		service     string
+		spec        string
+		expected    *PortMapping
+		expectError bool
+	}{
+		{
+			name:     "declared_port",
+			service:  "postgresql",
+			expected: &PortMapping{Service: "postgresql", LocalPort: "5432", RemotePort: "5432"},
+		},
+		{
+			name:     "declared_port_from_env",
+			service:  "redis",
+			expected: &PortMapping{Service: "redis", LocalPort: "5433", RemotePort: "5433"},
+		},
+		{
+			name:     "local_port_override",
+			service:  "postgresql",
+			spec:     "15432",
+			expected: &PortMapping{Service: "postgresql", LocalPort: "15432", RemotePort: "5432"},
+		},
+		{
+			name:     "local_and_remote_override",
+			service:  "worker",
+			spec:     "8080:80",
+			expected: &PortMapping{Service: "worker", LocalPort: "8080", RemotePort: "80"},
+		},
+		{
+			name:        "no_declared_port",
+			service:     "worker",
+			expectError: true,
+		},
+		{
+			name:        "invalid_port",
+			service:     "postgresql",
+			spec:        "http",
+			expectError: true,
+		},
+		{
+			name:        "unknown_service",
+			service:     "mysql",
+			expectError: true,
+		},
+	}
+
+	for _, testCase := range testCases {
+		t.Run(testCase.name, func(t *testing.T) {
+			mapping, err := ParsePortMapping(svcs, testCase.service, testCase.spec)
+			if testCase.expectError {
+				assert.Error(t, err)
+				return
+			}
+			assert.NoError(t, err)
+			assert.Equal(t, testCase.expected, mapping)
+		})
+	}
+}
@@ -6,6 +6,7 @@ import (
 	"io"
 	"os"
 	"os/exec"
+	"strings"
 	"time"
 
 	"github.com/fatih/color"
@@ -147,3 +148,42 @@ func listenToAutoPortForwardingChangesOnRemote(
 		},
 	)
 }
+
+// Replaced in tests so that restarting doesn't run the services' commands.
+var (
+	startServices = Start
+	stopServices  = Stop
+)
+
+// Restart stops and then starts each of the services. A service that fails to
+// stop, usually because it isn't running, is started anyway.
+func Restart(ctx context.Context, pkgs, serviceNames []string, projectDir string, w io.Writer) error {
+	services, err := plugin.GetServices(pkgs, projectDir)
+	if err != nil {
+		return err
+	}
+	for _, name := range serviceNames {
+		if _, found := services[name]; !found {
+			return usererr.New("Service %q not found", name)
+		}
+	}
+
+	restarted := []string{}
+	for _, name := range serviceNames {
+		if err := stopServices(ctx, pkgs, []string{name}, projectDir, w); err != nil {
+			fmt.Fprintf(w, "Service %q isn't running or failed to stop. Starting it.\n", name)
+		}
+		if err := startServices(ctx, pkgs, []string{name}, projectDir, w); err != nil {
+			if len(serviceNames) == 1 {
+				return err
+			}
+			fmt.Fprintf(w, "Service %q failed to restart. Error = %s\n", name, err)
+			continue
+		}
+		restarted = append(restarted, name)
+	}
+	if len(restarted) > 0 {
+		fmt.Fprintf(w, "Restarted services: %s\n", strings.Join(restarted, ", "))
+	}
+	return nil
+}
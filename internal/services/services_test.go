@@ -0,0 +1,43 @@
+package services
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"io"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestRestart(t *testing.T) {
+	originalStart, originalStop := startServices, stopServices
+	t.Cleanup(func() { startServices, stopServices = originalStart, originalStop })
+
+	calls := []string{}
+	stopServices = func(_ context.Context, _, names []string, _ string, _ io.Writer) error {
+		calls = append(calls, "stop "+names[0])
+		// nginx isn't running, so stopping it fails.
+		if names[0] == "nginx" {
+			return errors.New("not running")
+		}
+		return nil
+	}
+	startServices = func(_ context.Context, _, names []string, _ string, _ io.Writer) error {
+		calls = append(calls, "start "+names[0])
+		return nil
+	}
+
+	pkgs := []string{"postgresql", "nginx"}
+	out := &bytes.Buffer{}
+	err := Restart(context.Background(), pkgs, []string{"postgresql", "nginx"}, t.TempDir(), out)
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"stop postgresql", "start postgresql", "stop nginx", "start nginx"}, calls)
+	assert.Contains(t, out.String(), `Service "nginx" isn't running`)
+	assert.Contains(t, out.String(), "Restarted services: postgresql, nginx\n")
+
+	calls = nil
+	err = Restart(context.Background(), pkgs, []string{"postgresql", "redis"}, t.TempDir(), out)
+	assert.ErrorContains(t, err, `Service "redis" not found`)
+	assert.Empty(t, calls)
+}
@@ -0,0 +1,150 @@
+// Copyright 2023 Jetpack Technologies Inc and contributors. All rights reserved.
+// Use of this source code is governed by the license in the LICENSE file.
+
+package services
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"net"
+	"net/http"
+	"os"
+	"sort"
+	"time"
+
+	"github.com/pkg/errors"
+	"go.jetpack.io/devbox/internal/plugin"
+)
+
+// State is whether a service is running.
+type State string
+
+const (
+	StateRunning State = "running"
+	StateStopped State = "stopped"
+	// StateUnknown is for services that devbox has no way of checking, such
+	// as services without a port that process-compose doesn't manage.
+	StateUnknown State = "unknown"
+)
+
+// Info is a configured service and its current state.
+type Info struct {
+	Name           string `json:"name"`
+	ProcessCompose bool   `json:"process_compose"`
+	Port           string `json:"port,omitempty"`
+	State          State  `json:"state"`
+}
+
+// serviceProbe checks on the process manager and the services it runs.
+// localProbe is the real one, and tests use a fake so they don't need
+// process-compose or open ports.
+type serviceProbe interface {
+	processStates(ctx context.Context, port string) (map[string]string, bool)
+	processLogs(ctx context.Context, port, name string, limit int) ([]string, error)
+	isListening(port string) bool
+}
+
+// localProbe is the serviceProbe that talks to the process manager's API and
+// the services' ports on localhost.
+type localProbe struct{}
+
+// processStates returns the status of each process that the process manager
+// runs, keyed by process name. It returns false if the process manager isn't
+// running.
+func (localProbe) processStates(ctx context.Context, port string) (map[string]string, bool) {
+	ctx, cancel := context.WithTimeout(ctx, time.Second)
+	defer cancel()
+	req, err := http.NewRequestWithContext(
+		ctx, http.MethodGet, "http://localhost:"+port+"/processes", nil)
+	if err != nil {
+		return nil, false
+	}
+	res, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return nil, false
+	}
+	defer res.Body.Close()
+	if res.StatusCode != http.StatusOK {
+		return nil, false
+	}
+	states, err := parseProcessStates(res.Body)
+	if err != nil {
+		return nil, false
+	}
+	return states, true
+}
+
+func parseProcessStates(body io.Reader) (map[string]string, error) {
+	processes := struct {
+		Data []struct {
+			Name   string `json:"name"`
+			Status string `json:"status"`
+		} `json:"data"`
+	}{}
+	if err := json.NewDecoder(body).Decode(&processes); err != nil {
+		return nil, errors.WithStack(err)
+	}
+	states := map[string]string{}
+	for _, p := range processes.Data {
+		states[p.Name] = p.Status
+	}
+	return states, nil
+}
+
+// isListening reports whether something accepts connections on the port.
+func (localProbe) isListening(port string) bool {
+	conn, err := net.DialTimeout("tcp", net.JoinHostPort("localhost", port), 200*time.Millisecond)
+	if err != nil {
+		return false
+	}
+	conn.Close()
+	return true
+}
+
+// Statuses returns the services sorted by name, along with whether each one is
+// running. Services that process-compose manages get their state from the
+// process manager if it's running. The others are running if something
+// listens on their port. env resolves the variables in the services' ports
+// before the process environment does, so that ports are known outside of a
+// devbox shell. opts has the port that the process manager runs on.
+func Statuses(
+	ctx context.Context,
+	svcs plugin.Services,
+	env map[string]string,
+	opts *ProcessManagerOpts,
+) []Info {
+	probe := opts.serviceProbe()
+	pcStates, pcRunning := probe.processStates(ctx, opts.port())
+
+	infos := make([]Info, 0, len(svcs))
+	for name, svc := range svcs {
+		_, processCompose := svc.ProcessComposeYaml()
+		info := Info{
+			Name:           name,
+			ProcessCompose: processCompose,
+			Port: os.Expand(svc.RawPort, func(key string) string {
+				if value, ok := env[key]; ok {
+					return value
+				}
+				return os.Getenv(key)
+			}),
+			State: StateUnknown,
+		}
+		switch {
+		case processCompose && pcRunning:
+			info.State = StateStopped
+			if pcStates[name] == "Running" {
+				info.State = StateRunning
+			}
+		case info.Port != "":
+			info.State = StateStopped
+			if probe.isListening(info.Port) {
+				info.State = StateRunning
+			}
+		}
+		infos = append(infos, info)
+	}
+	sort.Slice(infos, func(i, j int) bool { return infos[i].Name < infos[j].Name })
+	return infos
+}
@@ -0,0 +1,77 @@
+// Copyright 2023 Jetpack Technologies Inc and contributors. All rights reserved.
+// Use of this source code is governed by the license in the LICENSE file.
+
+package services
+
+import (
+	"context"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.jetpack.io/devbox/internal/plugin"
+)
+
+func TestParseProcessStates(t *testing.T) {
+	body := `{"data": [
+		{"name": "nginx", "status": "Running", "pid": 12},
+		{"name": "php-fpm", "status": "Completed", "pid": 0}
+	]}`
+	states, err := parseProcessStates(strings.NewReader(body))
+	require.NoError(t, err)
+	assert.Equal(t, map[string]string{"nginx": "Running", "php-fpm": "Completed"}, states)
+
+	_, err = parseProcessStates(strings.NewReader("not json"))
+	assert.Error(t, err)
+}
+
+// fakeProbe is a serviceProbe for tests. Each method calls the field with the
+// same name.
+type fakeProbe struct {
+	states    func() (map[string]string, bool)
+	logs      func(name string) ([]string, error)
+	listening func(port string) bool
+}
+
+func (f *fakeProbe) processStates(context.Context, string) (map[string]string, bool) {
+	return f.states()
+}
+
+func (f *fakeProbe) processLogs(ctx context.Context, port, name string, limit int) ([]string, error) {
+	return f.logs(name)
+}
+
+func (f *fakeProbe) isListening(port string) bool {
+	return f.listening(port)
+}
+
+func TestStatuses(t *testing.T) {
+	probe := &fakeProbe{listening: func(port string) bool { return port == "8080" }}
+	opts := &ProcessManagerOpts{probe: probe}
+
+	// The apache, nginx and php plugins create process-compose.yaml files.
+	// redis doesn't, and has no port.
+	svcs, err := plugin.GetServices([]string{"apacheHttpd", "nginx", "php81", "redis"}, t.TempDir())
+	require.NoError(t, err)
+	env := map[string]string{"HTTPD_PORT": "8080"}
+
+	// process-compose runs nginx and php-fpm, but not apache.
+	probe.states = func() (map[string]string, bool) {
+		return map[string]string{"nginx": "Running", "php-fpm": "Completed"}, true
+	}
+	statuses := Statuses(context.Background(), svcs, env, opts)
+	assert.Equal(t, []Info{
+		{Name: "apache", ProcessCompose: true, Port: "8080", State: StateStopped},
+		{Name: "nginx", ProcessCompose: true, Port: statuses[1].Port, State: StateRunning},
+		{Name: "php-fpm", ProcessCompose: true, State: StateStopped},
+		{Name: "redis", State: StateUnknown},
+	}, statuses)
+
+	// Without the process manager, services fall back to their ports.
+	probe.states = func() (map[string]string, bool) { return nil, false }
+	statuses = Statuses(context.Background(), svcs, env, opts)
+	assert.Equal(t, StateRunning, statuses[0].State)
+	assert.Equal(t, StateUnknown, statuses[2].State)
+	assert.Equal(t, StateUnknown, statuses[3].State)
+}
@@ -50,3 +50,36 @@ func resolveDir(envvar string, defaultPath string) string {
 
 	return filepath.Join(home, defaultPath)
 }
+
+// DevboxStateDirEnv is the environment variable that moves all of devbox's
+// user-global state, such as the global profile, caches and config, into a
+// single directory instead of the XDG base directories. It's not
+// DEVBOX_CONFIG_DIR, which devbox sets in shells to the project's directory.
+const DevboxStateDirEnv = "DEVBOX_STATE_DIR"
+
+// DevboxDataSubpath returns subpath in devbox's data directory, which is
+// $DEVBOX_STATE_DIR or $XDG_DATA_HOME/devbox.
+func DevboxDataSubpath(subpath string) string {
+	if dir := os.Getenv(DevboxStateDirEnv); dir != "" {
+		return filepath.Join(dir, subpath)
+	}
+	return DataSubpath(filepath.Join("devbox", subpath))
+}
+
+// DevboxConfigSubpath returns subpath in devbox's config directory, which is
+// $DEVBOX_STATE_DIR or $XDG_CONFIG_HOME/devbox.
+func DevboxConfigSubpath(subpath string) string {
+	if dir := os.Getenv(DevboxStateDirEnv); dir != "" {
+		return filepath.Join(dir, subpath)
+	}
+	return ConfigSubpath(filepath.Join("devbox", subpath))
+}
+
+// DevboxCacheSubpath returns subpath in devbox's cache directory, which is
+// $DEVBOX_STATE_DIR/cache or $XDG_CACHE_HOME/devbox.
+func DevboxCacheSubpath(subpath string) string {
+	if dir := os.Getenv(DevboxStateDirEnv); dir != "" {
+		return filepath.Join(dir, "cache", subpath)
+	}
+	return CacheSubpath(filepath.Join("devbox", subpath))
+}
@@ -0,0 +1,44 @@
+package xdg
+
+import (
+	"path/filepath"
+	"testing"
+)
+
+func TestDevboxSubpaths(t *testing.T) {
+	t.Setenv("XDG_DATA_HOME", "/xdg/data")
+	t.Setenv("XDG_CONFIG_HOME", "/xdg/config")
+	t.Setenv("XDG_CACHE_HOME", "/xdg/cache")
+	t.Setenv(DevboxStateDirEnv, "")
+	// Devbox shells set DEVBOX_CONFIG_DIR to the project's directory, which
+	// mustn't move devbox's state into the project.
+	t.Setenv("DEVBOX_CONFIG_DIR", "/home/user/project")
+
+	cases := []struct {
+		got, want string
+	}{
+		{DevboxDataSubpath("global/default"), "/xdg/data/devbox/global/default"},
+		{DevboxConfigSubpath("shellrc"), "/xdg/config/devbox/shellrc"},
+		{DevboxCacheSubpath("nixpkgs.json"), "/xdg/cache/devbox/nixpkgs.json"},
+	}
+	for _, c := range cases {
+		if c.got != filepath.FromSlash(c.want) {
+			t.Errorf("Got %s, want %s", c.got, c.want)
+		}
+	}
+
+	// DEVBOX_STATE_DIR moves everything into one directory.
+	t.Setenv(DevboxStateDirEnv, "/devbox")
+	cases = []struct {
+		got, want string
+	}{
+		{DevboxDataSubpath("global/default"), "/devbox/global/default"},
+		{DevboxConfigSubpath("shellrc"), "/devbox/shellrc"},
+		{DevboxCacheSubpath("nixpkgs.json"), "/devbox/cache/nixpkgs.json"},
+	}
+	for _, c := range cases {
+		if c.got != filepath.FromSlash(c.want) {
+			t.Errorf("Got %s with %s set, want %s", c.got, DevboxStateDirEnv, c.want)
+		}
+	}
+}